@@ -0,0 +1,130 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	texttemplate "text/template"
+
+	"go/ast"
+)
+
+// ExhaustiveEnforce is the Gen.Annotation marking the expanded switches for the linters
+// honoring the directive of exhaustive, so that the cases missing are reported.
+const ExhaustiveEnforce = "//exhaustive:enforce"
+
+// AnnotationData is the data the text/template of Gen.Annotation is executed with.
+type AnnotationData struct {
+	// Subject is the expression switched on, e.g. m for switch m := m.(type).
+	Subject string
+
+	// Type is the type of Subject, qualified as in the file, e.g. io.Reader.
+	Type string
+}
+
+// parseAnnotation parses the text/template of g.Annotation.
+func (g Gen) parseAnnotation() (*texttemplate.Template, error) {
+	tmpl, err := texttemplate.New("annotation").Parse(g.Annotation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Annotation: %s", err)
+	}
+
+	return tmpl, nil
+}
+
+// annotationLines returns the comment lines of gen.Annotation for stmt, which must all be // comments.
+func (gen Gen) annotationLines(stmt *TypeSwitchStmt, src []byte) ([]string, error) {
+	tmpl, err := gen.parseAnnotation()
+	if err != nil {
+		return nil, err
+	}
+
+	data := AnnotationData{}
+	if x, _ := typeSwitchSubject(stmt.node); x != nil {
+		tf := gen.tokenFile(stmt.file)
+		data.Subject = string(src[tf.Offset(x.Pos()):tf.Offset(x.End())])
+		if t := stmt.info.TypeOf(x); t != nil {
+			data.Type = gen.relativeTypeString(t, stmt.file)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("invalid Annotation: %s", err)
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			return nil, fmt.Errorf("invalid Annotation: %q is not a // comment", line)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// withAnnotation extends edit, which rewrites the body of stmt, to put the lines of gen.Annotation
+// right above the switch statement, unless they are in the comments there already,
+// e.g. by the previous runs.
+func (gen Gen) withAnnotation(stmt *TypeSwitchStmt, src []byte, edit sourceEdit) (sourceEdit, error) {
+	if gen.Annotation == "" {
+		return edit, nil
+	}
+
+	lines, err := gen.annotationLines(stmt, src)
+	if err != nil {
+		return edit, err
+	}
+
+	existing := map[string]bool{}
+	if cg := gen.commentAbove(stmt.file, stmt.node); cg != nil {
+		for _, c := range cg.List {
+			existing[strings.TrimSpace(c.Text)] = true
+		}
+	}
+
+	missing := []string{}
+	for _, line := range lines {
+		if !existing[line] {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) == 0 {
+		return edit, nil
+	}
+
+	tf := gen.tokenFile(stmt.file)
+	pos := tf.Offset(stmt.node.Pos())
+	lineStart := bytes.LastIndexByte(src[:pos], '\n') + 1
+	indent := lineIndent(src, pos)
+
+	var buf bytes.Buffer
+	for _, line := range missing {
+		buf.WriteString(indent + line + "\n")
+	}
+	buf.Write(src[lineStart:edit.start])
+	buf.Write(edit.text)
+
+	return sourceEdit{start: lineStart, end: edit.end, text: buf.Bytes()}, nil
+}
+
+// commentAbove returns the comment group in file ending on the line right above node, or nil if none.
+func (gen Gen) commentAbove(file *ast.File, node ast.Node) *ast.CommentGroup {
+	line := gen.Loader.Fset.Position(node.Pos()).Line
+
+	for _, cg := range file.Comments {
+		if cg.End() > node.Pos() {
+			break
+		}
+		if gen.Loader.Fset.Position(cg.End()).Line == line-1 {
+			return cg
+		}
+	}
+
+	return nil
+}
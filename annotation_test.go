@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go/ast"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func annotateFile(t *testing.T, filename string, annotation string) (string, error) {
+	g := New()
+	g.Annotation = annotation
+	err := g.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	var edits []sourceEdit
+	err = forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		edit, _, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")))
+		edits = append(edits, edit)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	return g.showNode(file), nil
+}
+
+func TestExpandEdit_Annotation(t *testing.T) {
+	annotation := ExhaustiveEnforce + "\n//nolint:gocritic // switch on {{.Subject}} of {{.Type}}"
+
+	result, err := annotateFile(t, "testdata/layout.go", annotation)
+	require.NoError(t, err)
+	t.Log(result)
+
+	assert.Contains(t, result, "\t//exhaustive:enforce\n\t//nolint:gocritic // switch on m of interface{}\n\tswitch m := m.(type) {")
+	assert.Contains(t, result, "case map[string]bool:")
+
+	dir, err := ioutil.TempDir("", "tsgen-annotation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "layout.go")
+	err = ioutil.WriteFile(filename, []byte(result), 0644)
+	require.NoError(t, err)
+
+	// the annotation is not added again
+	result, err = annotateFile(t, filename, annotation)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(result, "//exhaustive:enforce"))
+	assert.Equal(t, 1, strings.Count(result, "//nolint:gocritic"))
+
+	_, err = annotateFile(t, "testdata/layout.go", "exhaustive:enforce")
+	require.Error(t, err)
+	assert.Equal(t, `invalid Annotation: "exhaustive:enforce" is not a // comment`, err.Error())
+}
+
+func TestCheckConfig_Annotation(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	g.Annotation = "//{{.Subject"
+	err = g.Sort()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid Annotation")
+}
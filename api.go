@@ -2,10 +2,14 @@ package gen
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"go/ast"
 	"go/format"
@@ -24,16 +28,306 @@ type Gen struct {
 	Loader loader.Config
 
 	// A function which returns an io.WriteCloser for given file path to be rewritten. Can return nil for non-target files.
+	// If not set, the files of the packages created or imported by Loader, not their dependencies, are rewritten in place,
+	// each replaced atomically by renaming a temporary file written in the same directory over it.
 	FileWriter func(string) io.WriteCloser
 
+	// Include, if set, restricts the files to rewrite to the ones for which it returns true,
+	// before FileWriter is asked for them.
+	Include func(path string) bool
+
+	// Backup keeps a copy of each file rewritten in place without FileWriter as <file>.orig.
+	Backup bool
+
+	// OutputDir, if set, makes the files rewritten written under it instead of in place, mirroring the layout of
+	// the module, e.g. <OutputDir>/lib/foo.go for <module>/lib/foo.go, so that the source tree is left as it is
+	// for the build systems keeping generated code out of it. The paths are relative to the common ancestor
+	// of the directories of Modules.Main, or the src directory of GOPATH, or else the working directory.
+	OutputDir string
+
+	// Archive, if set, collects the files rewritten instead of writing them, to be written with their manifest
+	// by Archive.WriteDir or Archive.WriteTar, e.g. as the outputs of a hermetic build action like a Bazel genrule.
+	Archive *Archive
+
+	// ListChanged, if set, is called with the name of each file to be rewritten whose content changes,
+	// as gofmt -l lists them, before it is written. It is called one at a time.
+	// Set FileWriter to discard the contents to only list the files.
+	ListChanged func(filename string)
+
+	// ReportStale, if set, is called with a Diagnostic of RuleStaleCode for each file to be rewritten whose content
+	// changes, at the first line changing, e.g. to report in SARIF the files whose generated code is out of date.
+	// It is called one at a time, as ListChanged.
+	ReportStale func(d Diagnostic)
+
+	// IncludePaths and ExcludePaths filter the files to rewrite by their paths, relative to the current directory.
+	// A pattern is a glob which may contain "**" (e.g. "internal/**/*.go"), matching as in .gitignore,
+	// or a regular expression prefixed with "re:". If IncludePaths is set, the files must match one of them,
+	// and the ones matching any of ExcludePaths are excluded.
+	// Besides, the files in vendor and testdata directories and the generated files, which have
+	// a "// Code generated ... DO NOT EDIT." comment, are excluded unless matched by IncludePaths
+	// or given to Loader by their names.
+	IncludePaths []string
+	ExcludePaths []string
+
 	// Main specifies main package for pointer analysis.
 	// If not set, the ad-hoc package created by CreateFromFilenames is used.
 	Main string
 
+	// Roots, if set, are the functions called as the entry points of the program by pointer analysis,
+	// instead of the main function or the tests of the main package, e.g. the handlers of a server framework
+	// routing requests by reflection, which have no meaningful call graph from main. They are named as by
+	// FuncFilter, e.g. lib.HandleRequest, lib.(*Worker).Run or lib.*, and must be exported to be called,
+	// with the zero values of their parameters, from a synthetic main package.
+	Roots []string
+
+	// Sorter specifies the strategy to sort case clauses in "sort" mode.
+	// If not set, ByInterfacePopularity is used.
+	Sorter CaseSorter
+
+	// InterfacePriority is an ordered list of interface names (e.g. "io.Reader", "fmt.Stringer")
+	// which overrides the computed popularity of interfaces when sorting by ByInterfacePopularity.
+	// Interfaces not listed follow them in the order of popularity.
+	InterfacePriority []string
+
+	// SortBanners makes "sort" mode keep the spacing between case clauses,
+	// separating and labelling groups of cases implementing the same interface by
+	// comment banners like "// --- implements io.Reader ---".
+	SortBanners bool
+
+	// ValueSorter, if set, makes "sort" mode sort the case clauses of value switches too, e.g. by ByConstantValue.
+	// Only the switches with a tag whose cases are all constants and none falls through are sorted,
+	// as reordering the others may change their behavior. The type switches are then rewritten keeping
+	// the comments above case clauses, as with SortBanners.
+	ValueSorter CaseSorter
+
+	// Features is the set of experimental features enabled.
+	Features Features
+
+	// MatchMode controls how named types are matched against patterns. The default is MatchNamed.
+	// In the other modes, expanded cases are of the input types themselves,
+	// as a case of the underlying type does not catch the values of named types.
+	MatchMode MatchMode
+
+	// TemplateMode controls what happens to the template clauses after expansion.
+	// The default is TemplateKeep, with which later runs regenerate the cases.
+	TemplateMode TemplateMode
+
+	// DefaultPanic makes a default clause added to the expanded type switches without one,
+	// panicking with the unexpected type, e.g. default: panic(fmt.Sprintf("unexpected type %T", x)),
+	// so that the types not anticipated at the time of expansion fail loudly instead of falling through.
+	DefaultPanic bool
+
+	// ErrorsAs makes the expanded cases of the type switches on errors generated as errors.As checks
+	// before the switches, which match the errors wrapped by fmt.Errorf with %w and the like as well.
+	// The types of the errors wrapped at the call sites, e.g. fmt.Errorf("...: %w", &os.PathError{...}),
+	// are inferred as the argument types too.
+	ErrorsAs bool
+
+	// GenerateTests makes "expand" mode generate a test file for each file rewritten, named by TestFileName,
+	// with a test for each generated case which calls the function with a zero value of the type of the case,
+	// so that every expansion is compiled and run at least once. The test files are written by FileWriter
+	// after the rewritten files, and regenerated on every run.
+	GenerateTests bool
+
+	// MergeCases makes the expanded clauses with identical bodies merged into multi-type case clauses,
+	// e.g. case int, string:, unless they refer to the variable bound by the type switch.
+	MergeCases bool
+
+	// LineDirectives makes the bodies of the expanded clauses preceded by //line directives pointing to
+	// the bodies of their templates, so that panics and debuggers attribute them to the templates,
+	// and followed by ones restoring the positions of the file.
+	LineDirectives bool
+
+	// Provenance makes each expanded clause preceded by a comment noting its origin for the reviewers of
+	// the generated code: the pattern of the template and the types bound, the call sites passed the type
+	// and the version of tsgen, like
+	//
+	//	// tsgen: from map[string]T with T=int, called at main.go:12 (tsgen v1.2.3)
+	Provenance bool
+
+	// Annotation, if set, is put above each expanded type switch unless it is there already, for the linters
+	// recognizing the switches by comments, e.g. ExhaustiveEnforce. It is a text/template of // comments executed
+	// with AnnotationData, e.g. "//nolint:gocritic // switch on {{.Type}} generated by tsgen".
+	Annotation string
+
+	// RewriteCallSites makes "specialize" mode rewrite the calls of the functions specialized
+	// whose arguments are statically of the types specialized for to call the specializations directly.
+	// Only the calls in the files of the functions, or of the specializations generated by the previous runs,
+	// are rewritten, so that they never refer to the specializations in files not written.
+	RewriteCallSites bool
+
+	// DispatchTableMin makes "specialize" mode generate a dispatch table of the specializations,
+	// a map from reflect.Type initialized in an init function, for the functions with this many
+	// specializations or more, looked up before the type switch instead of generating its cases.
+	// Zero disables the tables.
+	DispatchTableMin int
+
+	// NestedFullProduct makes nested type switches on other parameters expanded by
+	// all the argument types observed, generating the full product of the types.
+	// By default only the combinations of types which co-occur at the call sites are generated.
+	NestedFullProduct bool
+
+	// NestedProductMax limits the number of the type pairs NestedFullProduct generates for a nested type switch,
+	// the product of the numbers of the types of the outer and nested subjects. The nested switches exceeding it
+	// are expanded only by the combinations observed, with a warning. Zero means no limit.
+	NestedProductMax int
+
+	// Strict makes expansion fail if an argument type of a type switch with templates matches none of them
+	// and has no hand-written case clause, reporting the type switch and the call sites of the type,
+	// instead of silently generating a switch which does not handle the type.
+	Strict bool
+
+	// Lint makes expansion fail if a type switch without default clause has no case for an argument type,
+	// or has a case which never matches as a case before it, e.g. of an interface, matches all of its values,
+	// reported as diagnostics of RuleNonExhaustive and RuleUnreachableCase.
+	Lint bool
+
+	// MaxCasesPerSwitch limits the number of cases expanded in a type switch statement,
+	// and MaxCasesTotal limits the total number of them in a run. Zero means no limit.
+	// The cases generated in the type switches nested in the templates count, while the hand-written ones do not.
+	// Exceeding the limits is an error unless TruncateCases is set,
+	// in which case a warning is printed and the excess types are discarded.
+	MaxCasesPerSwitch int
+	MaxCasesTotal     int
+	TruncateCases     bool
+
+	// Implements makes the type switches with interface templates with type variables in their method sets,
+	// e.g. case interface{ Scan(T) error }:, expanded by all the named types of the program whose method sets
+	// unify with them, besides the ones passed at the call sites. It matches the interface patterns
+	// by the method sets as FeatureInterfaces does, but generates the cases of the matched types themselves,
+	// e.g. case *Celsius:, instead of the interfaces with the type variables replaced.
+	Implements bool
+
+	// DynamicFlow makes the type switches on the parameters of the functions called through interface methods
+	// or function values expanded by the dynamic types pointer analysis finds the subjects may have, besides
+	// the types at the call sites, as the arguments of such calls may be converted to interfaces elsewhere.
+	// Without it, such type switches are warned of as their types may be incomplete.
+	DynamicFlow bool
+
+	// Registries designate the type switches expanded by the types registered by the calls of registration functions,
+	// e.g. gob.Register(T{}), besides the ones passed at the call sites. The registered types are not cached.
+	Registries []Registry
+
+	// Owners maps the paths of the call sites to their owners.
+	// If set with OwnersReport, the owners of the call sites which contributed each expanded case
+	// are reported to OwnersReport.
+	Owners       *Owners
+	OwnersReport io.Writer
+
+	// CoverageReport, if set, receives the report of how the templates of each expanded type switch
+	// are utilized: the argument types each template matched, the templates which matched nothing,
+	// and the argument types which matched no template.
+	CoverageReport io.Writer
+
+	// CacheDir is the directory to cache the call sites inferred by the analysis in.
+	// While the sources of the program are unchanged, expansion skips SSA building and
+	// pointer analysis for the functions cached. Caching is disabled if empty.
+	CacheDir string
+
+	// Overlay maps file names to their contents, which take precedence over the files on disk
+	// when loading, e.g. the unsaved buffers of an editor.
+	Overlay map[string][]byte
+
+	// Modules, if set, resolves the imports of the packages of a Go module or a go.work workspace, including the ones of
+	// the sibling modules of the workspace, to the directories of the modules, instead of to the ones in GOPATH.
+	// The functions in a module are expanded by the types passed at the call sites in the others, e.g. from Main.
+	// See LoadModules.
+	Modules *Modules
+
+	// Format configures the formatting of the rewritten files, which is that of goimports by default.
+	Format FormatOptions
+
+	// BuildTags, GOOS, GOARCH and CgoEnabled, if set, override those of the build context of Loader,
+	// or build.Default, to generate the expansions for a platform. See BuildContext.
+	BuildTags  []string
+	GOOS       string
+	GOARCH     string
+	CgoEnabled *bool
+
+	// Validate type-checks the expanded files before writing them, and fails if
+	// any generated case clause does not compile, or skips such cases with warnings
+	// if SkipInvalidCases is set.
+	Validate         bool
+	SkipInvalidCases bool
+
+	// ChangedFiles, if not nil, restricts the files to rewrite to the ones listed,
+	// leaving the others as they are, e.g. in editor workflows.
+	// The functions in the other files are not analyzed.
+	ChangedFiles []string
+
+	// FuncFilter, if not nil, restricts the functions whose type switches are expanded or specialized
+	// to the ones matching any of its entries, so that a codebase can adopt expansion function by function.
+	// An entry is the name of a function, like Foo or (*T).Method, optionally qualified by the name
+	// or the path of its package (lib.Foo, example.com/lib.(*T).Method), all the functions of a package
+	// like lib.*, or a regular expression prefixed with "re:" matched against the name qualified by the path.
+	FuncFilter []string
+
+	// LowMemory bounds the memory of expansion for large programs like monorepos.
+	// The function bodies are type-checked and SSA is built only for the packages on the import paths
+	// from Main to the packages rewritten, found by their imports before loading, and the syntax trees
+	// and the type information of each package are released once its files are rewritten.
+	// The calls of the functions expanded through the other packages, e.g. of callbacks, are missed,
+	// and SSA is built even if the analysis of every function is cached.
+	LowMemory bool
+
+	// Confirm, if set, is asked whether to apply the expansion of each type switch before its file is rewritten,
+	// e.g. interactively, one at a time. It returns the text to replace the statement with, p.New or an edited one,
+	// or nil to leave the type switch as it is. An error aborts the expansion of the file.
+	Confirm func(p Proposal) ([]byte, error)
+
+	// Region, if set, restricts the type switches rewritten by Expand and Sort to the ones overlapping it,
+	// so that an editor can rewrite the one at its cursor. The other files are written unchanged.
+	Region *Region
+
+	// Metrics, if set, receives the measurements of the cost of the runs of Expand: the times of loading,
+	// SSA building and pointer analysis, and of each type switch expanded, with the numbers of the argument types
+	// inferred and matched and of the cases generated. See Metrics.
+	Metrics *Metrics
+
+	// Concurrency is the number of files rewritten concurrently after the analysis of the program.
+	// Zero or one rewrites files one by one. FileWriter is always called from a single goroutine,
+	// but the writers it returns may be written concurrently.
+	Concurrency int
+
+	// Logger receives diagnostics. If not set, they are written to stderr,
+	// where debug messages are written only if Verbose is set.
+	Logger Logger
+
 	Verbose bool
 
 	program    *loader.Program
 	ssaProgram *ssa.Program
+
+	// tests are the test files generated in the run, if g.GenerateTests is set.
+	tests *generatedTests
+
+	// totalCases is the number of cases expanded so far in the run.
+	totalCases *caseCount
+
+	// pta is the result of pointer analysis shared by the files rewritten in the run.
+	pta *analysisResult
+
+	// fileNames are the names of the files of the program, which can be read
+	// while the files are rewritten concurrently.
+	fileNames map[*ast.File]string
+
+	// callPaths are the import paths of the packages SSA is built for, if g.LowMemory is set.
+	callPaths map[string]bool
+
+	// releaseRewritten makes doFiles release the packages whose files are all rewritten.
+	releaseRewritten bool
+
+	// initialOnly restricts the files rewritten to the ones of the initial packages.
+	initialOnly bool
+
+	// registered are the types registered with g.Registries, found once in the run.
+	registered *registeredTypes
+
+	// cache is the on-disk cache of the analysis, if g.CacheDir is set.
+	cache *analysisCache
+
+	// ctx is the context of the current operation, set by *Context methods.
+	ctx context.Context
 }
 
 // New creates a Gen with some initial configuration.
@@ -47,17 +341,89 @@ func New() *Gen {
 // Expand expands type switches in the program with their template case clauses
 // and actual arguments.
 func (g Gen) Expand() error {
-	err := g.buildSSA()
+	return g.ExpandContext(context.Background())
+}
+
+// ExpandContext is like Expand but can be cancelled by ctx.
+// Cancellation is checked between the phases of loading, SSA building and pointer analysis,
+// and between the files rewritten. A phase in progress is not interrupted but runs to completion
+// before ExpandContext returns the error of ctx, so that nothing keeps running after it returns.
+func (g Gen) ExpandContext(ctx context.Context) error {
+	g.ctx = ctx
+
+	start := time.Now()
+	g.Metrics.reset()
+	defer g.Metrics.finish(start)
+
+	// SSA is built lazily by the first function to be analyzed,
+	// so that it is skipped if every function is cached or no file is changed,
+	// unless the packages are released after rewritten, which SSA is built from
+	n := needFuncBodies
+	if g.LowMemory {
+		n = needSSA
+		g.releaseRewritten = true
+	}
+
+	err := g.initProgram(n)
+	if err != nil {
+		return err
+	}
+
+	if g.CacheDir != "" {
+		g.cache, err = g.openAnalysisCache()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.initRun()
+
+	err = g.doFiles(g.expandFileTypeSwitches)
 	if err != nil {
 		return err
 	}
 
-	return g.doFiles(g.expandFileTypeSwitches)
+	if g.GenerateTests {
+		err = g.writeTests()
+		if err != nil {
+			return err
+		}
+	}
+
+	if g.cache != nil {
+		return g.cache.save()
+	}
+
+	return nil
+}
+
+// initRun initializes the state of a run of expansion, shared by the files rewritten.
+func (g *Gen) initRun() {
+	g.totalCases = &caseCount{}
+	g.pta = &analysisResult{}
+	g.tests = &generatedTests{files: map[string][]byte{}}
+	g.registered = &registeredTypes{}
+
+	if g.Validate {
+		g.fileNames = map[*ast.File]string{}
+		for _, pkg := range g.program.AllPackages {
+			for _, file := range pkg.Files {
+				g.fileNames[file] = g.tokenFile(file).Name()
+			}
+		}
+	}
 }
 
 // Sort sorts case clauses in the type switches in the program.
 func (g Gen) Sort() error {
-	err := g.load()
+	return g.SortContext(context.Background())
+}
+
+// SortContext is like Sort but can be cancelled by ctx.
+func (g Gen) SortContext(ctx context.Context) error {
+	g.ctx = ctx
+
+	err := g.initProgram(needTypes)
 	if err != nil {
 		return err
 	}
@@ -67,7 +433,14 @@ func (g Gen) Sort() error {
 
 // Scaffold fills type switches with empty case clauses using their subjects type.
 func (g Gen) Scaffold() error {
-	err := g.load()
+	return g.ScaffoldContext(context.Background())
+}
+
+// ScaffoldContext is like Scaffold but can be cancelled by ctx.
+func (g Gen) ScaffoldContext(ctx context.Context) error {
+	g.ctx = ctx
+
+	err := g.initProgram(needTypes)
 	if err != nil {
 		return err
 	}
@@ -75,28 +448,249 @@ func (g Gen) Scaffold() error {
 	return g.doFiles(g.scaffoldFileTypeSwitches)
 }
 
+// SortTypeSwitches sorts case clauses in the type switches in file like Sort,
+// but operates on a file which is already parsed with fset and type-checked into info by the caller.
+// No loader is involved; info must have Types, Defs and Uses recorded.
+// Interfaces used to sort are the ones declared or referred in info.
+func (g Gen) SortTypeSwitches(fset *token.FileSet, file *ast.File, info *types.Info) error {
+	g.Loader.Fset = fset
+	g.program = nil
+
+	return g.sortFileTypeSwitches(singleFilePackage(file, info), file)
+}
+
+// ScaffoldTypeSwitches fills the type switches in file like Scaffold,
+// but operates on a file which is already parsed with fset and type-checked into info by the caller.
+// No loader is involved; info must have Types, Defs and Uses recorded.
+// Candidate types are the ones declared or referred in info.
+func (g Gen) ScaffoldTypeSwitches(fset *token.FileSet, file *ast.File, info *types.Info) error {
+	g.Loader.Fset = fset
+	g.program = nil
+
+	return g.scaffoldFileTypeSwitches(singleFilePackage(file, info), file)
+}
+
+// singleFilePackage makes an ad-hoc *loader.PackageInfo from a type-checked file.
+func singleFilePackage(file *ast.File, info *types.Info) *loader.PackageInfo {
+	return &loader.PackageInfo{
+		Files: []*ast.File{file},
+		Info:  *info,
+	}
+}
+
+// typeNames returns all type names declared in the program.
+// If no program is loaded, as in single-file operations,
+// the type names declared or referred in info are returned instead.
+func (g Gen) typeNames(info *types.Info) []*types.TypeName {
+	names := []*types.TypeName{}
+	seen := map[*types.TypeName]bool{}
+
+	add := func(objs map[*ast.Ident]types.Object) {
+		for _, obj := range objs {
+			if tn, ok := obj.(*types.TypeName); ok && !seen[tn] {
+				names = append(names, tn)
+				seen[tn] = true
+			}
+		}
+	}
+
+	if g.program != nil {
+		for _, pkgInfo := range g.program.AllPackages {
+			add(pkgInfo.Defs)
+		}
+	} else {
+		add(info.Defs)
+		add(info.Uses)
+	}
+
+	return names
+}
+
+// context returns the context of the current operation.
+func (g Gen) context() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+
+	return g.ctx
+}
+
+// run runs f, a phase of the loader or the analyses, unless the context is cancelled.
+// As they cannot be interrupted, f runs to completion in the calling goroutine, and if the context
+// is cancelled meanwhile, its results are to be discarded by the error of the context returned.
+// Running f in another goroutine to return early would leave it running, holding the program.
+func (g Gen) run(f func() error) error {
+	ctx := g.context()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := f()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
 // load loads the program.
-func (g *Gen) load() (err error) {
-	g.program, err = g.Loader.Load()
-	return
+func (g *Gen) load() error {
+	defer g.Metrics.add(phaseLoad, time.Now())
+
+	allowed := g.allowGenericErrors()
+
+	var program *loader.Program
+	err := g.run(func() (err error) {
+		program, err = g.Loader.Load()
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	if allowed {
+		err := g.checkGenericErrors(program)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.program = program
+	return nil
 }
 
-// buildSSA loads the program and does SSA analysis.
-func (g *Gen) buildSSA() error {
-	err := g.load()
+// need is how far the program must be initialized for an operation.
+type need int
+
+const (
+	// needTypes type-checks the program, except for the function bodies of the
+	// packages other than the initial ones, which are only needed for SSA.
+	needTypes need = iota
+	// needFuncBodies type-checks the function bodies of all packages.
+	needFuncBodies
+	// needSSA also builds SSA of the program, which pointer analysis requires.
+	needSSA
+)
+
+// initProgram loads the program and initializes it as far as n.
+func (g *Gen) initProgram(n need) error {
+	err := g.checkConfig()
 	if err != nil {
 		return err
 	}
 
-	mode := ssa.SanityCheckFunctions
-	g.ssaProgram = ssa.Create(g.program, mode)
-	g.ssaProgram.BuildAll()
+	if n < needFuncBodies && g.Loader.TypeCheckFuncBodies == nil {
+		g.Loader.TypeCheckFuncBodies = g.isInitialPackage
+	}
+
+	err = g.applyOverlay()
+	if err != nil {
+		return err
+	}
+
+	g.applyModules()
+
+	err = g.applyBuildContext()
+	if err != nil {
+		return err
+	}
+
+	err = g.applyLowMemory()
+	if err != nil {
+		return err
+	}
+
+	err = g.load()
+	if err != nil {
+		return err
+	}
+
+	if n < needSSA {
+		return nil
+	}
+
+	return g.buildSSAProgram()
+}
+
+// isInitialPackage reports whether the package of path is created or imported by g.Loader.
+func (g *Gen) isInitialPackage(path string) bool {
+	if _, ok := g.Loader.ImportPkgs[path]; ok {
+		return true
+	}
+
+	for _, cp := range g.Loader.CreatePkgs {
+		if cp.Path == path {
+			return true
+		}
+		if cp.Path == "" && len(cp.Files) > 0 && cp.Files[0].Name.Name == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildSSAProgram builds SSA of the loaded program.
+func (g *Gen) buildSSAProgram() error {
+	defer g.Metrics.add(phaseSSA, time.Now())
+
+	var ssaProgram *ssa.Program
+	err := g.run(func() error {
+		mode := ssa.SanityCheckFunctions
+		ssaProgram = ssa.Create(g.program, mode)
+
+		// the values of the subjects queried are found by the debug information
+		for _, pkg := range g.subjectQueryPackages() {
+			// the packages with generic code are not built
+			if ssaPkg := ssaProgram.Package(pkg.Pkg); ssaPkg != nil {
+				ssaPkg.SetDebugMode(true)
+			}
+		}
+
+		if g.callPaths == nil {
+			ssaProgram.BuildAll()
+			return nil
+		}
+
+		for _, pkg := range ssaProgram.AllPackages() {
+			if g.callPaths[pkg.Object.Path()] {
+				pkg.Build()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	g.ssaProgram = ssaProgram
 	return nil
 }
 
 func (g Gen) writeNode(w io.WriteCloser, node interface{}) error {
-	err := format.Node(w, g.Loader.Fset, node)
+	var out []byte
+	if file, ok := node.(*ast.File); ok {
+		src, err := g.formatFile(file)
+		if err != nil {
+			return err
+		}
+		out = g.spliceUnchanged(file, g.preserveHeader(file, src))
+		if g.LineDirectives {
+			out = fixLineDirectives(out)
+		}
+	} else {
+		var buf bytes.Buffer
+		err := format.Node(&buf, g.Loader.Fset, node)
+		if err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	_, err := w.Write(out)
 	if err != nil {
 		return err
 	}
@@ -104,19 +698,37 @@ func (g Gen) writeNode(w io.WriteCloser, node interface{}) error {
 	return w.Close()
 }
 
+// writeMu serializes writes of the files rewritten concurrently, which may share a writer like stdout.
+var writeMu sync.Mutex
+
 func (g Gen) callGraphInEdges(funcDecl *ast.FuncDecl) ([]*callgraph.Edge, error) {
+	node, err := g.callGraphNode(funcDecl)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.In, nil
+}
+
+// callGraphNode returns the node of the function funcDecl in the call graph by pointer analysis.
+func (g Gen) callGraphNode(funcDecl *ast.FuncDecl) (*callgraph.Node, error) {
 	pta, err := g.pointerAnalysis()
 	if err != nil {
 		return nil, err
 	}
 
 	pkg, path, _ := g.program.PathEnclosingInterval(funcDecl.Pos(), funcDecl.End())
-	ssaFn := ssa.EnclosingFunction(g.ssaPackage(pkg), path)
+	ssaPkg := g.ssaPackage(pkg)
+	if ssaPkg == nil {
+		return nil, fmt.Errorf("package %s is not analyzed: it or its imports have generic code", pkg.Pkg.Path())
+	}
+
+	ssaFn := ssa.EnclosingFunction(ssaPkg, path)
 	if ssaFn == nil {
 		return nil, fmt.Errorf("BUG: could not find SSA function: %s", funcDecl.Name)
 	}
 
-	return pta.CallGraph.CreateNode(ssaFn).In, nil
+	return pta.CallGraph.CreateNode(ssaFn), nil
 }
 
 func namedParamPos(name string, list *ast.FieldList) int {
@@ -133,44 +745,345 @@ func namedParamPos(name string, list *ast.FieldList) int {
 	return -1
 }
 
-func argTypesAt(nth int, edges []*callgraph.Edge) []types.Type {
-	inTypes := []types.Type{}
+// callSites holds the argument types observed at the call sites of a function.
+type callSites struct {
+	funcDecl *ast.FuncDecl
+
+	// args[i][j] is the concrete type of the j-th argument at the i-th call site,
+	// or nil if the argument is not converted to an interface at the site.
+	args [][]types.Type
+
+	// positions[i] is the position of the i-th call site.
+	positions []token.Pos
+
+	// dynamic has the positions of the call sites through interface methods or function values,
+	// whose arguments may not be found converted to interfaces at the sites.
+	dynamic map[token.Pos]bool
+}
+
+func newCallSites(funcDecl *ast.FuncDecl, edges []*callgraph.Edge) *callSites {
+	cs := &callSites{funcDecl: funcDecl}
 
 	for _, edge := range edges {
-		site := edge.Site
-		if site == nil {
+		dynamic := edge.Site != nil && edge.Site.Common().StaticCallee() == nil
+
+		for _, site := range siteArgsOf(edge, map[*callgraph.Node]bool{}) {
+			if dynamic {
+				if cs.dynamic == nil {
+					cs.dynamic = map[token.Pos]bool{}
+				}
+				cs.dynamic[site.pos] = true
+			}
+
+			// a row for each combination of the types the arguments may have,
+			// e.g. the elements of a slice passed element by element
+			rows := [][]types.Type{make([]types.Type, len(site.args))}
+			for i, a := range site.args {
+				ts := argTypes(a)
+				if len(ts) == 0 {
+					continue
+				}
+
+				product := [][]types.Type{}
+				for _, row := range rows {
+					for _, t := range ts {
+						r := append([]types.Type{}, row...)
+						r[i] = t
+						product = append(product, r)
+					}
+				}
+				rows = product
+			}
+
+			for _, row := range rows {
+				cs.args = append(cs.args, row)
+				cs.positions = append(cs.positions, site.pos)
+			}
+		}
+	}
+
+	return cs
+}
+
+// argTypes returns the concrete types of the interface values an argument v may be.
+// The value converted to an interface at the call site has its type, and the elements of a slice,
+// either passed as is, e.g. to a variadic parameter, or loaded from it, e.g. by a range loop, have the types
+// of the values stored to the elements of the array behind it, as by a composite literal.
+func argTypes(v ssa.Value) []types.Type {
+	switch v := v.(type) {
+	case *ssa.MakeInterface:
+		return []types.Type{v.X.Type()}
+
+	case *ssa.UnOp:
+		if ia, ok := v.X.(*ssa.IndexAddr); ok && v.Op == token.MUL {
+			return elementTypes(ia.X)
+		}
+
+	case *ssa.Slice, *ssa.Alloc:
+		return elementTypes(v)
+	}
+
+	return nil
+}
+
+// elementTypes returns the concrete types of the interface values stored to the elements of the slice or array x.
+func elementTypes(x ssa.Value) []types.Type {
+	if slice, ok := x.(*ssa.Slice); ok {
+		x = slice.X
+	}
+
+	alloc, ok := x.(*ssa.Alloc)
+	if !ok || alloc.Referrers() == nil {
+		return nil
+	}
+
+	ts := []types.Type{}
+	for _, ref := range *alloc.Referrers() {
+		ia, ok := ref.(*ssa.IndexAddr)
+		if !ok || ia.Referrers() == nil {
+			continue
+		}
+
+		for _, ref := range *ia.Referrers() {
+			if store, ok := ref.(*ssa.Store); ok && store.Addr == ssa.Value(ia) {
+				if mi, ok := store.Val.(*ssa.MakeInterface); ok {
+					ts = append(ts, mi.X.Type())
+				}
+			}
+		}
+	}
+
+	return ts
+}
+
+// forwardedParam returns the index in params of the parameter the argument a is, or whose element it is,
+// or -1 if none. Only the parameters of interfaces or slices of interfaces are forwarded.
+func forwardedParam(a ssa.Value, params []*ssa.Parameter) int {
+	if load, ok := a.(*ssa.UnOp); ok && load.Op == token.MUL {
+		if ia, ok := load.X.(*ssa.IndexAddr); ok {
+			a = ia.X
+		}
+	}
+
+	for j, p := range params {
+		if a != ssa.Value(p) {
 			continue
 		}
 
-		a := site.Common().Args[nth]
-		if mi, ok := a.(*ssa.MakeInterface); ok {
-			inTypes = append(inTypes, mi.X.Type())
+		t := p.Type()
+		if slice, ok := t.Underlying().(*types.Slice); ok {
+			t = slice.Elem()
+		}
+		if types.IsInterface(t) {
+			return j
+		}
+	}
+
+	return -1
+}
+
+// siteArgs are the arguments passed to the parameters of a function at a call site.
+type siteArgs struct {
+	args []ssa.Value
+
+	// pos is the position of the left parenthesis of the call.
+	pos token.Pos
+}
+
+// siteArgsOf returns the arguments passed by the call of edge, or nil if it is synthetic.
+// The arguments which are the parameters of the caller passed through, as by the synthetic wrappers of method values
+// and method expressions or by the functions forwarding their parameters, e.g. func FooWrap(x interface{}) { Foo(x) },
+// are traced back to the call sites of the caller, not in visited, which are the sites of the arguments then.
+// So are the elements of the slice parameters of the caller, e.g. it of func Process(items ...interface{}) { for _, it := range items { Foo(it) } },
+// which are replaced by the slices passed at the call sites of the caller.
+func siteArgsOf(edge *callgraph.Edge, visited map[*callgraph.Node]bool) []siteArgs {
+	site := edge.Site
+	if site == nil {
+		return nil
+	}
+
+	args := calleeArgs(edge)
+
+	// the position of the call, not of the go or defer keyword, as the call sites are located by
+	pos := site.Common().Pos()
+	if pos == token.NoPos {
+		pos = site.Pos()
+	}
+	direct := []siteArgs{{args: args, pos: pos}}
+
+	caller := edge.Caller
+	if caller.Func == nil || visited[caller] || len(visited) >= maxForwardingDepth {
+		return direct
+	}
+
+	params := caller.Func.Params
+	if caller.Func.Signature.Recv() != nil && len(params) > 0 {
+		params = params[1:]
+	}
+
+	// forwarded[i] is the index of the parameter of the caller passed as args[i] or by its elements, or -1
+	forwarded := make([]int, len(args))
+	forwarding := false
+	for i, a := range args {
+		forwarded[i] = forwardedParam(a, params)
+		forwarding = forwarding || forwarded[i] != -1
+	}
+	if !forwarding && caller.Func.Synthetic == "" {
+		return direct
+	}
+
+	visited[caller] = true
+	defer delete(visited, caller)
+
+	sites := []siteArgs{}
+	for _, in := range caller.In {
+		for _, outer := range siteArgsOf(in, visited) {
+			traced := make([]ssa.Value, len(args))
+			for i, a := range args {
+				traced[i] = a
+				if j := forwarded[i]; j != -1 && j < len(outer.args) {
+					traced[i] = outer.args[j]
+				}
+			}
+			sites = append(sites, siteArgs{args: traced, pos: outer.pos})
+		}
+	}
+
+	// e.g. a wrapper called only from outside the program analyzed
+	if len(sites) == 0 && caller.Func.Synthetic == "" {
+		return direct
+	}
+
+	return sites
+}
+
+// maxForwardingDepth limits the number of the callers the arguments are traced back through by siteArgsOf.
+const maxForwardingDepth = 8
+
+// calleeArgs returns the arguments of the call of edge to the parameters of the callee, without the receiver.
+// The calls by go and defer statements have the arguments as the plain calls do, and so do the invocations
+// of interface methods, whose receivers are not arguments. A static call of a method has the receiver first.
+func calleeArgs(edge *callgraph.Edge) []ssa.Value {
+	common := edge.Site.Common()
+
+	args := common.Args
+	if !common.IsInvoke() && edge.Callee.Func.Signature.Recv() != nil && len(args) > 0 {
+		args = args[1:]
+	}
+
+	return args
+}
+
+// typesAt returns the concrete types of nth argument at the call sites.
+func (cs *callSites) typesAt(nth int) []types.Type {
+	inTypes := []types.Type{}
+
+	for _, args := range cs.args {
+		if nth < len(args) && args[nth] != nil {
+			inTypes = append(inTypes, args[nth])
 		}
 	}
 
 	return inTypes
 }
 
-func (g Gen) possibleSubjectTypes(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, typeSwitch *typeSwitchStmt) ([]types.Type, error) {
-	// XXX We can also obtain *loader.PackageInfo by:
-	// pkg, _, _ := g.program.PathEnclosingInterval(file.Pos(), file.End())
+// having returns the call sites whose nth argument is of type t.
+func (cs *callSites) having(nth int, t types.Type) *callSites {
+	filtered := &callSites{funcDecl: cs.funcDecl, dynamic: cs.dynamic}
 
-	subject := typeSwitch.subject()
-	subjectObj := pkg.Info.Uses[subject] // Where the type switch statement subject is defined
-	// g.log(file, funcDecl, "enclosing func: %s", funcDecl.Type)
-	if subjectObj.Parent() != pkg.Scopes[funcDecl.Type] {
-		return nil, fmt.Errorf("BUG: scope mismatch")
+	for i, args := range cs.args {
+		if nth < len(args) && args[nth] != nil && types.Identical(args[nth], t) {
+			filtered.args = append(filtered.args, args)
+			filtered.positions = append(filtered.positions, cs.positions[i])
+		}
 	}
 
-	paramPos := namedParamPos(subject.Name, funcDecl.Type.Params)
+	return filtered
+}
+
+// callSitesOf returns the call sites of the function funcDecl of pkg, along with the types registered for it.
+// They are read from and stored to g.cache if set, without the registered types.
+func (g Gen) callSitesOf(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl) (*callSites, error) {
+	if g.cache != nil {
+		if cs := g.cache.get(g.Loader.Fset, funcDecl); cs != nil {
+			g.log(nil, funcDecl, "call sites of %s read from cache", funcDecl.Name)
+			g.addRegisteredTypes(pkg, funcDecl, cs)
+			return cs, nil
+		}
+	}
 
-	// argument index of the variable which is subject of the type switch
 	in, err := g.callGraphInEdges(funcDecl)
 	if err != nil {
 		return nil, err
 	}
 
-	return argTypesAt(paramPos, in), nil
+	cs := newCallSites(funcDecl, in)
+	if g.ErrorsAs {
+		g.addWrappedErrors(cs)
+	}
+	if g.cache != nil {
+		g.cache.put(g.Loader.Fset, funcDecl, cs)
+	}
+	g.addRegisteredTypes(pkg, funcDecl, cs)
+
+	return cs, nil
+}
+
+// subjectParamPos returns the position of the parameter of the enclosing function
+// which the subject of typeSwitch flows from, or -1 if the subject does not flow from a parameter.
+func subjectParamPos(info *types.Info, funcDecl *ast.FuncDecl, typeSwitch *TypeSwitchStmt) int {
+	subject, ok := subjectSource(info, funcDecl, typeSwitch).(*ast.Ident)
+	if !ok {
+		return -1
+	}
+
+	subjectObj := info.Uses[subject] // Where the type switch statement subject is defined
+	if subjectObj == nil || subjectObj.Parent() != info.Scopes[funcDecl.Type] {
+		return -1
+	}
+
+	return namedParamPos(subject.Name, funcDecl.Type.Params)
+}
+
+func (g Gen) possibleSubjectTypes(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, typeSwitch *TypeSwitchStmt) ([]types.Type, error) {
+	// XXX We can also obtain *loader.PackageInfo by:
+	// pkg, _, _ := g.program.PathEnclosingInterval(file.Pos(), file.End())
+
+	// argument index of the variable which is subject of the type switch
+	paramPos := subjectParamPos(&pkg.Info, funcDecl, typeSwitch)
+	if paramPos == -1 {
+		if queriesSubject(&pkg.Info, funcDecl, typeSwitch.node) {
+			return g.queriedSubjectTypes(pkg, funcDecl, typeSwitch)
+		}
+		return nil, fmt.Errorf("BUG: scope mismatch")
+	}
+
+	if typeSwitch.sites == nil {
+		sites, err := g.callSitesOf(pkg, funcDecl)
+		if err != nil {
+			return nil, err
+		}
+		typeSwitch.sites = sites
+	}
+
+	inTypes := typeSwitch.sites.typesAt(paramPos)
+
+	// the arguments passed through interface methods or function values may be converted to interfaces elsewhere
+	if n := len(typeSwitch.sites.dynamic); n > 0 {
+		if !g.DynamicFlow {
+			g.warn(typeSwitch.file, typeSwitch.node, "the types of %s may be incomplete: %d dynamic call sites of %s", g.showNode(subjectSource(&pkg.Info, funcDecl, typeSwitch)), n, funcDecl.Name.Name)
+			return inTypes, nil
+		}
+
+		flowed, err := g.queriedSubjectTypes(pkg, funcDecl, typeSwitch)
+		if err != nil {
+			return nil, err
+		}
+		g.log(typeSwitch.file, typeSwitch.node, "%d dynamic call sites of %s, adding the types flowing to the subject: %v", n, funcDecl.Name.Name, flowed)
+		inTypes = append(inTypes, flowed...)
+	}
+
+	return inTypes, nil
 }
 
 func (g Gen) mainPkg() (*loader.PackageInfo, error) {
@@ -191,86 +1104,367 @@ func (g Gen) mainPkg() (*loader.PackageInfo, error) {
 }
 
 func (g Gen) ssaPackage(pkg *loader.PackageInfo) *ssa.Package {
+	if g.ssaProgram == nil && g.pta != nil {
+		return g.pta.ssaProgram.Package(pkg.Pkg)
+	}
+
 	return g.ssaProgram.Package(pkg.Pkg)
 }
 
+// caseCount counts the cases expanded in a run, which may span goroutines.
+type caseCount struct {
+	sync.Mutex
+	n int
+}
+
+// analysisResult holds the result of pointer analysis computed once in a run,
+// and the SSA program if it is built lazily for the analysis.
+type analysisResult struct {
+	once       sync.Once
+	ssaProgram *ssa.Program
+	result     *pointer.Result
+	err        error
+}
+
+// pointerAnalysis returns the result of pointer analysis of the program,
+// which is computed only once if g.pta is set. SSA is built if not yet.
 func (g Gen) pointerAnalysis() (*pointer.Result, error) {
+	if g.pta == nil {
+		return g.analyzePointers()
+	}
+
+	g.pta.once.Do(func() {
+		start := time.Now()
+		defer func() { g.Metrics.analyzed(start, time.Now()) }()
+
+		if g.ssaProgram == nil {
+			g.pta.err = g.buildSSAProgram()
+			if g.pta.err != nil {
+				return
+			}
+			g.pta.ssaProgram = g.ssaProgram
+		}
+
+		g.pta.result, g.pta.err = g.analyzePointers()
+	})
+
+	return g.pta.result, g.pta.err
+}
+
+func (g Gen) analyzePointers() (*pointer.Result, error) {
+	ssaMain, err := g.ssaMainPackage()
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &pointer.Config{
+		BuildCallGraph: true,
+		Mains:          []*ssa.Package{ssaMain},
+	}
+	g.addSubjectQueries(conf)
+
+	defer g.Metrics.add(phaseAnalysis, time.Now())
+
+	var result *pointer.Result
+	err = g.run(func() (err error) {
+		result, err = pointer.Analyze(conf)
+		return
+	})
+
+	return result, err
+}
+
+// ssaMainPackage returns the main package of pointer analysis: the synthetic one calling g.Roots if set,
+// the main package itself if it has main function, or the one running its tests.
+func (g Gen) ssaMainPackage() (*ssa.Package, error) {
+	if len(g.Roots) > 0 {
+		return g.rootsPackage()
+	}
+
 	pkg, err := g.mainPkg()
 	if err != nil {
 		return nil, err
 	}
 	ssaPkg := g.ssaPackage(pkg)
+	if ssaPkg == nil {
+		return nil, fmt.Errorf("main package %s is not analyzed: it or its imports have generic code", pkg.Pkg.Path())
+	}
 
-	var ssaMain *ssa.Package
 	if _, ok := ssaPkg.Members["main"]; ok {
-		ssaMain = ssaPkg
-	} else {
-		ssaMain = g.ssaProgram.CreateTestMainPackage(ssaPkg)
-		if ssaMain == nil {
-			return nil, fmt.Errorf("%s does not have main function nor tests", pkg)
-		}
+		return ssaPkg, nil
 	}
 
-	conf := &pointer.Config{
-		BuildCallGraph: true,
-		Mains:          []*ssa.Package{ssaMain},
+	ssaMain := g.ssaProgram.CreateTestMainPackage(ssaPkg)
+	if ssaMain == nil {
+		return nil, fmt.Errorf("%s does not have main function nor tests; set the roots of the program to analyze", pkg)
 	}
 
-	return pointer.Analyze(conf)
+	return ssaMain, nil
 }
 
 // doFiles is a utility method which calls rewrite for each *ast.File file in the program loaded
 // and writes out the modified file (to stdout or the original file).
 // rewrite is expected to modify the *ast.File file given.
-// It uses g.FileWriter to determine if the file is in target or not.
+// It uses g.IncludePaths, g.ExcludePaths, g.Include and g.FileWriter to determine if the file is in target or not.
 // Must be called after g.load().
-func (g Gen) doFiles(rewrite func(*loader.PackageInfo, *ast.File) error) (err error) {
+func (g Gen) doFiles(rewrite func(*loader.PackageInfo, *ast.File) error) error {
+	n := g.Concurrency
+	if n < 1 {
+		n = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		diags    DiagnosticList
+		sem      = make(chan struct{}, n)
+	)
+
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr
+	}
+
+	// the diagnostics of the files are collected, continuing with the other files
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if list, ok := err.(DiagnosticList); ok {
+			diags = append(diags, list...)
+			return
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// the numbers of the files of the packages being rewritten, plus one while the files are dispatched,
+	// to release each package after the last one with g.releaseRewritten
+	pending := map[*loader.PackageInfo]int{}
+	done := func(pkg *loader.PackageInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		pending[pkg]--
+		if pending[pkg] == 0 && g.releaseRewritten {
+			g.releasePackage(pkg)
+		}
+	}
+
+files:
 	for _, pkg := range g.program.AllPackages {
+		if (g.initialOnly || g.FileWriter == nil) && !g.isInitial(pkg) {
+			continue
+		}
+
+		mu.Lock()
+		pending[pkg]++
+		mu.Unlock()
+
 		for _, file := range pkg.Files {
-			w := g.FileWriter(filepath.Clean(g.tokenFile(file).Name()))
-			if w == nil {
-				continue
+			if err := g.context().Err(); err != nil {
+				fail(err)
+				break files
 			}
 
-			err = rewrite(pkg, file)
-			if err != nil {
-				return
+			sem <- struct{}{}
+
+			if failed() != nil {
+				<-sem
+				break files
 			}
 
-			err = g.writeNode(w, file)
-			if err != nil {
-				return
+			filename := filepath.Clean(g.tokenFile(file).Name())
+			if !g.isChanged(filename) || !g.includesFile(pkg, file, filename) {
+				<-sem
+				continue
+			}
+
+			w := g.fileWriter(filename)
+			if w == nil {
+				<-sem
+				continue
 			}
+
+			mu.Lock()
+			pending[pkg]++
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(pkg *loader.PackageInfo, file *ast.File, w io.WriteCloser) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer done(pkg)
+
+				err := rewrite(pkg, file)
+				if err == nil {
+					err = g.writeNode(w, file)
+				}
+				if err != nil {
+					fail(err)
+				}
+			}(pkg, file, w)
+		}
+
+		done(pkg)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	diags.Sort()
+	return diags.Err()
+}
+
+// isChanged reports whether the file is to be rewritten according to g.ChangedFiles.
+func (g Gen) isChanged(filename string) bool {
+	if g.ChangedFiles == nil {
+		return true
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+
+	for _, changed := range g.ChangedFiles {
+		if changedAbs, err := filepath.Abs(changed); err == nil && changedAbs == abs {
+			return true
 		}
 	}
 
+	return false
+}
+
+// sourceEdit is an edit to a source file, replacing text between offsets start and end.
+type sourceEdit struct {
+	start, end int
+	text       []byte
+}
+
+// fileSource returns the source text of file, which may be in g.Overlay.
+func (g Gen) fileSource(file *ast.File) ([]byte, error) {
+	return g.readSource(g.tokenFile(file).Name())
+}
+
+// editFileSource applies edits, which must not overlap, to the source of file,
+// and replaces file with the result parsed again.
+// Type information of file is no longer available after this.
+func (g Gen) editFileSource(file *ast.File, edits []sourceEdit) error {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return err
+	}
+
+	newFile, err := parser.ParseFile(g.Loader.Fset, g.tokenFile(file).Name(), applyEdits(src, edits), parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	*file = *newFile
+
 	return nil
 }
 
+// applyEdits returns src with edits, which must not overlap, applied.
+func applyEdits(src []byte, edits []sourceEdit) []byte {
+	sort.Sort(byEditStart(edits))
+
+	var buf bytes.Buffer
+	var last int
+	for _, e := range edits {
+		buf.Write(src[last:e.start])
+		buf.Write(e.text)
+		last = e.end
+	}
+	buf.Write(src[last:])
+
+	return buf.Bytes()
+}
+
+type byEditStart []sourceEdit
+
+func (s byEditStart) Len() int           { return len(s) }
+func (s byEditStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byEditStart) Less(i, j int) bool { return s[i].start < s[j].start }
+
+// relativeTypeString returns the string representation of t as written in file,
+// omitting the package qualifier of the package of file itself.
+func (g Gen) relativeTypeString(t types.Type, file *ast.File) string {
+	name, path := splitType(t)
+	if path == "" {
+		return name
+	}
+
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg().Name() == file.Name.Name {
+		return named.Obj().Name()
+	}
+	if pt, ok := t.(*types.Pointer); ok {
+		if named, ok := pt.Elem().(*types.Named); ok && named.Obj().Pkg().Name() == file.Name.Name {
+			return "*" + named.Obj().Name()
+		}
+	}
+
+	return name
+}
+
 func (g Gen) tokenFile(node ast.Node) *token.File {
 	return g.Loader.Fset.File(node.Pos())
 }
 
+// log sends a debug message to the logger.
+// ast.Node arguments are formatted as source code.
 func (g Gen) log(file *ast.File, node ast.Node, pattern string, args ...interface{}) {
-	if g.Verbose == false {
+	if g.Logger == nil && g.Verbose == false {
 		return
 	}
 
-	if file == nil && node == nil {
-		fmt.Fprintf(os.Stderr, pattern+"\n", args...)
+	g.logger().Debug(g.position(file, node), g.sprintf(pattern, args...))
+}
+
+// info sends an informational message with fields to the logger.
+func (g Gen) info(file *ast.File, node ast.Node, msg string, fields ...Field) {
+	if g.Logger == nil && g.Verbose == false {
 		return
 	}
 
-	pos := g.tokenFile(file).Position(node.Pos())
+	g.logger().Info(g.position(file, node), msg, fields...)
+}
+
+// warn sends a warning message to the logger, which is printed to stderr by default regardless of g.Verbose.
+func (g Gen) warn(file *ast.File, node ast.Node, pattern string, args ...interface{}) {
+	g.logger().Warn(g.position(file, node), g.sprintf(pattern, args...))
+}
+
+func (g Gen) logger() Logger {
+	if g.Logger != nil {
+		return g.Logger
+	}
+
+	return NewTextLogger(os.Stderr, g.Verbose)
+}
+
+// position returns the position of node in file, or the zero token.Position if not known.
+func (g Gen) position(file *ast.File, node ast.Node) token.Position {
+	if file == nil || node == nil {
+		return token.Position{}
+	}
+
+	return g.tokenFile(file).Position(node.Pos())
+}
 
+func (g Gen) sprintf(pattern string, args ...interface{}) string {
 	for i, a := range args {
 		if node, ok := a.(ast.Node); ok {
 			args[i] = g.showNode(node)
 		}
 	}
 
-	args = append([]interface{}{pos}, args...)
-	fmt.Fprintf(os.Stderr, "%s: "+pattern+"\n", args...)
+	return fmt.Sprintf(pattern, args...)
 }
 
 func (g Gen) showNode(node ast.Node) string {
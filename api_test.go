@@ -2,9 +2,16 @@ package gen
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"go/ast"
+	"go/token"
 	"golang.org/x/tools/go/types"
 
 	"github.com/stretchr/testify/assert"
@@ -64,3 +71,942 @@ func TestIsTypeVariable(t *testing.T) {
 	assert.True(t, gen.isTypeVariable(typeDefs["NumberT"]))
 	assert.False(t, gen.isTypeVariable(typeDefs["NonTypeVariableT"]))
 }
+
+func TestCanonicalTypes(t *testing.T) {
+	var (
+		intType    = types.Typ[types.Int]
+		stringType = types.Typ[types.String]
+		boolType   = types.Typ[types.Bool]
+	)
+
+	ts := canonicalTypes([]types.Type{stringType, intType, boolType, intType, types.NewSlice(intType)})
+
+	names := []string{}
+	for _, t := range ts {
+		names = append(names, t.String())
+	}
+
+	assert.Equal(t, []string{"[]int", "bool", "int", "string"}, names)
+}
+
+func TestCanonicalTypes_Identical(t *testing.T) {
+	intType := types.Typ[types.Int]
+
+	// Each call site yields a distinct but identical types.Type
+	ts := canonicalTypes([]types.Type{
+		types.NewMap(types.Typ[types.String], intType),
+		types.NewMap(types.Typ[types.String], intType),
+		types.NewMap(types.Typ[types.String], intType),
+	})
+
+	assert.Len(t, ts, 1)
+}
+
+func TestGen_Nested(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.Verbose = testing.Verbose()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/nested.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "./testdata/nested.go")
+	require.NoError(t, err)
+
+	err = g.Expand()
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	// Only the observed pairs (int, int), (float64, int), (string, string) are expanded
+	assert.Equal(t, 1, strings.Count(result, "case float64:"))
+	assert.Equal(t, 3, strings.Count(result, "case int:"))
+	assert.Equal(t, 2, strings.Count(result, "case string:"))
+}
+
+func TestGen_CallSites(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/gocalls.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/gocalls.go")
+	require.NoError(t, err)
+
+	err = g.Expand()
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	// go and defer statements
+	assert.Contains(t, result, "case []string:")
+	assert.Contains(t, result, "case []bool:")
+
+	// static calls of the method, with the receiver first
+	assert.Contains(t, result, "case []uint8:")
+	assert.Contains(t, result, "case []uint:")
+
+	// through the wrappers of the method value and the method expression
+	assert.Contains(t, result, "case []float64:")
+	assert.Contains(t, result, "case []int32:")
+}
+
+func TestGen_Forwarding(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/forward.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/forward.go")
+	require.NoError(t, err)
+
+	err = g.Expand()
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	// through lengthWrap, and lengthLogged and lengthWrap
+	assert.Contains(t, result, "case []string:")
+	assert.Contains(t, result, "case []bool:")
+	assert.Contains(t, result, "case []uint8:")
+	assert.Contains(t, result, "case []int:")
+}
+
+func TestGen_FuncLits(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/funclit.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/funclit.go")
+	require.NoError(t, err)
+
+	err = g.Expand()
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	// the closure called through a variable, and the one passed as a callback
+	assert.Contains(t, result, "case []int:")
+	assert.Contains(t, result, "case []string:")
+	assert.Contains(t, result, "case map[string]bool:")
+}
+
+func TestGen_SliceArgs(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/slices.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/slices.go")
+	require.NoError(t, err)
+
+	err = g.Expand()
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	// from the elements of the composite literal ranged over
+	assert.Contains(t, result, "case []int:")
+	assert.Contains(t, result, "case []string:")
+
+	// from the variadic arguments, passed one by one and as a slice
+	assert.Contains(t, result, "case []bool:")
+	assert.Contains(t, result, "case []uint8:")
+	assert.Contains(t, result, "case []float64:")
+}
+
+func TestGen_NestedProductMax(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/nested.go", "add", [][]types.Type{
+		{types.Typ[types.Int], types.Typ[types.Int]},
+		{types.Typ[types.Float64], types.Typ[types.Int]},
+		{types.Typ[types.String], types.Typ[types.String]},
+	})
+
+	expand := func(max int) (string, string) {
+		var out, log bytes.Buffer
+
+		g := New()
+		g.CacheDir = dir
+		g.NestedFullProduct = true
+		g.NestedProductMax = max
+		g.Logger = NewTextLogger(&log, false)
+		g.FileWriter = func(path string) io.WriteCloser {
+			if path == "testdata/nested.go" {
+				return nopCloser{&out}
+			}
+			return nil
+		}
+		err := g.Loader.CreateFromFilenames("", "testdata/nested.go")
+		require.NoError(t, err)
+
+		require.NoError(t, g.Expand())
+		return out.String(), log.String()
+	}
+
+	// 3 types of a by 2 types of b
+	result, _ := expand(0)
+	assert.Equal(t, 1, strings.Count(result, "case float64:"))
+	assert.Equal(t, 4, strings.Count(result, "case int:"))
+	assert.Equal(t, 4, strings.Count(result, "case string:"))
+
+	result, _ = expand(6)
+	assert.Equal(t, 4, strings.Count(result, "case int:"))
+
+	// only the observed pairs
+	result, log := expand(5)
+	assert.Equal(t, 1, strings.Count(result, "case float64:"))
+	assert.Equal(t, 3, strings.Count(result, "case int:"))
+	assert.Equal(t, 2, strings.Count(result, "case string:"))
+	assert.Equal(t, 1, strings.Count(log, "nested type switch would have 6 type pairs (max 5)"))
+}
+
+// callArgTypes returns the types of the arguments of calls to the function named funcName in file,
+// mimicking the types inferred by the pointer analysis.
+func callArgTypes(info *types.Info, file *ast.File, funcName string) []types.Type {
+	ts := []types.Type{}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == funcName {
+				ts = append(ts, info.TypeOf(call.Args[0]))
+			}
+		}
+		return true
+	})
+
+	return ts
+}
+
+func TestExpandEdit_Layout(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	var edits []sourceEdit
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")))
+		require.NoError(t, err)
+		require.True(t, ok)
+		edits = append(edits, edit)
+		return nil
+	})
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	result := g.showNode(file)
+	t.Log(result)
+
+	order := []string{
+		"// hand-written",
+		"case map[string]string:",
+		generatedBeginMarker,
+		"case map[string]bool:",
+		"case map[string]int:",
+		generatedEndMarker,
+		"case map[string]T:",
+		"default:",
+	}
+	for i := 1; i < len(order); i++ {
+		assert.True(t, strings.Index(result, order[i-1]) < strings.Index(result, order[i]), "%q must precede %q", order[i-1], order[i])
+	}
+
+	// Previously generated cases are replaced and hand-written ones are not duplicated
+	assert.Equal(t, 1, strings.Count(result, "case map[string]int:"))
+	assert.Equal(t, 1, strings.Count(result, "case map[string]string:"))
+	assert.NotContains(t, result, "case map[string]float64:")
+}
+
+func TestExpandEdit_TemplateMode(t *testing.T) {
+	for _, mode := range []TemplateMode{TemplateComment, TemplateDelete} {
+		g := New()
+		g.TemplateMode = mode
+		err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+		require.NoError(t, err)
+
+		err = g.load()
+		require.NoError(t, err)
+
+		pkg := g.program.Created[0]
+		file := pkg.Files[0]
+
+		var edits []sourceEdit
+		forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+			stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+			edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")))
+			require.NoError(t, err)
+			require.True(t, ok)
+			edits = append(edits, edit)
+			return nil
+		})
+
+		err = g.editFileSource(file, edits)
+		require.NoError(t, err)
+
+		result := g.showNode(file)
+		t.Log(result)
+
+		// generated cases are no longer regenerated, so left as hand-written ones
+		assert.NotContains(t, result, generatedBeginMarker, mode)
+		assert.Contains(t, result, "case map[string]int:", mode)
+		assert.NotContains(t, result, "\tcase map[string]T:", mode)
+
+		if mode == TemplateComment {
+			assert.Contains(t, result, "// case map[string]T:")
+			assert.Contains(t, result, "//\tkeys := make([]string, 0, len(m))")
+		} else {
+			assert.NotContains(t, result, "map[string]T")
+		}
+	}
+}
+
+func TestExpandEdit_TemplateFallback(t *testing.T) {
+	g := New()
+	g.TemplateMode = TemplateFallback
+	err := g.Loader.CreateFromFilenames("", "testdata/fallback.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+	var edits []sourceEdit
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, imports: imports}
+		edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, fd.Name.Name)))
+		if fd.Name.Name == "total" {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "cannot generate fallback for case *T")
+			}
+			return nil
+		}
+		require.NoError(t, err, fd.Name.Name)
+		require.True(t, ok)
+		edits = append(edits, edit)
+		return nil
+	})
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+	imports.fix(g.Loader.Fset, file)
+
+	result := g.showNode(file)
+	t.Log(result)
+
+	assert.Contains(t, result, "\tcase map[string]int:\n")
+	assert.NotContains(t, result, "case map[string]T:")
+	assert.Contains(t, result, `	default:
+		if rv := reflect.ValueOf(m); rv.Kind() == reflect.Map && rv.Type().Key() == reflect.TypeOf((*string)(nil)).Elem() {
+			m := make(map[string]interface{}, rv.Len())
+			for _, k := range rv.MapKeys() {
+				m[k.Interface().(string)] = rv.MapIndex(k).Interface()
+			}
+			keys := make([]string, 0, len(m))
+`)
+	assert.Contains(t, result, `		} else {
+			return nil
+		}
+`)
+	assert.Contains(t, result, `			// the elements as T
+			var elems []interface{}
+`)
+	assert.Contains(t, result, `if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.Type().Elem().Implements(reflect.TypeOf((*S)(nil)).Elem()) {
+			v := make([]S, rv.Len())
+			for i := range v {
+				v[i] = rv.Index(i).Interface().(S)
+			}
+`)
+	assert.Contains(t, result, "if rv := reflect.ValueOf(v); rv.IsValid() {\n\t\t\treturn \"any\"\n")
+
+	// the fallbacks compile
+	dir, err := ioutil.TempDir("", "tsgen-fallback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "fallback.go")
+	err = ioutil.WriteFile(filename, []byte(result), 0644)
+	require.NoError(t, err)
+
+	g2 := New()
+	err = g2.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+	_, err = g2.Loader.Load()
+	assert.NoError(t, err)
+}
+
+func TestExpandEdit_DefaultPanic(t *testing.T) {
+	g := New()
+	g.DefaultPanic = true
+	err := g.Loader.CreateFromFilenames("", "testdata/defaultpanic.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+	var edits []sourceEdit
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, imports: imports}
+		edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, fd.Name.Name)))
+		require.NoError(t, err)
+		require.True(t, ok)
+		edits = append(edits, edit)
+		return nil
+	})
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	imports.fix(g.Loader.Fset, file)
+
+	result := g.showNode(file)
+	t.Log(result)
+
+	assert.Contains(t, result, `import "fmt"`)
+	assert.Equal(t, 2, strings.Count(result, "default:"))
+	assert.Contains(t, result, `panic(fmt.Sprintf("unexpected type %T", v))`)
+	assert.Equal(t, 2, strings.Count(result, "case []int:"))
+}
+
+// errorArgTypes returns the concrete types of the first arguments at the call sites of funcName in file,
+// and the types of the errors they wrap.
+func errorArgTypes(info *types.Info, file *ast.File, funcName string) []types.Type {
+	ts := []types.Type{}
+	for _, t := range callArgTypes(info, file, funcName) {
+		if !types.IsInterface(t) {
+			ts = append(ts, t)
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == funcName {
+				ts = append(ts, wrappedErrorTypes(info, call.Args[0])...)
+			}
+		}
+		return true
+	})
+
+	return ts
+}
+
+func TestExpandEdit_ErrorsAs(t *testing.T) {
+	expand := func(overlay map[string][]byte) string {
+		g := New()
+		g.ErrorsAs = true
+		g.Overlay = overlay
+		err := g.Loader.CreateFromFilenames("", "testdata/errorsas.go")
+		require.NoError(t, err)
+
+		err = g.applyOverlay()
+		require.NoError(t, err)
+
+		err = g.load()
+		require.NoError(t, err)
+
+		pkg := g.program.Created[0]
+		file := pkg.Files[0]
+		imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+		var edits []sourceEdit
+		forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+			stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, imports: imports}
+			edit, ok, err := g.expandEdit(stmt, canonicalTypes(errorArgTypes(&pkg.Info, file, fd.Name.Name)))
+			require.NoError(t, err)
+			require.True(t, ok)
+			edits = append(edits, edit)
+			return nil
+		})
+
+		err = g.editFileSource(file, edits)
+		require.NoError(t, err)
+
+		imports.fix(g.Loader.Fset, file)
+
+		return g.showNode(file)
+	}
+
+	result := expand(nil)
+	t.Log(result)
+
+	assert.Contains(t, result, `"errors"`)
+	assert.Contains(t, result, "if target := (*NotFound)(nil); errors.As(err, &target) {")
+	assert.Contains(t, result, "if target := (*os.PathError)(nil); errors.As(err, &target) {")
+	assert.Equal(t, 2, strings.Count(result, "err := target\n"))
+	assert.Contains(t, result, "switch err := err.(type) {\n\tcase T:")
+
+	again := expand(map[string][]byte{"testdata/errorsas.go": []byte(result)})
+	assert.Equal(t, result, again)
+}
+
+func TestWrappedErrorTypes(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/errorsas.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	ts := []string{}
+	for _, t := range errorArgTypes(&pkg.Info, file, "describe") {
+		ts = append(ts, t.String())
+	}
+
+	assert.Equal(t, []string{"*testdata.NotFound", "*os.PathError", "*testdata.NotFound"}, ts)
+	assert.Equal(t, []rune{'s', 'w', '*', 'd'}, formatVerbs("%s: %w %% %*d"))
+}
+
+// specializeFile specializes the functions in testdata/specialize.go, or its content in overlay if not nil,
+// by the types of the arguments at the call sites of keys.
+func specializeFile(t *testing.T, g *Gen, overlay map[string][]byte) string {
+	g.Overlay = overlay
+	err := g.Loader.CreateFromFilenames("", "testdata/specialize.go")
+	require.NoError(t, err)
+
+	err = g.applyOverlay()
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+	existing := existingSpecializations(pkg)
+	tables := existingDispatchTables(pkg)
+
+	funcs := []*specializedFunc{}
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			if f := g.specializable(pkg, file, funcDecl); f != nil {
+				f.stmt.imports = newFileImports(file, pkg.Pkg, &pkg.Info)
+				g.planSpecializations(f, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")), existing["keys"], funcs)
+				g.planDispatchTable(f, tables["keys"])
+				funcs = append(funcs, f)
+			}
+		}
+	}
+	require.Len(t, funcs, 1)
+
+	edits, err := g.specializeEdits(pkg, file, funcs)
+	require.NoError(t, err)
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	funcs[0].stmt.imports.fix(g.Loader.Fset, file)
+
+	return g.showNode(file)
+}
+
+func TestSpecializeEdits(t *testing.T) {
+	g := New()
+	g.RewriteCallSites = true
+	result := specializeFile(t, g, nil)
+	t.Log(result)
+
+	assert.Contains(t, result, "func keysStringInt(m map[string]int) []string {")
+	assert.Contains(t, result, "func keysStringBool(m map[string]bool) []string {")
+	assert.Contains(t, result, "\tcase map[string]int:\n\t\treturn keysStringInt(m)\n")
+
+	// only the calls with statically typed arguments are rewritten
+	assert.Contains(t, result, "keysStringInt(map[string]int{})")
+	assert.Contains(t, result, "keysStringBool(map[string]bool{})")
+	assert.Contains(t, result, "keys(m)")
+
+	// the specializations are kept by the next run, though the calls no longer reach the original
+	g = New()
+	g.RewriteCallSites = true
+	again := specializeFile(t, g, map[string][]byte{"testdata/specialize.go": []byte(result)})
+	assert.Equal(t, result, again)
+}
+
+func TestSpecializeEdits_DispatchTable(t *testing.T) {
+	g := New()
+	g.DispatchTableMin = 2
+	result := specializeFile(t, g, nil)
+	t.Log(result)
+
+	assert.Contains(t, result, "\"reflect\"")
+	assert.Contains(t, result, "var keysTable = map[reflect.Type]func(m interface{}) []string{}")
+	assert.Contains(t, result, "keysTable[reflect.TypeOf((*map[string]int)(nil)).Elem()] = func(m interface{}) []string {\n\t\treturn keysStringInt(m.(map[string]int))\n\t}")
+	assert.Contains(t, result, "if specialized, ok := keysTable[reflect.TypeOf(m)]; ok {\n\t\treturn specialized(m)\n\t}")
+	assert.NotContains(t, result, generatedBeginMarker)
+
+	// regenerated in place
+	g = New()
+	g.DispatchTableMin = 2
+	again := specializeFile(t, g, map[string][]byte{"testdata/specialize.go": []byte(result)})
+	assert.Equal(t, result, again)
+
+	// and removed with the lookup if disabled
+	removed := specializeFile(t, New(), map[string][]byte{"testdata/specialize.go": []byte(result)})
+	assert.NotContains(t, removed, "keysTable")
+	assert.NotContains(t, removed, "reflect")
+	assert.Contains(t, removed, generatedBeginMarker)
+}
+
+func TestGenerateVisitor(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/visitor.go" {
+			return nopCloser{out}
+		}
+
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/visitor.go")
+	require.NoError(t, err)
+
+	err = g.GenerateVisitor("testdata/visitor.go", 24)
+	require.NoError(t, err)
+
+	result := out.String()
+	t.Log(result)
+
+	assert.Contains(t, result, "func eval(n Node, env map[string]int) int {\n\treturn AcceptNode(n, evalVisitor{env: env})\n}")
+	assert.Contains(t, result, "type NodeVisitor interface {\n\tVisitBinary(n *Binary) int\n\tVisitLiteral(n Literal) int\n\tVisitIdent(n Ident) int\n\tVisitDefault(n Node) int\n}")
+	assert.Contains(t, result, "\tcase *Binary:\n\t\treturn v.VisitBinary(n)\n")
+	assert.Contains(t, result, "func (vis evalVisitor) VisitIdent(n Ident) int {\n\tenv := vis.env\n\treturn env[string(n)]\n}")
+	assert.Contains(t, result, "func (vis evalVisitor) VisitDefault(n Node) int {\n\tpanic(\"unknown node\")\n}")
+	assert.Contains(t, result, "func (vis evalVisitor) VisitLiteral(n Literal) int {\n\treturn int(n)\n}")
+}
+
+func TestContext_Cancelled(t *testing.T) {
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		t.Fatalf("should not write %s", path)
+		return nil
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = g.SortContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestContext_CancelledMidRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out bytes.Buffer
+	written := []string{}
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		written = append(written, path)
+		// cancelled while the first file is rewritten
+		cancel()
+		return nopCloser{&out}
+	}
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go", "testdata/sort/values.go")
+	require.NoError(t, err)
+
+	err = g.SortContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, written, 1, "no file is rewritten after cancellation")
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := New()
+	g.ctx = ctx
+
+	// a phase cancelled meanwhile runs to completion before run returns
+	done := false
+	err := g.run(func() error {
+		cancel()
+		done = true
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, done)
+
+	// no phase runs once cancelled
+	err = g.run(func() error {
+		t.Fatal("should not run")
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestIsInitialPackage(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	name := g.Loader.CreatePkgs[0].Files[0].Name.Name
+	assert.True(t, g.isInitialPackage(name))
+	assert.False(t, g.isInitialPackage("fmt"))
+}
+
+func TestCheckUnmatched(t *testing.T) {
+	g := New()
+	g.Strict = true
+	err := g.Loader.CreateFromFilenames("", "testdata/coverage.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		ins := canonicalTypes(callArgTypes(&pkg.Info, file, "describe"))
+
+		err := g.checkUnmatched(stmt, fd, ins)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "testdata/coverage.go:13:2: 1 argument types match no template of the type switch")
+			assert.Contains(t, err.Error(), "\n\tint (from )")
+		}
+
+		matched := []types.Type{}
+		for _, in := range ins {
+			if in.String() != "int" {
+				matched = append(matched, in)
+			}
+		}
+
+		err = g.checkUnmatched(stmt, fd, matched)
+		assert.NoError(t, err)
+		return nil
+	})
+}
+
+func TestLimitCases(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/limit.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		ins := canonicalTypes(callArgTypes(&pkg.Info, file, "describe"))
+		require.Len(t, ins, 4)
+
+		// string has a hand-written case and int matches no template, so only []int and []bool are generated
+		g.MaxCasesPerSwitch = 2
+		limited, err := g.limitCases(stmt, fd, ins)
+		assert.NoError(t, err)
+		assert.Len(t, limited, 4)
+
+		g.MaxCasesPerSwitch = 1
+		_, err = g.limitCases(stmt, fd, ins)
+		if assert.Error(t, err) {
+			assert.Equal(t, RuleTooManyCases, err.(Diagnostic).Rule)
+			assert.Contains(t, err.Error(), "type switch would have 2 expanded cases (max per switch 1, max total 0, expanded so far 0)")
+			assert.NotContains(t, err.Error(), "\tstring (from ")
+		}
+
+		g.TruncateCases = true
+		g.Logger = NewTextLogger(ioutil.Discard, false)
+		limited, err = g.limitCases(stmt, fd, ins)
+		assert.NoError(t, err)
+		assert.Len(t, limited, 3)
+		return nil
+	})
+}
+
+func TestLimitCases_Nested(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/nested.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	var (
+		intType     = types.Typ[types.Int]
+		float64Type = types.Typ[types.Float64]
+		stringType  = types.Typ[types.String]
+	)
+
+	checked := false
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		if fd.Name.Name != "add" || sw.Pos() != fd.Body.List[0].Pos() {
+			return nil
+		}
+		checked = true
+
+		sites := &callSites{
+			funcDecl:  fd,
+			args:      [][]types.Type{{intType, intType}, {float64Type, intType}, {stringType, stringType}},
+			positions: []token.Pos{token.NoPos, token.NoPos, token.NoPos},
+		}
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, sites: sites}
+		ins := canonicalTypes(sites.typesAt(0))
+
+		// a case for each of the 3 types of a, and one in the nested type switch for each of the pairs observed
+		g.MaxCasesPerSwitch = 6
+		_, err := g.limitCases(stmt, fd, ins)
+		assert.NoError(t, err)
+
+		g.MaxCasesPerSwitch = 5
+		_, err = g.limitCases(stmt, fd, ins)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "type switch would have 6 expanded cases")
+		}
+
+		// the full product has the 2 types of b for each of a
+		g.NestedFullProduct = true
+		g.MaxCasesPerSwitch = 8
+		_, err = g.limitCases(stmt, fd, ins)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "type switch would have 9 expanded cases")
+		}
+		return nil
+	})
+	assert.True(t, checked)
+}
+
+func TestLimitCases_Refunded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filenames := []string{"testdata/limittotal/a.go", "testdata/limittotal/b.go"}
+	cacheCallSitesOf(t, dir, filenames, map[string][][]types.Type{
+		"fits":      {{types.NewSlice(types.Typ[types.String])}},
+		"unmatched": {{types.NewSlice(types.Typ[types.Int])}, {types.Typ[types.Int]}},
+		"later":     {{types.NewSlice(types.Typ[types.Int])}, {types.NewSlice(types.Typ[types.Bool])}},
+	})
+
+	// the type switch in b.go fits the total of 2 cases, as those in a.go are not expanded
+	// for the failure of unmatched, which the check finds after their cases are counted
+	for _, check := range []string{"strict", "lint"} {
+		var out bytes.Buffer
+
+		g := New()
+		g.CacheDir = dir
+		g.MaxCasesTotal = 2
+		g.Strict = check == "strict"
+		g.Lint = check == "lint"
+		g.Logger = NewTextLogger(ioutil.Discard, false)
+		g.FileWriter = func(path string) io.WriteCloser {
+			if path == "testdata/limittotal/b.go" {
+				return nopCloser{&out}
+			}
+			return nopCloser{new(bytes.Buffer)}
+		}
+		err := g.Loader.CreateFromFilenames("", filenames...)
+		require.NoError(t, err)
+
+		err = g.Expand()
+		require.Error(t, err, check)
+
+		diags, ok := err.(DiagnosticList)
+		require.True(t, ok, check)
+		require.Len(t, diags, 1, check)
+		assert.Equal(t, 24, diags[0].Pos.Line, check)
+		assert.NotEqual(t, RuleTooManyCases, diags[0].Rule, check)
+
+		assert.Contains(t, out.String(), "case []bool:", check)
+		assert.Contains(t, out.String(), "case []int:", check)
+	}
+}
+
+func TestExpandEdit_Comments(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/comments.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	var edits []sourceEdit
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "first")))
+		require.NoError(t, err)
+		require.True(t, ok)
+		edits = append(edits, edit)
+		return nil
+	})
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	result := g.showNode(file)
+	t.Log(result)
+
+	for _, typ := range []string{"int", "bool", "T"} {
+		assert.Contains(t, result, `case map[string]`+typ+`:
+		// the first value found
+		var r `+typ+` // <-- T here
+		for _, v := range m {
+			r = v /* found */
+			break
+		}
+		return r // zero if empty
+`)
+	}
+}
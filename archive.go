@@ -0,0 +1,188 @@
+package gen
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ArchiveManifestName is the name of the manifest written along with the files of an Archive.
+const ArchiveManifestName = "tsgen-manifest.json"
+
+// Archive collects the files written by Gen with Gen.Archive set, instead of writing them in place,
+// to be written at once by WriteDir or WriteTar with their manifest, e.g. as the outputs of a hermetic
+// build action. The files are keyed by their paths relative to the root of the module as with Gen.OutputDir,
+// and the bytes written depend only on the inputs and the version of tsgen.
+type Archive struct {
+	mu      sync.Mutex
+	inputs  map[string][]byte
+	outputs map[string][]byte
+}
+
+// ArchiveManifest lists the files rewritten, as the inputs, and the files generated from them, as the outputs,
+// sorted by their paths. It is written as ArchiveManifestName in JSON.
+type ArchiveManifest struct {
+	Tool    string         `json:"tool"`
+	Inputs  []ArchiveEntry `json:"inputs"`
+	Outputs []ArchiveEntry `json:"outputs"`
+}
+
+// ArchiveEntry is a file in ArchiveManifest, with its path separated by slashes and its SHA-256 digest in hex.
+type ArchiveEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// add records the file of path rewritten from input to output.
+func (a *Archive) add(path string, input, output []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.inputs == nil {
+		a.inputs = map[string][]byte{}
+		a.outputs = map[string][]byte{}
+	}
+
+	path = filepath.ToSlash(path)
+	if input != nil {
+		a.inputs[path] = input
+	}
+	a.outputs[path] = output
+}
+
+// Manifest returns the manifest of the files collected.
+func (a *Archive) Manifest() ArchiveManifest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return ArchiveManifest{
+		Tool:    "tsgen " + toolVersion(),
+		Inputs:  archiveEntries(a.inputs),
+		Outputs: archiveEntries(a.outputs),
+	}
+}
+
+func archiveEntries(files map[string][]byte) []ArchiveEntry {
+	entries := []ArchiveEntry{}
+	for path, content := range files {
+		sum := sha256.Sum256(content)
+		entries = append(entries, ArchiveEntry{Path: path, SHA256: hex.EncodeToString(sum[:])})
+	}
+	sort.Sort(byEntryPath(entries))
+
+	return entries
+}
+
+type byEntryPath []ArchiveEntry
+
+func (s byEntryPath) Len() int           { return len(s) }
+func (s byEntryPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byEntryPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+
+// files returns the files to be written, the outputs and the manifest, sorted by their paths.
+func (a *Archive) files() ([]ArchiveEntry, map[string][]byte, error) {
+	manifest := a.Manifest()
+
+	enc, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	contents := map[string][]byte{ArchiveManifestName: append(enc, '\n')}
+	for path, content := range a.outputs {
+		contents[path] = content
+	}
+
+	entries := append([]ArchiveEntry{{Path: ArchiveManifestName}}, manifest.Outputs...)
+	sort.Sort(byEntryPath(entries))
+
+	return entries, contents, nil
+}
+
+// WriteDir writes the files collected and the manifest under dir, creating the directories as needed.
+func (a *Archive) WriteDir(dir string) error {
+	entries, contents, err := a.files()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, filepath.FromSlash(e.Path))
+
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(path, contents[e.Path], 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteTar writes the files collected and the manifest to w as a tar archive, whose headers carry
+// no timestamps nor owners, so that the same inputs make the same bytes.
+func (a *Archive) WriteTar(w io.Writer) error {
+	entries, contents, err := a.files()
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		content := contents[e.Path]
+
+		err := tw.WriteHeader(&tar.Header{
+			Name:     e.Path,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tw.Write(content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// archiveWriter adds the file filename to g.Archive on Close.
+type archiveWriter struct {
+	bytes.Buffer
+	g        Gen
+	filename string
+}
+
+func (w *archiveWriter) Close() error {
+	path, err := w.g.relativeOutputPath(w.filename)
+	if err != nil {
+		return err
+	}
+
+	// the generated test files are new
+	input, _ := w.g.readSource(w.filename)
+
+	w.g.Archive.add(path, input, w.Bytes())
+	return nil
+}
@@ -0,0 +1,98 @@
+package gen
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v0.0.0-test"
+
+	dir, err := ioutil.TempDir("", "tsgen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	srcDir := filepath.Join(dir, "src")
+	filename := filepath.Join(srcDir, "lib", "cases.go")
+	err = os.MkdirAll(filepath.Dir(filename), 0777)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filename, src, 0644)
+	require.NoError(t, err)
+
+	archive := func() *Archive {
+		g := New()
+		g.Modules = &Modules{Main: []Module{{Path: "example.com/m", Dir: srcDir}}}
+		g.Archive = &Archive{}
+		err := g.Loader.CreateFromFilenames("", filename)
+		require.NoError(t, err)
+
+		err = g.Sort()
+		require.NoError(t, err)
+
+		return g.Archive
+	}
+
+	a := archive()
+
+	sum := sha256.Sum256(src)
+	manifest := a.Manifest()
+	assert.Equal(t, "tsgen v0.0.0-test", manifest.Tool)
+	assert.Equal(t, []ArchiveEntry{{Path: "lib/cases.go", SHA256: hex.EncodeToString(sum[:])}}, manifest.Inputs)
+	require.Len(t, manifest.Outputs, 1)
+	assert.Equal(t, "lib/cases.go", manifest.Outputs[0].Path)
+	assert.NotEqual(t, manifest.Inputs[0].SHA256, manifest.Outputs[0].SHA256)
+
+	// the source is left as it is
+	current, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, string(src), string(current))
+
+	var tar1, tar2 bytes.Buffer
+	err = a.WriteTar(&tar1)
+	require.NoError(t, err)
+	err = archive().WriteTar(&tar2)
+	require.NoError(t, err)
+	assert.Equal(t, tar1.Bytes(), tar2.Bytes())
+
+	names := []string{}
+	tr := tar.NewReader(&tar1)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"lib/cases.go", ArchiveManifestName}, names)
+
+	outDir := filepath.Join(dir, "out")
+	err = a.WriteDir(outDir)
+	require.NoError(t, err)
+
+	out, err := ioutil.ReadFile(filepath.Join(outDir, "lib", "cases.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "case C:")
+
+	b, err := ioutil.ReadFile(filepath.Join(outDir, ArchiveManifestName))
+	require.NoError(t, err)
+	var written ArchiveManifest
+	err = json.Unmarshal(b, &written)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, written)
+}
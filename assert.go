@@ -0,0 +1,290 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// ExpandAssertions expands the type assertions with type variables in the functions of the program,
+// e.g. y := x.(map[string]T), as Expand does the type switches. Such an assertion, along with the statements
+// following it in its block, is rewritten into a chain of if statements asserting each argument type matching
+// the pattern, whose bodies are the following statements with the type variables replaced:
+//
+//	if y, ok := x.(map[string]int); ok {
+//		...
+//	} else if y, ok := x.(map[string]bool); ok {
+//		...
+//	} else {
+//		y := x.(map[string]T)
+//		...
+//	}
+//
+// The assertion is kept in the last else block as the template, from which the chain is regenerated by later runs.
+// The subject x must be free of side effects, as it is evaluated by each if statement.
+func (g Gen) ExpandAssertions() error {
+	return g.ExpandAssertionsContext(context.Background())
+}
+
+// ExpandAssertionsContext is like ExpandAssertions but can be cancelled by ctx.
+func (g Gen) ExpandAssertionsContext(ctx context.Context) error {
+	g.ctx = ctx
+
+	err := g.initProgram(needFuncBodies)
+	if err != nil {
+		return err
+	}
+
+	if g.CacheDir != "" {
+		g.cache, err = g.openAnalysisCache()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.initRun()
+
+	// the generated assertions have one type each
+	g.MergeCases = false
+
+	err = g.doFiles(g.expandFileAssertions)
+	if err != nil {
+		return err
+	}
+
+	if g.cache != nil {
+		return g.cache.save()
+	}
+
+	return nil
+}
+
+// templateAssertion is a type assertion with type variables, y := x.(P) or y, ok := x.(P),
+// at the top level of a block, with the chain of if statements generated from it by the previous runs if any.
+type templateAssertion struct {
+	assign *ast.AssignStmt
+
+	// chain is the if statement generated, whose last else block begins with assign, or nil if not expanded yet.
+	chain *ast.IfStmt
+
+	// rest are the statements following assign in its block, which the if statements generated have as their bodies.
+	rest []ast.Stmt
+
+	// stmt is the type switch equivalent to the assertion, switch y := x.(type) { case P: rest },
+	// by which the assertion is expanded as the type switches are.
+	stmt *TypeSwitchStmt
+}
+
+// findTemplateAssertion returns the first template assertion at the top level of block in file, or nil if none.
+func (g Gen) findTemplateAssertion(file *ast.File, info *types.Info, block *ast.BlockStmt) *templateAssertion {
+	for i, st := range block.List {
+		switch st := st.(type) {
+		case *ast.AssignStmt:
+			if a := g.newTemplateAssertion(file, info, st, block.List[i+1:], block.Rbrace); a != nil {
+				return a
+			}
+
+		case *ast.IfStmt:
+			// the chain generated: if y, ok := x.(C); ok { ... } else if ... else { y := x.(P); ... }
+			last := st
+			for last != nil {
+				if _, ok := last.Init.(*ast.AssignStmt); !ok {
+					break
+				}
+				if next, ok := last.Else.(*ast.IfStmt); ok {
+					last = next
+					continue
+				}
+
+				elseBlock, ok := last.Else.(*ast.BlockStmt)
+				if !ok || len(elseBlock.List) == 0 {
+					break
+				}
+
+				assign, ok := elseBlock.List[0].(*ast.AssignStmt)
+				if !ok {
+					break
+				}
+
+				if a := g.newTemplateAssertion(file, info, assign, elseBlock.List[1:], elseBlock.Rbrace); a != nil {
+					a.chain = st
+					return a
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// newTemplateAssertion returns the template assertion of assign followed by rest in the block ending at rbrace,
+// or nil if assign is not a type assertion with type variables.
+func (g Gen) newTemplateAssertion(file *ast.File, info *types.Info, assign *ast.AssignStmt, rest []ast.Stmt, rbrace token.Pos) *templateAssertion {
+	if assign.Tok != token.DEFINE || len(assign.Rhs) != 1 || len(assign.Lhs) > 2 {
+		return nil
+	}
+
+	ta, ok := assign.Rhs[0].(*ast.TypeAssertExpr)
+	if !ok || ta.Type == nil {
+		return nil
+	}
+
+	for _, lhs := range assign.Lhs {
+		if _, ok := lhs.(*ast.Ident); !ok {
+			return nil
+		}
+	}
+
+	clause := &ast.CaseClause{Case: assign.Pos(), List: []ast.Expr{ta.Type}, Colon: assign.End() - 1, Body: rest}
+	node := &ast.TypeSwitchStmt{
+		Switch: assign.Pos(),
+		Assign: &ast.AssignStmt{
+			Lhs:    assign.Lhs[:1],
+			TokPos: assign.TokPos,
+			Tok:    token.DEFINE,
+			Rhs:    []ast.Expr{&ast.TypeAssertExpr{X: ta.X, Lparen: ta.Lparen, Rparen: ta.Rparen}},
+		},
+		Body: &ast.BlockStmt{Lbrace: assign.Pos(), List: []ast.Stmt{clause}, Rbrace: rbrace},
+	}
+
+	stmt := &TypeSwitchStmt{file: file, node: node, info: *info}
+	if !g.isTemplateClause(stmt, clause) {
+		return nil
+	}
+
+	return &templateAssertion{assign: assign, rest: rest, stmt: stmt}
+}
+
+// expandFileAssertions is the main logic for "assert" mode.
+// May rewrite the template assertions in *ast.File file.
+func (g Gen) expandFileAssertions(pkg *loader.PackageInfo, file *ast.File) error {
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+	edits := []sourceEdit{}
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
+
+		if !g.selectsFunc(pkg, funcDecl) {
+			continue
+		}
+
+		a := g.findTemplateAssertion(file, &pkg.Info, funcDecl.Body)
+		if a == nil || !g.inRegion(file, a.stmt.node) {
+			continue
+		}
+
+		if isGenericFunc(funcDecl) {
+			g.warn(file, a.assign, "type assertion in generic function %s is not expanded", funcDecl.Name.Name)
+			continue
+		}
+		a.stmt.imports = imports
+
+		if x, _ := typeSwitchSubject(a.stmt.node); !isPure(x) {
+			g.warn(file, a.assign, "type assertion on %s is not expanded: it may have side effects", g.showNode(x))
+			continue
+		}
+
+		inTypes, err := g.possibleSubjectTypes(pkg, funcDecl, a.stmt)
+		if err != nil {
+			return err
+		}
+
+		inTypes, err = g.limitCases(a.stmt, funcDecl, canonicalTypes(inTypes))
+		if err != nil {
+			return err
+		}
+
+		edit, ok, err := g.assertionEdit(a, inTypes)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			g.info(file, a.assign, "expanded type assertion", F("func", funcDecl.Name.Name), F("types", len(a.stmt.generated)))
+			edits = append(edits, edit)
+		}
+	}
+
+	if len(edits) == 0 {
+		return nil
+	}
+
+	err := g.editFileSource(file, edits)
+	if err != nil {
+		return err
+	}
+
+	imports.fix(g.Loader.Fset, file)
+
+	return nil
+}
+
+// assertionEdit returns an edit to the source which rewrites a into the chain of if statements asserting ins,
+// or back into the assertion if none of ins matches the template.
+func (g Gen) assertionEdit(a *templateAssertion, ins []types.Type) (sourceEdit, bool, error) {
+	clauses := g.expandClauses(a.stmt, ins)
+	if len(clauses) == 0 && a.chain == nil {
+		return sourceEdit{}, false, nil
+	}
+
+	src, err := g.fileSource(a.stmt.file)
+	if err != nil {
+		return sourceEdit{}, false, err
+	}
+
+	tf := g.tokenFile(a.stmt.file)
+	offset := func(pos token.Pos) int { return tf.Offset(pos) }
+
+	// the template, with the comment trailing the last statement
+	end := g.clauseEnd(a.stmt, a.stmt.node.Body.List[0].(*ast.CaseClause))
+	template := string(src[offset(a.assign.Pos()):offset(end)])
+
+	start := offset(a.assign.Pos())
+	if a.chain != nil {
+		start = offset(a.chain.Pos())
+		end = a.chain.End()
+	}
+
+	if len(clauses) == 0 {
+		return sourceEdit{start: start, end: offset(end), text: []byte(template)}, true, nil
+	}
+
+	x, _ := typeSwitchSubject(a.stmt.node)
+	subject := string(src[offset(x.Pos()):offset(x.End())])
+	y := a.assign.Lhs[0].(*ast.Ident).Name
+
+	// the variable of the result of the assertion, named after the one of the template if any
+	ok := ""
+	if len(a.assign.Lhs) == 2 && a.assign.Lhs[1].(*ast.Ident).Name != "_" {
+		ok = a.assign.Lhs[1].(*ast.Ident).Name
+	} else {
+		ok = "ok"
+		for ok == y || refersTo(a.rest, ok) {
+			ok = ok + "_"
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, clause := range clauses {
+		typ := g.showNode(clause.List[0])
+
+		// printed as a default clause, to take the body
+		clause.List = nil
+		body := strings.TrimPrefix(g.showClause(a.stmt, clause), "default:")
+
+		fmt.Fprintf(&buf, "if %s, %s := %s.(%s); %s {%s\n} else ", y, ok, subject, typ, ok, body)
+	}
+	fmt.Fprintf(&buf, "{\n%s\n}", template)
+
+	return sourceEdit{start: start, end: offset(end), text: buf.Bytes()}, true, nil
+}
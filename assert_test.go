@@ -0,0 +1,97 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandAssertions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/assert.go", "keys", [][]types.Type{
+		{types.NewMap(types.Typ[types.String], types.Typ[types.Int])},
+		{types.NewMap(types.Typ[types.String], types.Typ[types.Bool])},
+	})
+
+	g := New()
+	g.CacheDir = dir
+	err = g.Loader.CreateFromFilenames("", "testdata/assert.go")
+	require.NoError(t, err)
+
+	sources, err := g.ExpandAssertionsBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/assert.go"])
+	t.Log(out)
+
+	assert.Contains(t, out, `func keys(x interface{}) []string {
+	if m, ok := x.(map[string]bool); ok {
+		ks := []string{}
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks // sorted later
+	} else if m, ok := x.(map[string]int); ok {
+		ks := []string{}
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks // sorted later
+	} else {
+		m := x.(map[string]T)
+		ks := []string{}
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks // sorted later
+	}
+}`)
+
+	// assertions without type variables are left as they are
+	assert.Contains(t, out, `	if _, ok := x.(fmt.Stringer); ok {
+		return
+	}
+	fmt.Println(x)`)
+
+	// regenerated from the template in the chain
+	srcDir, err := ioutil.TempDir("", "tsgen-assert")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+
+	filename := filepath.Join(srcDir, "assert.go")
+	err = ioutil.WriteFile(filename, []byte(out), 0644)
+	require.NoError(t, err)
+
+	cacheCallSites(t, dir, filename, "keys", [][]types.Type{
+		{types.NewMap(types.Typ[types.String], types.Typ[types.Int])},
+	})
+
+	g = New()
+	g.CacheDir = dir
+	err = g.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+
+	sources, err = g.ExpandAssertionsBytes()
+	require.NoError(t, err)
+
+	out = string(sources[filename])
+	assert.Contains(t, out, `func keys(x interface{}) []string {
+	if m, ok := x.(map[string]int); ok {
+		ks := []string{}
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks // sorted later
+	} else {
+		m := x.(map[string]T)`)
+	assert.NotContains(t, out, "map[string]bool); ok")
+}
@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"path/filepath"
+
+	"go/build"
+	"golang.org/x/tools/go/loader"
+)
+
+// hasBuildOverrides reports whether any of g.BuildTags, g.GOOS, g.GOARCH and g.CgoEnabled is set.
+func (g Gen) hasBuildOverrides() bool {
+	return g.BuildTags != nil || g.GOOS != "" || g.GOARCH != "" || g.CgoEnabled != nil
+}
+
+// BuildContext returns the build context the program is loaded with: the one of g.Loader,
+// or build.Default if not set, with g.BuildTags, g.GOOS, g.GOARCH and g.CgoEnabled applied.
+func (g Gen) BuildContext() *build.Context {
+	ctxt := build.Default
+	if g.Loader.Build != nil {
+		ctxt = *g.Loader.Build
+	}
+
+	if g.BuildTags != nil {
+		ctxt.BuildTags = append([]string{}, g.BuildTags...)
+	}
+
+	if g.GOOS != "" {
+		ctxt.GOOS = g.GOOS
+	}
+
+	if g.GOARCH != "" {
+		ctxt.GOARCH = g.GOARCH
+	}
+
+	if g.CgoEnabled != nil {
+		ctxt.CgoEnabled = *g.CgoEnabled
+	} else if ctxt.GOOS != build.Default.GOOS || ctxt.GOARCH != build.Default.GOARCH {
+		// as the go command, which disables cgo when cross-compiling
+		ctxt.CgoEnabled = false
+	}
+
+	return &ctxt
+}
+
+// applyBuildContext makes g.Loader load the program with g.BuildContext(), if any of its knobs is set.
+// The files of the created packages which do not match the context,
+// e.g. foo_windows.go for GOOS=linux or the ones with unsatisfied build constraints, are left out.
+func (g *Gen) applyBuildContext() error {
+	if !g.hasBuildOverrides() {
+		return nil
+	}
+
+	ctxt := g.BuildContext()
+	g.Loader.Build = ctxt
+
+	// Copy not to modify the packages of the caller's Gen
+	createPkgs := make([]loader.CreatePkg, len(g.Loader.CreatePkgs))
+	for i, cp := range g.Loader.CreatePkgs {
+		createPkgs[i] = loader.CreatePkg{Path: cp.Path}
+
+		for _, file := range cp.Files {
+			name := g.tokenFile(file).Name()
+
+			match, err := ctxt.MatchFile(filepath.Dir(name), filepath.Base(name))
+			if err != nil {
+				return err
+			}
+
+			if match {
+				createPkgs[i].Files = append(createPkgs[i].Files, file)
+			} else {
+				g.log(file, file.Name, "file excluded by the build context (%s/%s, tags %v)", ctxt.GOOS, ctxt.GOARCH, ctxt.BuildTags)
+			}
+		}
+	}
+	g.Loader.CreatePkgs = createPkgs
+
+	return nil
+}
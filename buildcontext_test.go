@@ -0,0 +1,58 @@
+package gen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildContext(t *testing.T) {
+	g := New()
+	g.GOOS = "windows"
+	g.GOARCH = "386"
+	g.BuildTags = []string{"extra"}
+
+	ctxt := g.BuildContext()
+	assert.Equal(t, "windows", ctxt.GOOS)
+	assert.Equal(t, "386", ctxt.GOARCH)
+	assert.Equal(t, []string{"extra"}, ctxt.BuildTags)
+	assert.False(t, ctxt.CgoEnabled, "cross-compiling")
+
+	cgo := true
+	g.CgoEnabled = &cgo
+	assert.True(t, g.BuildContext().CgoEnabled)
+}
+
+func TestApplyBuildContext(t *testing.T) {
+	filenames, err := filepath.Glob("testdata/buildctx/*.go")
+	require.NoError(t, err)
+
+	loaded := func(g *Gen) []string {
+		err := g.Loader.CreateFromFilenames("", filenames...)
+		require.NoError(t, err)
+
+		err = g.initProgram(needTypes)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, file := range g.program.Created[0].Files {
+			names = append(names, filepath.Base(g.tokenFile(file).Name()))
+		}
+		return names
+	}
+
+	g := New()
+	g.GOOS = "linux"
+	assert.Equal(t, []string{"main.go", "platform_linux.go"}, loaded(g))
+
+	g = New()
+	g.GOOS = "windows"
+	g.BuildTags = []string{"extra"}
+	assert.Equal(t, []string{"extra.go", "main.go", "platform_windows.go"}, loaded(g))
+
+	platform := g.program.Created[0].Pkg.Scope().Lookup("platform")
+	require.NotNil(t, platform)
+	assert.Equal(t, "func() int", platform.Type().String())
+}
@@ -0,0 +1,80 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// ExpandBytes is like Expand, but returns the rewritten sources of the files
+// in the initial packages by their file names instead of writing them through FileWriter.
+func (g Gen) ExpandBytes() (map[string][]byte, error) {
+	return g.rewriteBytes(Gen.Expand)
+}
+
+// SortBytes is like Sort, but returns the rewritten sources like ExpandBytes.
+func (g Gen) SortBytes() (map[string][]byte, error) {
+	return g.rewriteBytes(Gen.Sort)
+}
+
+// ScaffoldBytes is like Scaffold, but returns the rewritten sources like ExpandBytes.
+func (g Gen) ScaffoldBytes() (map[string][]byte, error) {
+	return g.rewriteBytes(Gen.Scaffold)
+}
+
+// ExpandAssertionsBytes is like ExpandAssertions, but returns the rewritten sources like ExpandBytes.
+func (g Gen) ExpandAssertionsBytes() (map[string][]byte, error) {
+	return g.rewriteBytes(Gen.ExpandAssertions)
+}
+
+func (g Gen) rewriteBytes(rewrite func(Gen) error) (map[string][]byte, error) {
+	var mu sync.Mutex
+	sources := map[string][]byte{}
+
+	g.initialOnly = true
+	g.FileWriter = func(filename string) io.WriteCloser {
+		return &bytesWriter{close: func(src []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			sources[filename] = src
+		}}
+	}
+
+	err := rewrite(g)
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// bytesWriter passes the bytes written to close on Close.
+type bytesWriter struct {
+	bytes.Buffer
+	close func([]byte)
+}
+
+func (w *bytesWriter) Close() error {
+	w.close(w.Bytes())
+	return nil
+}
+
+// isInitial reports whether pkg is one of the packages created or imported by g.Loader,
+// not their dependencies.
+func (g Gen) isInitial(pkg *loader.PackageInfo) bool {
+	for _, created := range g.program.Created {
+		if created == pkg {
+			return true
+		}
+	}
+
+	for _, imported := range g.program.Imported {
+		if imported == pkg {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,210 @@
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+)
+
+// cacheVersion is mixed into the cache keys, to be bumped when the format or the analysis changes.
+const cacheVersion = "tsgen-analysis-2"
+
+// analysisCache stores on disk the call sites of functions inferred by the analysis,
+// keyed by the hash of the sources of the program, so that SSA building and
+// pointer analysis can be skipped while the program is unchanged.
+type analysisCache struct {
+	filename string
+
+	mu      sync.Mutex
+	entries map[string][]cachedCallSite
+	dirty   bool
+
+	// files and typesByString resolve the positions and types stored in the cache.
+	files         map[string]*token.File
+	typesByString map[string]types.Type
+}
+
+// cachedCallSite is a call site stored in the cache.
+type cachedCallSite struct {
+	File   string
+	Offset int
+	// Args are the type strings of the arguments, or "" if not converted to an interface.
+	Args []string
+	// Dynamic tells whether the call is through an interface method or a function value.
+	Dynamic bool `json:",omitempty"`
+}
+
+// openAnalysisCache opens the cache of the loaded program in g.CacheDir.
+// It must be called before the files of the program are edited.
+func (g Gen) openAnalysisCache() (*analysisCache, error) {
+	c := &analysisCache{
+		entries:       map[string][]cachedCallSite{},
+		files:         map[string]*token.File{},
+		typesByString: map[string]types.Type{},
+	}
+
+	h := sha256.New()
+	fmt.Fprintln(h, cacheVersion)
+
+	// the call sites differ by the roots of the analysis
+	if len(g.Roots) > 0 {
+		fmt.Fprintln(h, "roots", strings.Join(g.Roots, ","))
+	}
+
+	g.Loader.Fset.Iterate(func(f *token.File) bool {
+		if f.Name() == rootsFilename {
+			// the synthetic main package of Gen.Roots, which has no source on disk
+			return true
+		}
+		c.files[f.Name()] = f
+		return true
+	})
+
+	names := []string{}
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		src, err := g.readSource(name)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(src))
+		h.Write(src)
+	}
+
+	c.filename = filepath.Join(g.CacheDir, hex.EncodeToString(h.Sum(nil))+".json")
+
+	for _, pkg := range g.program.AllPackages {
+		for _, tv := range pkg.Types {
+			if tv.Type != nil {
+				c.typesByString[types.TypeString(tv.Type, nil)] = tv.Type
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(c.filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &c.entries)
+	if err != nil {
+		g.warn(nil, nil, "ignoring broken analysis cache %s: %s", c.filename, err)
+		c.entries = map[string][]cachedCallSite{}
+	}
+
+	return c, nil
+}
+
+// funcKey returns the key of funcDecl in the cache.
+func (c *analysisCache) funcKey(fset *token.FileSet, funcDecl *ast.FuncDecl) string {
+	pos := fset.Position(funcDecl.Pos())
+	return fmt.Sprintf("%s:%d", pos.Filename, pos.Offset)
+}
+
+// get returns the cached call sites of funcDecl, or nil if not cached
+// or the cache refers to positions or types unknown to the program.
+func (c *analysisCache) get(fset *token.FileSet, funcDecl *ast.FuncDecl) *callSites {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sites, ok := c.entries[c.funcKey(fset, funcDecl)]
+	if !ok {
+		return nil
+	}
+
+	cs := &callSites{funcDecl: funcDecl}
+	for _, site := range sites {
+		f := c.files[site.File]
+		if f == nil || site.Offset > f.Size() {
+			return nil
+		}
+
+		args := make([]types.Type, len(site.Args))
+		for i, s := range site.Args {
+			if s == "" {
+				continue
+			}
+
+			args[i] = c.typesByString[s]
+			if args[i] == nil {
+				return nil
+			}
+		}
+
+		cs.args = append(cs.args, args)
+		cs.positions = append(cs.positions, f.Pos(site.Offset))
+		if site.Dynamic {
+			if cs.dynamic == nil {
+				cs.dynamic = map[token.Pos]bool{}
+			}
+			cs.dynamic[f.Pos(site.Offset)] = true
+		}
+	}
+
+	return cs
+}
+
+// put stores the call sites of funcDecl.
+func (c *analysisCache) put(fset *token.FileSet, funcDecl *ast.FuncDecl, cs *callSites) {
+	sites := make([]cachedCallSite, len(cs.args))
+	for i, args := range cs.args {
+		pos := fset.Position(cs.positions[i])
+		sites[i] = cachedCallSite{File: pos.Filename, Offset: pos.Offset, Args: make([]string, len(args)), Dynamic: cs.dynamic[cs.positions[i]]}
+		for j, t := range args {
+			if t != nil {
+				sites[i].Args[j] = types.TypeString(t, nil)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[c.funcKey(fset, funcDecl)] = sites
+	c.dirty = true
+}
+
+// save writes the cache to disk if it has been updated.
+func (c *analysisCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.filename + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.filename)
+}
@@ -0,0 +1,62 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalysisCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	open := func() (Gen, *analysisCache, *ast.FuncDecl) {
+		g := New()
+		g.CacheDir = dir
+		err := g.Loader.CreateFromFilenames("", "testdata/nested.go")
+		require.NoError(t, err)
+
+		require.NoError(t, g.load())
+
+		c, err := g.openAnalysisCache()
+		require.NoError(t, err)
+
+		var add *ast.FuncDecl
+		for _, decl := range g.program.Created[0].Files[0].Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "add" {
+				add = funcDecl
+			}
+		}
+		require.NotNil(t, add)
+
+		return *g, c, add
+	}
+
+	g, c, add := open()
+	assert.Nil(t, c.get(g.Loader.Fset, add))
+
+	cs := &callSites{
+		funcDecl:  add,
+		args:      [][]types.Type{{types.Typ[types.Int], nil}},
+		positions: []token.Pos{add.Pos()},
+		dynamic:   map[token.Pos]bool{add.Pos(): true},
+	}
+	c.put(g.Loader.Fset, add, cs)
+	require.NoError(t, c.save())
+
+	g, c, add = open()
+	cached := c.get(g.Loader.Fset, add)
+	require.NotNil(t, cached)
+	assert.Equal(t, []types.Type{types.Typ[types.Int]}, cached.typesAt(0))
+	assert.Empty(t, cached.typesAt(1))
+	assert.Equal(t, g.Loader.Fset.Position(add.Pos()), g.Loader.Fset.Position(cached.positions[0]))
+	assert.True(t, cached.dynamic[cached.positions[0]])
+}
@@ -0,0 +1,168 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// CallGraphDOT writes to w, in the Graphviz DOT language, the slice of the call graph by pointer analysis
+// feeding the type switch at the line of the file: the functions from which the enclosing function is reachable,
+// from the roots of the graph, and the calls between them.
+// A call is labelled by the types of the arguments converted to interfaces at the call site,
+// which are the types observed by Expand for the calls of the enclosing function, whose subject of the switch is marked.
+// The calls without call sites, e.g. of the synthetic root, are dashed.
+func (g Gen) CallGraphDOT(filename string, line int, w io.Writer) error {
+	err := g.initProgram(needSSA)
+	if err != nil {
+		return err
+	}
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtLine(filename, line)
+	if err != nil {
+		return err
+	}
+
+	typeSwitch := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+	paramPos := subjectParamPos(&pkg.Info, funcDecl, typeSwitch)
+
+	target, err := g.callGraphNode(funcDecl)
+	if err != nil {
+		return err
+	}
+
+	// the nodes reaching target, found backwards from it
+	nodes := map[*callgraph.Node]bool{target: true}
+	queue := []*callgraph.Node{target}
+	sliced := []*callgraph.Edge{}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		for _, e := range n.In {
+			sliced = append(sliced, e)
+			if !nodes[e.Caller] {
+				nodes[e.Caller] = true
+				queue = append(queue, e.Caller)
+			}
+		}
+	}
+
+	ids := []int{}
+	byID := map[int]*callgraph.Node{}
+	for n := range nodes {
+		ids = append(ids, n.ID)
+		byID[n.ID] = n
+	}
+	sort.Ints(ids)
+
+	graph := dotGraph{label: fmt.Sprintf("calls reaching the type switch at %s", g.Loader.Fset.Position(sw.Pos()))}
+	for _, id := range ids {
+		n := byID[id]
+		graph.nodes = append(graph.nodes, dotNode{id: n.ID, name: nodeName(n), target: n == target, root: len(n.In) == 0})
+	}
+
+	for _, e := range sliced {
+		edge := dotEdge{from: e.Caller.ID, to: e.Callee.ID, synthetic: e.Site == nil, target: e.Callee == target}
+		if e.Site != nil {
+			pos := -1
+			if e.Callee == target {
+				pos = paramPos
+			}
+			edge.label = interfaceArgTypes(calleeArgs(e), pos)
+		}
+		graph.edges = append(graph.edges, edge)
+	}
+
+	_, err = w.Write(graph.bytes())
+	return err
+}
+
+// dotGraph is the slice of the call graph rendered by CallGraphDOT.
+type dotGraph struct {
+	label string
+	nodes []dotNode
+	edges []dotEdge
+}
+
+// dotNode is a function in dotGraph, the one of the type switch if target, or a root of the call graph if root.
+type dotNode struct {
+	id           int
+	name         string
+	target, root bool
+}
+
+// dotEdge is a call in dotGraph labelled by the types of the arguments, without a call site if synthetic,
+// and calling the function of the type switch if target.
+type dotEdge struct {
+	from, to          int
+	label             string
+	synthetic, target bool
+}
+
+// bytes renders graph in the DOT language.
+func (graph dotGraph) bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph tsgen {\n")
+	fmt.Fprintf(&buf, "\tlabel=%s;\n", strconv.Quote(graph.label))
+	fmt.Fprintf(&buf, "\tnode [shape=box];\n")
+
+	for _, n := range graph.nodes {
+		attrs := []string{"label=" + strconv.Quote(n.name)}
+		if n.target {
+			attrs = append(attrs, "style=bold")
+		} else if n.root {
+			attrs = append(attrs, "shape=ellipse")
+		}
+		fmt.Fprintf(&buf, "\tn%d [%s];\n", n.id, strings.Join(attrs, ", "))
+	}
+
+	for _, e := range graph.edges {
+		attrs := []string{}
+		if e.synthetic {
+			attrs = append(attrs, "style=dashed")
+		} else {
+			attrs = append(attrs, "label="+strconv.Quote(e.label))
+			if e.target {
+				attrs = append(attrs, "style=bold")
+			}
+		}
+		fmt.Fprintf(&buf, "\tn%d -> n%d [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+// nodeName returns the name of the function of the call graph node n.
+func nodeName(n *callgraph.Node) string {
+	if n.Func == nil {
+		return "<root>"
+	}
+
+	return n.Func.String()
+}
+
+// interfaceArgTypes returns the concrete types of the arguments converted to interfaces at a call site,
+// the one of the argument of index marked with an asterisk.
+func interfaceArgTypes(args []ssa.Value, marked int) string {
+	ts := []string{}
+	for i, a := range args {
+		for _, t := range argTypes(a) {
+			s := t.String()
+			if i == marked {
+				s = "*" + s
+			}
+			ts = append(ts, s)
+		}
+	}
+
+	return strings.Join(ts, ", ")
+}
@@ -0,0 +1,43 @@
+package gen
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestDOTGraph(t *testing.T) {
+	graph := dotGraph{
+		label: "calls reaching the type switch at app/describe.go:12:2",
+		nodes: []dotNode{
+			{id: 0, name: "<root>", root: true},
+			{id: 1, name: "example.com/app.main"},
+			{id: 2, name: "example.com/app.dispatch"},
+			{id: 3, name: "example.com/app.describe", target: true},
+		},
+		edges: []dotEdge{
+			{from: 0, to: 1, synthetic: true},
+			{from: 1, to: 2, label: "int"},
+			{from: 2, to: 3, label: "*int, string", target: true},
+			{from: 1, to: 3, label: "*[]string", target: true},
+			// a recursive call with a struct tag to be quoted
+			{from: 3, to: 3, label: "*struct{Name string \"json:\\\"name\\\"\"}", target: true},
+		},
+	}
+
+	out := graph.bytes()
+
+	golden := "testdata/callgraph.dot"
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(golden, out, 0644))
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(out))
+}
@@ -0,0 +1,235 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// TemplateIssue is a template case clause whose body does not compile for the synthetic types
+// bound to its type variables by CheckTemplates, e.g. calling a method the bound of T does not have.
+type TemplateIssue struct {
+	Pos token.Position
+
+	// Pattern is the case type of the template, e.g. []T.
+	Pattern string
+
+	// Err is the first type error in the clause generated from the template,
+	// written with the names of the type variables in place of the synthetic types.
+	Err string
+}
+
+func (issue TemplateIssue) String() string {
+	return fmt.Sprintf("%s: %s", issue.Pos, issue.message())
+}
+
+func (issue TemplateIssue) message() string {
+	return fmt.Sprintf("template case %s does not compile: %s", issue.Pattern, issue.Err)
+}
+
+// Diagnostic returns the issue as a Diagnostic of RuleInvalidTemplate, e.g. for SARIF reports.
+func (issue TemplateIssue) Diagnostic() Diagnostic {
+	return Diagnostic{Pos: issue.Pos, Msg: issue.message(), Rule: RuleInvalidTemplate}
+}
+
+// CheckTemplates type-checks the template case clauses of the type switches in the program against synthetic types,
+// to find the bodies which cannot compile for any type before a caller passes one. Each template is applied
+// with its type variables bound to new struct types, which have the methods of the bounds of the type variables
+// by embedding them, or of the interface switched on for a pattern of the type variable itself, e.g. case T:.
+// The length variables of array patterns are bound to 1.
+//
+// The clauses generated so are type-checked in place, after the templates, and the type errors in them are reported.
+// The templates need not compile as they are, e.g. calling a method of the interface switched on for T.
+func (g Gen) CheckTemplates() ([]TemplateIssue, error) {
+	// the errors in the templates are found again in the clauses generated, and the others are not of interest
+	g.Loader.AllowErrors = true
+	g.Loader.TypeChecker.Error = func(err error) {}
+
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := append([]*loader.PackageInfo{}, g.program.Created...)
+	for _, pkg := range g.program.Imported {
+		pkgs = append(pkgs, pkg)
+	}
+
+	issues := []TemplateIssue{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			fileIssues, err := g.checkFileTemplates(pkg, file)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, fileIssues...)
+		}
+	}
+
+	return issues, nil
+}
+
+// syntheticTemplate is a template applied with its type variables bound to synthetic types.
+type syntheticTemplate struct {
+	stmt *TypeSwitchStmt
+	tmpl Template
+
+	// names maps the names of the synthetic types to the names of the type variables they are bound to.
+	names map[string]string
+}
+
+// checkFileTemplates checks the templates of the type switches in file of pkg by CheckTemplates.
+func (g Gen) checkFileTemplates(pkg *loader.PackageInfo, file *ast.File) ([]TemplateIssue, error) {
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+	var (
+		synthetics []*syntheticTemplate
+		edits      []sourceEdit
+		decls      bytes.Buffer
+	)
+
+	tf := g.tokenFile(file)
+
+	forTypeSwitchStmt(file, func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, imports: imports}
+
+		x, _ := typeSwitchSubject(sw)
+		subject, _ := pkg.TypeOf(x).(*types.Named)
+
+		for _, tmpl := range stmt.templates() {
+			expr := tmpl.Clause.List[tmpl.index]
+			if len(g.exprTypeVariables(stmt, expr)) == 0 {
+				continue
+			}
+
+			st := &syntheticTemplate{stmt: stmt, tmpl: tmpl, names: map[string]string{}}
+			m := Bindings{}
+
+			for _, name := range lengthVariables(expr, &pkg.Info) {
+				m[name] = ArrayLen(1)
+			}
+
+			ast.Inspect(expr, func(node ast.Node) bool {
+				ident, ok := node.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				tn, ok := pkg.Uses[ident].(*types.TypeName)
+				if !ok {
+					return true
+				}
+				named, ok := tn.Type().(*types.Named)
+				if !ok || !g.isTypeVariable(named) || m[ident.Name] != nil {
+					return true
+				}
+
+				// a struct type with the methods the type variable is known to have
+				var embedded types.Type
+				if typeVariableBound(named) != nil {
+					embedded = named
+				} else if ident == expr && subject != nil && types.NewMethodSet(subject).Len() > 0 {
+					embedded = subject
+				}
+
+				synthName := fmt.Sprintf("tsgenCheck%d%s", len(synthetics), ident.Name)
+				st.names[synthName] = ident.Name
+				m[ident.Name] = types.NewNamed(types.NewTypeName(token.NoPos, pkg.Pkg, synthName, nil), types.NewStruct(nil, nil), nil)
+
+				if embedded != nil {
+					fmt.Fprintf(&decls, "\n\ntype %s struct{ %s }\n", synthName, types.TypeString(embedded, imports.qualifier))
+				} else {
+					fmt.Fprintf(&decls, "\n\ntype %s struct{}\n", synthName)
+				}
+
+				return true
+			})
+
+			clause := tmpl.apply(m, imports.qualifier)
+			end := tf.Offset(g.clauseEnd(stmt, tmpl.Clause))
+			edits = append(edits, sourceEdit{start: end, end: end, text: []byte("\n" + g.showNode(clause))})
+			synthetics = append(synthetics, st)
+		}
+
+		return nil
+	})
+
+	if len(synthetics) == 0 {
+		return nil, nil
+	}
+
+	src, err := g.fileSource(file)
+	if err != nil {
+		return nil, err
+	}
+	edits = append(edits, sourceEdit{start: len(src), end: len(src), text: decls.Bytes()})
+
+	newFile, _, typeErrors, err := g.typeCheckSource(pkg, file, applyEdits(src, edits), imports.fix)
+	if err != nil {
+		return nil, err
+	}
+
+	// the generated clauses, by the synthetic types in their case types
+	generated := map[*ast.CaseClause]*syntheticTemplate{}
+	ast.Inspect(newFile, func(node ast.Node) bool {
+		clause, ok := node.(*ast.CaseClause)
+		if !ok || len(clause.List) == 0 {
+			return true
+		}
+
+		ast.Inspect(clause.List[0], func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				for _, st := range synthetics {
+					if _, ok := st.names[ident.Name]; ok {
+						generated[clause] = st
+					}
+				}
+			}
+			return true
+		})
+
+		return true
+	})
+
+	issues := []TemplateIssue{}
+	reported := map[*syntheticTemplate]bool{}
+	for _, terr := range typeErrors {
+		// a case of a type not implementing the interface switched on, which the actual types do
+		if strings.Contains(terr.Msg, "impossible type switch case") {
+			continue
+		}
+
+		for clause, st := range generated {
+			if terr.Pos < clause.Pos() || clause.End() <= terr.Pos || reported[st] {
+				continue
+			}
+			reported[st] = true
+
+			msg := terr.Msg
+			for synthName, name := range st.names {
+				msg = strings.Replace(msg, synthName, name, -1)
+			}
+
+			issues = append(issues, TemplateIssue{
+				Pos:     g.Loader.Fset.Position(st.tmpl.Clause.Pos()),
+				Pattern: types.ExprString(st.tmpl.Clause.List[st.tmpl.index]),
+				Err:     msg,
+			})
+		}
+	}
+
+	sort.Sort(byTemplateIssuePos(issues))
+
+	return issues, nil
+}
+
+type byTemplateIssuePos []TemplateIssue
+
+func (s byTemplateIssuePos) Len() int           { return len(s) }
+func (s byTemplateIssuePos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTemplateIssuePos) Less(i, j int) bool { return s[i].Pos.Offset < s[j].Pos.Offset }
@@ -0,0 +1,34 @@
+package gen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTemplates(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/checktemplates.go")
+	require.NoError(t, err)
+
+	issues, err := g.CheckTemplates()
+	require.NoError(t, err)
+
+	for _, issue := range issues {
+		t.Log(issue)
+	}
+
+	require.Len(t, issues, 2)
+
+	assert.Equal(t, 21, issues[0].Pos.Line)
+	assert.Equal(t, "map[string]S", issues[0].Pattern)
+	assert.Contains(t, issues[0].Err, "Len")
+	assert.Contains(t, issues[0].String(), "template case map[string]S does not compile: ")
+	assert.NotContains(t, issues[0].Err, "tsgenCheck")
+
+	assert.Equal(t, 24, issues[1].Pos.Line)
+	assert.Equal(t, "[]T", issues[1].Pattern)
+	assert.Contains(t, issues[1].Err, "not an interface")
+	assert.Equal(t, RuleInvalidTemplate, issues[1].Diagnostic().Rule)
+}
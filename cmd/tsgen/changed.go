@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// parseChangedFiles parses the value of -changed, which is either a comma-separated list of files
+// or "git" to detect the files modified or untracked in the git work tree of path.
+func parseChangedFiles(value, path string) ([]string, error) {
+	if value == "git" {
+		dir := path
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		return gitChangedFiles(dir)
+	}
+
+	files := []string{}
+	for _, f := range strings.Split(value, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+func gitChangedFiles(dir string) ([]string, error) {
+	git := func(args ...string) ([]string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(bytes.TrimSpace(out))), nil
+	}
+
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil || len(top) == 0 {
+		return nil, err
+	}
+
+	modified, err := git("diff", "--name-only", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := git("ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, f := range append(modified, untracked...) {
+		files = append(files, filepath.Join(top[0], filepath.FromSlash(f)))
+	}
+
+	return files, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go/build"
+	"go/parser"
+	"go/token"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+const repoImportPath = "github.com/motemen/go-typeswitch-gen"
+
+// defaultExamplesDir returns the _example directory of the tsgen source.
+func defaultExamplesDir() (string, error) {
+	pkg, err := build.Import(repoImportPath, "", build.FindOnly)
+	if err != nil {
+		return "", fmt.Errorf("could not find examples: %s", err)
+	}
+
+	return filepath.Join(pkg.Dir, "_example"), nil
+}
+
+// runDemo copies each example under dir into a temporary directory, expands the files
+// which have "//go:generate tsgen" directives, prints them before and after the expansion
+// and runs the example (or its tests if not a main package).
+// It fails if any of the examples fail.
+func runDemo(dir string, w io.Writer) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir("", "tsgen-demo")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	failed := []string{}
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			continue
+		}
+
+		fmt.Fprintf(w, "# %s\n", fi.Name())
+
+		err := runDemoExample(filepath.Join(dir, fi.Name()), filepath.Join(tmp, fi.Name()), w)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL: %s: %s\n", fi.Name(), err)
+			failed = append(failed, fi.Name())
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("examples failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func runDemoExample(src, dest string, w io.Writer) error {
+	err := os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+
+	filenames, err := listGoFiles(src)
+	if err != nil {
+		return err
+	}
+
+	copied := []string{}
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, filepath.Base(filename))
+		err = ioutil.WriteFile(target, data, 0644)
+		if err != nil {
+			return err
+		}
+
+		copied = append(copied, target)
+	}
+
+	isMain := false
+	for _, filename := range copied {
+		args, pkgName, err := generateDirectives(filename)
+		if err != nil {
+			return err
+		}
+
+		isMain = isMain || pkgName == "main"
+
+		for _, arg := range args {
+			if len(arg) < 2 || arg[0] != "-w" || arg[1] != "expand" {
+				fmt.Fprintf(w, "skipping directive: tsgen %s\n", strings.Join(arg, " "))
+				continue
+			}
+
+			before, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+
+			err = demoExpand(filename)
+			if err != nil {
+				return err
+			}
+
+			after, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(w, "## %s (before)\n%s\n", filepath.Base(filename), before)
+			fmt.Fprintf(w, "## %s (after)\n%s\n", filepath.Base(filename), after)
+		}
+	}
+
+	goFiles := []string{}
+	for _, filename := range copied {
+		if isMain && strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		goFiles = append(goFiles, filepath.Base(filename))
+	}
+
+	var cmd *exec.Cmd
+	if isMain {
+		fmt.Fprintf(w, "## go run\n")
+		cmd = exec.Command("go", append([]string{"run"}, goFiles...)...)
+	} else {
+		fmt.Fprintf(w, "## go test\n")
+		cmd = exec.Command("go", append([]string{"test", "-v"}, goFiles...)...)
+	}
+	cmd.Dir = dest
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	return cmd.Run()
+}
+
+// generateDirectives returns the arguments of "//go:generate tsgen" directives in the file
+// and its package name.
+func generateDirectives(filename string) ([][]string, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), filename, data, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := [][]string{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "//go:generate" && fields[1] == "tsgen" {
+			args = append(args, fields[2:])
+		}
+	}
+
+	return args, file.Name.Name, s.Err()
+}
+
+// demoExpand expands the file in place, as "tsgen -w expand <file>".
+// The errors writing it are returned on Close, failing the expansion.
+func demoExpand(target string) error {
+	g := gen.New()
+	g.FileWriter = func(filename string) io.WriteCloser {
+		if filename != target {
+			return nil
+		}
+
+		return gen.NewFileReplacer(target)
+	}
+
+	return doExpand(g, target, "")
+}
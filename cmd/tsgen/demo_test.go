@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDemo(t *testing.T) {
+	var out bytes.Buffer
+	err := runDemo("testdata/demo", &out)
+	t.Log(out.String())
+
+	// the examples are run in order, and the failed ones are reported at last
+	if assert.Error(t, err) {
+		assert.Equal(t, "examples failed: fail", err.Error())
+	}
+
+	result := out.String()
+	assert.Contains(t, result, "# fail\n## go run\n")
+	assert.Contains(t, result, "FAIL: fail: exit status 1\n")
+
+	assert.Contains(t, result, "# ok\n## main.go (before)\n//go:generate tsgen -w expand $GOFILE\n")
+	assert.Contains(t, result, "## main.go (after)\n")
+	assert.Contains(t, result, "\tcase int:\n")
+	assert.Contains(t, result, "skipping directive: tsgen -w sort $GOFILE\n## go run\nint string\n")
+	assert.NotContains(t, result, "FAIL: ok")
+}
+
+func TestDemoExpand_ReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the permissions are not enforced for root")
+	}
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	src, err := ioutil.ReadFile("testdata/demo/ok/main.go")
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "main.go")
+	require.NoError(t, ioutil.WriteFile(filename, src, 0644))
+
+	require.NoError(t, os.Chmod(dir, 0555))
+	defer os.Chmod(dir, 0755)
+
+	err = demoExpand(filename)
+	assert.Error(t, err)
+}
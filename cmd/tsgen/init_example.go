@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"go/build"
+)
+
+// exampleFiles are the templates of files generated by "init-example" mode,
+// a copy of _example/keys wired with go:generate directives and a check target.
+var exampleFiles = map[string]string{
+	"keys.go": `//go:generate tsgen -w expand $GOFILE
+//go:generate goimports -w $GOFILE
+
+package main
+
+import "fmt"
+
+// T is a type variable, which is replaced by concrete types on expansion.
+type T interface{}
+
+func keys(m interface{}) []string {
+	switch m := m.(type) {
+	case map[string]T:
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		return keys
+	default:
+		panic(fmt.Sprintf("unexpected type: %T", m))
+	}
+}
+`,
+	"main.go": `package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	intMap := map[string]int{
+		"foo": 1,
+		"bar": 2,
+	}
+	boolMap := map[string]bool{
+		"a": true,
+		"b": false,
+	}
+
+	fmt.Println(keys(intMap))
+	fmt.Println(keys(boolMap))
+}
+`,
+	"Makefile": `generate:
+	go generate {{.ImportPath}}
+
+run: generate
+	go run $(shell go list -f '{{"{{"}}join .GoFiles " "{{"}}"}}' {{.ImportPath}})
+
+# check fails if the generated code is not up to date.
+check: generate
+	git diff --exit-code .
+`,
+	"README": `This is an example of tsgen, {{.ImportPath}}.
+
+Edit the template case clause in keys.go or the calls in main.go, then run below:
+
+    make generate  # expand type switches
+    make run       # expand and run
+    make check     # fail if expanded code is not committed
+`,
+}
+
+// initExample writes an example package into dir, which must not contain the files to be generated.
+func initExample(dir string) error {
+	importPath, err := importPathOf(dir)
+	if err != nil {
+		return err
+	}
+
+	for name := range exampleFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(dir, name))
+		}
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data := struct{ ImportPath string }{importPath}
+
+	names := []string{}
+	for name := range exampleFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		text := exampleFiles[name]
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		err = tmpl.Execute(f, data)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(os.Stderr, "created", filepath.Join(dir, name))
+	}
+
+	return nil
+}
+
+// importPathOf returns the import path of the package in dir,
+// determined by the nearest go.mod or else by GOPATH.
+func importPathOf(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for d := dir; ; d = filepath.Dir(d) {
+		if modPath := readModulePath(filepath.Join(d, "go.mod")); modPath != "" {
+			rel, err := filepath.Rel(d, dir)
+			if err != nil {
+				return "", err
+			}
+			if rel == "." {
+				return modPath, nil
+			}
+			return modPath + "/" + filepath.ToSlash(rel), nil
+		}
+
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(gopath, "src")
+		rel, err := filepath.Rel(src, dir)
+		if err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+
+	return "", fmt.Errorf("could not determine import path of %s: not in a module nor GOPATH", dir)
+}
+
+// readModulePath returns the module path declared in the go.mod file,
+// or "" if the file does not exist or has no module directive.
+func readModulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
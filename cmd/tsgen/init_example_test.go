@@ -0,0 +1,96 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tempDir creates a temporary directory with the subdirectories subdirs,
+// returning its path with the symlinks resolved and a function removing it.
+func tempDir(t *testing.T, subdirs ...string) (string, func()) {
+	tmp, err := ioutil.TempDir("", "tsgen")
+	require.NoError(t, err)
+
+	dir, err := filepath.EvalSymlinks(tmp)
+	require.NoError(t, err)
+
+	for _, d := range subdirs {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0777))
+	}
+
+	return dir, func() { os.RemoveAll(tmp) }
+}
+
+// chdir changes the working directory to dir, returning a function restoring it.
+func chdir(t *testing.T, dir string) func() {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+
+	return func() { os.Chdir(wd) }
+}
+
+func TestImportPathOf_Module(t *testing.T) {
+	dir, cleanup := tempDir(t, "x/y")
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0666))
+
+	defer chdir(t, filepath.Join(dir, "x"))()
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{"./y", "example.com/m/x/y"},
+		{"y", "example.com/m/x/y"},
+		{".", "example.com/m/x"},
+		{"..", "example.com/m"},
+		{filepath.Join(dir, "x", "y"), "example.com/m/x/y"},
+	}
+
+	for _, test := range tests {
+		path, err := importPathOf(test.dir)
+		if assert.NoError(t, err, test.dir) {
+			assert.Equal(t, test.expected, path, test.dir)
+		}
+	}
+}
+
+func TestImportPathOf_GOPATH(t *testing.T) {
+	dir, cleanup := tempDir(t, "src/github.com/a/b", "outside")
+	defer cleanup()
+
+	defer func(gopath string) { build.Default.GOPATH = gopath }(build.Default.GOPATH)
+	build.Default.GOPATH = dir
+
+	defer chdir(t, filepath.Join(dir, "src", "github.com", "a"))()
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{"./b", "github.com/a/b"},
+		{".", "github.com/a"},
+		{filepath.Join(dir, "src", "github.com", "a", "b"), "github.com/a/b"},
+	}
+
+	for _, test := range tests {
+		path, err := importPathOf(test.dir)
+		if assert.NoError(t, err, test.dir) {
+			assert.Equal(t, test.expected, path, test.dir)
+		}
+	}
+
+	_, err := importPathOf("../../../outside")
+	assert.Error(t, err)
+
+	_, err = importPathOf("../..")
+	assert.Error(t, err, "GOPATH/src itself")
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+const interactiveHelp = `y - apply this expansion
+n - do not apply this expansion
+e - edit the expanded statement before applying it
+a - apply this and all the remaining expansions
+q - quit; do not apply this or any of the remaining expansions
+? - print help
+`
+
+// interactive confirms the expansions proposed one by one, printing each as a diff and prompting
+// whether to apply it, as git add -p does. It is set as Gen.Confirm.
+type interactive struct {
+	in    *bufio.Reader
+	out   io.Writer
+	color bool
+
+	// all and quit are set by the answers applying or skipping the remaining expansions.
+	all  bool
+	quit bool
+}
+
+// newInteractive creates an interactive prompting on stderr, colored if it is a terminal unless $NO_COLOR is set.
+func newInteractive() *interactive {
+	color := os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	if fi, err := os.Stderr.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		color = false
+	}
+
+	return &interactive{in: bufio.NewReader(os.Stdin), out: os.Stderr, color: color}
+}
+
+func (ia *interactive) confirm(p gen.Proposal) ([]byte, error) {
+	if ia.quit {
+		return nil, nil
+	}
+	if ia.all {
+		return p.New, nil
+	}
+
+	ia.printDiff(p)
+
+	for {
+		fmt.Fprint(ia.out, ia.paint(colorBold, "Apply this expansion [y,n,e,a,q,?]? "))
+
+		answer, err := ia.in.ReadString('\n')
+		if err != nil && answer == "" {
+			if err == io.EOF {
+				// no more answers; leave the rest as they are
+				fmt.Fprintln(ia.out)
+				ia.quit = true
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		switch strings.TrimSpace(answer) {
+		case "y":
+			return p.New, nil
+
+		case "n":
+			return nil, nil
+
+		case "e":
+			text, err := editText(p.New)
+			if err != nil {
+				return nil, err
+			}
+			if len(bytes.TrimSpace(text)) == 0 {
+				// emptied; not applied as git add -p does
+				return nil, nil
+			}
+			return text, nil
+
+		case "a":
+			ia.all = true
+			return p.New, nil
+
+		case "q":
+			ia.quit = true
+			return nil, nil
+
+		default:
+			fmt.Fprint(ia.out, ia.paint(colorRed, interactiveHelp))
+		}
+	}
+}
+
+// printDiff prints the lines of p.Old removed and of p.New added, headed by the position and the function.
+func (ia *interactive) printDiff(p gen.Proposal) {
+	fmt.Fprintln(ia.out, ia.paint(colorCyan, fmt.Sprintf("%s: type switch in %s", p.Pos, p.Func)))
+
+	for _, l := range diffLines(splitLines(p.Old), splitLines(p.New)) {
+		switch l.op {
+		case '-':
+			fmt.Fprintln(ia.out, ia.paint(colorRed, "-"+l.text))
+		case '+':
+			fmt.Fprintln(ia.out, ia.paint(colorGreen, "+"+l.text))
+		default:
+			fmt.Fprintln(ia.out, " "+l.text)
+		}
+	}
+}
+
+func (ia *interactive) paint(color, s string) string {
+	if !ia.color {
+		return s
+	}
+
+	return color + s + colorReset
+}
+
+// editText lets the user edit text in $EDITOR (vi by default), returning the text saved.
+func editText(text []byte) ([]byte, error) {
+	f, err := ioutil.TempFile("", "tsgen-edit")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(text)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", editor[0], err)
+	}
+
+	return ioutil.ReadFile(f.Name())
+}
+
+// diffLine is a line of a diff, whose op is '-' if removed, '+' if added, or ' ' if common.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the diff from a to b by their longest common subsequence of lines.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
+
+func splitLines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
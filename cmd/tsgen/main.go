@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"go/build"
@@ -35,12 +36,44 @@ func (nc noCloser) Close() error {
 	return nil
 }
 
-var usage = `Usage: %s [-w] [-main <pkg>] [-verbose] <mode> <file>
+var usage = `Usage: %s [-w] [-l] [-backup] [-output-dir <dir>] [-archive <dir>|<file>.tar] [-main <pkg>] [-root <func>]... [-tags <tags>] [-local <prefixes>] [-tabs=false] [-tabwidth <n>] [-sort-by <strategy>] [-sort-values <strategy>] [-priority <interfaces>] [-features <names>] [-match-mode <mode>] [-banners] [-max-cases <n>] [-max-total-cases <n>] [-truncate] [-strict] [-lint] [-nested-product] [-nested-product-max <n>] [-merge-cases] [-line-directives] [-provenance] [-annotate <comment>] [-tests] [-templates <mode>] [-default-panic] [-errors-as] [-implements] [-dynamic-flow] [-registry <funcs>] [-rewrite-calls] [-dispatch-table <n>] [-owners <CODEOWNERS>] [-coverage] [-concurrency <n>] [-low-memory] [-cache <dir>] [-metrics <file>] [-changed <files>|git] [-funcs <names>] [-include <patterns>] [-exclude <patterns>] [-validate] [-skip-invalid] [-sarif <file>] [-verbose] <mode> <file>
 
 Modes:
-  expand:   expand generic case clauses in type switch statements by its actual arguments
+  expand:   expand generic case clauses in type switch statements by its actual arguments,
+            with -i confirming each expansion shown as a diff (usage: expand [-i] <file>)
+  assert:   expand type assertions with type variables, e.g. y := x.(map[string]T), into if statements asserting the actual arguments
   sort:     sort case clauses in type switch statements
   scaffold: generate stub case clauses based on types that implement subject interface
+  specialize: generate a specialized function per argument type of the type switches, dispatched from the originals
+  instantiate: generate the instances of template functions requested by "+tsgen instantiate" directives, across packages
+  explain:  explain how the type switch at -pos <file>:<line> would be expanded (usage: explain -pos <file>:<line>)
+  callgraph: print the slice of the call graph from its roots to the function of the type switch at -pos <file>:<line> in DOT,
+            with the calls labelled by the types of their interface arguments (usage: callgraph -pos <file>:<line>)
+  visitor:  rewrite the type switch at -pos <file>:<line> on an interface into a visitor interface, its Accept function and implementation
+            (usage: visitor -pos <file>:<line>)
+  to-generic: rewrite the function of the type switch at -pos <file>:<line> into a generic function constrained by the union
+            of the case types, keeping the original as a deprecated wrapper with -wrapper (usage: to-generic [-wrapper] -pos <file>:<line>)
+  from-generic: rewrite the generic function at -pos <file>:<line> into a type switch on the types it is instantiated with
+            in the program, the reverse of to-generic (usage: from-generic -pos <file>:<line>)
+  migrate:  report case clauses and assertions on -iface <interface> which fail to compile, optionally rewriting them with -snippet
+            (usage: migrate -iface <interface> [-snippet <stmts>] <file>)
+  consistency: report type switches on the same named interface whose case types differ, adding the missing cases with -fix
+            (usage: consistency [-fix] <file>)
+  check-templates: type-check the template case clauses applied to synthetic types for their type variables,
+            reporting the ones which would not compile for any type, before a caller passes one
+  list:     list the type switches in the package of <file> (a directory, or <dir>/... for all under it) with their subjects,
+            numbers of cases and whether they are expandable
+  stats:    report the numbers of type switches per package, a histogram of their numbers of cases, and the interfaces
+            switched on and case types most common in the packages as in list mode (usage: stats [-top <n>] <file>)
+  spec:     check the pattern matching semantics against a spec file (see testdata/spec/match.spec)
+  spec-doc: print a spec file as an AsciiDoc document
+  pre-commit: expand the type switches in the staged files only, whose paths relative to <file> (a directory) are read from stdin,
+            failing listing the files changed, rewritten with -w (usage: git diff --cached --name-only | tsgen [-w] pre-commit <dir>)
+  watch:    re-expand type switches of the package in <file> (a directory, or <dir>/... for all under it) on every change
+  serve:    keep the program of <file> (or -main) loaded and analyzed, answering JSON-RPC requests to expand the type switch at
+            a position or list the type switches of a package over a unix socket (usage: serve [-socket <path>] <file>)
+  demo:     expand and run the bundled examples (or the ones in <file>, a directory) in a temporary directory, printing them before and after expansion
+  init-example: create an example package in <file> (a directory) to start with
 
 Flags:
 `
@@ -52,17 +85,94 @@ func init() {
 	}
 }
 
+// stringsFlag is a flag which can be given more than once, collecting the values given.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
 func main() {
 	var err error
+	var roots stringsFlag
+	flag.Var(&roots, "root", "function called as an entry point of the program by pointer analysis instead of main, e.g. lib.HandleRequest or lib.(*Worker).Run; can be given more than once")
 	var (
 		overwrite = flag.Bool("w", false, "write result to (source) file instead of stdout")
+		listOnly  = flag.Bool("l", false, "list the files whose contents would change instead of printing the result, as gofmt -l")
+		archive   = flag.String("archive", "", "collect the results and their manifest of digests into this directory, or tar file if it ends with .tar, instead of stdout")
+		outDir    = flag.String("output-dir", "", "write the results under this directory, mirroring the layout of the module, instead of stdout")
 		verbose   = flag.Bool("verbose", false, "log verbose")
+		backup    = flag.Bool("backup", false, "with -w, keep the original file as <file>.orig")
 		main      = flag.String("main", "", "entrypoint package")
+		local     = flag.String("local", "", "comma-separated import path prefixes whose imports are grouped after third-party ones, as goimports -local")
+		useTabs   = flag.Bool("tabs", true, "indent with tabs, or with -tabwidth spaces if false, as gofmt -tabs did")
+		tabWidth  = flag.Int("tabwidth", 8, "tab width the alignment is computed with, as gofmt -tabwidth did")
+		tags      = flag.String("tags", "", "comma-separated build tags to load the files with, along with $GOOS, $GOARCH and $CGO_ENABLED")
+		banners   = flag.Bool("banners", false, "group sorted cases under comment banners of interfaces in sort mode")
+		maxCases  = flag.Int("max-cases", 0, "max number of cases expanded per type switch (0 for no limit)")
+		maxTotal  = flag.Int("max-total-cases", 0, "max number of cases expanded in total (0 for no limit)")
+		validate  = flag.Bool("validate", false, "type-check expanded files before writing, failing if any generated case does not compile")
+		skipBad   = flag.Bool("skip-invalid", false, "with -validate, skip generated cases which do not compile with warnings instead of failing")
+		sarif     = flag.String("sarif", "", "write the diagnostics of expand, specialize, consistency and migrate modes, and the files whose generated code is out of date, to this file as SARIF, e.g. for GitHub code scanning")
+		changed   = flag.String("changed", "", "comma-separated files to rewrite, leaving others as they are, or \"git\" for the files changed in the work tree")
+		funcs     = flag.String("funcs", "", "comma-separated functions whose type switches are expanded, e.g. lib.Foo, (*T).Method, lib.* or re:<regexp> (all if empty)")
+		include   = flag.String("include", "", "comma-separated path patterns (globs with **, or re:<regexp>) of the files to rewrite")
+		exclude   = flag.String("exclude", "", "comma-separated path patterns (globs with **, or re:<regexp>) of the files not to rewrite")
+		cacheDir  = flag.String("cache", "", "directory to cache the analysis in, skipping it while the sources are unchanged")
+		parallel  = flag.Int("concurrency", 1, "number of files rewritten concurrently")
+		metrics   = flag.String("metrics", "", "write the times of the analysis and of each type switch expanded, with the numbers of types inferred, matched and expanded, to this file in the Prometheus text format")
+		lowMem    = flag.Bool("low-memory", false, "analyze only the packages on the import paths from -main to the files rewritten, releasing each package once rewritten, for large programs")
+		coverage  = flag.Bool("coverage", false, "report the argument types each template matched, unused templates and the types matching no template")
+		owners    = flag.String("owners", "", "CODEOWNERS file to report the owners of the call sites contributed each expanded case")
+		product   = flag.Bool("nested-product", false, "expand nested type switches by the full product of argument types instead of observed combinations")
+		prodMax   = flag.Int("nested-product-max", 0, "with -nested-product, max number of type pairs of a nested type switch, beyond which only observed combinations are expanded (0 for no limit)")
+		lineDirs  = flag.Bool("line-directives", false, "attribute the bodies of expanded cases to their templates with //line directives, e.g. for panics and debuggers")
+		annotate  = flag.String("annotate", "", "comment put above each expanded type switch for linters, e.g. //exhaustive:enforce, as a text/template with .Subject and .Type")
+		prov      = flag.Bool("provenance", false, "precede each expanded case with a comment noting its template, the types bound, the call sites and the version of tsgen")
+		merge     = flag.Bool("merge-cases", false, "merge expanded cases with identical bodies into multi-type case clauses")
+		panicDef  = flag.Bool("default-panic", false, "add a default clause panicking with the unexpected type to expanded type switches without one")
+		registry  = flag.String("registry", "", "comma-separated registration functions whose calls register types for type switches, as func[:arg][=switch], e.g. encoding/gob.Register or RegisterHandler:1=lib.handle")
+		errorsAs  = flag.Bool("errors-as", false, "expand type switches on errors into errors.As checks, matching wrapped errors too")
+		rewrite   = flag.Bool("rewrite-calls", false, "with specialize mode, rewrite calls with arguments of the specialized types to call the specializations")
+		tableMin  = flag.Int("dispatch-table", 0, "with specialize mode, dispatch by a table of reflect.Type for functions with this many specializations or more (0 to disable)")
+		genTests  = flag.Bool("tests", false, "generate a test file <file>_tsgen_test.go calling the function of each expanded case with a zero value")
+		templates = flag.String("templates", "keep", "what to do with template cases after expansion: keep, comment, delete or fallback")
+		dynFlow   = flag.Bool("dynamic-flow", false, "expand type switches of functions called through interface methods or function values by the types pointer analysis finds their subjects may have too")
+		impls     = flag.Bool("implements", false, "expand interface templates with type variables in their method sets, e.g. interface{ Scan(T) error }, by all the types of the program implementing them")
+		strict    = flag.Bool("strict", false, "fail if an argument type matches no template of a type switch with templates")
+		lint      = flag.Bool("lint", false, "fail if a type switch without default clause has no case for an argument type, or has a case never matching as a case before it matches all of its values")
+		truncate  = flag.Bool("truncate", false, "truncate cases exceeding the limits with warnings instead of failing")
+		features  = flag.String("features", "", "comma-separated experimental features to enable ("+strings.Join(gen.FeatureNames(), ", ")+")")
+		matchMode = flag.String("match-mode", "named", "how named types match patterns: by their names (named), underlying types (underlying) or both (either)")
+		priority  = flag.String("priority", "", "interface priority for sort mode, e.g. \"io.Reader > fmt.Stringer\"")
+		sortBy    = flag.String("sort-by", "popularity", "sort strategy for sort mode ("+strings.Join(gen.CaseSorterNames(), ", ")+")")
+		sortVals  = flag.String("sort-values", "", "sort value switches with constant cases too in sort mode by this strategy ("+strings.Join(gen.ValueSorterNames(), ", ")+")")
 	)
 	flag.Parse()
 
+	if *tags != "" {
+		// the files listed and loaded are matched with build.Default
+		build.Default.BuildTags = strings.Split(*tags, ",")
+	}
+
 	args := flag.Args()
 
+	if len(args) >= 1 && args[0] == "demo" {
+		dir := ""
+		if len(args) >= 2 {
+			dir = args[1]
+		} else {
+			dir, err = defaultExamplesDir()
+			dieIf(err)
+		}
+
+		dieIf(runDemo(dir, os.Stdout))
+		return
+	}
+
 	if len(args) < 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -70,51 +180,742 @@ func main() {
 
 	mode := args[0]
 
+	var line int
+	var wrapper bool
+	if mode == "explain" || mode == "visitor" || mode == "callgraph" || mode == "to-generic" || mode == "from-generic" {
+		fs := flag.NewFlagSet(mode, flag.ExitOnError)
+		what := "type switch"
+		if mode == "from-generic" {
+			what = "generic function"
+		}
+		pos := fs.String("pos", "", "position of the "+what+" to "+mode+", in the form of <file>:<line>")
+		if mode == "to-generic" {
+			fs.BoolVar(&wrapper, "wrapper", false, "keep the original function as a deprecated wrapper of the generic function")
+		}
+		fs.Parse(args[1:])
+
+		var file string
+		file, line, err = splitFileLine(*pos)
+		dieIf(err)
+
+		args = []string{mode, file}
+	}
+
+	var iface, snippet string
+	if mode == "migrate" {
+		fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+		fs.StringVar(&iface, "iface", "", "name of the interface whose method set changed, e.g. io.Reader")
+		fs.StringVar(&snippet, "snippet", "", "Go statements to replace failing case bodies with (text/template with .Interface, .Type and .Var)")
+		fs.Parse(args[1:])
+
+		if iface == "" || fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		args = []string{mode, fs.Arg(0)}
+	}
+
+	var fix bool
+	if mode == "consistency" {
+		fs := flag.NewFlagSet("consistency", flag.ExitOnError)
+		fs.BoolVar(&fix, "fix", false, "add the missing case clauses to the type switches")
+		fs.Parse(args[1:])
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		args = []string{mode, fs.Arg(0)}
+	}
+
+	var interactively bool
+	if mode == "expand" {
+		fs := flag.NewFlagSet("expand", flag.ExitOnError)
+		fs.BoolVar(&interactively, "i", false, "show each expansion as a diff and prompt whether to apply, skip or edit it")
+		fs.Parse(args[1:])
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		args = []string{mode, fs.Arg(0)}
+	}
+
+	var socket string
+	if mode == "serve" {
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		fs.StringVar(&socket, "socket", "", "path of the unix socket to listen on (default: .tsgen.sock in the directory of the package)")
+		fs.Parse(args[1:])
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		args = []string{mode, fs.Arg(0)}
+	}
+
+	top := 10
+	if mode == "stats" {
+		fs := flag.NewFlagSet("stats", flag.ExitOnError)
+		fs.IntVar(&top, "top", 10, "number of the interfaces and case types reported (0 for all)")
+		fs.Parse(args[1:])
+
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		args = []string{mode, fs.Arg(0)}
+	}
+
 	target := args[1]
 	target, err = filepath.Abs(target)
 	dieIf(err)
 
+	if mode == "init-example" {
+		dieIf(initExample(target))
+		return
+	}
+
+	// newGen creates a Gen configured by the flags
+	newGen := func() *gen.Gen {
+		g := gen.New()
+		g.Verbose = *verbose
+
+		g.Features, err = gen.ParseFeatures(*features)
+		dieIf(err)
+
+		g.MatchMode, err = gen.ParseMatchMode(*matchMode)
+		dieIf(err)
+
+		g.TemplateMode, err = gen.ParseTemplateMode(*templates)
+		dieIf(err)
+
+		if *coverage {
+			g.CoverageReport = os.Stderr
+		}
+		if *owners != "" {
+			g.Owners, err = gen.ReadOwners(*owners)
+			dieIf(err)
+			g.OwnersReport = os.Stderr
+		}
+
+		g.Concurrency = *parallel
+		g.LowMemory = *lowMem
+		if *metrics != "" {
+			g.Metrics = &gen.Metrics{}
+		}
+		g.CacheDir = *cacheDir
+		g.OutputDir = *outDir
+
+		dir := target
+		if fi, err := os.Stat(target); err != nil || !fi.IsDir() {
+			dir = filepath.Dir(target)
+		}
+		g.Modules, err = gen.LoadModules(dir)
+		dieIf(err)
+
+		// the features enabled for the repository, along with the ones of -features
+		repoFeatures, err := gen.LoadFeatures(dir)
+		dieIf(err)
+		for f := range repoFeatures {
+			g.Features[f] = true
+		}
+		g.Validate = *validate
+		g.SkipInvalidCases = *skipBad
+
+		if *changed != "" {
+			g.ChangedFiles, err = parseChangedFiles(*changed, target)
+			dieIf(err)
+		}
+		g.Roots = roots
+		if *funcs != "" {
+			g.FuncFilter = strings.Split(*funcs, ",")
+		}
+		if *include != "" {
+			g.IncludePaths = strings.Split(*include, ",")
+		}
+		if *exclude != "" {
+			g.ExcludePaths = strings.Split(*exclude, ",")
+		}
+		g.Format.LocalPrefix = *local
+		g.Format.TabWidth = *tabWidth
+		g.Format.SpaceIndent = !*useTabs
+		g.NestedFullProduct = *product
+		g.NestedProductMax = *prodMax
+		g.MergeCases = *merge
+		g.LineDirectives = *lineDirs
+		g.Provenance = *prov
+		g.Annotation = *annotate
+		g.GenerateTests = *genTests
+		g.ErrorsAs = *errorsAs
+		if *registry != "" {
+			for _, spec := range strings.Split(*registry, ",") {
+				r, err := gen.ParseRegistry(spec)
+				dieIf(err)
+				g.Registries = append(g.Registries, r)
+			}
+		}
+		g.DefaultPanic = *panicDef
+		g.RewriteCallSites = *rewrite
+		g.DispatchTableMin = *tableMin
+		g.MaxCasesPerSwitch = *maxCases
+		g.MaxCasesTotal = *maxTotal
+		g.TruncateCases = *truncate
+		g.Strict = *strict
+		g.Lint = *lint
+		g.Implements = *impls
+		g.DynamicFlow = *dynFlow
+
+		g.SortBanners = *banners
+		g.InterfacePriority = gen.ParseInterfacePriority(*priority)
+
+		g.Sorter = gen.LookupCaseSorter(*sortBy)
+		if g.Sorter == nil {
+			dieIf(fmt.Errorf("unknown sort strategy: %s", *sortBy))
+		}
+
+		if *sortVals != "" {
+			g.ValueSorter = gen.LookupValueSorter(*sortVals)
+			if g.ValueSorter == nil {
+				dieIf(fmt.Errorf("unknown value sort strategy: %s", *sortVals))
+			}
+		}
+
+		return g
+	}
+
+	if mode == "watch" {
+		dieIf(watch(target, newGen))
+		return
+	}
+
+	if mode == "list" {
+		dieIf(doList(target, newGen))
+		return
+	}
+
+	if mode == "stats" {
+		dieIf(doStats(target, newGen, top))
+		return
+	}
+
+	if mode == "serve" {
+		dieIf(serve(target, socket, *main, newGen))
+		return
+	}
+
+	if mode == "pre-commit" {
+		dieIf(preCommit(os.Stdin, target, *main, *overwrite, newGen))
+		return
+	}
+
 	if fi, err := os.Stat(target); err != nil || fi.IsDir() {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	g := gen.New()
-	g.Verbose = *verbose
-	g.FileWriter = func(filename string) io.WriteCloser {
+	g := newGen()
+	if *archive != "" {
+		g.Archive = &gen.Archive{}
+	}
+
+	// the target and the test file generated for it are rewritten
+	isTarget := func(filename string) bool {
 		if filepath.IsAbs(filename) == false {
 			// TODO check errors
 			filename, _ = filepath.Abs(filename)
 		}
 
-		if filename != target {
-			return nil
-		}
+		return filename == target || (*genTests && filename == gen.TestFileName(target))
+	}
 
-		if *overwrite {
-			w, err := os.Create(target)
-			if err != nil {
-				panic(err)
+	if *overwrite || *outDir != "" || *archive != "" {
+		g.Include = isTarget
+		g.Backup = *backup
+	} else {
+		g.FileWriter = func(filename string) io.WriteCloser {
+			if !isTarget(filename) {
+				return nil
 			}
-			return w
+
+			return noCloser{os.Stdout}
 		}
+	}
 
-		return noCloser{os.Stdout}
+	// diags are the diagnostics of the run reported by -sarif
+	var diags gen.DiagnosticList
+
+	if *sarif != "" {
+		g.ReportStale = func(d gen.Diagnostic) {
+			diags = append(diags, d)
+		}
+	}
+
+	if *listOnly {
+		g.ListChanged = func(filename string) {
+			fmt.Println(relativePath(filename))
+		}
+		if !*overwrite && *outDir == "" && *archive == "" {
+			g.FileWriter = func(filename string) io.WriteCloser {
+				if !isTarget(filename) {
+					return nil
+				}
+
+				return noCloser{ioutil.Discard}
+			}
+		}
 	}
 
 	switch mode {
 	case "expand":
-		err := doExpand(g, target, *main)
-		dieIf(err)
+		if interactively {
+			g.Confirm = newInteractive().confirm
+		}
+		err = doExpand(g, target, *main)
+
+	case "assert":
+		err = doExpandAssertions(g, target, *main)
+
+	case "specialize":
+		err = doSpecialize(g, target, *main)
+
+	case "instantiate":
+		err = doInstantiate(g, target)
 
 	case "sort":
-		err := doSort(g, target)
-		dieIf(err)
+		err = doSort(g, target)
 
 	case "scaffold":
-		err := doScaffold(g, target)
-		dieIf(err)
+		err = doScaffold(g, target)
+
+	case "explain":
+		err = doExplain(g, target, line, *main)
+
+	case "callgraph":
+		err = doCallGraph(g, target, line, *main)
+
+	case "visitor":
+		err = doVisitor(g, target, line)
+
+	case "to-generic":
+		err = doToGeneric(g, target, line, wrapper)
+
+	case "from-generic":
+		err = doFromGeneric(g, target, line)
+
+	case "migrate":
+		diags, err = doMigrate(g, target, *main, iface, snippet)
+
+	case "consistency":
+		diags, err = doConsistency(g, target, *main, fix)
+
+	case "check-templates":
+		diags, err = doCheckTemplates(g, target, *main)
+
+	case "spec":
+		err = doSpec(g, target)
+
+	case "spec-doc":
+		err = doSpecDoc(target)
+	}
+
+	if *sarif != "" {
+		if list, ok := err.(gen.DiagnosticList); ok {
+			diags = append(diags, list...)
+		}
+		dieIf(writeSARIF(*sarif, diags))
+	}
+
+	if g.Metrics != nil {
+		dieIf(writeMetrics(*metrics, g.Metrics))
+	}
+
+	if err == nil && g.Archive != nil {
+		err = writeArchive(*archive, g.Archive)
+	}
+
+	dieIf(err)
+}
+
+// relativePath returns filename relative to the working directory if it is under it, as gofmt -l lists them.
+func relativePath(filename string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filename
+	}
+
+	return rel
+}
+
+// writeSARIF writes diags to the file filename as SARIF.
+func writeSARIF(filename string, diags gen.DiagnosticList) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = gen.WriteSARIF(f, diags)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeArchive writes the files of a and its manifest to the tar file path if it ends with .tar,
+// or else under the directory path.
+func writeArchive(path string, a *gen.Archive) error {
+	if !strings.HasSuffix(path, ".tar") {
+		return a.WriteDir(path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = a.WriteTar(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeMetrics writes m to the file filename in the Prometheus text format.
+func writeMetrics(filename string, m *gen.Metrics) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = m.WritePrometheus(f)
+	if err != nil {
+		f.Close()
+		return err
 	}
+
+	return f.Close()
+}
+
+func doVisitor(g *gen.Gen, target string, line int) error {
+	filenames, err := listSiblingFiles(target)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Loader.CreateFromFilenames("", filenames...); err != nil {
+		return err
+	}
+
+	return g.GenerateVisitor(target, line)
+}
+
+func doToGeneric(g *gen.Gen, target string, line int, wrapper bool) error {
+	filenames, err := listSiblingFiles(target)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Loader.CreateFromFilenames("", filenames...); err != nil {
+		return err
+	}
+
+	return g.ToGeneric(target, line, wrapper)
+}
+
+func doFromGeneric(g *gen.Gen, target string, line int) error {
+	filenames, err := listSiblingFiles(target)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Loader.CreateFromFilenames("", filenames...); err != nil {
+		return err
+	}
+
+	return g.FromGeneric(target, line)
+}
+
+// doCheckTemplates reports the issues of CheckTemplates, returning them as diagnostics,
+// and fails if any.
+func doCheckTemplates(g *gen.Gen, target, main string) (gen.DiagnosticList, error) {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return nil, err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		g.Loader.Import(main)
+	}
+
+	issues, err := g.CheckTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	diags := gen.DiagnosticList{}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		diags = append(diags, issue.Diagnostic())
+	}
+
+	if len(issues) > 0 {
+		return diags, fmt.Errorf("%d templates do not compile", len(issues))
+	}
+
+	return diags, nil
+}
+
+// doMigrate reports the issues of Migrate, returning them as diagnostics.
+func doMigrate(g *gen.Gen, target, main, iface, snippet string) (gen.DiagnosticList, error) {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return nil, err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		g.Loader.Import(main)
+	}
+
+	issues, err := g.Migrate(iface, snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	diags := gen.DiagnosticList{}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		diags = append(diags, issue.Diagnostic())
+	}
+
+	return diags, nil
+}
+
+// doConsistency reports the inconsistencies of CheckConsistency, returning them as diagnostics.
+func doConsistency(g *gen.Gen, target, main string, fix bool) (gen.DiagnosticList, error) {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return nil, err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		g.Loader.Import(main)
+	}
+
+	issues, err := g.CheckConsistency(fix)
+	if err != nil {
+		return nil, err
+	}
+
+	diags := gen.DiagnosticList{}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		diags = append(diags, issue.Diagnostic())
+	}
+
+	return diags, nil
+}
+
+// doList prints the type switches in the packages of target by listTypeSwitches.
+func doList(target string, newGen func() *gen.Gen) error {
+	return listTypeSwitches(target, newGen, func(list []gen.TypeSwitchInfo) {
+		for _, info := range list {
+			fmt.Println(info)
+		}
+	})
+}
+
+// doStats prints the statistics of the type switches in the packages of target by listTypeSwitches.
+func doStats(target string, newGen func() *gen.Gen, top int) error {
+	stats := gen.NewStats()
+
+	err := listTypeSwitches(target, newGen, stats.Add)
+	if err != nil {
+		return err
+	}
+
+	return stats.WriteReport(os.Stdout, top)
+}
+
+// listTypeSwitches lists the type switches in the package in the directory target, or the packages under it
+// if target ends with "/...", or the package of target if it is a file, passing them to proc package by package.
+// The packages failing to load are reported and skipped, failing after all.
+func listTypeSwitches(target string, newGen func() *gen.Gen, proc func([]gen.TypeSwitchInfo)) error {
+	recursive := strings.HasSuffix(target, string(filepath.Separator)+"...")
+	root := strings.TrimSuffix(target, string(filepath.Separator)+"...")
+
+	if fi, err := os.Stat(root); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		root = filepath.Dir(root)
+	}
+
+	dirs, err := watchDirs(root, recursive)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, dir := range dirs {
+		filenames, err := listGoFiles(dir)
+		if err != nil {
+			return err
+		}
+		if len(filenames) == 0 {
+			continue
+		}
+
+		g := newGen()
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", dir, err)
+			failed++
+			continue
+		}
+
+		list, err := g.ListTypeSwitches()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", dir, err)
+			failed++
+			continue
+		}
+
+		proc(list)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d packages failed to load", failed)
+	}
+
+	return nil
+}
+
+func readMatchSpec(target string) (*gen.MatchSpec, error) {
+	f, err := os.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return gen.ParseMatchSpec(f)
+}
+
+func doSpec(g *gen.Gen, target string) error {
+	spec, err := readMatchSpec(target)
+	if err != nil {
+		return err
+	}
+
+	results, err := g.RunMatchSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if !r.OK() {
+			fmt.Printf("%s:%d: %s against %s: expected %q but got %q\n", target, r.Case.Line, r.Case.Pattern, r.Case.Input, r.Case.Expected, r.Actual)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(results))
+	}
+
+	fmt.Printf("%d cases passed\n", len(results))
+
+	return nil
+}
+
+func doSpecDoc(target string) error {
+	spec, err := readMatchSpec(target)
+	if err != nil {
+		return err
+	}
+
+	return spec.WriteDoc(os.Stdout)
+}
+
+func doExplain(g *gen.Gen, target string, line int, main string) error {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return err
+		}
+	} else {
+		g.Loader.Import(main)
+		g.Main = main
+	}
+
+	return g.Explain(target, line, os.Stdout)
+}
+
+func doCallGraph(g *gen.Gen, target string, line int, main string) error {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return err
+		}
+	} else {
+		g.Loader.Import(main)
+		g.Main = main
+	}
+
+	return g.CallGraphDOT(target, line, os.Stdout)
+}
+
+// splitFileLine splits a position like "file.go:42" into the file name and the line number.
+func splitFileLine(pos string) (string, int, error) {
+	i := strings.LastIndex(pos, ":")
+	if i == -1 {
+		return "", 0, fmt.Errorf("invalid position: %q (expected <file>:<line>)", pos)
+	}
+
+	line, err := strconv.Atoi(pos[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid position: %q (expected <file>:<line>)", pos)
+	}
+
+	return pos[:i], line, nil
 }
 
 func doExpand(g *gen.Gen, target, main string) error {
@@ -136,6 +937,57 @@ func doExpand(g *gen.Gen, target, main string) error {
 	return g.Expand()
 }
 
+func doExpandAssertions(g *gen.Gen, target, main string) error {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return err
+		}
+	} else {
+		g.Loader.Import(main)
+		g.Main = main
+	}
+
+	return g.ExpandAssertions()
+}
+
+func doSpecialize(g *gen.Gen, target, main string) error {
+	if main == "" {
+		filenames, err := listSiblingFiles(target)
+		if err != nil {
+			return err
+		}
+
+		err = g.Loader.CreateFromFilenames("", filenames...)
+		if err != nil {
+			return err
+		}
+	} else {
+		g.Loader.Import(main)
+		g.Main = main
+	}
+
+	return g.Specialize()
+}
+
+func doInstantiate(g *gen.Gen, target string) error {
+	filenames, err := listSiblingFiles(target)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Loader.CreateFromFilenames("", filenames...); err != nil {
+		return err
+	}
+
+	return g.Instantiate()
+}
+
 func doSort(g *gen.Gen, target string) error {
 	filenames, err := listSiblingFiles(target)
 	if err != nil {
@@ -163,7 +1015,11 @@ func doScaffold(g *gen.Gen, target string) error {
 }
 
 func listSiblingFiles(filename string) ([]string, error) {
-	dir := filepath.Dir(filename)
+	return listGoFiles(filepath.Dir(filename))
+}
+
+// listGoFiles lists the Go files in dir which match the build context.
+func listGoFiles(dir string) ([]string, error) {
 	entries, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+// readStagedFiles reads the paths of the staged files from r, one per line relative to dir
+// as printed by git diff --cached --name-only, and returns the absolute paths of the Go files
+// among them which exist, skipping the directories the go tool ignores like testdata.
+func readStagedFiles(r io.Reader, dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		path := strings.TrimSpace(s.Text())
+		if path == "" || filepath.Ext(path) != ".go" {
+			continue
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, filepath.FromSlash(path))
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			// deleted
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+
+		skip := false
+		for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+			if name != "." && name != ".." && skipWatchDir(name) {
+				skip = true
+			}
+		}
+		if !skip {
+			files = append(files, path)
+		}
+	}
+
+	return files, s.Err()
+}
+
+// preCommit expands the type switches in the staged files read from r, rewriting them if overwrite is set,
+// and fails listing the files which changed or would change, so that a git pre-commit hook stops the commit
+// until they are staged again. The other files are not rewritten and the functions in them are not analyzed.
+// Without main the package of each directory of the files is analyzed on its own, and with main only
+// the packages on the import paths from it to the packages of the files are, as with -low-memory,
+// unless the roots are given, which -low-memory does not support, and the whole program is analyzed.
+//
+// The files are read from the working tree, not from the index, so a file with unstaged changes
+// is checked, and rewritten, with those changes.
+func preCommit(r io.Reader, dir, main string, overwrite bool, newGen func() *gen.Gen) error {
+	staged, err := readStagedFiles(r, dir)
+	if err != nil || len(staged) == 0 {
+		return err
+	}
+
+	changed := []string{}
+	run := func(g *gen.Gen, files []string) error {
+		g.ChangedFiles = files
+		g.ListChanged = func(filename string) {
+			changed = append(changed, filename)
+		}
+		if !overwrite && g.OutputDir == "" {
+			g.FileWriter = func(filename string) io.WriteCloser {
+				return noCloser{ioutil.Discard}
+			}
+		}
+
+		return g.Expand()
+	}
+
+	byDir := map[string][]string{}
+	dirs := []string{}
+	for _, f := range staged {
+		d := filepath.Dir(f)
+		if _, ok := byDir[d]; !ok {
+			dirs = append(dirs, d)
+		}
+		byDir[d] = append(byDir[d], f)
+	}
+	sort.Strings(dirs)
+
+	if main != "" {
+		g := newGen()
+		g.Main = main
+		g.Loader.Import(main)
+		for _, d := range dirs {
+			path, err := importPathOf(d)
+			if err != nil {
+				return err
+			}
+			g.Loader.Import(path)
+		}
+		g.LowMemory = len(g.Roots) == 0
+
+		err := run(g, staged)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, d := range dirs {
+			filenames, err := listGoFiles(d)
+			if err != nil {
+				return err
+			}
+
+			g := newGen()
+			err = g.Loader.CreateFromFilenames("", filenames...)
+			if err != nil {
+				return err
+			}
+
+			err = run(g, byDir[d])
+			if err != nil {
+				return fmt.Errorf("%s: %s", d, err)
+			}
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	sort.Strings(changed)
+	for _, f := range changed {
+		fmt.Println(relativePath(f))
+	}
+
+	if overwrite {
+		return fmt.Errorf("rewrote type switches in %d staged files; stage them again", len(changed))
+	}
+	return fmt.Errorf("type switches in %d staged files are not up to date; run with -w and stage them again", len(changed))
+}
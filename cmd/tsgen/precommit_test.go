@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+func TestReadStagedFiles(t *testing.T) {
+	dir, cleanup := tempDir(t, "pkg/sub", "pkg/testdata", "vendor/x", "_tmp", ".hidden")
+	defer cleanup()
+
+	for _, name := range []string{"pkg/a.go", "pkg/a_test.go", "pkg/README.md", "pkg/sub/s.go", "pkg/testdata/t.go", "vendor/x/v.go", "_tmp/u.go", ".hidden/h.go"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), nil, 0666))
+	}
+
+	staged := strings.Join([]string{
+		"pkg/a.go",
+		filepath.Join(dir, "pkg", "a_test.go"),
+		"pkg/README.md",
+		"pkg/deleted.go",
+		"",
+		"  pkg/sub/s.go  ",
+		"pkg/testdata/t.go",
+		"vendor/x/v.go",
+		"_tmp/u.go",
+		".hidden/h.go",
+	}, "\n")
+
+	expected := []string{
+		filepath.Join(dir, "pkg", "a.go"),
+		filepath.Join(dir, "pkg", "a_test.go"),
+		filepath.Join(dir, "pkg", "sub", "s.go"),
+	}
+
+	files, err := readStagedFiles(strings.NewReader(staged), dir)
+	require.NoError(t, err)
+	assert.Equal(t, expected, files)
+
+	// the paths are made absolute from a relative dir too
+	defer chdir(t, filepath.Join(dir, "pkg"))()
+
+	files, err = readStagedFiles(strings.NewReader(staged), "..")
+	require.NoError(t, err)
+	assert.Equal(t, expected, files)
+
+	// only the directories under dir are skipped by their names
+	files, err = readStagedFiles(strings.NewReader("t.go\n"), "testdata")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "pkg", "testdata", "t.go")}, files)
+}
+
+func TestPreCommit(t *testing.T) {
+	dir, cleanup := tempDir(t, "pkg", "other")
+	defer cleanup()
+
+	filename := filepath.Join(dir, "pkg", "main.go")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(watchSource), 0666))
+
+	// not staged, so not rewritten
+	other := filepath.Join(dir, "other", "main.go")
+	require.NoError(t, ioutil.WriteFile(other, []byte(watchSource), 0666))
+
+	preCommitStaged := func(overwrite bool) error {
+		return preCommit(strings.NewReader("pkg/main.go\n"), dir, "", overwrite, gen.New)
+	}
+
+	err := preCommitStaged(false)
+	if assert.Error(t, err) {
+		assert.Equal(t, "type switches in 1 staged files are not up to date; run with -w and stage them again", err.Error())
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, watchSource, string(content))
+
+	err = preCommitStaged(true)
+	if assert.Error(t, err) {
+		assert.Equal(t, "rewrote type switches in 1 staged files; stage them again", err.Error())
+	}
+
+	content, err = ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "case int:")
+
+	assert.NoError(t, preCommitStaged(false))
+
+	content, err = ioutil.ReadFile(other)
+	require.NoError(t, err)
+	assert.Equal(t, watchSource, string(content))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+// serve serves expansion of the program of target, the package of the file or the directory, or main if set,
+// over the unix socket, which defaults to .tsgen.sock in the directory of the package.
+// The program is loaded and analyzed before listening, so that the first request is answered as fast as the others.
+func serve(target, socket, main string, newGen func() *gen.Gen) error {
+	dir := target
+	if fi, err := os.Stat(target); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		dir = filepath.Dir(target)
+	}
+
+	if socket == "" {
+		socket = filepath.Join(dir, ".tsgen.sock")
+	}
+
+	s := gen.NewServer(func() (*gen.Gen, error) {
+		g := newGen()
+		if main != "" {
+			g.Loader.Import(main)
+			g.Main = main
+			return g, nil
+		}
+
+		filenames, err := listGoFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		return g, g.Loader.CreateFromFilenames("", filenames...)
+	})
+
+	fmt.Fprintf(os.Stderr, "loading %s\n", dir)
+	err := s.Warm()
+	if err != nil {
+		return err
+	}
+
+	// a socket left by a previous server
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	interrupted := make(chan struct{})
+	go func() {
+		<-sig
+		close(interrupted)
+		l.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving on %s\n", socket)
+	err = s.Serve(l)
+
+	select {
+	case <-interrupted:
+		// the listener closed, which removes the socket
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,22 @@
+//go:generate tsgen -w expand $GOFILE
+//go:generate tsgen -w sort $GOFILE
+
+package main
+
+import "fmt"
+
+type T interface{}
+
+func show(x interface{}) string {
+	//tsgen:expand types=int,string
+	switch x := x.(type) {
+	case T:
+		return fmt.Sprintf("%T", x)
+	}
+
+	return ""
+}
+
+func main() {
+	fmt.Println(show(1), show("s"))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+// watchDebounce is how long watch mode waits for changes to settle before regenerating.
+const watchDebounce = 200 * time.Millisecond
+
+// watch watches the directory target, or the tree under it if target ends with "/...",
+// and expands type switches of the package in each directory whose Go files are changed.
+func watch(target string, newGen func() *gen.Gen) error {
+	recursive := strings.HasSuffix(target, string(filepath.Separator)+"...")
+	root := strings.TrimSuffix(target, string(filepath.Separator)+"...")
+
+	// the events are named after the directories watched, which must be absolute
+	// to be compared with the files written, which the FileWriter makes absolute
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs, err := watchDirs(root, recursive)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		err := watcher.Add(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "watching %d directories under %s\n", len(dirs), root)
+
+	// written holds the contents written by expansion, not to regenerate on the changes by itself
+	written := map[string][]byte{}
+	pending := map[string]bool{}
+
+	var timer <-chan time.Time
+
+	for {
+		select {
+		case ev := <-watcher.Events:
+			if fi, err := os.Stat(ev.Name); recursive && ev.Op&fsnotify.Create != 0 && err == nil && fi.IsDir() {
+				if !skipWatchDir(fi.Name()) {
+					watcher.Add(ev.Name)
+				}
+				continue
+			}
+
+			if filepath.Ext(ev.Name) != ".go" || ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			if content, ok := written[ev.Name]; ok {
+				if current, err := ioutil.ReadFile(ev.Name); err == nil && bytes.Equal(current, content) {
+					continue
+				}
+				delete(written, ev.Name)
+			}
+
+			pending[filepath.Dir(ev.Name)] = true
+			timer = time.After(watchDebounce)
+
+		case err := <-watcher.Errors:
+			fmt.Fprintf(os.Stderr, "watch error: %s\n", err)
+
+		case <-timer:
+			timer = nil
+
+			changedDirs := []string{}
+			for dir := range pending {
+				changedDirs = append(changedDirs, dir)
+			}
+			sort.Strings(changedDirs)
+			pending = map[string]bool{}
+
+			for _, dir := range changedDirs {
+				files, err := expandDir(newGen(), dir, written)
+
+				stamp := time.Now().Format("15:04:05")
+				switch {
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "[%s] %s: error: %s\n", stamp, dir, err)
+				case len(files) == 0:
+					fmt.Fprintf(os.Stderr, "[%s] %s: no changes\n", stamp, dir)
+				default:
+					fmt.Fprintf(os.Stderr, "[%s] %s: rewrote %s\n", stamp, dir, strings.Join(files, ", "))
+				}
+			}
+		}
+	}
+}
+
+// watchDirs returns root and, if recursive, the directories under it
+// except for the ones the go tool ignores.
+func watchDirs(root string, recursive bool) ([]string, error) {
+	if !recursive {
+		return []string{root}, nil
+	}
+
+	dirs := []string{}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if path != root && skipWatchDir(fi.Name()) {
+			return filepath.SkipDir
+		}
+
+		dirs = append(dirs, path)
+		return nil
+	})
+
+	return dirs, err
+}
+
+func skipWatchDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor"
+}
+
+// expandDir expands type switches in the package in dir, writing only the files whose content changed,
+// which are recorded in written by their absolute names. It returns the base names of the files written.
+// The files may be written concurrently with g.Concurrency.
+func expandDir(g *gen.Gen, dir string, written map[string][]byte) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames, err := listGoFiles(dir)
+	if err != nil || len(filenames) == 0 {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	rewritten := []string{}
+	g.FileWriter = func(filename string) io.WriteCloser {
+		if filepath.IsAbs(filename) == false {
+			filename, _ = filepath.Abs(filename)
+		}
+
+		if filepath.Dir(filename) != dir {
+			return nil
+		}
+
+		return &changeWriter{filename: filename, onWrite: func(content []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			written[filename] = content
+			rewritten = append(rewritten, filepath.Base(filename))
+		}}
+	}
+
+	err = g.Loader.CreateFromFilenames("", filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.Expand()
+	sort.Strings(rewritten)
+
+	return rewritten, err
+}
+
+// changeWriter replaces the file on Close, as gen.NewFileReplacer does, only if the content differs from the one on disk.
+type changeWriter struct {
+	bytes.Buffer
+	filename string
+	onWrite  func([]byte)
+}
+
+func (w *changeWriter) Close() error {
+	current, err := ioutil.ReadFile(w.filename)
+	if err == nil && bytes.Equal(current, w.Bytes()) {
+		return nil
+	}
+
+	r := gen.NewFileReplacer(w.filename)
+	_, err = r.Write(w.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = r.Close()
+	if err != nil {
+		return err
+	}
+
+	w.onWrite(w.Bytes())
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+const watchSource = `package main
+
+type T interface{}
+
+func show(x interface{}) string {
+	//tsgen:expand types=int
+	switch x.(type) {
+	case T:
+		var _ T
+		return "T"
+	}
+	return ""
+}
+
+func main() {
+	show(1)
+}
+`
+
+func TestExpandDir_Relative(t *testing.T) {
+	dir, cleanup := tempDir(t, "pkg")
+	defer cleanup()
+
+	filename := filepath.Join(dir, "pkg", "main.go")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(watchSource), 0666))
+
+	defer chdir(t, dir)()
+
+	written := map[string][]byte{}
+	files, err := expandDir(gen.New(), "pkg", written)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go"}, files)
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "case int:")
+
+	if assert.Contains(t, written, filename) {
+		assert.Equal(t, string(content), string(written[filename]))
+	}
+
+	// the content written is not written again
+	files, err = expandDir(gen.New(), "pkg", map[string][]byte{})
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
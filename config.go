@@ -0,0 +1,213 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkConfig reports the errors in the configuration of g, before loading the program.
+func (g Gen) checkConfig() error {
+	if len(g.Loader.CreatePkgs) == 0 && len(g.Loader.ImportPkgs) == 0 {
+		return fmt.Errorf("no packages to load: call Loader.CreateFromFilenames or Loader.Import first")
+	}
+
+	if g.SkipInvalidCases && !g.Validate {
+		return fmt.Errorf("SkipInvalidCases requires Validate")
+	}
+
+	if g.MaxCasesPerSwitch < 0 || g.MaxCasesTotal < 0 {
+		return fmt.Errorf("negative limit of cases: MaxCasesPerSwitch=%d, MaxCasesTotal=%d", g.MaxCasesPerSwitch, g.MaxCasesTotal)
+	}
+
+	if g.Concurrency < 0 {
+		return fmt.Errorf("negative Concurrency: %d", g.Concurrency)
+	}
+
+	if g.Format.TabWidth < 0 {
+		return fmt.Errorf("negative Format.TabWidth: %d", g.Format.TabWidth)
+	}
+
+	if g.DispatchTableMin < 0 {
+		return fmt.Errorf("negative DispatchTableMin: %d", g.DispatchTableMin)
+	}
+
+	if err := checkPathPatterns(g.IncludePaths); err != nil {
+		return err
+	}
+	if err := checkPathPatterns(g.ExcludePaths); err != nil {
+		return err
+	}
+
+	if err := g.checkFuncFilter(); err != nil {
+		return err
+	}
+
+	for _, r := range g.Registries {
+		if err := r.check(); err != nil {
+			return err
+		}
+	}
+
+	for _, root := range g.Roots {
+		if err := checkFuncFilterEntry(root); err != nil {
+			return err
+		}
+	}
+	if len(g.Roots) > 0 && g.LowMemory {
+		return fmt.Errorf("LowMemory cannot be used with Roots, as the packages on the call paths are found from Main")
+	}
+
+	if _, err := g.parseAnnotation(); err != nil {
+		return err
+	}
+
+	if g.Backup && g.FileWriter != nil {
+		return fmt.Errorf("Backup requires rewriting files in place without FileWriter")
+	}
+
+	if g.OutputDir != "" && (g.FileWriter != nil || g.Backup) {
+		return fmt.Errorf("OutputDir cannot be used with FileWriter nor Backup")
+	}
+
+	if g.Archive != nil && (g.FileWriter != nil || g.Backup || g.OutputDir != "") {
+		return fmt.Errorf("Archive cannot be used with FileWriter, Backup nor OutputDir")
+	}
+
+	if g.OwnersReport != nil && g.Owners == nil {
+		return fmt.Errorf("OwnersReport requires Owners")
+	}
+
+	return nil
+}
+
+// fileWriter returns the writer of the file filename to be rewritten by g.FileWriter,
+// or one adding it to g.Archive, writing it under g.OutputDir or rewriting it in place if it is not set,
+// or nil if the file is not included.
+func (g Gen) fileWriter(filename string) io.WriteCloser {
+	if g.Include != nil && !g.Include(filename) {
+		return nil
+	}
+
+	var w io.WriteCloser
+	if g.FileWriter != nil {
+		w = g.FileWriter(filename)
+	} else if g.Archive != nil {
+		w = &archiveWriter{g: g, filename: filename}
+	} else if g.OutputDir != "" {
+		w = &outputWriter{g: g, filename: filename}
+	} else {
+		w = &fileReplacer{filename: filename, backup: g.Backup}
+	}
+
+	if w != nil && (g.ListChanged != nil || g.ReportStale != nil) {
+		w = &changeLister{g: g, filename: filename, w: w}
+	}
+
+	return w
+}
+
+// changeLister passes the name of the file to g.ListChanged, and its Diagnostic of RuleStaleCode to g.ReportStale,
+// on Close if the bytes written differ from its source, and writes them to w.
+type changeLister struct {
+	bytes.Buffer
+	g        Gen
+	filename string
+	w        io.WriteCloser
+}
+
+func (l *changeLister) Close() error {
+	src, err := l.g.readSource(l.filename)
+	if err != nil || !bytes.Equal(src, l.Bytes()) {
+		if l.g.ListChanged != nil {
+			l.g.ListChanged(l.filename)
+		}
+		if l.g.ReportStale != nil {
+			l.g.ReportStale(staleDiagnostic(l.filename, src, l.Bytes()))
+		}
+	}
+
+	_, err = l.w.Write(l.Bytes())
+	if err != nil {
+		l.w.Close()
+		return err
+	}
+
+	return l.w.Close()
+}
+
+// NewFileReplacer returns the writer replacing the file filename with the bytes written on Close as Gen does
+// without FileWriter, for the FileWriters rewriting files in place themselves.
+func NewFileReplacer(filename string) io.WriteCloser {
+	return &fileReplacer{filename: filename}
+}
+
+// fileReplacer replaces the file with the bytes written on Close, atomically by renaming
+// a temporary file in the same directory over it, so that the file can be read while it is rewritten
+// and is never left truncated. The mode of the file is preserved.
+type fileReplacer struct {
+	bytes.Buffer
+	filename string
+
+	// backup keeps the original content in filename+".orig".
+	backup bool
+}
+
+func (w *fileReplacer) Close() error {
+	mode := os.FileMode(0666)
+	fi, err := os.Stat(w.filename)
+	if err == nil {
+		mode = fi.Mode()
+	}
+
+	if w.backup && err == nil {
+		orig, err := ioutil.ReadFile(w.filename)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(w.filename+".orig", orig, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(w.filename), "."+filepath.Base(w.filename)+".tsgen")
+	if err != nil {
+		return err
+	}
+
+	err = writeSynced(f, w.Bytes(), mode)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = os.Rename(f.Name(), w.filename)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// writeSynced writes b to f with mode, flushing it to the disk, and closes f.
+func writeSynced(f *os.File, b []byte, mode os.FileMode) error {
+	_, err := f.Write(b)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,256 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	g := New()
+	err := g.Sort()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no packages to load")
+	}
+
+	err = g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	g.SkipInvalidCases = true
+	err = g.Sort()
+	if assert.Error(t, err) {
+		assert.Equal(t, "SkipInvalidCases requires Validate", err.Error())
+	}
+}
+
+func TestFileWriter_Default(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/layout.go")
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "layout.go")
+	err = ioutil.WriteFile(filename, src, 0644)
+	require.NoError(t, err)
+
+	g := New()
+	err = g.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+
+	g.Include = func(path string) bool { return false }
+	err = g.Sort()
+	require.NoError(t, err)
+
+	result, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, string(src), string(result), "not included")
+
+	g.Include = nil
+	w := g.fileWriter(filename)
+	require.NotNil(t, w)
+
+	_, err = w.Write([]byte("package testdata\n"))
+	require.NoError(t, err)
+
+	result, err = ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, string(src), string(result), "replaced on Close")
+
+	err = w.Close()
+	require.NoError(t, err)
+
+	result, err = ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "package testdata\n", string(result))
+
+	fi, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode())
+}
+
+func TestIncludesFile(t *testing.T) {
+	fset := token.NewFileSet()
+	parse := func(src string) *ast.File {
+		file, err := parser.ParseFile(fset, "x.go", src, parser.ParseComments)
+		require.NoError(t, err)
+		return file
+	}
+
+	file := parse("package x\n")
+	generated := parse("// Code generated by tsgen; DO NOT EDIT.\n\npackage x\n")
+
+	created := &loader.PackageInfo{}
+	imported := &loader.PackageInfo{}
+
+	g := New()
+	g.program = &loader.Program{Created: []*loader.PackageInfo{created}}
+
+	assert.True(t, g.includesFile(imported, file, "a/b.go"))
+	assert.False(t, g.includesFile(imported, file, "vendor/a/b.go"))
+	assert.False(t, g.includesFile(imported, file, "a/testdata/b.go"))
+	assert.False(t, g.includesFile(imported, generated, "a/b.go"))
+	assert.True(t, g.includesFile(created, generated, "testdata/b.go"), "given by name")
+
+	g.ExcludePaths = []string{"**/*_test.go", `re:^a/.*\.pb\.go$`}
+	assert.False(t, g.includesFile(created, file, "a/b_test.go"))
+	assert.False(t, g.includesFile(imported, file, "a/b.pb.go"))
+	assert.True(t, g.includesFile(imported, file, "b/b.pb.go"))
+
+	g.IncludePaths = []string{"vendor/**/*.go"}
+	assert.True(t, g.includesFile(imported, file, "vendor/a/b.go"))
+	assert.False(t, g.includesFile(created, file, "a/b.go"))
+	assert.False(t, g.includesFile(imported, file, "vendor/a/b_test.go"))
+}
+
+func TestCheckConfig_PathPatterns(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	g.ExcludePaths = []string{"re:a("}
+	err = g.Sort()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid path pattern "re:a("`)
+	}
+
+	g.ExcludePaths = []string{"a/[b.go"}
+	err = g.Sort()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid path pattern "a/[b.go"`)
+	}
+}
+
+func TestFileWriter_Backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "a.go")
+	err = ioutil.WriteFile(filename, []byte("package a\n"), 0600)
+	require.NoError(t, err)
+
+	g := New()
+	g.Backup = true
+
+	w := g.fileWriter(filename)
+	_, err = w.Write([]byte("package a // rewritten\n"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.NoError(t, err)
+
+	result, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "package a // rewritten\n", string(result))
+
+	orig, err := ioutil.ReadFile(filename + ".orig")
+	require.NoError(t, err)
+	assert.Equal(t, "package a\n", string(orig))
+
+	fi, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode())
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files left")
+}
+
+func TestFileWriter_ListChanged(t *testing.T) {
+	var out bytes.Buffer
+	changed := []string{}
+
+	g := New()
+	g.ListChanged = func(filename string) {
+		changed = append(changed, filename)
+	}
+	g.FileWriter = func(path string) io.WriteCloser {
+		return nopCloser{&out}
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go", "testdata/sort/values.go")
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"testdata/sort/cases.go"}, changed)
+	assert.Contains(t, out.String(), "package E")
+}
+
+func TestFileWriter_ReportStale(t *testing.T) {
+	var out bytes.Buffer
+	diags := DiagnosticList{}
+
+	g := New()
+	g.ReportStale = func(d Diagnostic) {
+		diags = append(diags, d)
+	}
+	g.FileWriter = func(path string) io.WriteCloser {
+		return nopCloser{&out}
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go", "testdata/sort/values.go")
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+
+	require.Len(t, diags, 1)
+	assert.Equal(t, RuleStaleCode, diags[0].Rule)
+	assert.Equal(t, "testdata/sort/cases.go", diags[0].Pos.Filename)
+	assert.Equal(t, 26, diags[0].Pos.Line, "the first line changing")
+	assert.Equal(t, "generated code is out of date; run tsgen to regenerate it", diags[0].Msg)
+}
+
+func TestFileWriter_OutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	srcDir := filepath.Join(dir, "src")
+	filename := filepath.Join(srcDir, "lib", "cases.go")
+	err = os.MkdirAll(filepath.Dir(filename), 0777)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filename, src, 0644)
+	require.NoError(t, err)
+
+	g := New()
+	g.Modules = &Modules{Main: []Module{{Path: "example.com/m", Dir: srcDir}}}
+	g.OutputDir = filepath.Join(dir, "out")
+	err = g.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "out", "lib", "cases.go"))
+	require.NoError(t, err)
+	assert.NotEqual(t, string(src), string(out))
+	assert.Contains(t, string(out), "case C:")
+
+	// the source is left as it is
+	current, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, string(src), string(current))
+
+	g.Backup = true
+	err = g.Sort()
+	require.Error(t, err)
+	assert.Equal(t, "OutputDir cannot be used with FileWriter nor Backup", err.Error())
+}
@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"sync"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+)
+
+// Proposal is the expansion of a type switch proposed to Gen.Confirm.
+type Proposal struct {
+	Pos token.Position
+
+	// Func is the name of the enclosing function, e.g. Foo or (*T).Method.
+	Func string
+
+	// Old is the text of the statement in the source, and New the text proposed to replace it, formatted,
+	// which includes the errors.As checks preceding the statement with Gen.ErrorsAs.
+	Old []byte
+	New []byte
+}
+
+// confirmMu serializes the calls of g.Confirm for the files rewritten concurrently.
+var confirmMu sync.Mutex
+
+// confirmEdits asks g.Confirm whether to apply the expansions of file edited, returning the edits confirmed.
+func (g Gen) confirmEdits(pkg *loader.PackageInfo, file *ast.File, expansions []*expansion) ([]sourceEdit, error) {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+
+	edits := []sourceEdit{}
+	for _, e := range expansions {
+		if !e.edited {
+			continue
+		}
+
+		start, end, text, err := g.statementEdit(file, e.stmt.node, e.edit)
+		if err != nil {
+			return nil, err
+		}
+
+		text, err = g.Confirm(Proposal{
+			Pos:  g.Loader.Fset.Position(e.stmt.node.Pos()),
+			Func: funcDeclName(pkg, e.funcDecl),
+			Old:  src[start:end],
+			New:  text,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if text == nil {
+			g.log(file, e.stmt.node, "expansion skipped")
+			e.edited = false
+			continue
+		}
+
+		edits = append(edits, sourceEdit{start: start, end: end, text: text})
+	}
+
+	return edits, nil
+}
@@ -0,0 +1,60 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_Confirm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/nested.go", "add", [][]types.Type{{types.Typ[types.Int], types.Typ[types.Int]}})
+
+	expand := func(confirm func(Proposal) ([]byte, error)) string {
+		g := New()
+		g.CacheDir = dir
+		g.Confirm = confirm
+		err := g.Loader.CreateFromFilenames("", "testdata/nested.go")
+		require.NoError(t, err)
+
+		sources, err := g.ExpandBytes()
+		require.NoError(t, err)
+		return string(sources["testdata/nested.go"])
+	}
+
+	proposals := []Proposal{}
+	out := expand(func(p Proposal) ([]byte, error) {
+		proposals = append(proposals, p)
+		return nil, nil
+	})
+
+	src, err := ioutil.ReadFile("testdata/nested.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(src), out)
+
+	require.Len(t, proposals, 1)
+	assert.Equal(t, 13, proposals[0].Pos.Line)
+	assert.Equal(t, "add", proposals[0].Func)
+	assert.True(t, strings.HasPrefix(string(proposals[0].Old), "switch a := a.(type) {\n\tcase A:"))
+	assert.Contains(t, string(proposals[0].New), "\tcase int:\n\t\tswitch b := b.(type) {")
+
+	out = expand(func(p Proposal) ([]byte, error) {
+		return p.New, nil
+	})
+	assert.Contains(t, out, "\tcase int:\n\t\tswitch b := b.(type) {")
+
+	// edited
+	out = expand(func(p Proposal) ([]byte, error) {
+		return []byte(strings.Replace(string(p.New), "var x int = a", "x := a", 1)), nil
+	})
+	assert.Contains(t, out, "\t\t\tx := a\n")
+}
@@ -0,0 +1,297 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// Inconsistency is a type switch on a named interface whose case types differ from those of
+// the other type switches on the interface in the program, e.g. a switch on a sum type
+// which has not been updated after a variant was added.
+type Inconsistency struct {
+	Pos token.Position
+
+	// Interface is the named interface switched on.
+	Interface types.Type
+
+	// Missing are the types handled by the other switches on Interface but not by this one.
+	Missing []types.Type
+
+	// Extra are the types handled by this switch only.
+	Extra []types.Type
+
+	stmt *TypeSwitchStmt
+}
+
+// CheckConsistency finds the type switches on each named interface in the program,
+// and reports the ones whose case types differ from the union of the case types of all of them,
+// so that the switches dispatching on a sum type stay in lockstep.
+// The template clauses, nil cases and the interfaces switched on only once are not considered.
+//
+// If fix is true, the missing case clauses are added to the switches, before the default clause if any,
+// and the files are written by g.FileWriter. The body of an added clause is a copy of that of
+// the default clause, so that the behavior is unchanged, or panic("not implemented") without one.
+// Extra types are left as they are, since they are missing from the other switches.
+func (g Gen) CheckConsistency(fix bool) ([]Inconsistency, error) {
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	type switchCases struct {
+		stmt  *TypeSwitchStmt
+		types []types.Type
+	}
+
+	ifaces := []types.Type{}
+	switches := map[types.Type][]switchCases{}
+
+	pkgs := append([]*loader.PackageInfo{}, g.program.Created...)
+	for _, pkg := range g.program.Imported {
+		pkgs = append(pkgs, pkg)
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				sw, ok := n.(*ast.TypeSwitchStmt)
+				if !ok {
+					return true
+				}
+
+				x, _ := typeSwitchSubject(sw)
+				if x == nil {
+					return true
+				}
+
+				named, ok := pkg.TypeOf(x).(*types.Named)
+				if !ok || g.isTypeVariable(named) {
+					return true
+				}
+				if _, ok := named.Underlying().(*types.Interface); !ok {
+					return true
+				}
+
+				stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+				sc := switchCases{stmt: stmt, types: g.consistencyCaseTypes(stmt)}
+
+				var iface types.Type
+				for _, t := range ifaces {
+					if types.Identical(t, named) {
+						iface = t
+					}
+				}
+				if iface == nil {
+					iface = named
+					ifaces = append(ifaces, iface)
+				}
+
+				switches[iface] = append(switches[iface], sc)
+
+				return true
+			})
+		}
+	}
+
+	issues := []Inconsistency{}
+
+	for _, iface := range ifaces {
+		if len(switches[iface]) < 2 {
+			continue
+		}
+
+		union := []types.Type{}
+		for _, sc := range switches[iface] {
+			for _, t := range sc.types {
+				if !containsIdentical(union, t) {
+					union = append(union, t)
+				}
+			}
+		}
+
+		for i, sc := range switches[iface] {
+			missing := []types.Type{}
+			for _, t := range union {
+				if !containsIdentical(sc.types, t) {
+					missing = append(missing, t)
+				}
+			}
+
+			extra := []types.Type{}
+		types:
+			for _, t := range sc.types {
+				for j, other := range switches[iface] {
+					if j != i && containsIdentical(other.types, t) {
+						continue types
+					}
+				}
+				extra = append(extra, t)
+			}
+
+			if len(missing) == 0 && len(extra) == 0 {
+				continue
+			}
+
+			sort.Sort(byTypeString(missing))
+			sort.Sort(byTypeString(extra))
+
+			issues = append(issues, Inconsistency{
+				Pos:       g.Loader.Fset.Position(sc.stmt.node.Pos()),
+				Interface: iface,
+				Missing:   missing,
+				Extra:     extra,
+				stmt:      sc.stmt,
+			})
+		}
+	}
+
+	sort.Sort(byInconsistencyPos(issues))
+
+	if !fix {
+		return issues, nil
+	}
+
+	return issues, g.doFiles(func(pkg *loader.PackageInfo, file *ast.File) error {
+		src, err := g.fileSource(file)
+		if err != nil {
+			return err
+		}
+
+		imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+		edits := []sourceEdit{}
+
+		for _, issue := range issues {
+			if issue.stmt.file != file || len(issue.Missing) == 0 {
+				continue
+			}
+
+			issue.stmt.imports = imports
+			edits = append(edits, g.missingCasesEdit(issue.stmt, issue.Missing, src))
+		}
+
+		if len(edits) == 0 {
+			return nil
+		}
+
+		err = g.editFileSource(file, edits)
+		if err != nil {
+			return err
+		}
+
+		imports.fix(g.Loader.Fset, file)
+
+		return nil
+	})
+}
+
+// consistencyCaseTypes returns the case types of stmt, except for the template clauses and nil cases.
+func (g Gen) consistencyCaseTypes(stmt *TypeSwitchStmt) []types.Type {
+	ts := []types.Type{}
+
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		for _, e := range clause.List {
+			if len(g.exprTypeVariables(stmt, e)) > 0 {
+				continue
+			}
+
+			t := stmt.info.TypeOf(e)
+			if t == nil || types.Identical(t, types.Typ[types.UntypedNil]) {
+				continue
+			}
+
+			if !containsIdentical(ts, t) {
+				ts = append(ts, t)
+			}
+		}
+	}
+
+	return ts
+}
+
+// missingCasesEdit returns the edit of the source src of the file of stmt
+// which adds case clauses of the types missing, before the default clause if any.
+func (g Gen) missingCasesEdit(stmt *TypeSwitchStmt, missing []types.Type, src []byte) sourceEdit {
+	tf := g.tokenFile(stmt.file)
+	qf := stmt.qualifier()
+
+	body := "panic(\"not implemented\")\n"
+	pos := stmt.node.Body.Rbrace
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		if clause.List != nil {
+			continue
+		}
+
+		pos = clause.Pos()
+		if len(clause.Body) > 0 {
+			body = string(src[tf.Offset(clause.Body[0].Pos()):tf.Offset(clause.Body[len(clause.Body)-1].End())]) + "\n"
+		} else {
+			body = ""
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, t := range missing {
+		fmt.Fprintf(&buf, "case %s:\n%s", typeString(t, qf), body)
+	}
+
+	// keep the indentation of the line of pos
+	offset := tf.Offset(pos)
+	lineStart := bytes.LastIndexByte(src[:offset], '\n') + 1
+	if strings.TrimSpace(string(src[lineStart:offset])) == "" {
+		offset = lineStart
+	}
+
+	return sourceEdit{start: offset, end: offset, text: buf.Bytes()}
+}
+
+// String returns a human-readable report of the inconsistency.
+func (issue Inconsistency) String() string {
+	return fmt.Sprintf("%s: %s", issue.Pos, issue.message())
+}
+
+// message returns the report of the inconsistency without its position.
+func (issue Inconsistency) message() string {
+	typeStrings := func(ts []types.Type) string {
+		ss := make([]string, len(ts))
+		for i, t := range ts {
+			ss[i] = t.String()
+		}
+		return strings.Join(ss, ", ")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type switch on %s", issue.Interface)
+	if len(issue.Missing) > 0 {
+		fmt.Fprintf(&buf, "\n\tmissing: %s", typeStrings(issue.Missing))
+	}
+	if len(issue.Extra) > 0 {
+		fmt.Fprintf(&buf, "\n\textra: %s", typeStrings(issue.Extra))
+	}
+
+	return buf.String()
+}
+
+// Diagnostic returns the inconsistency as a Diagnostic of RuleMissingCases, e.g. for SARIF reports.
+func (issue Inconsistency) Diagnostic() Diagnostic {
+	return Diagnostic{Pos: issue.Pos, Msg: issue.message(), Rule: RuleMissingCases}
+}
+
+type byInconsistencyPos []Inconsistency
+
+func (s byInconsistencyPos) Len() int      { return len(s) }
+func (s byInconsistencyPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byInconsistencyPos) Less(i, j int) bool {
+	if s[i].Pos.Filename != s[j].Pos.Filename {
+		return s[i].Pos.Filename < s[j].Pos.Filename
+	}
+	return s[i].Pos.Offset < s[j].Pos.Offset
+}
@@ -0,0 +1,50 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	var out bytes.Buffer
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/consistency/shape.go" {
+			return nopCloser{&out}
+		}
+
+		return nil
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/consistency/shape.go")
+	require.NoError(t, err)
+
+	issues, err := g.CheckConsistency(true)
+	require.NoError(t, err)
+
+	for _, issue := range issues {
+		t.Log(issue)
+	}
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, "shape.Shape", issues[0].Interface.String())
+	assert.Equal(t, "[shape.Triangle]", fmt.Sprint(issues[0].Missing))
+	assert.Empty(t, issues[0].Extra)
+	assert.Equal(t, "[shape.Square]", fmt.Sprint(issues[1].Missing))
+
+	diag := issues[0].Diagnostic()
+	assert.Equal(t, RuleMissingCases, diag.Rule)
+	assert.Equal(t, issues[0].String(), diag.Error())
+
+	result := out.String()
+	t.Log(result)
+
+	assert.Contains(t, result, "\tcase Triangle:\n\t\treturn fmt.Sprint(s)\n\tdefault:\n\t\treturn fmt.Sprint(s)\n")
+	assert.Contains(t, result, "\tcase Triangle:\n\t\treturn 3\n\tcase Square:\n\t\tpanic(\"not implemented\")\n\t}\n")
+}
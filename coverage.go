@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+)
+
+// reportCoverage writes to g.CoverageReport how the templates of stmt in funcDecl are utilized by inTypes:
+// the types each template matched, the templates which matched nothing, and the types which matched no template,
+// so that a template which silently stopped matching, e.g. after a refactoring, is noticed.
+// The types having hand-written case clauses are listed separately.
+func (g Gen) reportCoverage(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, inTypes []types.Type) {
+	if g.CoverageReport == nil {
+		return
+	}
+
+	templates := []Template{}
+	for _, t := range stmt.templates() {
+		if len(g.exprTypeVariables(stmt, t.Clause.List[t.index])) > 0 {
+			templates = append(templates, t)
+		}
+	}
+	if len(templates) == 0 {
+		return
+	}
+
+	seen := g.handWrittenTypes(stmt)
+	matched := make([][]types.Type, len(templates))
+	handWritten := []types.Type{}
+	unmatched := []types.Type{}
+
+	for _, in := range inTypes {
+		if containsIdentical(seen, in) {
+			handWritten = append(handWritten, in)
+			continue
+		}
+
+		t, _, _ := g.findMatchingTemplate(stmt, in)
+		if t == nil {
+			unmatched = append(unmatched, in)
+			continue
+		}
+
+		for i := range templates {
+			if templates[i].Clause == t.Clause && templates[i].index == t.index {
+				matched[i] = append(matched[i], in)
+			}
+		}
+	}
+
+	typeStrings := func(ts []types.Type) string {
+		ss := make([]string, len(ts))
+		for i, t := range ts {
+			ss[i] = g.relativeTypeString(t, stmt.file)
+		}
+		return strings.Join(ss, ", ")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: type switch in %s\n", g.Loader.Fset.Position(stmt.node.Pos()), funcDecl.Name.Name)
+	for i, t := range templates {
+		if len(matched[i]) == 0 {
+			fmt.Fprintf(&buf, "  template %s: matched nothing\n", g.showNode(t.Clause.List[t.index]))
+		} else {
+			fmt.Fprintf(&buf, "  template %s: %s\n", g.showNode(t.Clause.List[t.index]), typeStrings(matched[i]))
+		}
+	}
+	if len(handWritten) > 0 {
+		fmt.Fprintf(&buf, "  hand-written: %s\n", typeStrings(handWritten))
+	}
+	if len(unmatched) > 0 {
+		fmt.Fprintf(&buf, "  matched no template: %s\n", typeStrings(unmatched))
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	buf.WriteTo(g.CoverageReport)
+}
@@ -0,0 +1,41 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+
+	"go/ast"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportCoverage(t *testing.T) {
+	var out bytes.Buffer
+
+	g := New()
+	g.CoverageReport = &out
+	err := g.Loader.CreateFromFilenames("", "testdata/coverage.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		g.reportCoverage(stmt, fd, canonicalTypes(callArgTypes(&pkg.Info, file, "describe")))
+		return nil
+	})
+
+	t.Log(out.String())
+
+	assert.Equal(t, `testdata/coverage.go:13:2: type switch in describe
+  template map[string]T: map[string]bool, map[string]int
+  template []T: matched nothing
+  hand-written: string
+  matched no template: int
+`, out.String())
+}
@@ -0,0 +1,119 @@
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go/ast"
+	"go/token"
+)
+
+// Diagnostic is a failure to rewrite a type switch, at the position of the switch.
+type Diagnostic struct {
+	Pos token.Position
+	Msg string
+
+	// Rule identifies the kind of the diagnostic, one of the Rule constants, e.g. in SARIF reports.
+	// Empty means RuleFailure.
+	Rule string
+}
+
+// The kinds of diagnostics.
+const (
+	// RuleFailure is a failure to rewrite a type switch not of the other kinds.
+	RuleFailure = "failure"
+
+	// RuleTooManyCases is a type switch which would have more expanded cases than allowed.
+	RuleTooManyCases = "too-many-cases"
+
+	// RuleUnmatchedType is an argument type matching no template of a type switch, with Gen.Strict.
+	RuleUnmatchedType = "unmatched-type"
+
+	// RuleInvalidCase is a generated case which does not compile, with Gen.Validate.
+	RuleInvalidCase = "invalid-case"
+
+	// RuleMissingCases is a type switch missing the cases the others on its interface have, by CheckConsistency.
+	RuleMissingCases = "missing-cases"
+
+	// RuleInvalidTemplate is a template case which does not compile for synthetic types, by CheckTemplates.
+	RuleInvalidTemplate = "invalid-template"
+
+	// RuleMigration is a case or assertion failing to compile after the interface changed, by Migrate.
+	RuleMigration = "migration"
+
+	// RuleStaleCode is a file whose generated code is out of date, which expansion would change, by Gen.ReportStale.
+	RuleStaleCode = "stale-generated-code"
+
+	// RuleNonExhaustive is a type switch without default clause which no case handles an argument type of, with Gen.Lint.
+	RuleNonExhaustive = "non-exhaustive-switch"
+
+	// RuleUnreachableCase is a case never matching as a case before it matches all of its values, with Gen.Lint.
+	RuleUnreachableCase = "unreachable-case"
+)
+
+// Error returns the diagnostic in the form of the compiler errors, <file>:<line>:<column>: <message>.
+func (d Diagnostic) Error() string {
+	if !d.Pos.IsValid() {
+		return d.Msg
+	}
+
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// DiagnosticList is a list of the failures collected in a run from all of the type switches and files,
+// returned by Expand and the like instead of stopping at the first failure.
+// The files with failures are not rewritten.
+type DiagnosticList []Diagnostic
+
+// Error returns the diagnostics one per line.
+func (l DiagnosticList) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns l as an error, or nil if l is empty.
+func (l DiagnosticList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// Sort sorts l by the positions.
+func (l DiagnosticList) Sort() {
+	sort.Stable(byDiagnosticPos(l))
+}
+
+type byDiagnosticPos DiagnosticList
+
+func (s byDiagnosticPos) Len() int      { return len(s) }
+func (s byDiagnosticPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDiagnosticPos) Less(i, j int) bool {
+	a, b := s[i].Pos, s[j].Pos
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// diagnose makes err of the type switch node in file a Diagnostic at its position,
+// unless it is already a Diagnostic or a DiagnosticList.
+func (g Gen) diagnose(file *ast.File, node ast.Node, err error) DiagnosticList {
+	switch err := err.(type) {
+	case Diagnostic:
+		return DiagnosticList{err}
+	case DiagnosticList:
+		return err
+	}
+
+	return DiagnosticList{{Pos: g.position(file, node), Msg: err.Error()}}
+}
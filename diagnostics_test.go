@@ -0,0 +1,52 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticList(t *testing.T) {
+	var out bytes.Buffer
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		return nopCloser{&out}
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/coverage.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	err = g.doFiles(func(pkg *loader.PackageInfo, file *ast.File) error {
+		var diags DiagnosticList
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				diags = append(diags, g.diagnose(file, fd, fmt.Errorf("func %s", fd.Name.Name))...)
+			}
+		}
+		diags = append(diags, g.diagnose(file, file, Diagnostic{Pos: token.Position{Filename: "a.go", Line: 1, Column: 1}, Msg: "first"})...)
+		return diags.Err()
+	})
+
+	require.Error(t, err)
+	diags, ok := err.(DiagnosticList)
+	require.True(t, ok)
+	assert.Len(t, diags, 3)
+	assert.Equal(t, "a.go:1:1: first\ntestdata/coverage.go:5:1: func main\ntestdata/coverage.go:12:1: func describe", err.Error())
+
+	assert.Empty(t, out.String(), "files with diagnostics are not written")
+
+	assert.NoError(t, DiagnosticList{}.Err())
+	assert.Equal(t, "no position", Diagnostic{Msg: "no position"}.Error())
+}
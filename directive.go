@@ -0,0 +1,180 @@
+package gen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// expandDirective prefixes the comment right above a type switch configuring its expansion, like
+//
+//	//tsgen:expand types=int,string default=panic dedupe=true
+const expandDirective = "tsgen:expand"
+
+// switchDirective is the configuration of a type switch by its expandDirective, which overrides the settings of Gen.
+// The settings not given are left nil.
+type switchDirective struct {
+	// types are the types to expand the type switch by, in place of the ones at the call sites.
+	types []types.Type
+
+	// defaultPanic overrides Gen.DefaultPanic by default=panic or default=none.
+	defaultPanic *bool
+
+	// mergeCases overrides Gen.MergeCases by dedupe=<bool>.
+	mergeCases *bool
+
+	// templateMode overrides Gen.TemplateMode by templates=<mode>.
+	templateMode *TemplateMode
+
+	// maxCases overrides Gen.MaxCasesPerSwitch by max-cases=<n>.
+	maxCases *int
+
+	// strict overrides Gen.Strict by strict=<bool>.
+	strict *bool
+}
+
+// directiveComment returns the text of the expandDirective comment right above sw in file, or "" if none.
+func (g Gen) directiveComment(file *ast.File, sw *ast.TypeSwitchStmt) string {
+	cg := g.commentAbove(file, sw)
+	if cg == nil {
+		return ""
+	}
+
+	for _, c := range cg.List {
+		if strings.HasPrefix(c.Text, "//"+expandDirective) {
+			return strings.TrimPrefix(c.Text, "//")
+		}
+	}
+
+	return ""
+}
+
+// parseSwitchDirective parses the directive of the type switch sw in file of pkg, or returns nil if it has none.
+// The types are evaluated in the scope of sw, e.g. types=int,*bytes.Buffer, and written without spaces.
+func (g Gen) parseSwitchDirective(pkg *loader.PackageInfo, file *ast.File, sw *ast.TypeSwitchStmt) (*switchDirective, error) {
+	text := g.directiveComment(file, sw)
+	if text == "" {
+		return nil, nil
+	}
+
+	fail := func(format string, args ...interface{}) (*switchDirective, error) {
+		return nil, fmt.Errorf("invalid %s directive: %s", expandDirective, fmt.Sprintf(format, args...))
+	}
+
+	d := &switchDirective{}
+	for _, field := range strings.Fields(strings.TrimPrefix(text, expandDirective)) {
+		i := strings.Index(field, "=")
+		if i <= 0 {
+			return fail("%q must be <key>=<value>", field)
+		}
+		key, value := field[:i], field[i+1:]
+
+		switch key {
+		case "types":
+			for _, expr := range splitTypeList(value) {
+				tv, err := types.Eval(g.Loader.Fset, pkg.Pkg, sw.Pos(), expr)
+				if err != nil {
+					return fail("%s", err)
+				}
+				if !tv.IsType() {
+					return fail("%s is not a type", expr)
+				}
+				d.types = append(d.types, tv.Type)
+			}
+
+		case "default":
+			var b bool
+			switch value {
+			case "panic":
+				b = true
+			case "none":
+				b = false
+			default:
+				return fail("default must be panic or none, not %q", value)
+			}
+			d.defaultPanic = &b
+
+		case "dedupe", "strict":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fail("%s must be true or false, not %q", key, value)
+			}
+			if key == "dedupe" {
+				d.mergeCases = &b
+			} else {
+				d.strict = &b
+			}
+
+		case "templates":
+			mode, err := ParseTemplateMode(value)
+			if err != nil {
+				return fail("%s", err)
+			}
+			d.templateMode = &mode
+
+		case "max-cases":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fail("max-cases must be a non-negative integer, not %q", value)
+			}
+			d.maxCases = &n
+
+		default:
+			return fail("unknown key %q (known keys: types, default, dedupe, templates, max-cases, strict)", key)
+		}
+	}
+
+	return d, nil
+}
+
+// splitTypeList splits the comma-separated type expressions s, e.g. "int,map[string]int,func(int,string)",
+// at the commas not in brackets, braces or parentheses.
+func splitTypeList(s string) []string {
+	list := []string{}
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				list = append(list, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(list, s[start:])
+}
+
+// forStmt returns the copy of gen with the settings overridden by the directive of stmt, if any.
+func (gen Gen) forStmt(stmt *TypeSwitchStmt) Gen {
+	d := stmt.directive
+	if d == nil {
+		return gen
+	}
+
+	if d.defaultPanic != nil {
+		gen.DefaultPanic = *d.defaultPanic
+	}
+	if d.mergeCases != nil {
+		gen.MergeCases = *d.mergeCases
+	}
+	if d.templateMode != nil {
+		gen.TemplateMode = *d.templateMode
+	}
+	if d.maxCases != nil {
+		gen.MaxCasesPerSwitch = *d.maxCases
+	}
+	if d.strict != nil {
+		gen.Strict = *d.strict
+	}
+
+	return gen
+}
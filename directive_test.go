@@ -0,0 +1,52 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_Directive(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/directive.go")
+	require.NoError(t, err)
+
+	// the types are given by the directives, without analysis
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/directive.go"])
+	t.Log(out)
+
+	assert.Contains(t, out, "\tcase *bytes.Buffer:\n\t\treturn fmt.Sprint(v)\n\tcase int:\n\t\treturn fmt.Sprint(v)\n\tcase map[string]int:\n\t\treturn fmt.Sprint(v)\n")
+	assert.Contains(t, out, "\tdefault:\n\t\tpanic(")
+
+	assert.Contains(t, out, "\tswitch v.(type) {\n\tcase []int, []string:\n\t\treturn 1\n\t}\n")
+	assert.NotContains(t, out, "case []T:")
+	assert.Equal(t, 1, strings.Count(out, "default:"))
+}
+
+func TestParseSwitchDirective_Invalid(t *testing.T) {
+	for _, directive := range []string{
+		"types=Unknown",
+		"default=maybe",
+		"dedupe=yes",
+		"templates=hide",
+		"max-cases=-1",
+		"sort=name",
+		"types",
+	} {
+		g := New()
+		g.Overlay = map[string][]byte{
+			"testdata/directive.go": []byte("package testdata\n\ntype T interface{}\n\nfunc f(v interface{}) {\n\t//tsgen:expand " + directive + "\n\tswitch v := v.(type) {\n\tcase []T:\n\t\t_ = v\n\t}\n}\n"),
+		}
+		err := g.Loader.CreateFromFilenames("", "testdata/directive.go")
+		require.NoError(t, err)
+
+		_, err = g.ExpandBytes()
+		require.Error(t, err, directive)
+		assert.Contains(t, err.Error(), "invalid tsgen:expand directive: ", directive)
+	}
+}
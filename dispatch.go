@@ -0,0 +1,220 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// dispatchTableMarker prefixes the doc comment lines of the declarations of the dispatch table
+// of a function generated by Specialize, followed by the name of the function.
+const dispatchTableMarker = "// tsgen: dispatch table of "
+
+// dispatchTableOf returns the name of the function which decl declares or initializes the dispatch table of,
+// or an empty string if it is not generated by Specialize.
+func dispatchTableOf(decl ast.Decl) string {
+	var doc *ast.CommentGroup
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		doc = decl.Doc
+	case *ast.GenDecl:
+		doc = decl.Doc
+	}
+
+	if doc == nil {
+		return ""
+	}
+
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, dispatchTableMarker) {
+			return strings.TrimSpace(strings.TrimPrefix(c.Text, dispatchTableMarker))
+		}
+	}
+
+	return ""
+}
+
+// existingDispatchTables returns the declarations of the dispatch tables in pkg generated by the previous runs,
+// keyed by the names of the functions specialized.
+func existingDispatchTables(pkg *loader.PackageInfo) map[string][]ast.Decl {
+	existing := map[string][]ast.Decl{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			if name := dispatchTableOf(decl); name != "" {
+				existing[name] = append(existing[name], decl)
+			}
+		}
+	}
+
+	return existing
+}
+
+// planDispatchTable names the dispatch table of f if it has g.DispatchTableMin specializations or more,
+// and finds the declarations of the table and the lookup statement generated by the previous runs in existing,
+// which are replaced or removed.
+func (g Gen) planDispatchTable(f *specializedFunc, existing []ast.Decl) {
+	staleNames := map[string]bool{}
+	for _, decl := range existing {
+		if g.tokenFile(decl) != g.tokenFile(f.file) {
+			continue
+		}
+
+		f.staleTable = append(f.staleTable, decl)
+		if genDecl, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range genDecl.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok {
+					for _, name := range vs.Names {
+						staleNames[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	for i, st := range f.decl.Body.List {
+		if st == ast.Stmt(f.stmt.node) && i > 0 && isDispatchLookup(f.decl.Body.List[i-1], staleNames) {
+			f.staleLookup = f.decl.Body.List[i-1]
+		}
+	}
+
+	if g.DispatchTableMin <= 0 || len(f.specs) < g.DispatchTableMin {
+		return
+	}
+
+	taken := func(name string) bool {
+		return f.pkg.Pkg != nil && f.pkg.Pkg.Scope().Lookup(name) != nil && !staleNames[name]
+	}
+
+	f.table = f.decl.Name.Name + "Table"
+	for i := 2; taken(f.table); i++ {
+		f.table = f.decl.Name.Name + "Table" + strconv.Itoa(i)
+	}
+}
+
+// isDispatchLookup reports whether st is a lookup of one of the dispatch tables named names,
+// like if f, ok := keysTable[reflect.TypeOf(m)]; ok { ... }.
+func isDispatchLookup(st ast.Stmt, names map[string]bool) bool {
+	ifStmt, ok := st.(*ast.IfStmt)
+	if !ok {
+		return false
+	}
+
+	assign, ok := ifStmt.Init.(*ast.AssignStmt)
+	if !ok || len(assign.Rhs) != 1 {
+		return false
+	}
+
+	index, ok := assign.Rhs[0].(*ast.IndexExpr)
+	if !ok {
+		return false
+	}
+
+	ident, ok := index.X.(*ast.Ident)
+	return ok && names[ident.Name]
+}
+
+// dispatchSignature returns the parameters of f as written in the source src, and the results.
+func (g Gen) dispatchSignature(f *specializedFunc, src []byte) (params []string, results string) {
+	tf := g.tokenFile(f.file)
+	text := func(node ast.Node) string {
+		return string(src[tf.Offset(node.Pos()):tf.Offset(node.End())])
+	}
+
+	for _, field := range f.decl.Type.Params.List {
+		for _, name := range field.Names {
+			params = append(params, name.Name+" "+text(field.Type))
+		}
+	}
+
+	if f.decl.Type.Results != nil {
+		results = text(f.decl.Type.Results)
+	}
+
+	return
+}
+
+// dispatchArgs returns the arguments passing the parameters of f, with the subject replaced with subject.
+func dispatchArgs(f *specializedFunc, subject string) []string {
+	args := []string{}
+	for _, field := range f.decl.Type.Params.List {
+		for _, name := range field.Names {
+			args = append(args, name.Name)
+		}
+	}
+	args[f.paramPos] = subject
+
+	if _, variadic := f.decl.Type.Params.List[len(f.decl.Type.Params.List)-1].Type.(*ast.Ellipsis); variadic {
+		args[len(args)-1] += "..."
+	}
+
+	return args
+}
+
+// dispatchReturn returns the statements which call and return from call in f.
+func dispatchReturn(f *specializedFunc, call string) string {
+	if f.decl.Type.Results != nil && len(f.decl.Type.Results.List) > 0 {
+		return "return " + call
+	}
+
+	return call + "\nreturn"
+}
+
+// dispatchLookup returns the source of the statement of f which looks up the dispatch table
+// by the dynamic type of the subject and calls the specialization found, placed before the type switch.
+func (g Gen) dispatchLookup(f *specializedFunc) string {
+	used := map[string]bool{}
+	for _, field := range f.decl.Type.Params.List {
+		for _, name := range field.Names {
+			used[name.Name] = true
+		}
+	}
+
+	fn, ok := "specialized", "ok"
+	for used[fn] {
+		fn = fn + "_"
+	}
+	for used[ok] {
+		ok = ok + "_"
+	}
+
+	subject := f.stmt.subject().Name
+	reflectPkg := f.stmt.qualifier()(types.NewPackage("reflect", "reflect"))
+
+	call := fmt.Sprintf("%s(%s)", fn, strings.Join(dispatchArgs(f, subject), ", "))
+
+	return fmt.Sprintf("if %s, %s := %s[%s.TypeOf(%s)]; %s {\n%s\n}", fn, ok, f.table, reflectPkg, subject, ok, dispatchReturn(f, call))
+}
+
+// dispatchTableSource returns the source of the dispatch table of f, whose source file is src,
+// which maps the types to the functions calling the specializations.
+// The table is filled in an init function, as the specializations may refer to the table through f.
+func (g Gen) dispatchTableSource(f *specializedFunc, src []byte) string {
+	qf := f.stmt.qualifier()
+	reflectPkg := qf(types.NewPackage("reflect", "reflect"))
+	name := f.decl.Name.Name
+	subject := f.stmt.subject().Name
+
+	params, results := g.dispatchSignature(f, src)
+	funcType := fmt.Sprintf("func(%s) %s", strings.Join(params, ", "), results)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s maps the types of %s to the specializations of %s.\n", f.table, subject, name)
+	fmt.Fprintf(&buf, "%s%s\n", dispatchTableMarker, name)
+	fmt.Fprintf(&buf, "var %s = map[%s.Type]%s{}\n\n", f.table, reflectPkg, funcType)
+
+	fmt.Fprintf(&buf, "%s%s\n", dispatchTableMarker, name)
+	buf.WriteString("func init() {\n")
+	for _, spec := range f.specs {
+		typ := typeString(spec.in, qf)
+		call := fmt.Sprintf("%s(%s)", spec.name, strings.Join(dispatchArgs(f, fmt.Sprintf("%s.(%s)", subject, typ)), ", "))
+		fmt.Fprintf(&buf, "%s[%s.TypeOf((*%s)(nil)).Elem()] = %s {\n%s\n}\n", f.table, reflectPkg, typ, funcType, dispatchReturn(f, call))
+	}
+	buf.WriteString("}")
+
+	return buf.String()
+}
@@ -0,0 +1,324 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types"
+)
+
+// isErrorSwitch reports whether stmt switches on a value of type error.
+func isErrorSwitch(stmt *TypeSwitchStmt) bool {
+	x, _ := typeSwitchSubject(stmt.node)
+	if x == nil {
+		return false
+	}
+
+	t := stmt.info.TypeOf(x)
+	return t != nil && types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// errorsAsEdit is expandEdit for a type switch on an error with gen.ErrorsAs set.
+// The generated clauses ending with a return statement or a panic become errors.As checks
+// placed before the switch, which match the wrapped errors too:
+//
+//	if target := (*os.PathError)(nil); errors.As(err, &target) {
+//		err := target
+//		...
+//	}
+//
+// The checks generated by the previous runs are replaced. The other clauses are generated as cases,
+// as the control would flow from a check into the following checks and the switch.
+func (gen Gen) errorsAsEdit(stmt *TypeSwitchStmt, clauses []*ast.CaseClause) (sourceEdit, bool, error) {
+	x, bound := typeSwitchSubject(stmt.node)
+	subject := gen.showNode(x)
+	errorsPkg := stmt.qualifier()(types.NewPackage("errors", "errors"))
+
+	checks := []string{}
+	cases := []string{}
+	for _, clause := range clauses {
+		if len(clause.List) != 1 || !terminates(clause.Body) {
+			cases = append(cases, gen.showClause(stmt, clause))
+			continue
+		}
+
+		used := map[string]bool{}
+		ast.Inspect(clause, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+			return true
+		})
+		target := "target"
+		for used[target] || target == subject {
+			target = target + "_"
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "if %s := (%s)(nil); %s.As(%s, &%s) {\n", target, gen.showNode(clause.List[0]), errorsPkg, subject, target)
+		if bound != "" && refersTo(clause.Body, bound) {
+			fmt.Fprintf(&buf, "%s := %s\n", bound, target)
+		}
+		for _, st := range clause.Body {
+			buf.WriteString(gen.showNode(st) + "\n")
+		}
+		buf.WriteString("}")
+
+		checks = append(checks, buf.String())
+	}
+
+	edit, ok, err := gen.layoutEdit(stmt, cases)
+	if err != nil {
+		return sourceEdit{}, false, err
+	}
+
+	stale := gen.staleErrorChecks(stmt, subject)
+	if len(checks) == 0 && len(stale) == 0 {
+		return edit, ok, nil
+	}
+
+	src, err := gen.fileSource(stmt.file)
+	if err != nil {
+		return sourceEdit{}, false, err
+	}
+
+	tf := gen.tokenFile(stmt.file)
+	if !ok {
+		// the body of the switch is left as it is
+		edit = sourceEdit{
+			start: tf.Offset(stmt.node.Body.Lbrace),
+			end:   tf.Offset(stmt.node.Body.Rbrace) + 1,
+			text:  src[tf.Offset(stmt.node.Body.Lbrace) : tf.Offset(stmt.node.Body.Rbrace)+1],
+		}
+	}
+
+	start := stmt.node.Pos()
+	if len(stale) > 0 {
+		start = stale[0].Pos()
+	}
+
+	var buf bytes.Buffer
+	for _, check := range checks {
+		buf.WriteString(check + "\n\n")
+	}
+	buf.Write(src[tf.Offset(stmt.node.Pos()):edit.start])
+	buf.Write(edit.text)
+
+	return sourceEdit{start: tf.Offset(start), end: edit.end, text: buf.Bytes()}, true, nil
+}
+
+// staleErrorChecks returns the errors.As checks on subject generated by the previous runs,
+// which are the statements immediately preceding stmt.
+func (gen Gen) staleErrorChecks(stmt *TypeSwitchStmt, subject string) []ast.Stmt {
+	path, _ := astutil.PathEnclosingInterval(stmt.file, stmt.node.Pos(), stmt.node.End())
+
+	var list []ast.Stmt
+	if len(path) > 1 {
+		switch node := path[1].(type) {
+		case *ast.BlockStmt:
+			list = node.List
+		case *ast.CaseClause:
+			list = node.Body
+		case *ast.CommClause:
+			list = node.Body
+		}
+	}
+
+	i := -1
+	for k, st := range list {
+		if st == ast.Stmt(stmt.node) {
+			i = k
+		}
+	}
+	if i == -1 {
+		return nil
+	}
+
+	j := i
+	for j > 0 && isErrorCheck(list[j-1], subject) {
+		j--
+	}
+
+	return list[j:i]
+}
+
+// isErrorCheck reports whether st is an errors.As check on subject generated by errorsAsEdit,
+// like if target := (T)(nil); errors.As(subject, &target) { ... }.
+func isErrorCheck(st ast.Stmt, subject string) bool {
+	ifStmt, ok := st.(*ast.IfStmt)
+	if !ok || ifStmt.Else != nil {
+		return false
+	}
+
+	assign, ok := ifStmt.Init.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return false
+	}
+	target, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok {
+		return false
+	}
+	conv, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || len(conv.Args) != 1 {
+		return false
+	}
+	if _, ok := conv.Fun.(*ast.ParenExpr); !ok {
+		return false
+	}
+	if ident, ok := conv.Args[0].(*ast.Ident); !ok || ident.Name != "nil" {
+		return false
+	}
+
+	call, ok := ifStmt.Cond.(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return false
+	}
+	if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "As" {
+		return false
+	}
+	if ident, ok := call.Args[0].(*ast.Ident); !ok || ident.Name != subject {
+		return false
+	}
+	ref, ok := call.Args[1].(*ast.UnaryExpr)
+	if !ok || ref.Op != token.AND {
+		return false
+	}
+	ident, ok := ref.X.(*ast.Ident)
+	return ok && ident.Name == target.Name
+}
+
+// addWrappedErrors adds to cs the types of the errors wrapped by the arguments which are not converted
+// to interfaces at the call sites, e.g. fmt.Errorf("...: %w", &os.PathError{...}),
+// as if they were passed by other call sites at the same positions.
+func (g Gen) addWrappedErrors(cs *callSites) {
+	n := len(cs.args)
+	for i := 0; i < n; i++ {
+		pos := cs.positions[i]
+		pkg, path, _ := g.program.PathEnclosingInterval(pos, pos)
+		if pkg == nil {
+			continue
+		}
+
+		var call *ast.CallExpr
+		for _, node := range path {
+			if c, ok := node.(*ast.CallExpr); ok && c.Lparen == pos {
+				call = c
+				break
+			}
+		}
+		if call == nil {
+			continue
+		}
+
+		for j, arg := range cs.args[i] {
+			if arg != nil || j >= len(call.Args) {
+				continue
+			}
+
+			for _, t := range wrappedErrorTypes(&pkg.Info, call.Args[j]) {
+				args := make([]types.Type, len(cs.args[i]))
+				copy(args, cs.args[i])
+				args[j] = t
+
+				cs.args = append(cs.args, args)
+				cs.positions = append(cs.positions, pos)
+			}
+		}
+	}
+}
+
+// wrappedErrorTypes returns the concrete types of the errors wrapped by expr, which is
+// a call of fmt.Errorf with %w verbs or of errors.Join, looking into the nested calls.
+func wrappedErrorTypes(info *types.Info, expr ast.Expr) []types.Type {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.X
+	}
+
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return nil
+	}
+
+	var wrapped []ast.Expr
+	switch fn.Pkg().Path() + "." + fn.Name() {
+	case "fmt.Errorf":
+		if len(call.Args) == 0 {
+			return nil
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return nil
+		}
+		format, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return nil
+		}
+		for i, verb := range formatVerbs(format) {
+			if verb == 'w' && i+1 < len(call.Args) {
+				wrapped = append(wrapped, call.Args[i+1])
+			}
+		}
+	case "errors.Join":
+		wrapped = call.Args
+	default:
+		return nil
+	}
+
+	ts := []types.Type{}
+	for _, e := range wrapped {
+		t := info.TypeOf(e)
+		if t == nil {
+			continue
+		}
+		if types.IsInterface(t) {
+			ts = append(ts, wrappedErrorTypes(info, e)...)
+		} else {
+			ts = append(ts, t)
+		}
+	}
+
+	return ts
+}
+
+// formatVerbs returns the verbs of the format string of fmt.Printf and the like, one for each argument.
+// Explicit argument indexes are not supported.
+func formatVerbs(format string) []rune {
+	verbs := []rune{}
+	inVerb := false
+	for _, r := range format {
+		if !inVerb {
+			inVerb = r == '%'
+			continue
+		}
+
+		switch {
+		case r == '%':
+			inVerb = false
+		case r == '*':
+			// the width or precision taken from an argument
+			verbs = append(verbs, r)
+		case ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z'):
+			verbs = append(verbs, r)
+			inVerb = false
+		}
+	}
+
+	return verbs
+}
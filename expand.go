@@ -1,10 +1,18 @@
 package gen
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"sort"
 	"strings"
+	"time"
 
 	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
 	"golang.org/x/tools/go/loader"
 	"golang.org/x/tools/go/types"
 
@@ -14,9 +22,59 @@ import (
 // expandFileTypeSwitches is the main logic for "expand" mode.
 // May rewrite type switch statements in *ast.File file.
 func (g Gen) expandFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) error {
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+
+	edits, expansions, err := g.expandFileEdits(pkg, file, imports)
+	if err != nil {
+		return err
+	}
+
+	if g.Confirm != nil && len(edits) > 0 {
+		edits, err = g.confirmEdits(pkg, file, expansions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(edits) == 0 {
+		g.recordSwitches(pkg, expansions)
+		return nil
+	}
+
+	for _, e := range expansions {
+		if e.edited {
+			g.reportOwners(e.stmt, e.funcDecl, e.inTypes)
+			g.info(file, e.stmt.node, "expanded type switch", F("func", e.funcDecl.Name.Name), F("types", len(e.inTypes)))
+		}
+	}
+
+	err = g.editFileSource(file, edits)
+	if err != nil {
+		return err
+	}
+
+	g.recordSwitches(pkg, expansions)
+
+	imports.fix(g.Loader.Fset, file)
+
+	if g.GenerateTests {
+		return g.addCaseTests(pkg, file, expansions)
+	}
+
+	return nil
+}
+
+// expandFileEdits returns the edits to the source of file expanding its type switches, with the expansions of them,
+// validated if g.Validate is set. The imports the expanded cases need are added to imports.
+func (g Gen) expandFileEdits(pkg *loader.PackageInfo, file *ast.File, imports *fileImports) ([]sourceEdit, []*expansion, error) {
 	// XXX We can also obtain *loader.PackageInfo by:
 	// pkg, _, _ := g.program.PathEnclosingInterval(file.Pos(), file.End())
-	for _, decl := range file.Decls {
+	expansions := []*expansion{}
+
+	// the failures of the type switches, reported together
+	var diags DiagnosticList
+
+	for i, decl := range file.Decls {
 		funcDecl, ok := decl.(*ast.FuncDecl)
 		if !ok {
 			continue
@@ -27,294 +85,993 @@ func (g Gen) expandFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) err
 			continue
 		}
 
-		// For each type switch statements...
-		for _, stmt := range funcDecl.Body.List {
-			sw, ok := stmt.(*ast.TypeSwitchStmt)
-			if !ok {
-				continue
+		if !g.selectsFunc(pkg, funcDecl) {
+			continue
+		}
+
+		for _, fn := range withFuncLits(funcDecl) {
+			funcDecl, lit := fn.funcDecl, fn.lit
+
+			// For each type switch statements...
+			for j, stmt := range funcDecl.Body.List {
+				sw, ok := stmt.(*ast.TypeSwitchStmt)
+				if !ok {
+					continue
+				}
+
+				if !g.inRegion(file, sw) {
+					continue
+				}
+
+				g.log(file, sw, "type switch statement: %v", sw.Assign)
+
+				start := time.Now()
+
+				typeSwitch := &TypeSwitchStmt{
+					file:    file,
+					node:    sw,
+					info:    pkg.Info,
+					imports: imports,
+				}
+
+				if isGenericFunc(funcDecl) {
+					// its type parameters would be taken for type variables, and its call sites are of instantiations
+					if g.hasTemplates(typeSwitch) {
+						g.warn(file, sw, "type switch in generic function %s is not expanded", funcDecl.Name.Name)
+					}
+					continue
+				}
+
+				if err := g.checkTypeVariables(typeSwitch); err != nil {
+					diags = append(diags, g.diagnose(file, sw, err)...)
+					continue
+				}
+
+				directive, err := g.parseSwitchDirective(pkg, file, sw)
+				if err != nil {
+					diags = append(diags, g.diagnose(file, sw, err)...)
+					continue
+				}
+				typeSwitch.directive = directive
+
+				// the settings of the statement, overridden by its directive
+				g := g.forStmt(typeSwitch)
+
+				g.log(file, funcDecl, "enclosing func: %v", funcDecl.Type)
+
+				var inTypes []types.Type
+				if directive != nil && directive.types != nil {
+					inTypes = directive.types
+				} else if !pkg.TransitivelyErrorFree {
+					// not built into SSA
+					if g.hasTemplates(typeSwitch) {
+						g.warn(file, sw, "type switch in package %s is not expanded, as it or its imports have generic code", pkg.Pkg.Path())
+					}
+					continue
+				} else {
+					inTypes, err = g.possibleSubjectTypes(pkg, funcDecl, typeSwitch)
+					if err != nil {
+						if g.context().Err() != nil {
+							return nil, nil, err
+						}
+						diags = append(diags, g.diagnose(file, sw, err)...)
+						continue
+					}
+					inTypes = append(inTypes, g.implementingTypes(pkg, typeSwitch)...)
+				}
+
+				inTypes = canonicalTypes(inTypes)
+				inferred := inTypes
+
+				inTypes, err = g.limitCases(typeSwitch, funcDecl, inTypes)
+				if err != nil {
+					diags = append(diags, g.diagnose(file, sw, err)...)
+					continue
+				}
+
+				if g.Strict {
+					err := g.checkUnmatched(typeSwitch, funcDecl, inTypes)
+					if err != nil {
+						diags = append(diags, g.diagnose(file, sw, err)...)
+						g.refundCases(typeSwitch, inTypes)
+						continue
+					}
+				}
+
+				if g.Lint {
+					var lintDiags DiagnosticList
+					if err := g.checkExhaustive(typeSwitch, funcDecl, inTypes); err != nil {
+						lintDiags = append(lintDiags, g.diagnose(file, sw, err)...)
+					}
+					if err := g.checkUnreachable(typeSwitch, inTypes); err != nil {
+						lintDiags = append(lintDiags, g.diagnose(file, sw, err)...)
+					}
+					if len(lintDiags) > 0 {
+						diags = append(diags, lintDiags...)
+						g.refundCases(typeSwitch, inTypes)
+						continue
+					}
+				}
+
+				for _, inType := range inTypes {
+					// g.log(file, funcDecl, "argument type: %s (from %s)", inType, in[0].Caller.Func)
+					g.log(file, funcDecl, "argument type: %s", inType)
+				}
+
+				g.reportCoverage(typeSwitch, funcDecl, inTypes)
+
+				expansions = append(expansions, &expansion{
+					stmt:      typeSwitch,
+					funcDecl:  funcDecl,
+					inTypes:   inTypes,
+					inferred:  inferred,
+					declIndex: i,
+					lit:       lit,
+					stmtIndex: j,
+					elapsed:   g.Metrics.since(start),
+				})
 			}
+		}
+	}
 
-			g.log(file, sw, "type switch statement: %s", sw.Assign)
+	if len(diags) > 0 {
+		// none of the type switches of the file are expanded
+		for _, e := range expansions {
+			g.forStmt(e.stmt).refundCases(e.stmt, e.inTypes)
+		}
+		return nil, nil, diags
+	}
 
-			typeSwitch := &typeSwitchStmt{
-				file: file,
-				node: sw,
-				info: pkg.Info,
+	for {
+		// Finally rewrite it
+		edits := []sourceEdit{}
+		for _, e := range expansions {
+			start := time.Now()
+			edit, ok, err := g.forStmt(e.stmt).expandEdit(e.stmt, e.inTypes)
+			if err != nil {
+				return nil, nil, err
 			}
+			e.elapsed += g.Metrics.since(start)
+			e.edited = ok
+			if ok {
+				e.edit = edit
+				edits = append(edits, edit)
+			}
+		}
 
-			g.log(file, funcDecl, "enclosing func: %s", funcDecl.Type)
+		if len(edits) == 0 {
+			return nil, expansions, nil
+		}
 
-			inTypes, err := g.possibleSubjectTypes(pkg, funcDecl, typeSwitch)
+		if g.Validate {
+			invalid, err := g.invalidCases(pkg, file, edits, expansions)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 
-			for _, inType := range inTypes {
-				// g.log(file, funcDecl, "argument type: %s (from %s)", inType, in[0].Caller.Func)
-				g.log(file, funcDecl, "argument type: %s", inType)
+			if len(invalid) > 0 {
+				if !g.SkipInvalidCases {
+					return nil, nil, g.invalidCasesError(invalid)
+				}
+
+				for _, c := range invalid {
+					g.warn(file, c.expansion.stmt.node, "skipping case %s: %s", c.typ, c.err)
+					g.forStmt(c.expansion.stmt).refundCases(c.expansion.stmt, []types.Type{c.typ})
+					c.expansion.remove(c.typ)
+				}
+				continue
 			}
+		}
+
+		return edits, expansions, nil
+	}
+}
 
-			// Finally rewrite it
-			*sw = *g.expand(typeSwitch, inTypes)
+// expansion is a type switch statement to be expanded for the types inTypes.
+type expansion struct {
+	stmt     *TypeSwitchStmt
+	funcDecl *ast.FuncDecl
+	inTypes  []types.Type
+
+	// inferred are the types inferred at the call sites, before limited by g.MaxCasesPerSwitch and the like.
+	inferred []types.Type
+
+	// declIndex, lit and stmtIndex locate stmt in the file, which are kept after rewriting:
+	// stmt is the stmtIndex-th statement of the declaration, or of its lit-th function literal if not 0.
+	declIndex, lit, stmtIndex int
+
+	// edited is whether stmt is rewritten, by edit.
+	edited bool
+	edit   sourceEdit
+
+	// elapsed is the time spent on stmt, recorded in g.Metrics.
+	elapsed time.Duration
+}
+
+// remove removes the type t from the types to expand.
+func (e *expansion) remove(t types.Type) {
+	inTypes := []types.Type{}
+	for _, in := range e.inTypes {
+		if !types.Identical(in, t) {
+			inTypes = append(inTypes, in)
 		}
 	}
+	e.inTypes = inTypes
+}
 
-	return nil
+// limitCases checks the number of cases the expansion of stmt generates for inTypes against g.MaxCasesPerSwitch
+// and g.MaxCasesTotal, counting those of the type switches nested in the templates but not the types with
+// hand-written case clauses or matching no template, which generate none.
+// If exceeded, it returns an error describing the types and the call sites contributed them,
+// or truncates inTypes with a warning if g.TruncateCases is set.
+// The cases of the types returned are counted into the total, to be refunded by refundCases if not expanded.
+func (g Gen) limitCases(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, inTypes []types.Type) ([]types.Type, error) {
+	var total int
+	if g.totalCases != nil {
+		g.totalCases.Lock()
+		defer g.totalCases.Unlock()
+		total = g.totalCases.n
+	}
+
+	handWritten := g.handWrittenTypes(stmt)
+	counts := make([]int, len(inTypes))
+	generating := []types.Type{}
+	n := 0
+	for i, t := range inTypes {
+		counts[i] = g.generatedCases(stmt, t, handWritten)
+		if counts[i] > 0 {
+			generating = append(generating, t)
+		}
+		n += counts[i]
+	}
+
+	max := n
+	if g.MaxCasesPerSwitch > 0 && max > g.MaxCasesPerSwitch {
+		max = g.MaxCasesPerSwitch
+	}
+	if g.MaxCasesTotal > 0 && total+max > g.MaxCasesTotal {
+		max = g.MaxCasesTotal - total
+		if max < 0 {
+			max = 0
+		}
+	}
+
+	if max < n {
+		pos := g.Loader.Fset.Position(stmt.node.Pos())
+		msg := fmt.Sprintf("type switch would have %d expanded cases (max per switch %d, max total %d, expanded so far %d)", n, g.MaxCasesPerSwitch, g.MaxCasesTotal, total)
+		msg = msg + g.typeSitesMessage(stmt, funcDecl, generating)
+
+		if !g.TruncateCases {
+			return nil, Diagnostic{Pos: pos, Msg: msg, Rule: RuleTooManyCases}
+		}
+
+		g.warn(nil, nil, "%s: %s\ntruncated to %d cases", pos, msg, max)
+
+		// the types generating no cases are kept
+		truncated := []types.Type{}
+		n = 0
+		for i, t := range inTypes {
+			if n+counts[i] > max {
+				continue
+			}
+			truncated = append(truncated, t)
+			n += counts[i]
+		}
+		inTypes = truncated
+	}
+
+	if g.totalCases != nil {
+		g.totalCases.n += n
+	}
+
+	return inTypes, nil
+}
+
+// refundCases takes the cases the expansion of stmt generates for inTypes, which limitCases has counted
+// against g.MaxCasesTotal, back from the total, as stmt is not expanded for them after all.
+func (g Gen) refundCases(stmt *TypeSwitchStmt, inTypes []types.Type) {
+	if g.totalCases == nil {
+		return
+	}
+
+	handWritten := g.handWrittenTypes(stmt)
+	n := 0
+	for _, t := range inTypes {
+		n += g.generatedCases(stmt, t, handWritten)
+	}
+
+	g.totalCases.Lock()
+	defer g.totalCases.Unlock()
+	g.totalCases.n -= n
 }
 
-// typeSwitchStmt represents a parsed type switch statement.
-type typeSwitchStmt struct {
+// generatedCases returns the number of the case clauses the expansion of stmt generates for the type in:
+// none if in is of handWritten, the types of the hand-written case clauses, or matches no template,
+// or else one, with the clauses generated in the type switches nested in the template by applyNested.
+func (g Gen) generatedCases(stmt *TypeSwitchStmt, in types.Type, handWritten []types.Type) int {
+	if containsIdentical(handWritten, in) {
+		return 0
+	}
+
+	t, m, _ := g.findMatchingTemplate(stmt, in)
+	if t == nil {
+		return 0
+	}
+
+	// the warnings are given by the expansion
+	quiet := g
+	quiet.Logger = NewTextLogger(ioutil.Discard, false)
+
+	n := 1
+	for _, nested := range quiet.nestedExpansions(stmt, t, m, in) {
+		nestedHandWritten := g.handWrittenTypes(nested.stmt)
+		for _, nestedIn := range nested.inTypes {
+			n += g.generatedCases(nested.stmt, nestedIn, nestedHandWritten)
+		}
+	}
+
+	return n
+}
+
+// hasTemplates reports whether stmt has any template clause.
+func (g Gen) hasTemplates(stmt *TypeSwitchStmt) bool {
+	for _, st := range stmt.node.Body.List {
+		if g.isTemplateClause(stmt, st.(*ast.CaseClause)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkUnmatched returns an error describing the types of inTypes which match no template of stmt
+// and have no hand-written case clauses, with the call sites contributed them, for g.Strict.
+// Type switches without templates are not checked.
+func (g Gen) checkUnmatched(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, inTypes []types.Type) error {
+	if !g.hasTemplates(stmt) {
+		return nil
+	}
+
+	handWritten := g.handWrittenTypes(stmt)
+	unmatched := []types.Type{}
+	for _, t := range inTypes {
+		if containsIdentical(handWritten, t) {
+			continue
+		}
+		if tmpl, _, _ := g.findMatchingTemplate(stmt, t); tmpl == nil {
+			unmatched = append(unmatched, t)
+		}
+	}
+	if len(unmatched) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%d argument types match no template of the type switch", len(unmatched))
+	msg = msg + g.typeSitesMessage(stmt, funcDecl, unmatched)
+
+	return Diagnostic{Pos: g.Loader.Fset.Position(stmt.node.Pos()), Msg: msg, Rule: RuleUnmatchedType}
+}
+
+// TypeSwitchStmt is a type switch statement with the type information of its file,
+// whose template clauses are expanded by FindMatchingTemplate and Inflate.
+type TypeSwitchStmt struct {
 	file *ast.File
 	node *ast.TypeSwitchStmt
 	info types.Info
+
+	// sites are the call sites of the enclosing function which reach the statement,
+	// used to expand nested type switches by the observed argument types.
+	sites *callSites
+
+	// imports are the imports of the file, by which the types in the generated clauses are qualified.
+	imports *fileImports
+
+	// generated are the types of the clauses generated by the last expansion.
+	generated []types.Type
+
+	// comments are the comments of the templates the clauses generated by the last expansion are printed with.
+	comments map[*ast.CaseClause][]*ast.CommentGroup
+
+	// provenance are the comments noting the origins of the clauses generated by the last expansion,
+	// with gen.Provenance.
+	provenance map[*ast.CaseClause][]string
+
+	// directive is the configuration of the statement by its directive comment, if any.
+	directive *switchDirective
+}
+
+// qualifier returns the qualifier of the types written in the generated clauses of stmt.
+// Without imports, the types are qualified by the package names except for the package of the file.
+func (stmt TypeSwitchStmt) qualifier() types.Qualifier {
+	if stmt.imports != nil {
+		return stmt.imports.qualifier
+	}
+
+	return func(pkg *types.Package) string {
+		if pkg.Name() == stmt.file.Name.Name {
+			return ""
+		}
+		return pkg.Name()
+	}
 }
 
-// typeMatchResult is a type variable name to concrete type mapping
-type typeMatchResult map[string]types.Type
+// NewTypeSwitchStmt returns the TypeSwitchStmt of node in file, type-checked into info.
+// Without a loaded program, only the empty interfaces with all-uppercase names are type variables.
+func NewTypeSwitchStmt(file *ast.File, node *ast.TypeSwitchStmt, info *types.Info) *TypeSwitchStmt {
+	return &TypeSwitchStmt{file: file, node: node, info: *info}
+}
 
-func (stmt typeSwitchStmt) templates() []template {
-	templates := []template{}
+// templates returns the templates of the case clauses of stmt, one for each of the case types.
+func (stmt TypeSwitchStmt) templates() []Template {
+	templates := []Template{}
 
 	for _, clause := range stmt.node.Body.List {
 		clause := clause.(*ast.CaseClause) // must not fail
 
-		if len(clause.List) != 1 { // XXX should/can we support multiple patterns?
-			continue
+		comments := []*ast.CommentGroup{}
+		if stmt.file != nil {
+			for _, cg := range stmt.file.Comments {
+				if clause.Colon < cg.Pos() && cg.End() <= clause.End() {
+					comments = append(comments, cg)
+				}
+			}
 		}
 
-		tmpl := template{
-			typePattern: stmt.info.TypeOf(clause.List[0]),
-			caseClause:  clause,
+		for i, e := range clause.List {
+			tmpl := Template{
+				Pattern:  &TypePattern{Type: stmt.info.TypeOf(e), lenVars: lengthVariables(e, &stmt.info)},
+				Clause:   clause,
+				Comments: comments,
+				index:    i,
+			}
+			templates = append(templates, tmpl)
 		}
-		templates = append(templates, tmpl)
 	}
 
 	return templates
 }
 
-// findMatchingTemplate finds the first matching template to the input type in and returns the template and a typeMatchResult.
-func (gen Gen) findMatchingTemplate(stmt *typeSwitchStmt, in types.Type) (*template, typeMatchResult) {
+// FindMatchingTemplate finds the first template clause of stmt whose pattern matches the input type in,
+// and returns the template and the types bound to its type variables, or nil if none matched.
+// Only the case types with type variables are considered as patterns.
+// The clauses with multiple case types, e.g. case []T, map[string]T:, are templates only if FeatureUnions is enabled.
+func (gen Gen) FindMatchingTemplate(stmt *TypeSwitchStmt, in types.Type) (*Template, Bindings) {
+	t, m, _ := gen.findMatchingTemplate(stmt, in)
+	return t, m
+}
+
+// findMatchingTemplate is like FindMatchingTemplate, but also returns the reasons which prevented the templates
+// from matching, e.g. the violations of the bounds of type variables or their conflicting bindings.
+func (gen Gen) findMatchingTemplate(stmt *TypeSwitchStmt, in types.Type) (*Template, Bindings, []matchFailure) {
+	violations := []matchFailure{}
+
 	for _, t := range stmt.templates() {
-		m := typeMatchResult{}
-		if gen.typeMatches(stmt, t.typePattern, in, m) {
-			return &t, m
+		if len(t.Clause.List) > 1 && !gen.enabled(FeatureUnions) {
+			continue
 		}
+
+		if len(gen.exprTypeVariables(stmt, t.Clause.List[t.index])) == 0 {
+			continue
+		}
+
+		t.Pattern.isVar = gen.isTypeVariable
+		t.Pattern.matchLen = gen.enabled(FeatureArrays)
+		t.Pattern.matchMethods = gen.enabled(FeatureInterfaces) || gen.Implements
+		t.Pattern.mode = gen.MatchMode
+		m, vs := t.Pattern.match(in)
+		if m != nil {
+			return &t, m, nil
+		}
+
+		violations = append(violations, vs...)
 	}
 
-	return nil, nil
+	return nil, nil, violations
 }
 
-// expand generates a type switch statement with expanded clauses for input types ins.
-func (gen Gen) expand(stmt *typeSwitchStmt, ins []types.Type) *ast.TypeSwitchStmt {
+// canonicalTypes sorts types by their string representations and removes duplicates
+// in terms of types.Identical, so that the expansion results do not depend on
+// the order of call graph edges nor the number of call sites.
+func canonicalTypes(ts []types.Type) []types.Type {
+	sorted := make([]types.Type, len(ts))
+	copy(sorted, ts)
+	sort.Stable(byTypeString(sorted))
+
+	result := []types.Type{}
+	for _, t := range sorted {
+		if !containsIdentical(result, t) {
+			result = append(result, t)
+		}
+	}
+
+	return result
+}
+
+// containsIdentical reports whether ts contains a type identical to t.
+func containsIdentical(ts []types.Type, t types.Type) bool {
+	for _, u := range ts {
+		if types.Identical(t, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type byTypeString []types.Type
+
+func (s byTypeString) Len() int           { return len(s) }
+func (s byTypeString) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTypeString) Less(i, j int) bool { return s[i].String() < s[j].String() }
+
+// Inflate generates a copy of the type switch statement with the clauses expanded for the input types ins
+// from its templates. Expanded clauses are placed before the existing ones in the order of ins,
+// and the types which already have hand-written clauses or match no template are skipped.
+func (gen Gen) Inflate(stmt *TypeSwitchStmt, ins []types.Type) *ast.TypeSwitchStmt {
 	node := astutil.CopyNode(stmt.node).(*ast.TypeSwitchStmt)
-	seen := map[string]bool{}
+
+	clauses := []ast.Stmt{}
+	for _, clause := range gen.expandClauses(stmt, ins) {
+		clauses = append(clauses, clause)
+	}
+
+	node.Body.List = append(clauses, node.Body.List...)
+
+	return node
+}
+
+// expandClauses generates case clauses for input types ins from the template clauses of stmt.
+// Types which already have hand-written case clauses are skipped.
+func (gen Gen) expandClauses(stmt *TypeSwitchStmt, ins []types.Type) []*ast.CaseClause {
+	clauses := []*ast.CaseClause{}
+	seen := gen.handWrittenTypes(stmt)
+	stmt.generated = nil
+	stmt.comments = map[*ast.CaseClause][]*ast.CommentGroup{}
+	stmt.provenance = map[*ast.CaseClause][]string{}
 	for _, in := range ins {
-		if seen[in.String()] {
+		if containsIdentical(seen, in) {
+			gen.log(stmt.file, stmt.node, "%s already has a case clause", in)
 			continue
 		}
 
-		t, m := gen.findMatchingTemplate(stmt, in)
+		// e.g. a value of an unexported type returned by a function of another package
+		if obj := stmt.unnameable(in); obj != nil {
+			gen.warn(stmt.file, stmt.node, "%s is skipped: %s is unexported in package %s", in, obj.Name(), obj.Pkg().Path())
+			continue
+		}
+
+		t, m, violations := gen.findMatchingTemplate(stmt, in)
 		if t == nil {
-			// TODO error reporting
+			for _, v := range violations {
+				gen.warn(stmt.file, stmt.node, "%s is skipped: %s", in, v)
+			}
+			gen.log(stmt.file, stmt.node, "%s matched no template", in)
+			continue
 		}
 
-		gen.log(stmt.file, stmt.node, "%s matched to %s -> %s", in, t.typePattern, m)
+		gen.log(stmt.file, stmt.node, "%s matched to %s -> %s", in, t.Pattern, m)
+
+		clause := gen.applyNested(stmt, t, m, in)
+		gen.hygiene(stmt, t, clause, m, in)
+
+		// A type matched by its underlying type, e.g. Celsius by float64, needs a case of itself to be caught,
+		// and one matched by its methods has a case of itself with Implements
+		if gen.MatchMode != MatchNamed || gen.Implements && isInterfacePattern(t.Pattern) {
+			expr, err := parser.ParseExpr(typeString(in, stmt.qualifier()))
+			if err != nil {
+				gen.warn(stmt.file, stmt.node, "%s is skipped: %s", in, err)
+				continue
+			}
+			clause.List = []ast.Expr{expr}
+		}
 
-		clause := t.apply(m)
-		node.Body.List = append(
-			[]ast.Stmt{clause},
-			node.Body.List...,
-		)
+		clauses = append(clauses, clause)
+		stmt.generated = append(stmt.generated, in)
+		stmt.comments[clause] = append(t.Comments, gen.trailingComments(stmt, t.Clause)...)
+		if gen.Provenance {
+			stmt.provenance[clause] = []string{gen.provenanceComment(stmt, t, m, in)}
+		}
 
-		seen[in.String()] = true
+		seen = append(seen, in)
 	}
 
-	return node
-}
+	if gen.MergeCases {
+		clauses = gen.mergeClauses(stmt, clauses)
+	}
 
-// subject returns the variable ast.Ident of interest of type-switch.
-// TODO: support other forms than `switch y := x.(type)`, otherwise panics
-func (stmt typeSwitchStmt) subject() *ast.Ident {
-	return stmt.node.Assign.(*ast.AssignStmt).Rhs[0].(*ast.TypeAssertExpr).X.(*ast.Ident)
+	return clauses
 }
 
-// caseTypes returns the map to clauses from their type cases.
-func (stmt typeSwitchStmt) caseTypes() map[types.Type]*ast.CaseClause {
-	cases := map[types.Type]*ast.CaseClause{}
-	for _, cc := range stmt.node.Body.List {
-		cc := cc.(*ast.CaseClause) // should not fail
-		if cc.List == nil {        // the "default" case
-			cases[nil] = cc
+// mergeClauses merges the clauses with identical bodies into multi-type case clauses, e.g. case int, string:,
+// in the position of the first of them. Clauses referring to the variable bound by the switch are not merged,
+// as its type in a multi-type case clause is not of the case type but of the switch expression.
+func (gen Gen) mergeClauses(stmt *TypeSwitchStmt, clauses []*ast.CaseClause) []*ast.CaseClause {
+	varName := ""
+	if assign, ok := stmt.node.Assign.(*ast.AssignStmt); ok {
+		varName = assign.Lhs[0].(*ast.Ident).Name
+	}
+
+	merged := []*ast.CaseClause{}
+	byBody := map[string]*ast.CaseClause{}
+	for _, clause := range clauses {
+		if varName != "" && refersTo(clause.Body, varName) {
+			merged = append(merged, clause)
 			continue
 		}
 
-		for _, e := range cc.List {
-			t := stmt.info.TypeOf(e)
-			cases[t] = cc
+		body := make([]string, len(clause.Body))
+		for i, st := range clause.Body {
+			body[i] = gen.showNode(st)
+		}
+		key := strings.Join(body, "\n")
+
+		if first, ok := byBody[key]; ok {
+			first.List = append(first.List, clause.List...)
+			stmt.provenance[first] = append(stmt.provenance[first], stmt.provenance[clause]...)
+			continue
 		}
+
+		byBody[key] = clause
+		merged = append(merged, clause)
 	}
 
-	return cases
+	return merged
 }
 
-// template represents a clause template.
-type template struct {
-	// typePattern is a type wich type variables e.g. map[string]T, func(T) (S, error).
-	typePattern types.Type
+// refersTo reports whether any of the statements has an identifier named name.
+func refersTo(stmts []ast.Stmt, name string) bool {
+	found := false
+	for _, st := range stmts {
+		ast.Inspect(st, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok && ident.Name == name {
+				found = true
+			}
+			return !found
+		})
+	}
 
-	// caseClause is a clause template with type variables.
-	caseClause *ast.CaseClause
+	return found
 }
 
-// typeMatches is a helper function for FindMatchingTemplate
-func (gen Gen) typeMatches(stmt *typeSwitchStmt, pat, in types.Type, m typeMatchResult) bool {
-	switch pat := pat.(type) {
-	case *types.Array:
-		in, ok := in.(*types.Array)
-		if !ok {
-			return false
+// handWrittenTypes returns the types of the case clauses in stmt
+// which are neither templates nor generated by the previous runs.
+func (gen Gen) handWrittenTypes(stmt *TypeSwitchStmt) []types.Type {
+	ts := []types.Type{}
+
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		if gen.isTemplateClause(stmt, clause) || gen.isGeneratedClause(stmt, clause) {
+			continue
 		}
 
-		return gen.typeMatches(stmt, pat.Elem(), in.Elem(), m)
+		for _, e := range clause.List {
+			ts = append(ts, stmt.info.TypeOf(e))
+		}
+	}
 
-	case *types.Basic:
-		return types.Identical(pat, in)
+	return ts
+}
 
-	case *types.Chan:
-		in, ok := in.(*types.Chan)
-		if !ok {
-			return false
-		}
+// applyNested applies m to the template t like t.apply, also expanding the type switches
+// nested in the template clause whose subjects are other parameters of the enclosing function.
+// The nested switches are expanded only by the argument types observed at the call sites
+// where the subject of stmt is of type in, not by all the combinations,
+// unless gen.NestedFullProduct is set.
+// Nested switches whose type variables are all bound by m are left to be filled by m.
+func (gen Gen) applyNested(stmt *TypeSwitchStmt, t *Template, m Bindings, in types.Type) *ast.CaseClause {
+	nested := gen.nestedExpansions(stmt, t, m, in)
+	if len(nested) == 0 {
+		return t.apply(m, stmt.qualifier())
+	}
 
-		if pat.Dir() != in.Dir() {
-			return false
-		}
+	body := t.Clause.Body
+	defer func() { t.Clause.Body = body }()
 
-		return gen.typeMatches(stmt, pat.Elem(), in.Elem(), m)
+	t.Clause.Body = make([]ast.Stmt, len(body))
+	copy(t.Clause.Body, body)
 
-	case *types.Interface:
-		in, ok := in.(*types.Interface)
-		if !ok {
-			return false
-		}
+	for _, n := range nested {
+		gen.log(stmt.file, n.stmt.node, "nested type switch: %s for %s", n.inTypes, in)
 
-		// XXX is it OK?
-		return types.Identical(pat, in)
+		t.Clause.Body[n.index] = gen.Inflate(n.stmt, n.inTypes)
+	}
 
-	case *types.Map:
-		in, ok := in.(*types.Map)
-		if !ok {
-			return false
-		}
+	return t.apply(m, stmt.qualifier())
+}
 
-		if !gen.typeMatches(stmt, pat.Key(), in.Key(), m) {
-			return false
-		}
-		if !gen.typeMatches(stmt, pat.Elem(), in.Elem(), m) {
-			return false
-		}
+// nestedExpansion is a type switch nested in a template clause, to be expanded by inTypes.
+type nestedExpansion struct {
+	// index is the index of the type switch in the body of the clause.
+	index int
 
-		return true
+	stmt    *TypeSwitchStmt
+	inTypes []types.Type
+}
 
-	case *types.Named:
-		if gen.isTypeVariable(pat) {
-			m[pat.Obj().Name()] = in
-			return true
-		}
+// nestedExpansions returns the type switches nested in the template t of stmt which applyNested expands
+// when t is applied with m for the type in, with their argument types.
+func (gen Gen) nestedExpansions(stmt *TypeSwitchStmt, t *Template, m Bindings, in types.Type) []nestedExpansion {
+	if stmt.sites == nil {
+		return nil
+	}
 
-		return pat.String() == in.String()
+	pos := subjectParamPos(&stmt.info, stmt.sites.funcDecl, stmt)
+	if pos == -1 {
+		return nil
+	}
 
-	case *types.Pointer:
-		in, ok := in.(*types.Pointer)
+	expansions := []nestedExpansion{}
+	for i, st := range t.Clause.Body {
+		sw, ok := st.(*ast.TypeSwitchStmt)
 		if !ok {
-			return false
+			continue
 		}
 
-		return gen.typeMatches(stmt, pat.Elem(), in.Elem(), m)
+		nested := &TypeSwitchStmt{
+			file:    stmt.file,
+			node:    sw,
+			info:    stmt.info,
+			sites:   stmt.sites.having(pos, in),
+			imports: stmt.imports,
+		}
 
-	case *types.Signature:
-		in, ok := in.(*types.Signature)
-		if !ok {
-			return false
+		if !gen.hasUnboundTypeVariables(nested, m) {
+			continue
 		}
 
-		if !gen.typeMatches(stmt, pat.Params(), in.Params(), m) {
-			return false
+		nestedPos := subjectParamPos(&stmt.info, stmt.sites.funcDecl, nested)
+		if nestedPos == -1 {
+			continue
 		}
 
-		if !gen.typeMatches(stmt, pat.Results(), in.Results(), m) {
-			return false
+		if gen.NestedFullProduct && gen.withinProductMax(stmt, nested, pos, nestedPos, in) {
+			nested.sites = stmt.sites
 		}
 
+		expansions = append(expansions, nestedExpansion{
+			index:   i,
+			stmt:    nested,
+			inTypes: canonicalTypes(nested.sites.typesAt(nestedPos)),
+		})
+	}
+
+	return expansions
+}
+
+// withinProductMax reports whether the full product of the types of the subjects of stmt and nested,
+// at the parameters pos and nestedPos, is within gen.NestedProductMax.
+// Exceeding it is warned once for nested, when applied for the first of the types in of stmt.
+func (gen Gen) withinProductMax(stmt, nested *TypeSwitchStmt, pos, nestedPos int, in types.Type) bool {
+	if gen.NestedProductMax <= 0 {
 		return true
+	}
 
-	case *types.Slice:
-		in, ok := in.(*types.Slice)
-		if !ok {
-			return false
+	outer := canonicalTypes(stmt.sites.typesAt(pos))
+	n := len(outer) * len(canonicalTypes(stmt.sites.typesAt(nestedPos)))
+	if n <= gen.NestedProductMax {
+		return true
+	}
+
+	if len(outer) > 0 && types.Identical(outer[0], in) {
+		gen.warn(stmt.file, nested.node, "nested type switch would have %d type pairs (max %d); expanding only the pairs observed", n, gen.NestedProductMax)
+	}
+
+	return false
+}
+
+// hasUnboundTypeVariables reports whether any of the case clauses of stmt has
+// type variables which are not bound in m.
+func (gen Gen) hasUnboundTypeVariables(stmt *TypeSwitchStmt, m Bindings) bool {
+	for _, clause := range stmt.node.Body.List {
+		for _, name := range gen.clauseTypeVariables(stmt, clause.(*ast.CaseClause)) {
+			if _, bound := m[name]; !bound {
+				return true
+			}
 		}
+	}
 
-		return gen.typeMatches(stmt, pat.Elem(), in.Elem(), m)
+	return false
+}
+
+// isTemplateClause reports whether the clause is a template, whose case types have type variables.
+func (gen Gen) isTemplateClause(stmt *TypeSwitchStmt, clause *ast.CaseClause) bool {
+	return len(gen.clauseTypeVariables(stmt, clause)) > 0
+}
+
+// clauseTypeVariables returns the names of type variables in the case types of clause,
+// including the length variables of array patterns if FeatureArrays is enabled.
+func (gen Gen) clauseTypeVariables(stmt *TypeSwitchStmt, clause *ast.CaseClause) []string {
+	names := []string{}
+
+	for _, e := range clause.List {
+		names = append(names, gen.exprTypeVariables(stmt, e)...)
+	}
+
+	return names
+}
+
+// exprTypeVariables returns the names of type variables in the case type expression e of stmt.
+func (gen Gen) exprTypeVariables(stmt *TypeSwitchStmt, e ast.Expr) []string {
+	names := []string{}
+
+	if gen.enabled(FeatureArrays) {
+		for _, name := range lengthVariables(e, &stmt.info) {
+			names = append(names, name)
+		}
+	}
 
-	case *types.Struct:
-		in, ok := in.(*types.Struct)
+	ast.Inspect(e, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
 		if !ok {
-			return false
+			return true
 		}
 
-		if pat.NumFields() != in.NumFields() {
-			return false
+		tn, ok := stmt.info.Uses[ident].(*types.TypeName)
+		if !ok {
+			return true
 		}
 
-		for i := 0; i < pat.NumFields(); i++ {
-			if !gen.typeMatches(stmt, pat.Field(i).Type(), in.Field(i).Type(), m) {
-				return false
-			}
+		if named, ok := tn.Type().(*types.Named); ok && gen.isTypeVariable(named) {
+			names = append(names, named.Obj().Name())
 		}
 
 		return true
+	})
 
-	case *types.Tuple:
-		in, ok := in.(*types.Tuple)
-		if !ok {
-			return false
-		}
+	return names
+}
 
-		if pat.Len() != in.Len() {
-			return false
+// subject returns the variable ast.Ident of interest of type-switch,
+// or nil if it switches on another expression, e.g. a selector or a call.
+func (stmt TypeSwitchStmt) subject() *ast.Ident {
+	x, _ := typeSwitchSubject(stmt.node)
+	ident, _ := x.(*ast.Ident)
+	return ident
+}
+
+// caseTypes returns the map to clauses from their type cases.
+func (stmt TypeSwitchStmt) caseTypes() map[types.Type]*ast.CaseClause {
+	cases := map[types.Type]*ast.CaseClause{}
+	for _, cc := range stmt.node.Body.List {
+		cc := cc.(*ast.CaseClause) // should not fail
+		if cc.List == nil {        // the "default" case
+			cases[nil] = cc
+			continue
 		}
 
-		for i := 0; i < pat.Len(); i++ {
-			if !gen.typeMatches(stmt, pat.At(i).Type(), in.At(i).Type(), m) {
-				return false
-			}
+		for _, e := range cc.List {
+			t := stmt.info.TypeOf(e)
+			cases[t] = cc
 		}
+	}
 
-		return true
+	return cases
+}
 
-	default:
-		fmt.Printf("TODO: %#v\n", pat)
-		return false
-	}
+// Template is a case clause of a type switch whose type contains type variables,
+// from which clauses for the concrete types matching the pattern are generated.
+type Template struct {
+	// Pattern is the type of the clause, e.g. map[string]T, func(T) (S, error).
+	Pattern *TypePattern
+
+	// Clause is the case clause with type variables.
+	Clause *ast.CaseClause
+
+	// Comments are the comments inside Clause, which the clauses generated by Apply are printed with,
+	// e.g. by printer.CommentedNode, as they share the positions of Clause.
+	Comments []*ast.CommentGroup
+
+	// index is the index of Pattern in the case types of Clause, which may have more than one.
+	index int
+}
+
+// Apply returns a copy of the clause of the template with the type variables replaced by the types bound in m.
+// All of the type variables in the clause, e.g. both K and V of map[K]V, are replaced.
+// Of the case types of the clause, only the one of the pattern is kept.
+// The types are qualified by their package names.
+func (t *Template) Apply(m Bindings) *ast.CaseClause {
+	return t.apply(m, func(pkg *types.Package) string { return pkg.Name() })
 }
 
-// apply applies typeMatchResult m to the template's caseClause and fills the type variables to specific types.
-func (t *template) apply(m typeMatchResult) *ast.CaseClause {
-	newClause := astutil.CopyNode(t.caseClause).(*ast.CaseClause)
-	ast.Inspect(newClause, func(node ast.Node) bool {
+// apply is Apply with the types qualified by qf.
+func (t *Template) apply(m Bindings, qf types.Qualifier) *ast.CaseClause {
+	newClause := astutil.CopyNode(t.Clause).(*ast.CaseClause)
+	newClause.List = newClause.List[t.index : t.index+1]
+
+	var replace func(node ast.Node) bool
+	replace = func(node ast.Node) bool {
+		// Selected names (e.g. x.K) never refer to type variables
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			ast.Inspect(sel.X, replace)
+			return false
+		}
+
 		if ident, ok := node.(*ast.Ident); ok {
 			if r, ok := m[ident.Name]; ok {
-				// TODO insert import; Here must be enhanced
-				name, _ := splitType(r)
-				ident.Name = name
+				ident.Name = typeString(r, qf)
 			}
 		}
 		return true
-	})
+	}
+	ast.Inspect(newClause, replace)
 
 	return newClause
 }
 
+// trailingComments returns the comments following the last statement of clause on its line in the file of stmt,
+// which are outside of clause and so not in Template.Comments.
+func (gen Gen) trailingComments(stmt *TypeSwitchStmt, clause *ast.CaseClause) []*ast.CommentGroup {
+	comments := []*ast.CommentGroup{}
+	if stmt.file == nil || len(clause.Body) == 0 {
+		return comments
+	}
+
+	// stmt may not be loaded by gen, as by NewTypeSwitchStmt
+	if gen.Loader.Fset == nil {
+		return comments
+	}
+	tf := gen.tokenFile(stmt.file)
+	if tf == nil {
+		return comments
+	}
+
+	for _, cg := range stmt.file.Comments {
+		if cg.Pos() >= clause.End() && tf.Line(cg.Pos()) == tf.Line(clause.End()) {
+			comments = append(comments, cg)
+		}
+	}
+
+	return comments
+}
+
+// clauseEnd returns the end of clause including the comments trailing it by trailingComments.
+func (gen Gen) clauseEnd(stmt *TypeSwitchStmt, clause *ast.CaseClause) token.Pos {
+	end := clause.End()
+	for _, cg := range gen.trailingComments(stmt, clause) {
+		end = cg.End()
+	}
+
+	return end
+}
+
+// showClause returns the source of clause generated for stmt, with the comments of its template
+// placed as in the template.
+func (gen Gen) showClause(stmt *TypeSwitchStmt, clause *ast.CaseClause) string {
+	var comments, trailing []*ast.CommentGroup
+	for _, cg := range stmt.comments[clause] {
+		if cg.Pos() < clause.End() {
+			comments = append(comments, cg)
+		} else {
+			trailing = append(trailing, cg)
+		}
+	}
+
+	var buf bytes.Buffer
+	if len(comments) == 0 {
+		buf.WriteString(gen.showNode(clause))
+	} else {
+		format.Node(&buf, gen.Loader.Fset, &printer.CommentedNode{Node: clause, Comments: comments})
+	}
+
+	// the printer drops the comments after the end of the node
+	for _, cg := range trailing {
+		for _, c := range cg.List {
+			buf.WriteString(" " + c.Text)
+		}
+	}
+
+	return buf.String()
+}
+
+// typeString returns the string representation of t, a type or an ArrayLen, with the packages qualified by qf.
+func typeString(t types.Type, qf types.Qualifier) string {
+	if n, ok := t.(ArrayLen); ok {
+		return n.String()
+	}
+
+	return types.TypeString(t, qf)
+}
+
 // splitType splits types.Type t to short form and its belonging package.
 // e.g. type github.com/motemen/gen.Gen -> ("gen.Gen", "github.com/motemen/gen")
 func splitType(t types.Type) (string, string) {
@@ -334,15 +1091,16 @@ func splitType(t types.Type) (string, string) {
 // - is an interface{} with name consisted of all uppercase letters
 // - or a type declared with a comment of "// +tsgen typevar"
 func (gen *Gen) isTypeVariable(t *types.Named) bool {
-	if it, ok := t.Underlying().(*types.Interface); ok && it.Empty() {
-		name := t.Obj().Name()
-		if name == strings.ToUpper(name) {
-			return true
-		}
+	if isTypeVariableName(t) {
+		return true
 	}
 
 	genDecls := []*ast.GenDecl{}
 
+	if gen.program == nil {
+		return false
+	}
+
 	for _, lpkg := range gen.program.Created {
 		for _, file := range lpkg.Files {
 			for _, decl := range file.Decls {
@@ -0,0 +1,276 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// Explain writes to w how the type switch at the line of the file would be expanded:
+// every call site of the enclosing function with the argument type it contributes,
+// the candidate types with the templates they matched, and the reasons why types are skipped.
+// The call sites are read from the analysis cache if g.CacheDir is set and they are cached, as Expand does.
+func (g Gen) Explain(filename string, line int, w io.Writer) error {
+	// SSA is built lazily by pointer analysis as in Expand, so that it is skipped if the call sites are cached
+	err := g.initProgram(needFuncBodies)
+	if err != nil {
+		return err
+	}
+
+	if g.CacheDir != "" {
+		g.cache, err = g.openAnalysisCache()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.initRun()
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtLine(filename, line)
+	if err != nil {
+		return err
+	}
+
+	typeSwitch := &TypeSwitchStmt{
+		file:    file,
+		node:    sw,
+		info:    pkg.Info,
+		imports: newFileImports(file, pkg.Pkg, &pkg.Info),
+	}
+
+	fmt.Fprintf(w, "type switch at %s in func %s: switch %s\n", g.Loader.Fset.Position(sw.Pos()), funcDecl.Name.Name, g.showNode(sw.Assign))
+
+	source := subjectSource(&pkg.Info, funcDecl, typeSwitch)
+
+	var (
+		candidates []types.Type
+		from       map[types.Type][]string
+	)
+
+	paramPos := subjectParamPos(&pkg.Info, funcDecl, typeSwitch)
+	switch {
+	case paramPos != -1:
+		fmt.Fprintf(w, "subject: parameter %s (#%d)\n", g.showNode(source), paramPos)
+
+		candidates, from, err = g.explainCallSites(w, pkg, funcDecl, paramPos)
+		if err != nil {
+			return err
+		}
+
+	case queriesSubject(&pkg.Info, funcDecl, sw):
+		fmt.Fprintf(w, "subject: %s, whose types are queried of pointer analysis\n", g.showNode(source))
+
+		candidates, err = g.queriedSubjectTypes(pkg, funcDecl, typeSwitch)
+		if err != nil {
+			return err
+		}
+		from = map[types.Type][]string{}
+
+	default:
+		fmt.Fprintf(w, "subject %s is not a parameter of %s; not expandable\n", g.showNode(source), funcDecl.Name.Name)
+		return nil
+	}
+
+	fmt.Fprintln(w, "candidate types:")
+
+	existing := []types.Type{}
+	for t := range typeSwitch.caseTypes() {
+		if t != nil {
+			existing = append(existing, t)
+		}
+	}
+
+	for _, t := range canonicalTypes(candidates) {
+		fmt.Fprintf(w, "  %s\n", t)
+		if len(from[t]) > 0 {
+			fmt.Fprintf(w, "    from %s\n", strings.Join(from[t], ", "))
+		}
+
+		if containsIdentical(existing, t) {
+			fmt.Fprintln(w, "    note: a case clause of the type already exists")
+		}
+
+		if obj := typeSwitch.unnameable(t); obj != nil {
+			fmt.Fprintf(w, "    skipped: %s is unexported in package %s\n", obj.Name(), obj.Pkg().Path())
+			continue
+		}
+
+		tmpl, m, violations := g.findMatchingTemplate(typeSwitch, t)
+		if tmpl == nil {
+			for _, v := range violations {
+				fmt.Fprintf(w, "    note: %s\n", v)
+			}
+			fmt.Fprintln(w, "    skipped: no template matched")
+			continue
+		}
+
+		fmt.Fprintf(w, "    matched template %s with %s\n", tmpl.Pattern, m)
+	}
+
+	return nil
+}
+
+// explainCallSites writes to w the call sites of funcDecl with the types of their arguments at paramPos,
+// and the registration calls of the types registered for it in pkg,
+// returning the types and the positions of the sites by the types.
+func (g Gen) explainCallSites(w io.Writer, pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, paramPos int) ([]types.Type, map[types.Type][]string, error) {
+	candidates := []types.Type{}
+	from := map[types.Type][]string{}
+
+	add := func(t types.Type, pos string) {
+		candidates = append(candidates, t)
+		for _, c := range candidates {
+			if types.Identical(c, t) {
+				from[c] = append(from[c], pos)
+				break
+			}
+		}
+	}
+
+	var cached *callSites
+	if g.cache != nil {
+		cached = g.cache.get(g.Loader.Fset, funcDecl)
+	}
+
+	if cached != nil {
+		fmt.Fprintln(w, "call sites (read from the analysis cache):")
+
+		for i, args := range cached.args {
+			pos := g.Loader.Fset.Position(cached.positions[i]).String()
+
+			if paramPos >= len(args) {
+				fmt.Fprintf(w, "  %s: skipped: argument #%d not found\n", pos, paramPos)
+				continue
+			}
+			if args[paramPos] == nil {
+				fmt.Fprintf(w, "  %s: skipped: argument is not converted to an interface here\n", pos)
+				continue
+			}
+
+			fmt.Fprintf(w, "  %s: %s\n", pos, args[paramPos])
+			add(args[paramPos], pos)
+		}
+	} else {
+		edges, err := g.callGraphInEdges(funcDecl)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fmt.Fprintln(w, "call sites:")
+
+		for _, edge := range edges {
+			caller := edge.Caller.Func.String()
+
+			if edge.Site == nil {
+				fmt.Fprintf(w, "  (synthetic call from %s): skipped: no call site\n", caller)
+				continue
+			}
+
+			// the sites of the calls through the synthetic wrappers are of the calls of the wrappers
+			for _, site := range siteArgsOf(edge, map[*callgraph.Node]bool{}) {
+				pos := g.Loader.Fset.Position(site.pos).String()
+
+				args := site.args
+				if paramPos >= len(args) {
+					fmt.Fprintf(w, "  %s (%s): skipped: argument #%d not found\n", pos, caller, paramPos)
+					continue
+				}
+
+				ts := argTypes(args[paramPos])
+				if len(ts) == 0 {
+					fmt.Fprintf(w, "  %s (%s): skipped: argument of type %s is not converted to an interface here\n", pos, caller, args[paramPos].Type())
+					continue
+				}
+
+				for _, t := range ts {
+					fmt.Fprintf(w, "  %s (%s): %s\n", pos, caller, t)
+					add(t, pos)
+				}
+			}
+		}
+	}
+
+	for _, site := range g.registeredSites(pkg, funcDecl) {
+		pos := g.Loader.Fset.Position(site.pos).String()
+
+		t := site.args[paramPos]
+		if t == nil {
+			fmt.Fprintf(w, "  %s (registered by %s): skipped: the type does not implement the parameter\n", pos, site.registry)
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s (registered by %s): %s\n", pos, site.registry, t)
+		add(t, pos)
+	}
+
+	return candidates, from, nil
+}
+
+// typeSwitchAtLine finds the type switch statement directly inside a function
+// declaration at the line of the file, which must be loaded.
+func (g Gen) typeSwitchAtLine(filename string, line int) (*loader.PackageInfo, *ast.File, *ast.FuncDecl, *ast.TypeSwitchStmt, error) {
+	pkg, file, funcDecl, sw, err := g.findTypeSwitch(filename, func(tf *token.File, sw *ast.TypeSwitchStmt) bool {
+		return tf.Line(sw.Pos()) <= line && line <= tf.Line(sw.End())
+	})
+	if err == nil && sw == nil {
+		err = fmt.Errorf("no type switch found at %s:%d", filename, line)
+	}
+
+	return pkg, file, funcDecl, sw, err
+}
+
+// typeSwitchAtOffset finds the type switch statement directly inside a function
+// declaration enclosing the byte offset of the file, which must be loaded.
+func (g Gen) typeSwitchAtOffset(filename string, offset int) (*loader.PackageInfo, *ast.File, *ast.FuncDecl, *ast.TypeSwitchStmt, error) {
+	pkg, file, funcDecl, sw, err := g.findTypeSwitch(filename, func(tf *token.File, sw *ast.TypeSwitchStmt) bool {
+		return tf.Offset(sw.Pos()) <= offset && offset <= tf.Offset(sw.End())
+	})
+	if err == nil && sw == nil {
+		err = fmt.Errorf("no type switch found at offset %d of %s", offset, filename)
+	}
+
+	return pkg, file, funcDecl, sw, err
+}
+
+// findTypeSwitch finds the last type switch statement directly inside a function declaration
+// of the file for which match returns true, or returns nils if not found.
+func (g Gen) findTypeSwitch(filename string, match func(*token.File, *ast.TypeSwitchStmt) bool) (*loader.PackageInfo, *ast.File, *ast.FuncDecl, *ast.TypeSwitchStmt, error) {
+	target, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	for _, pkg := range g.program.AllPackages {
+		for _, file := range pkg.Files {
+			tf := g.tokenFile(file)
+			name, err := filepath.Abs(tf.Name())
+			if err != nil || name != target {
+				continue
+			}
+
+			var (
+				foundDecl *ast.FuncDecl
+				found     *ast.TypeSwitchStmt
+			)
+			forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+				if match(tf, sw) {
+					foundDecl, found = fd, sw
+				}
+				return nil
+			})
+
+			if found != nil {
+				return pkg, file, foundDecl, found, nil
+			}
+		}
+	}
+
+	return nil, nil, nil, nil, nil
+}
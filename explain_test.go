@@ -0,0 +1,149 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeSwitchAtLine(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/explain.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		line     int
+		funcName string
+		err      string
+	}{
+		{line: 15, funcName: "describe"},
+		{line: 19, funcName: "describe"},
+		{line: 20, funcName: "describe"},
+		{line: 28, funcName: "local"},
+		{line: 14, err: "no type switch found at testdata/explain.go:14"},
+		{line: 6, err: "no type switch found at testdata/explain.go:6"},
+	}
+
+	for _, test := range tests {
+		_, _, funcDecl, sw, err := g.typeSwitchAtLine("testdata/explain.go", test.line)
+		if test.err != "" {
+			if assert.Error(t, err, "line %d", test.line) {
+				assert.Equal(t, test.err, err.Error())
+			}
+			continue
+		}
+
+		require.NoError(t, err, "line %d", test.line)
+		assert.Equal(t, test.funcName, funcDecl.Name.Name, "line %d", test.line)
+		assert.True(t, g.Loader.Fset.Position(sw.Pos()).Line <= test.line, "line %d", test.line)
+	}
+
+	_, _, _, _, err = g.typeSwitchAtLine("testdata/nested.go", 15)
+	if assert.Error(t, err) {
+		assert.Equal(t, "no type switch found at testdata/nested.go:15", err.Error(), "the file is not loaded")
+	}
+}
+
+func TestTypeSwitchAtOffset(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/explain.go")
+	require.NoError(t, err)
+
+	g := New()
+	err = g.Loader.CreateFromFilenames("", "testdata/explain.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	tests := []struct {
+		at       string
+		funcName string
+		err      bool
+	}{
+		{at: "switch x := x.(type)", funcName: "describe"},
+		{at: `return "slice"`, funcName: "describe"},
+		{at: "switch x.(type)", funcName: "local"},
+		{at: "func describe", err: true},
+		{at: "describe(1)", err: true},
+	}
+
+	for _, test := range tests {
+		offset := bytes.Index(src, []byte(test.at))
+		require.NotEqual(t, -1, offset, test.at)
+
+		_, _, funcDecl, _, err := g.typeSwitchAtOffset("testdata/explain.go", offset)
+		if test.err {
+			if assert.Error(t, err, test.at) {
+				assert.Contains(t, err.Error(), "no type switch found at offset")
+			}
+			continue
+		}
+
+		require.NoError(t, err, test.at)
+		assert.Equal(t, test.funcName, funcDecl.Name.Name, test.at)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sliceType := types.NewSlice(types.Typ[types.Int])
+	cacheCallSites(t, dir, "testdata/explain.go", "describe", [][]types.Type{
+		{types.Typ[types.Int]},
+		{types.Typ[types.String]},
+		{sliceType},
+		{sliceType},
+		{nil},
+	})
+
+	explain := func(line int) (string, error) {
+		var out bytes.Buffer
+
+		g := New()
+		g.CacheDir = dir
+		err := g.Loader.CreateFromFilenames("", "testdata/explain.go")
+		require.NoError(t, err)
+
+		err = g.Explain("testdata/explain.go", line, &out)
+		return out.String(), err
+	}
+
+	result, err := explain(17)
+	require.NoError(t, err)
+	t.Log(result)
+
+	// cacheCallSites puts the sites at the position of the function
+	site := "testdata/explain.go:14:1"
+
+	assert.Contains(t, result, "type switch at testdata/explain.go:15:2 in func describe: switch x := x.(type)\n")
+	assert.Contains(t, result, "subject: parameter x (#0)\n")
+	assert.Contains(t, result, "call sites (read from the analysis cache):\n")
+	assert.Contains(t, result, "  "+site+": int\n")
+	assert.Contains(t, result, "  "+site+": skipped: argument is not converted to an interface here\n")
+
+	// the sites are attributed to the types they contribute
+	assert.Contains(t, result, "  []int\n    from "+site+", "+site+"\n    matched template []testdata.T with T=int\n")
+	assert.Contains(t, result, "  string\n    from "+site+"\n    note: a case clause of the type already exists\n")
+	assert.Contains(t, result, "  int\n    from "+site+"\n")
+	assert.Contains(t, result, "    skipped: no template matched\n")
+
+	result, err = explain(27)
+	require.NoError(t, err)
+	assert.Contains(t, result, "subject 1 is not a parameter of local; not expandable\n")
+
+	_, err = explain(6)
+	if assert.Error(t, err) {
+		assert.Equal(t, "no type switch found at testdata/explain.go:6", err.Error())
+	}
+}
@@ -0,0 +1,246 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+)
+
+// fallbackClause returns the default clause of stmt for TemplateFallback, which tries the patterns of the template
+// clauses in order by reflection on the subject, and runs the body of the first one matching with the subject
+// converted to the pattern, where the unbounded type variables are replaced by interface{} and the bounded ones
+// by their bounds. The body of the default clause of stmt, or the panic of gen.DefaultPanic, runs if none matches.
+//
+// The patterns of a single type variable, slices of a type variable and maps whose keys and values are
+// type variables or concrete types are supported, e.g. T, []T and map[string]T; the others fail.
+func (gen Gen) fallbackClause(stmt *TypeSwitchStmt, src []byte) (string, error) {
+	tf := gen.tokenFile(stmt.file)
+	qf := stmt.qualifier()
+	reflectPkg := qf(types.NewPackage("reflect", "reflect"))
+
+	// the variable bound by the switch, and the value reflected on
+	var bound, subject string
+	switch a := stmt.node.Assign.(type) {
+	case *ast.AssignStmt:
+		bound = a.Lhs[0].(*ast.Ident).Name
+		subject = bound
+	case *ast.ExprStmt:
+		x := a.X.(*ast.TypeAssertExpr).X
+		if !isPure(x) {
+			return "", fmt.Errorf("cannot generate fallback: %s may have side effects", gen.showNode(x))
+		}
+		subject = string(src[tf.Offset(x.Pos()):tf.Offset(x.End())])
+	}
+
+	var defaultBody string
+	clauses := []*ast.CaseClause{}
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		switch {
+		case gen.isGeneratedClause(stmt, clause):
+		case clause.List == nil:
+			defaultBody = strings.TrimSpace(string(src[tf.Offset(clause.Colon)+1 : tf.Offset(gen.clauseEnd(stmt, clause))]))
+		case gen.isTemplateClause(stmt, clause):
+			clauses = append(clauses, clause)
+		}
+	}
+	if defaultBody == "" && gen.DefaultPanic {
+		defaultBody = strings.TrimPrefix(gen.defaultPanicClause(stmt, src), "default:\n")
+	}
+
+	rv := "rv"
+	for i := 2; refersToAny(stmt.node.Body.List, rv); i++ {
+		rv = fmt.Sprintf("rv%d", i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("default:\n")
+
+	for i, clause := range clauses {
+		names := gen.clauseTypeVariables(stmt, clause)
+		convert := bound != "" && len(clause.List) == 1 && refersTo(clause.Body, bound)
+
+		for _, e := range clause.List {
+			fb, err := gen.fallbackPattern(stmt, e, rv, reflectPkg)
+			if err != nil {
+				return "", fmt.Errorf("cannot generate fallback for case %s: %s", gen.showNode(e), err)
+			}
+
+			if i > 0 || e != clause.List[0] {
+				buf.WriteString(" else ")
+			}
+			fmt.Fprintf(&buf, "if %s := %s.ValueOf(%s); %s {\n", rv, reflectPkg, subject, fb.cond)
+			if convert && fb.convert != "" {
+				buf.WriteString(fmt.Sprintf(fb.convert, bound) + "\n")
+			}
+			buf.WriteString(gen.fallbackBody(stmt, clause, src, names, fb.replacements) + "\n}")
+		}
+	}
+
+	if defaultBody != "" {
+		buf.WriteString(" else {\n" + defaultBody + "\n}")
+	}
+
+	return buf.String(), nil
+}
+
+// fallback is the reflection on the subject of a pattern for fallbackClause.
+type fallback struct {
+	// cond is the condition of the reflect.Value of the subject matching the pattern.
+	cond string
+
+	// convert is the format of the statements converting the subject, named by %[1]s, to the pattern.
+	convert string
+
+	// replacements maps the names of the type variables of the pattern to the types replacing them.
+	replacements map[string]string
+}
+
+// fallbackPattern returns the fallback of the pattern e in stmt, whose reflect.Value is named rv,
+// with the reflect package qualified by reflectPkg.
+func (gen Gen) fallbackPattern(stmt *TypeSwitchStmt, e ast.Expr, rv, reflectPkg string) (*fallback, error) {
+	qf := stmt.qualifier()
+	fb := &fallback{replacements: map[string]string{}}
+
+	// component returns the type replacing the type variable or the concrete type e in the converted pattern,
+	// the condition of its reflect.Type named t, and the type assertion from interface{} to it
+	component := func(e ast.Expr, t string) (typ, cond, assert string, err error) {
+		vars := gen.exprTypeVariables(stmt, e)
+		if len(vars) == 0 {
+			typ = typeString(stmt.info.TypeOf(e), qf)
+			return typ, fmt.Sprintf("%s == %s.TypeOf((*%s)(nil)).Elem()", t, reflectPkg, typ), ".(" + typ + ")", nil
+		}
+
+		ident, ok := e.(*ast.Ident)
+		if !ok {
+			return "", "", "", fmt.Errorf("nested type variables are not supported")
+		}
+
+		typ = "interface{}"
+		if iface, ok := stmt.info.TypeOf(e).Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+			// the bound
+			typ = ident.Name
+			cond = fmt.Sprintf("%s.Implements(%s.TypeOf((*%s)(nil)).Elem())", t, reflectPkg, typ)
+			assert = ".(" + typ + ")"
+		}
+		fb.replacements[ident.Name] = typ
+
+		return typ, cond, assert, nil
+	}
+
+	and := func(conds ...string) string {
+		nonEmpty := []string{}
+		for _, c := range conds {
+			if c != "" {
+				nonEmpty = append(nonEmpty, c)
+			}
+		}
+		return strings.Join(nonEmpty, " && ")
+	}
+
+	switch e := e.(type) {
+	case *ast.Ident:
+		_, cond, assert, err := component(e, rv+".Type()")
+		if err != nil {
+			return nil, err
+		}
+		fb.cond = and(rv+".IsValid()", cond)
+		if assert != "" {
+			fb.convert = "%[1]s := %[1]s" + assert
+		}
+
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return nil, fmt.Errorf("arrays are not supported")
+		}
+
+		elem, cond, assert, err := component(e.Elt, rv+".Type().Elem()")
+		if err != nil {
+			return nil, err
+		}
+		fb.cond = and(fmt.Sprintf("%s.Kind() == %s.Slice", rv, reflectPkg), cond)
+		fb.convert = fmt.Sprintf(`%%[1]s := make([]%s, %s.Len())
+for i := range %%[1]s {
+%%[1]s[i] = %s.Index(i).Interface()%s
+}`, elem, rv, rv, assert)
+
+	case *ast.MapType:
+		key, keyCond, keyAssert, err := component(e.Key, rv+".Type().Key()")
+		if err != nil {
+			return nil, err
+		}
+		elem, elemCond, elemAssert, err := component(e.Value, rv+".Type().Elem()")
+		if err != nil {
+			return nil, err
+		}
+		fb.cond = and(fmt.Sprintf("%s.Kind() == %s.Map", rv, reflectPkg), keyCond, elemCond)
+		fb.convert = fmt.Sprintf(`%%[1]s := make(map[%s]%s, %s.Len())
+for _, k := range %s.MapKeys() {
+%%[1]s[k.Interface()%s] = %s.MapIndex(k).Interface()%s
+}`, key, elem, rv, rv, keyAssert, rv, elemAssert)
+
+	default:
+		return nil, fmt.Errorf("only type variables, slices and maps are supported")
+	}
+
+	return fb, nil
+}
+
+// fallbackBody returns the source of the body of clause, with the type variables names replaced as in replacements.
+// The unbounded type variables missing in replacements, e.g. of another pattern of the clause, become interface{}.
+func (gen Gen) fallbackBody(stmt *TypeSwitchStmt, clause *ast.CaseClause, src []byte, names []string, replacements map[string]string) string {
+	tf := gen.tokenFile(stmt.file)
+	start, end := tf.Offset(clause.Colon)+1, tf.Offset(gen.clauseEnd(stmt, clause))
+
+	isTypeVar := map[string]bool{}
+	for _, name := range names {
+		isTypeVar[name] = true
+	}
+
+	edits := []sourceEdit{}
+	var replace func(node ast.Node) bool
+	replace = func(node ast.Node) bool {
+		// selected names never refer to type variables, as in Template.Apply
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			ast.Inspect(sel.X, replace)
+			return false
+		}
+
+		ident, ok := node.(*ast.Ident)
+		if !ok || !isTypeVar[ident.Name] {
+			return true
+		}
+		if _, ok := stmt.info.Uses[ident].(*types.TypeName); !ok {
+			return true
+		}
+
+		typ, ok := replacements[ident.Name]
+		if !ok {
+			typ = "interface{}"
+			if iface, ok := stmt.info.TypeOf(ident).Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				typ = ident.Name
+			}
+		}
+		edits = append(edits, sourceEdit{start: tf.Offset(ident.Pos()) - start, end: tf.Offset(ident.End()) - start, text: []byte(typ)})
+		return true
+	}
+	for _, st := range clause.Body {
+		ast.Inspect(st, replace)
+	}
+
+	return strings.TrimSpace(string(applyEdits(src[start:end], edits)))
+}
+
+// refersToAny reports whether any of the clauses in stmts refers to name in their bodies.
+func refersToAny(stmts []ast.Stmt, name string) bool {
+	for _, st := range stmts {
+		if refersTo(st.(*ast.CaseClause).Body, name) {
+			return true
+		}
+	}
+
+	return false
+}
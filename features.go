@@ -0,0 +1,138 @@
+package gen
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Feature is a name of an experimental feature of pattern matching.
+// Experimental features are disabled by default and enabled by Gen.Features,
+// so that the default behavior stays stable.
+type Feature string
+
+// Experimental features.
+const (
+	// FeatureArrays enables matching array patterns with their lengths (e.g. [N]T).
+	FeatureArrays Feature = "arrays"
+
+	// FeatureInterfaces enables matching anonymous interface patterns
+	// with type variables in their method sets (e.g. interface{ Get() T }).
+	FeatureInterfaces Feature = "interfaces"
+
+	// FeatureUnions enables multiple patterns in a template case clause (e.g. case []T, map[string]T:).
+	FeatureUnions Feature = "unions"
+
+	// FeatureGenerics enables converting type switches into generic functions and back
+	// (Gen.ToGeneric and Gen.FromGeneric).
+	FeatureGenerics Feature = "generics"
+)
+
+var knownFeatures = map[Feature]bool{
+	FeatureArrays:     true,
+	FeatureInterfaces: true,
+	FeatureUnions:     true,
+	FeatureGenerics:   true,
+}
+
+// Features is a set of enabled experimental features.
+type Features map[Feature]bool
+
+// ParseFeatures parses a comma-separated list of feature names like "arrays,unions".
+// It returns an error for unknown feature names.
+func ParseFeatures(s string) (Features, error) {
+	features := Features{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		f := Feature(name)
+		if !knownFeatures[f] {
+			return nil, fmt.Errorf("unknown feature: %q (known features: %s)", name, strings.Join(FeatureNames(), ", "))
+		}
+
+		features[f] = true
+	}
+
+	return features, nil
+}
+
+// FeatureNames returns the names of all known features in alphabetical order.
+func FeatureNames() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for f := range knownFeatures {
+		names = append(names, string(f))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FeaturesFile is the name of the file enabling features for the repository, looked up by LoadFeatures.
+const FeaturesFile = ".tsgen"
+
+// LoadFeatures loads the features enabled by the FeaturesFile in dir or its ancestors, so that a repository opts in
+// for everyone working on it. It returns no features if there is no such file. The file is line-oriented:
+//
+//	# a comment
+//	features arrays,unions
+func LoadFeatures(dir string) (Features, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := findUp(dir, FeaturesFile)
+	if filename == "" {
+		return Features{}, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	features := Features{}
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] != "features" {
+			return nil, fmt.Errorf("%s:%d: unknown setting: %q", filename, n, fields[0])
+		}
+
+		fs, err := ParseFeatures(strings.Join(fields[1:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, n, err)
+		}
+		for f := range fs {
+			features[f] = true
+		}
+	}
+
+	return features, s.Err()
+}
+
+// enabled reports whether the feature f is enabled in g.
+func (g Gen) enabled(f Feature) bool {
+	return g.Features[f]
+}
+
+// requireFeature returns an error if the feature f, which what needs, is not enabled in g.
+func (g Gen) requireFeature(f Feature, what string) error {
+	if !g.enabled(f) {
+		return fmt.Errorf("%s is experimental: enable it by the feature %q", what, f)
+	}
+
+	return nil
+}
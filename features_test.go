@@ -0,0 +1,91 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeatures(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected Features
+		err      string
+	}{
+		{"", Features{}, ""},
+		{"arrays", Features{FeatureArrays: true}, ""},
+		{"arrays,unions", Features{FeatureArrays: true, FeatureUnions: true}, ""},
+		{" generics , interfaces ,", Features{FeatureGenerics: true, FeatureInterfaces: true}, ""},
+		{"unions,unions", Features{FeatureUnions: true}, ""},
+		{"arrays,tuples", nil, `unknown feature: "tuples" (known features: arrays, generics, interfaces, unions)`},
+		{"Arrays", nil, `unknown feature: "Arrays"`},
+	}
+
+	for _, test := range tests {
+		features, err := ParseFeatures(test.s)
+		if test.err != "" {
+			if assert.Error(t, err, test.s) {
+				assert.Contains(t, err.Error(), test.err, test.s)
+			}
+			continue
+		}
+
+		if assert.NoError(t, err, test.s) {
+			assert.Equal(t, test.expected, features, test.s)
+		}
+	}
+}
+
+func TestFeatureNames(t *testing.T) {
+	assert.Equal(t, []string{"arrays", "generics", "interfaces", "unions"}, FeatureNames())
+}
+
+func TestLoadFeatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-features")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "a", "b")
+	require.NoError(t, os.MkdirAll(sub, 0777))
+
+	features, err := LoadFeatures(sub)
+	require.NoError(t, err)
+	assert.Empty(t, features)
+
+	filename := filepath.Join(dir, FeaturesFile)
+
+	tests := []struct {
+		content  string
+		expected Features
+		err      string
+	}{
+		{"# experimental\n\nfeatures arrays,unions\nfeatures generics\n", Features{FeatureArrays: true, FeatureUnions: true, FeatureGenerics: true}, ""},
+		{"features arrays, unions\n", Features{FeatureArrays: true, FeatureUnions: true}, ""},
+		{"features\n", Features{}, ""},
+		{"features arrays\nfeatures tuples\n", nil, FeaturesFile + `:2: unknown feature: "tuples"`},
+		{"matchers arrays\n", nil, FeaturesFile + `:1: unknown setting: "matchers"`},
+	}
+
+	for _, test := range tests {
+		require.NoError(t, ioutil.WriteFile(filename, []byte(test.content), 0666))
+
+		// from the directory of the file and below it
+		for _, d := range []string{dir, sub} {
+			features, err := LoadFeatures(d)
+			if test.err != "" {
+				if assert.Error(t, err, test.content) {
+					assert.Contains(t, err.Error(), test.err, test.content)
+				}
+				continue
+			}
+
+			if assert.NoError(t, err, test.content) {
+				assert.Equal(t, test.expected, features, test.content)
+			}
+		}
+	}
+}
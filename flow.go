@@ -0,0 +1,230 @@
+package gen
+
+import (
+	"fmt"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/pointer"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/types"
+)
+
+// subjectSource returns the expression the subject of typeSwitch flows from in funcDecl.
+// The variables defined once and never assigned again, e.g. v of switch v := f(); x := v.(type),
+// are traced back to the expressions defining them, until a parameter of funcDecl,
+// whose types are observed at the call sites, or another expression like a selector or a call,
+// whose types are queried of pointer analysis.
+func subjectSource(info *types.Info, funcDecl *ast.FuncDecl, typeSwitch *TypeSwitchStmt) ast.Expr {
+	x, _ := typeSwitchSubject(typeSwitch.node)
+
+	for x != nil {
+		if paren, ok := x.(*ast.ParenExpr); ok {
+			x = paren.X
+			continue
+		}
+
+		ident, ok := x.(*ast.Ident)
+		if !ok || funcDecl == nil || isParam(info, funcDecl, ident) {
+			return x
+		}
+
+		def := definingExpr(info, funcDecl.Body, info.Uses[ident])
+		if def == nil {
+			return x
+		}
+		x = def
+	}
+
+	return x
+}
+
+// definingExpr returns the expression the local variable obj is defined by in body, by := or var,
+// or nil if it is not defined so, assigned again or its address is taken.
+func definingExpr(info *types.Info, body *ast.BlockStmt, obj types.Object) ast.Expr {
+	if _, ok := obj.(*types.Var); !ok {
+		return nil
+	}
+
+	var (
+		def      ast.Expr
+		modified bool
+	)
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if n.Tok == token.DEFINE && info.Defs[ident] == obj && len(n.Lhs) == len(n.Rhs) {
+					def = n.Rhs[i]
+				} else if info.Uses[ident] == obj {
+					modified = true
+				}
+			}
+
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if info.Defs[name] == obj && len(n.Names) == len(n.Values) {
+					def = n.Values[i]
+				}
+			}
+
+		case *ast.UnaryExpr:
+			if ident, ok := n.X.(*ast.Ident); ok && n.Op == token.AND && info.Uses[ident] == obj {
+				modified = true
+			}
+		}
+
+		return !modified
+	})
+
+	if modified {
+		return nil
+	}
+
+	return def
+}
+
+// queriesSubject reports whether the types of the subject of the type switch sw in funcDecl are queried
+// of pointer analysis, as it does not flow from a parameter.
+func queriesSubject(info *types.Info, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) bool {
+	x := subjectSource(info, funcDecl, &TypeSwitchStmt{node: sw})
+	if x == nil || isParam(info, funcDecl, x) {
+		return false
+	}
+
+	return types.IsInterface(info.TypeOf(x))
+}
+
+// needsSubjectQuery reports whether the types of the subject of the type switch sw in funcDecl are queried
+// of pointer analysis: the subjects not flowing from parameters, and the ones flowing from parameters
+// of interface types too with g.DynamicFlow, which are needed if funcDecl has dynamic call sites.
+func (g Gen) needsSubjectQuery(info *types.Info, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) bool {
+	if queriesSubject(info, funcDecl, sw) {
+		return true
+	}
+
+	if !g.DynamicFlow {
+		return false
+	}
+
+	x := subjectSource(info, funcDecl, &TypeSwitchStmt{node: sw})
+	return x != nil && isParam(info, funcDecl, x) && types.IsInterface(info.TypeOf(x))
+}
+
+// subjectQueryPackages returns the packages with type switches whose subjects are queried of pointer analysis,
+// in the ones rewritten as doFiles does, whose SSA is built with the debug information to find the values of the subjects.
+func (g Gen) subjectQueryPackages() []*loader.PackageInfo {
+	pkgs := []*loader.PackageInfo{}
+
+	for _, pkg := range g.program.AllPackages {
+		if (g.initialOnly || g.FileWriter == nil) && !g.isInitial(pkg) {
+			continue
+		}
+
+		found := false
+		for _, file := range pkg.Files {
+			g.forSubjectSwitch(pkg, file, func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) {
+				found = found || g.needsSubjectQuery(&pkg.Info, funcDecl, sw)
+			})
+		}
+
+		if found {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	return pkgs
+}
+
+// addSubjectQueries adds to conf the queries of the subjects of the type switches not flowing from parameters.
+func (g Gen) addSubjectQueries(conf *pointer.Config) {
+	for _, pkg := range g.subjectQueryPackages() {
+		for _, file := range pkg.Files {
+			g.forSubjectSwitch(pkg, file, func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) {
+				if !g.needsSubjectQuery(&pkg.Info, funcDecl, sw) {
+					return
+				}
+
+				v, isAddr := g.subjectValue(pkg, funcDecl, sw)
+				if v == nil {
+					return
+				}
+
+				if isAddr {
+					conf.AddIndirectQuery(v)
+				} else {
+					conf.AddQuery(v)
+				}
+			})
+		}
+	}
+}
+
+// forSubjectSwitch calls proc for the type switches at the top level of the functions in file,
+// and the ones equivalent to the template assertions expanded by ExpandAssertions.
+func (g Gen) forSubjectSwitch(pkg *loader.PackageInfo, file *ast.File, proc func(*ast.FuncDecl, *ast.TypeSwitchStmt)) {
+	forTypeSwitchStmt(file, func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		proc(funcDecl, sw)
+		return nil
+	})
+
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Body != nil && !isGenericFunc(funcDecl) {
+			if a := g.findTemplateAssertion(file, &pkg.Info, funcDecl.Body); a != nil {
+				proc(funcDecl, a.stmt.node)
+			}
+		}
+	}
+}
+
+// subjectValue returns the SSA value of the subject expression of sw in funcDecl, and whether it is its address,
+// or nil if not found, e.g. as its package is built without the debug information.
+func (g Gen) subjectValue(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) (ssa.Value, bool) {
+	x, _ := typeSwitchSubject(sw)
+	if x == nil {
+		return nil, false
+	}
+
+	ssaPkg := g.ssaPackage(pkg)
+	if ssaPkg == nil {
+		return nil, false
+	}
+
+	_, path, _ := g.program.PathEnclosingInterval(x.Pos(), x.End())
+	fn := ssa.EnclosingFunction(ssaPkg, path)
+	if fn == nil {
+		return nil, false
+	}
+
+	return fn.ValueForExpr(x)
+}
+
+// queriedSubjectTypes returns the dynamic types the subject of typeSwitch may have by pointer analysis,
+// for the subjects not flowing from parameters, or the ones of the functions with dynamic call sites with g.DynamicFlow.
+func (g Gen) queriedSubjectTypes(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, typeSwitch *TypeSwitchStmt) ([]types.Type, error) {
+	pta, err := g.pointerAnalysis()
+	if err != nil {
+		return nil, err
+	}
+
+	v, isAddr := g.subjectValue(pkg, funcDecl, typeSwitch.node)
+	if v == nil {
+		x, _ := typeSwitchSubject(typeSwitch.node)
+		return nil, fmt.Errorf("could not find SSA value of %s", g.showNode(x))
+	}
+
+	ptr, ok := pta.Queries[v]
+	if isAddr {
+		ptr, ok = pta.IndirectQueries[v]
+	}
+	if !ok {
+		return nil, fmt.Errorf("BUG: subject %s not queried", v)
+	}
+
+	return ptr.PointsTo().DynamicTypes().Keys(), nil
+}
@@ -0,0 +1,110 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectSource(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/flow.go")
+	require.NoError(t, err)
+	require.NoError(t, g.load())
+
+	pkg := g.program.Created[0]
+
+	type source struct {
+		expr     string
+		paramPos int
+		queried  bool
+	}
+	sources := map[string]source{}
+
+	forTypeSwitchStmt(pkg.Files[0], func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{node: sw, info: pkg.Info}
+		sources[funcDecl.Name.Name] = source{
+			expr:     g.showNode(subjectSource(&pkg.Info, funcDecl, stmt)),
+			paramPos: subjectParamPos(&pkg.Info, funcDecl, stmt),
+			queried:  queriesSubject(&pkg.Info, funcDecl, sw),
+		}
+		return nil
+	})
+
+	assert.Equal(t, source{"p", 0, false}, sources["initStmt"])
+	assert.Equal(t, source{"p", 0, false}, sources["defined"])
+	assert.Equal(t, source{"h.v", -1, true}, sources["field"])
+	assert.Equal(t, source{"get()", -1, true}, sources["call"])
+	assert.Equal(t, source{"v", -1, true}, sources["reassigned"])
+
+	// the subjects flowing from parameters are queried too with DynamicFlow
+	g.DynamicFlow = true
+	forTypeSwitchStmt(pkg.Files[0], func(funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		assert.True(t, g.needsSubjectQuery(&pkg.Info, funcDecl, sw), funcDecl.Name.Name)
+		return nil
+	})
+	g.DynamicFlow = false
+
+	list, err := g.ListTypeSwitches()
+	require.NoError(t, err)
+
+	require.Len(t, list, 5)
+	for _, info := range list {
+		assert.True(t, info.Expandable, info.String())
+	}
+}
+
+func TestExpand_DynamicCallSites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// describe is called through a function value and an interface method forwarding its argument
+	{
+		g := New()
+		g.CacheDir = dir
+		err := g.Loader.CreateFromFilenames("", "testdata/dynamic.go")
+		require.NoError(t, err)
+		require.NoError(t, g.load())
+
+		c, err := g.openAnalysisCache()
+		require.NoError(t, err)
+
+		for _, decl := range g.program.Created[0].Files[0].Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "describe" {
+				c.put(g.Loader.Fset, funcDecl, &callSites{
+					funcDecl:  funcDecl,
+					args:      [][]types.Type{{types.NewSlice(types.Typ[types.Int])}, {types.NewSlice(types.Typ[types.String])}},
+					positions: []token.Pos{funcDecl.Pos(), funcDecl.Body.Pos()},
+					dynamic:   map[token.Pos]bool{funcDecl.Pos(): true, funcDecl.Body.Pos(): true},
+				})
+			}
+		}
+		require.NoError(t, c.save())
+	}
+
+	var log bytes.Buffer
+	g := New()
+	g.CacheDir = dir
+	g.Logger = NewTextLogger(&log, false)
+	err = g.Loader.CreateFromFilenames("", "testdata/dynamic.go")
+	require.NoError(t, err)
+
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/dynamic.go"])
+	assert.Contains(t, out, "case []int:")
+	assert.Contains(t, out, "case []string:")
+
+	t.Log(log.String())
+	assert.Contains(t, log.String(), "the types of v may be incomplete: 2 dynamic call sites of describe")
+}
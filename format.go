@@ -0,0 +1,212 @@
+package gen
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+)
+
+// FormatOptions configures the formatting of the rewritten files, which is that of goimports:
+// the imports are sorted, and separated into groups of the standard library, the third-party packages
+// and the local ones, within each block of imports separated by blank lines.
+type FormatOptions struct {
+	// LocalPrefix is a comma-separated list of import path prefixes, like goimports -local,
+	// whose imports are grouped after the third-party ones.
+	LocalPrefix string
+
+	// TabWidth is the width of tabs the alignment is computed with. The default is 8 as gofmt.
+	TabWidth int
+
+	// SpaceIndent indents the code with TabWidth spaces instead of tabs, as gofmt -tabs=false did,
+	// for the codebases formatted so.
+	SpaceIndent bool
+}
+
+// importGroup returns the group of the import of path, ordered as goimports:
+// 0 for the standard library, 1 for third-party packages and 2 for local ones.
+func (opts FormatOptions) importGroup(path string) int {
+	if opts.LocalPrefix != "" {
+		for _, prefix := range strings.Split(opts.LocalPrefix, ",") {
+			if prefix != "" && strings.HasPrefix(path, prefix) {
+				return 2
+			}
+		}
+	}
+
+	if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+		return 1
+	}
+
+	return 0
+}
+
+// formatFile returns the formatted source of file, with its imports grouped by g.Format.
+func (g Gen) formatFile(file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	err := format.Node(&buf, g.Loader.Fset, file)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := g.Format.groupImports(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Format.reprint(src)
+}
+
+// reprint returns src, a source formatted by gofmt, printed again by the printer configured by opts
+// unless it is configured as gofmt.
+func (opts FormatOptions) reprint(src []byte) ([]byte, error) {
+	if (opts.TabWidth == 0 || opts.TabWidth == 8) && !opts.SpaceIndent {
+		return src, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: opts.TabWidth}
+	if config.Tabwidth == 0 {
+		config.Tabwidth = 8
+	}
+	if opts.SpaceIndent {
+		config.Mode = printer.UseSpaces
+	}
+
+	var buf bytes.Buffer
+	err = config.Fprint(&buf, fset, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// groupImports returns src, a formatted source, with the imports in each block of the import declarations
+// ordered by their groups and separated by blank lines between the groups.
+// The declarations with comments other than those of the specs are left as they are.
+func (opts FormatOptions) groupImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := fset.File(file.Pos())
+	edits := []sourceEdit{}
+
+decls:
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || !genDecl.Lparen.IsValid() || len(genDecl.Specs) < 2 {
+			continue
+		}
+
+		attached := map[*ast.CommentGroup]bool{}
+		for _, spec := range genDecl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			attached[spec.Doc] = true
+			attached[spec.Comment] = true
+		}
+		for _, cg := range file.Comments {
+			if genDecl.Lparen < cg.Pos() && cg.End() < genDecl.Rparen && !attached[cg] {
+				continue decls
+			}
+		}
+
+		start := func(spec *ast.ImportSpec) token.Pos {
+			if spec.Doc != nil {
+				return spec.Doc.Pos()
+			}
+			return spec.Pos()
+		}
+		end := func(spec *ast.ImportSpec) token.Pos {
+			if spec.Comment != nil {
+				return spec.Comment.End()
+			}
+			return spec.End()
+		}
+
+		// the runs of specs not separated by blank lines
+		runs := [][]*ast.ImportSpec{}
+		var last *ast.ImportSpec
+		for _, spec := range genDecl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if last == nil || tf.Line(start(spec)) > tf.Line(end(last))+1 {
+				runs = append(runs, nil)
+			}
+			runs[len(runs)-1] = append(runs[len(runs)-1], spec)
+			last = spec
+		}
+
+		var text bytes.Buffer
+		changed := false
+		for i, run := range runs {
+			sorted := make([]*ast.ImportSpec, len(run))
+			copy(sorted, run)
+			sort.Stable(byImportGroup{sorted, opts})
+
+			if i > 0 {
+				text.WriteString("\n")
+			}
+			for j, spec := range sorted {
+				if j > 0 && opts.importGroup(importPath(spec)) != opts.importGroup(importPath(sorted[j-1])) {
+					text.WriteString("\n")
+					changed = true
+				}
+				if spec != run[j] {
+					changed = true
+				}
+				text.Write(src[tf.Offset(start(spec)):tf.Offset(end(spec))])
+				text.WriteString("\n")
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		edits = append(edits, sourceEdit{
+			start: tf.Offset(genDecl.Lparen) + 1,
+			end:   tf.Offset(genDecl.Rparen),
+			text:  append([]byte("\n"), text.Bytes()...),
+		})
+	}
+
+	if len(edits) == 0 {
+		return src, nil
+	}
+
+	return format.Source(applyEdits(src, edits))
+}
+
+func importPath(spec *ast.ImportSpec) string {
+	p, _ := strconv.Unquote(spec.Path.Value)
+	return p
+}
+
+type byImportGroup struct {
+	specs []*ast.ImportSpec
+	opts  FormatOptions
+}
+
+func (s byImportGroup) Len() int      { return len(s.specs) }
+func (s byImportGroup) Swap(i, j int) { s.specs[i], s.specs[j] = s.specs[j], s.specs[i] }
+func (s byImportGroup) Less(i, j int) bool {
+	gi, gj := s.opts.importGroup(importPath(s.specs[i])), s.opts.importGroup(importPath(s.specs[j]))
+	if gi != gj {
+		return gi < gj
+	}
+	return importPath(s.specs[i]) < importPath(s.specs[j])
+}
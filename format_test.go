@@ -0,0 +1,88 @@
+package gen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupImports(t *testing.T) {
+	src := `package a
+
+import (
+	"example.com/me/util"
+	"fmt" // for Println
+	// types
+	"golang.org/x/tools/go/types"
+	"os"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+)
+`
+
+	out, err := FormatOptions{LocalPrefix: "example.com/me"}.groupImports([]byte(src))
+	require.NoError(t, err)
+
+	assert.Equal(t, `package a
+
+import (
+	"fmt" // for Println
+	"os"
+
+	// types
+	"golang.org/x/tools/go/types"
+
+	"example.com/me/util"
+
+	"go/ast"
+
+	"golang.org/x/tools/go/loader"
+)
+`, string(out))
+
+	again, err := FormatOptions{LocalPrefix: "example.com/me"}.groupImports(out)
+	require.NoError(t, err)
+	assert.Equal(t, string(out), string(again))
+
+	grouped := "package a\n\nimport (\n\t\"fmt\"\n\n\t\"golang.org/x/tools/go/types\"\n)\n"
+	out, err = FormatOptions{}.groupImports([]byte(grouped))
+	require.NoError(t, err)
+	assert.Equal(t, grouped, string(out))
+}
+
+func TestFormatFile(t *testing.T) {
+	g := New()
+	g.Format.LocalPrefix = "example.com/"
+
+	file, err := g.Loader.ParseFile("a.go", "package a\nimport (\n\"example.com/x\"\n\"fmt\"\n)\nvar _ = fmt.Println\nvar _ = x.X\n")
+	require.NoError(t, err)
+
+	out, err := g.formatFile(file)
+	require.NoError(t, err)
+
+	assert.Equal(t, "package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/x\"\n)\n\nvar _ = fmt.Println\nvar _ = x.X\n", string(out))
+}
+
+func TestGroupImports_FloatingComments(t *testing.T) {
+	src := "package a\n\nimport (\n\t\"golang.org/x/tools/go/types\"\n\n\t// floating\n\n\t\"fmt\"\n\t\"example.com/x\"\n)\n"
+
+	out, err := FormatOptions{}.groupImports([]byte(src))
+	require.NoError(t, err)
+	assert.Equal(t, src, string(out))
+}
+
+func TestFormatFile_SpaceIndent(t *testing.T) {
+	g := New()
+	g.Format.TabWidth = 4
+	g.Format.SpaceIndent = true
+
+	file, err := g.Loader.ParseFile("a.go", "package a\nfunc f(x int) int {\nswitch x {\ncase 1: // one\nreturn 2\n}\nreturn 0\n}\n")
+	require.NoError(t, err)
+
+	out, err := g.formatFile(file)
+	require.NoError(t, err)
+
+	assert.Equal(t, "package a\n\nfunc f(x int) int {\n    switch x {\n    case 1: // one\n        return 2\n    }\n    return 0\n}\n", string(out))
+}
@@ -0,0 +1,523 @@
+//go:build go1.18
+// +build go1.18
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// FromGeneric rewrites the generic function at the line of the file, the reverse of ToGeneric,
+// into a function without type parameters switching on the types it is instantiated with in the program,
+// e.g. func f[T int | string](v T) instantiated as f(1) and f[string]("") into func f(v interface{})
+// with the case clauses of int and string, each having the body of f with T replaced by the type.
+// The explicit instantiations are rewritten into the plain references to f.
+//
+// The function must have a single type parameter, which is the type of one of its parameters and not of the others
+// nor the results. The parameter is of the constraint if it has methods only, or interface{} otherwise.
+//
+// The type checker predates generics, so the type parameter and the type arguments are resolved by their names,
+// and the errors type-checking the function and its instantiations are ignored. It requires FeatureGenerics.
+func (g Gen) FromGeneric(filename string, line int) error {
+	err := g.requireFeature(FeatureGenerics, "from-generic")
+	if err != nil {
+		return err
+	}
+
+	g.Loader.AllowErrors = true
+	g.Loader.TypeChecker.Error = func(err error) {}
+
+	err = g.initProgram(needTypes)
+	if err != nil {
+		return err
+	}
+
+	pkg, file, funcDecl, err := g.funcDeclAtLine(filename, line)
+	if err != nil {
+		return err
+	}
+
+	src, err := g.fileSource(file)
+	if err != nil {
+		return err
+	}
+
+	gf, err := g.newGenericInstances(pkg, file, funcDecl)
+	if err != nil {
+		return err
+	}
+
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+	edits, err := gf.edits(g, src, imports)
+	if err != nil {
+		return err
+	}
+
+	return g.doFiles(func(_ *loader.PackageInfo, f *ast.File) error {
+		fileEdits := gf.refs[f]
+		if f == file {
+			fileEdits = append(fileEdits, edits...)
+		}
+		if len(fileEdits) == 0 {
+			return nil
+		}
+
+		if err := g.editFileSource(f, fileEdits); err != nil {
+			return err
+		}
+		if f == file {
+			imports.fix(g.Loader.Fset, f)
+		}
+
+		return nil
+	})
+}
+
+// funcDeclAtLine finds the function declaration at the line of the file, which must be loaded.
+func (g Gen) funcDeclAtLine(filename string, line int) (*loader.PackageInfo, *ast.File, *ast.FuncDecl, error) {
+	for _, pkg := range g.program.AllPackages {
+		for _, file := range pkg.Files {
+			tf := g.tokenFile(file)
+			if !sameFile(tf.Name(), filename) {
+				continue
+			}
+
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if ok && funcDecl.Body != nil && tf.Line(funcDecl.Pos()) <= line && line <= tf.Line(funcDecl.End()) {
+					return pkg, file, funcDecl, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil, nil, fmt.Errorf("no function found at %s:%d", filename, line)
+}
+
+// genericInstances is a generic function to be rewritten into a type switch on the types it is instantiated with.
+type genericInstances struct {
+	pkg      *loader.PackageInfo
+	file     *ast.File
+	funcDecl *ast.FuncDecl
+
+	// typeParam is the name of the type parameter, and param is the parameter of it.
+	typeParam *ast.Ident
+	param     *ast.Ident
+
+	// types are the type arguments of the instantiations, in the order of their first positions in the files.
+	types []types.Type
+
+	// refs are the edits to the files removing the type arguments of the explicit instantiations.
+	refs map[*ast.File][]sourceEdit
+}
+
+// newGenericInstances checks that funcDecl in file of pkg can be rewritten without its type parameter,
+// and finds the instantiations of it in the program.
+func (g Gen) newGenericInstances(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl) (*genericInstances, error) {
+	fail := func(format string, args ...interface{}) (*genericInstances, error) {
+		return nil, fmt.Errorf("%s: cannot generate type switch: %s", g.Loader.Fset.Position(funcDecl.Pos()), fmt.Sprintf(format, args...))
+	}
+
+	if funcDecl.Recv != nil || funcDecl.Type.TypeParams == nil {
+		return fail("%s is not a generic function", funcDecl.Name.Name)
+	}
+
+	tparams := funcDecl.Type.TypeParams
+	if tparams.NumFields() != 1 {
+		return fail("%s has %d type parameters, not one", funcDecl.Name.Name, tparams.NumFields())
+	}
+
+	gi := &genericInstances{
+		pkg:      pkg,
+		file:     file,
+		funcDecl: funcDecl,
+		refs:     map[*ast.File][]sourceEdit{},
+	}
+	gi.typeParam = tparams.List[0].Names[0]
+
+	for _, field := range funcDecl.Type.Params.List {
+		if !gi.mentionsTypeParam(field.Type) {
+			continue
+		}
+
+		if ident, ok := field.Type.(*ast.Ident); !ok || !gi.isTypeParam(ident) || len(field.Names) != 1 || gi.param != nil {
+			return fail("%s must be the type of exactly one parameter", gi.typeParam.Name)
+		}
+		gi.param = field.Names[0]
+	}
+	if gi.param == nil || gi.param.Name == "_" {
+		return fail("%s is not the type of a named parameter", gi.typeParam.Name)
+	}
+	if funcDecl.Type.Results != nil && gi.mentionsTypeParam(funcDecl.Type.Results) {
+		return fail("the results of %s are of %s", funcDecl.Name.Name, gi.typeParam.Name)
+	}
+
+	fn, ok := pkg.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return fail("%s is not type-checked", funcDecl.Name.Name)
+	}
+	index := -1
+	for i, name := range paramNames(funcDecl) {
+		if name == gi.param.Name {
+			index = i
+		}
+	}
+
+	var (
+		insts      []instanceRef
+		uncalled   []token.Position
+		unresolved []token.Position
+	)
+	for _, p := range g.program.AllPackages {
+		info := &p.Info
+		for _, file := range p.Files {
+			var stack []ast.Node
+			ast.Inspect(file, func(node ast.Node) bool {
+				if node == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, node)
+
+				ident, ok := node.(*ast.Ident)
+				if !ok || info.Uses[ident] != fn {
+					return true
+				}
+
+				// the reference, qualified or instantiated explicitly
+				tf := g.tokenFile(file)
+				var ref ast.Expr = ident
+				i := len(stack) - 2
+				if sel, ok := stack[i].(*ast.SelectorExpr); ok && sel.Sel == ident {
+					ref = sel
+					i--
+				}
+				inst, ok := stack[i].(*ast.IndexExpr)
+				if ok && inst.X == ref {
+					ref = inst
+					i--
+				} else {
+					inst = nil
+				}
+
+				// a function value would change its type
+				call, ok := stack[i].(*ast.CallExpr)
+				if !ok || call.Fun != ref || index >= len(call.Args) {
+					uncalled = append(uncalled, g.Loader.Fset.Position(ref.Pos()))
+					return true
+				}
+
+				// in a generic function, the type argument may be its type parameter
+				for _, n := range stack {
+					if caller, ok := n.(*ast.FuncDecl); ok && isGenericFunc(caller) {
+						unresolved = append(unresolved, g.Loader.Fset.Position(ref.Pos()))
+						return true
+					}
+				}
+
+				var typ types.Type
+				if inst != nil {
+					typ = typeOfTypeExpr(p, file, inst.Index)
+				} else {
+					typ = typeOfArgument(info, call.Args[index])
+				}
+				if typ == nil {
+					unresolved = append(unresolved, g.Loader.Fset.Position(ref.Pos()))
+					return true
+				}
+
+				if inst != nil {
+					refs := []sourceEdit{{start: tf.Offset(inst.X.End()), end: tf.Offset(inst.End())}}
+
+					// the constants, which may be untyped, are converted to the type argument as passed
+					arg := call.Args[index]
+					if info.Types[arg].Value != nil {
+						refs = append(refs,
+							sourceEdit{start: tf.Offset(arg.Pos()), end: tf.Offset(arg.Pos()), text: []byte(g.showNode(inst.Index) + "(")},
+							sourceEdit{start: tf.Offset(arg.End()), end: tf.Offset(arg.End()), text: []byte(")")},
+						)
+					}
+
+					gi.refs[file] = append(gi.refs[file], refs...)
+				}
+
+				insts = append(insts, instanceRef{typ: typ, pos: g.Loader.Fset.Position(ref.Pos())})
+				return true
+			})
+		}
+	}
+
+	if len(uncalled) > 0 {
+		return fail("%s is referred to without being called at %s", funcDecl.Name.Name, uncalled[0])
+	}
+	if len(unresolved) > 0 {
+		return fail("type argument of %s is not resolved at %s", funcDecl.Name.Name, unresolved[0])
+	}
+
+	sort.Sort(byInstancePos(insts))
+	for _, inst := range insts {
+		if !containsIdentical(gi.types, inst.typ) {
+			gi.types = append(gi.types, inst.typ)
+		}
+	}
+
+	if len(gi.types) == 0 {
+		return fail("%s is not instantiated in the program", funcDecl.Name.Name)
+	}
+
+	return gi, nil
+}
+
+// isTypeParam reports whether ident in the function of gi refers to its type parameter: it is of the name,
+// and is either not resolved by the type checker or resolved to the declaration in the type parameter list.
+func (gi *genericInstances) isTypeParam(ident *ast.Ident) bool {
+	if ident.Name != gi.typeParam.Name || gi.pkg.Defs[ident] != nil {
+		return false
+	}
+
+	obj := gi.pkg.Uses[ident]
+	if obj == nil {
+		return true
+	}
+
+	tparams := gi.funcDecl.Type.TypeParams
+	return tparams.Pos() <= obj.Pos() && obj.Pos() < tparams.End()
+}
+
+// typeParamRefs returns the identifiers in node referring to the type parameter of gi,
+// skipping the selectors of fields and methods.
+func (gi *genericInstances) typeParamRefs(node ast.Node) []*ast.Ident {
+	idents := []*ast.Ident{}
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok && gi.isTypeParam(ident) {
+					idents = append(idents, ident)
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			if gi.isTypeParam(node) {
+				idents = append(idents, node)
+			}
+		}
+		return true
+	})
+
+	return idents
+}
+
+// mentionsTypeParam reports whether node refers to the type parameter of gi.
+func (gi *genericInstances) mentionsTypeParam(node ast.Node) bool {
+	return len(gi.typeParamRefs(node)) > 0
+}
+
+// typeOfTypeExpr returns the type denoted by expr, a type argument in file of p, or nil if it is not resolved.
+// The names are looked up in the package and universe scopes and the imports of file, as the type checker
+// does not type-check type arguments. Local types are not resolved.
+func typeOfTypeExpr(p *loader.PackageInfo, file *ast.File, expr ast.Expr) types.Type {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return typeOfTypeExpr(p, file, expr.X)
+
+	case *ast.Ident:
+		obj := p.Pkg.Scope().Lookup(expr.Name)
+		if obj == nil {
+			obj = types.Universe.Lookup(expr.Name)
+		}
+		if tn, ok := obj.(*types.TypeName); ok {
+			return tn.Type()
+		}
+
+	case *ast.SelectorExpr:
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			for _, imp := range p.Pkg.Imports() {
+				if imp.Path() != path || importName(spec, &p.Info) != x.Name {
+					continue
+				}
+				if tn, ok := imp.Scope().Lookup(expr.Sel.Name).(*types.TypeName); ok && tn.Exported() {
+					return tn.Type()
+				}
+			}
+		}
+
+	case *ast.StarExpr:
+		if elem := typeOfTypeExpr(p, file, expr.X); elem != nil {
+			return types.NewPointer(elem)
+		}
+
+	case *ast.ArrayType:
+		if elem := typeOfTypeExpr(p, file, expr.Elt); elem != nil && expr.Len == nil {
+			return types.NewSlice(elem)
+		}
+
+	case *ast.MapType:
+		key, elem := typeOfTypeExpr(p, file, expr.Key), typeOfTypeExpr(p, file, expr.Value)
+		if key != nil && elem != nil {
+			return types.NewMap(key, elem)
+		}
+	}
+
+	return nil
+}
+
+// typeOfArgument returns the type of arg passed as the parameter of the type parameter, from which
+// the type argument is inferred, with the untyped constants of their default types, or nil if it is not typed.
+func typeOfArgument(info *types.Info, arg ast.Expr) types.Type {
+	t := info.TypeOf(arg)
+	if b, ok := t.(*types.Basic); ok && b.Kind() == types.Invalid {
+		t = nil
+	}
+
+	if t == nil {
+		// the parameter of the type parameter, which is not declared, may leave the literals invalid
+		lit, ok := arg.(*ast.BasicLit)
+		if !ok {
+			return nil
+		}
+		switch lit.Kind {
+		case token.INT:
+			t = types.Typ[types.UntypedInt]
+		case token.FLOAT:
+			t = types.Typ[types.UntypedFloat]
+		case token.IMAG:
+			t = types.Typ[types.UntypedComplex]
+		case token.CHAR:
+			t = types.Typ[types.UntypedRune]
+		case token.STRING:
+			t = types.Typ[types.UntypedString]
+		}
+	}
+
+	return types.Default(t)
+}
+
+// isBasicInterface reports whether the constraint expr in file of p is an interface having methods only,
+// e.g. fmt.Stringer, which can be the type of a parameter.
+func isBasicInterface(p *loader.PackageInfo, file *ast.File, expr ast.Expr) bool {
+	if iface, ok := expr.(*ast.InterfaceType); ok {
+		for _, field := range iface.Methods.List {
+			if len(field.Names) == 0 {
+				return false
+			}
+		}
+		return len(iface.Methods.List) > 0
+	}
+
+	t := typeOfTypeExpr(p, file, expr)
+	if t == nil {
+		return false
+	}
+
+	iface, ok := t.Underlying().(*types.Interface)
+	return ok && iface.NumMethods() > 0 && iface.NumEmbeddeds() == 0
+}
+
+// paramNames returns the names of the parameters of funcDecl, one by one, with "" for the unnamed ones.
+func paramNames(funcDecl *ast.FuncDecl) []string {
+	names := []string{}
+	for _, field := range funcDecl.Type.Params.List {
+		if len(field.Names) == 0 {
+			names = append(names, "")
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+
+	return names
+}
+
+// instanceRef is a type argument of an instantiation, at the position of the reference to the function.
+type instanceRef struct {
+	typ types.Type
+	pos token.Position
+}
+
+type byInstancePos []instanceRef
+
+func (s byInstancePos) Len() int      { return len(s) }
+func (s byInstancePos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byInstancePos) Less(i, j int) bool {
+	if s[i].pos.Filename != s[j].pos.Filename {
+		return s[i].pos.Filename < s[j].pos.Filename
+	}
+	return s[i].pos.Offset < s[j].pos.Offset
+}
+
+// edits returns the edits to the file of the function, whose source is src, replacing the function
+// with the one switching on the types of the instantiations. The types are qualified by imports.
+func (gi *genericInstances) edits(g Gen, src []byte, imports *fileImports) ([]sourceEdit, error) {
+	funcDecl := gi.funcDecl
+	tf := g.tokenFile(funcDecl)
+	text := func(from, to token.Pos) string {
+		return string(src[tf.Offset(from):tf.Offset(to)])
+	}
+
+	typeStrings := []string{}
+	for _, t := range gi.types {
+		if named, ok := t.(*types.Named); ok && !named.Obj().Exported() && named.Obj().Pkg() != nil && named.Obj().Pkg() != gi.pkg.Pkg {
+			return nil, fmt.Errorf("%s: cannot generate type switch: %s is not accessible from the package of %s", g.Loader.Fset.Position(funcDecl.Pos()), t, funcDecl.Name.Name)
+		}
+		typeStrings = append(typeStrings, types.TypeString(t, imports.qualifier))
+	}
+
+	// the parameter is of the constraint if it has methods only
+	paramType := "interface{}"
+	constraint := funcDecl.Type.TypeParams.List[0].Type
+	if isBasicInterface(gi.pkg, gi.file, constraint) {
+		paramType = text(constraint.Pos(), constraint.End())
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "func %s(", funcDecl.Name.Name)
+	for i, field := range funcDecl.Type.Params.List {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if len(field.Names) == 1 && field.Names[0] == gi.param {
+			fmt.Fprintf(&buf, "%s %s", gi.param.Name, paramType)
+		} else {
+			buf.WriteString(text(field.Pos(), field.End()))
+		}
+	}
+	buf.WriteString(")")
+	if funcDecl.Type.Results != nil {
+		buf.WriteString(" " + text(funcDecl.Type.Results.Pos(), funcDecl.Type.Results.End()))
+	}
+
+	// the body in each clause, with the type parameter replaced by the type
+	body := funcDecl.Body
+	inner := func(typ string) string {
+		edits := []sourceEdit{}
+		for _, ident := range gi.typeParamRefs(body) {
+			edits = append(edits, sourceEdit{start: tf.Offset(ident.Pos()) - tf.Offset(body.Lbrace+1), end: tf.Offset(ident.End()) - tf.Offset(body.Lbrace+1), text: []byte(typ)})
+		}
+
+		return string(applyEdits([]byte(text(body.Lbrace+1, body.Rbrace)), edits))
+	}
+
+	fmt.Fprintf(&buf, " {\nswitch %s := %s.(type) {\n", gi.param.Name, gi.param.Name)
+	for _, typ := range typeStrings {
+		fmt.Fprintf(&buf, "case %s:\n%s\n", typ, strings.TrimSpace(inner(typ)))
+	}
+	fmt.Fprintf(&buf, "default:\npanic(%q)\n}\n}", funcDecl.Name.Name+": unexpected type")
+
+	return []sourceEdit{{start: tf.Offset(funcDecl.Pos()), end: tf.Offset(funcDecl.End()), text: buf.Bytes()}}, nil
+}
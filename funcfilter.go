@@ -0,0 +1,106 @@
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// funcNames returns the names the function fn can be referred to by in Gen.FuncFilter:
+// its name (Foo, or (*T).Method and T.Method for methods) unqualified,
+// qualified by the name of its package and qualified by the path of its package.
+// The last one is the one matched by regular expressions.
+func funcNames(fn *types.Func) []string {
+	name := fn.Name()
+
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		t := recv.Type()
+		ptr := false
+		if p, ok := t.(*types.Pointer); ok {
+			t, ptr = p.Elem(), true
+		}
+
+		typeName := types.TypeString(t, func(*types.Package) string { return "" })
+		if ptr {
+			name = "(*" + typeName + ")." + name
+		} else {
+			name = typeName + "." + name
+		}
+	}
+
+	if fn.Pkg() == nil {
+		return []string{name}
+	}
+
+	return []string{name, fn.Pkg().Name() + "." + name, fn.Pkg().Path() + "." + name}
+}
+
+// selectsFunc reports whether the type switches of funcDecl of pkg are to be expanded according to g.FuncFilter.
+func (g Gen) selectsFunc(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl) bool {
+	if g.FuncFilter == nil {
+		return true
+	}
+
+	fn, ok := pkg.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+
+	for _, filter := range g.FuncFilter {
+		if matchesFunc(filter, fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesFunc reports whether filter, an entry of Gen.FuncFilter, matches the function fn.
+func matchesFunc(filter string, fn *types.Func) bool {
+	names := funcNames(fn)
+
+	if strings.HasPrefix(filter, regexpPrefix) {
+		ok, err := regexp.MatchString(strings.TrimPrefix(filter, regexpPrefix), names[len(names)-1])
+		return err == nil && ok
+	}
+
+	if pkgName := strings.TrimSuffix(filter, ".*"); pkgName != filter && fn.Pkg() != nil {
+		return pkgName == fn.Pkg().Name() || pkgName == fn.Pkg().Path()
+	}
+
+	for _, name := range names {
+		if filter == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkFuncFilter reports the invalid regular expressions in g.FuncFilter.
+func (g Gen) checkFuncFilter() error {
+	for _, filter := range g.FuncFilter {
+		if err := checkFuncFilterEntry(filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkFuncFilterEntry reports the invalid regular expression of filter, an entry of Gen.FuncFilter.
+func checkFuncFilterEntry(filter string) error {
+	if !strings.HasPrefix(filter, regexpPrefix) {
+		return nil
+	}
+
+	if _, err := regexp.Compile(strings.TrimPrefix(filter, regexpPrefix)); err != nil {
+		return fmt.Errorf("invalid function filter %q: %s", filter, err)
+	}
+
+	return nil
+}
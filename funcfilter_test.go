@@ -0,0 +1,41 @@
+package gen
+
+import (
+	"testing"
+
+	"go/ast"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectsFunc(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/funcfilter.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+
+	selected := func(filter ...string) []string {
+		g.FuncFilter = filter
+
+		names := []string{}
+		for _, decl := range pkg.Files[0].Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && g.selectsFunc(pkg, funcDecl) {
+				names = append(names, funcDecl.Name.Name)
+			}
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"main", "describe", "area", "name"}, selected())
+	assert.Equal(t, []string{"describe"}, selected("describe"))
+	assert.Equal(t, []string{"describe", "name"}, selected("main.describe", "(*shape).name"))
+	assert.Equal(t, []string{"area"}, selected("shape.area", "shape.name"))
+	assert.Equal(t, []string{"area", "name"}, selected(`re:\.\(?\*?shape\)?\.`))
+	assert.Equal(t, []string{"main", "describe", "area", "name"}, selected("main.*"))
+	assert.Equal(t, []string{}, selected("other.*", "Describe"))
+}
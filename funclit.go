@@ -0,0 +1,56 @@
+package gen
+
+import (
+	"fmt"
+
+	"go/ast"
+)
+
+// funcOrLit is a function declaration, or a function literal in one as a declaration by funcLitDecl.
+type funcOrLit struct {
+	funcDecl *ast.FuncDecl
+
+	// lit is the number of the literal in the declaration, counted from 1 in the order of funcLits,
+	// or 0 for the declaration itself.
+	lit int
+}
+
+// withFuncLits returns funcDecl followed by the function literals in it, e.g. the closures assigned to variables
+// or passed as callbacks, so that their type switches are expanded by the arguments of their calls as well.
+// The literals of generic functions are not, as of the declarations themselves.
+func withFuncLits(funcDecl *ast.FuncDecl) []funcOrLit {
+	fns := []funcOrLit{{funcDecl: funcDecl}}
+	if isGenericFunc(funcDecl) {
+		return fns
+	}
+
+	for i, lit := range funcLits(funcDecl) {
+		fns = append(fns, funcOrLit{funcDecl: funcLitDecl(funcDecl, lit, i+1), lit: i + 1})
+	}
+
+	return fns
+}
+
+// funcLits returns the function literals in funcDecl in the order of their positions, including the nested ones.
+func funcLits(funcDecl *ast.FuncDecl) []*ast.FuncLit {
+	lits := []*ast.FuncLit{}
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		if lit, ok := node.(*ast.FuncLit); ok {
+			lits = append(lits, lit)
+		}
+		return true
+	})
+
+	return lits
+}
+
+// funcLitDecl returns the n-th function literal lit in funcDecl as a declaration of the type and the body of lit,
+// named after funcDecl as the anonymous functions in SSA are, e.g. f$1. Its position is that of lit,
+// which locates the anonymous function in the call graph and keys its call sites in the cache.
+func funcLitDecl(funcDecl *ast.FuncDecl, lit *ast.FuncLit, n int) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Name: &ast.Ident{NamePos: lit.Pos(), Name: fmt.Sprintf("%s$%d", funcDecl.Name.Name, n)},
+		Type: lit.Type,
+		Body: lit.Body,
+	}
+}
@@ -0,0 +1,65 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_FuncLits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the call sites of the first literal in main, size
+	{
+		g := New()
+		g.CacheDir = dir
+		err := g.Loader.CreateFromFilenames("", "testdata/funclit.go")
+		require.NoError(t, err)
+		require.NoError(t, g.load())
+
+		c, err := g.openAnalysisCache()
+		require.NoError(t, err)
+
+		for _, decl := range g.program.Created[0].Files[0].Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "main" {
+				fns := withFuncLits(funcDecl)
+				require.Len(t, fns, 3)
+				assert.Equal(t, "main$1", fns[1].funcDecl.Name.Name)
+
+				lit := fns[1].funcDecl
+				args := [][]types.Type{{types.NewSlice(types.Typ[types.Int])}, {types.NewSlice(types.Typ[types.String])}}
+				c.put(g.Loader.Fset, lit, &callSites{funcDecl: lit, args: args, positions: []token.Pos{lit.Pos(), lit.Pos()}})
+			}
+		}
+		require.NoError(t, c.save())
+	}
+
+	g := New()
+	g.CacheDir = dir
+	err = g.Loader.CreateFromFilenames("", "testdata/funclit.go")
+	require.NoError(t, err)
+
+	// the switch of size only, as the other literal is not cached
+	src, err := ioutil.ReadFile("testdata/funclit.go")
+	require.NoError(t, err)
+	offset := bytes.Index(src, []byte("case []T:"))
+	g.Region = &Region{Filename: "testdata/funclit.go", Start: offset, End: offset}
+
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/funclit.go"])
+	t.Log(out)
+
+	assert.Contains(t, out, "\t\tcase []int:\n\t\t\treturn len(v)\n\t\tcase []string:\n\t\t\treturn len(v)\n")
+}
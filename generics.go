@@ -0,0 +1,121 @@
+package gen
+
+import (
+	"fmt"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// The type checker predates generics, so the generic functions and types (Go 1.18 or later) and their instantiations
+// fail to type-check, and the packages having them or importing them are not built into SSA. Their type errors are
+// tolerated, leaving the type switches in such packages unexpanded, as their call sites are not analyzed.
+
+// allowGenericErrors makes g.Loader keep loading the packages with type errors, to be checked by checkGenericErrors,
+// unless the type errors are handled by the caller.
+func (g *Gen) allowGenericErrors() bool {
+	if g.Loader.AllowErrors || g.Loader.TypeChecker.Error != nil {
+		return false
+	}
+
+	g.Loader.AllowErrors = true
+	g.Loader.TypeChecker.Error = func(err error) {}
+	return true
+}
+
+// checkGenericErrors returns the first error of the packages in program which is not a type error in generic code.
+// The packages having the type errors in generic code are warned about.
+func (g Gen) checkGenericErrors(program *loader.Program) error {
+	var regions []genericRegion
+
+	for _, pkg := range program.AllPackages {
+		if len(pkg.Errors) == 0 {
+			continue
+		}
+
+		if regions == nil {
+			regions = genericRegions(program)
+		}
+
+		var tolerated *types.Error
+		for _, err := range pkg.Errors {
+			terr, ok := err.(types.Error)
+			if !ok || !inGenericRegion(regions, terr.Pos) {
+				return err
+			}
+			if tolerated == nil {
+				tolerated = &terr
+			}
+		}
+
+		g.logger().Warn(tolerated.Fset.Position(tolerated.Pos), fmt.Sprintf("package %s is not analyzed: generic code does not type-check: %s", pkg.Pkg.Path(), tolerated.Msg))
+	}
+
+	return nil
+}
+
+// genericRegion is the range of generic code in a file.
+type genericRegion struct {
+	pos, end token.Pos
+}
+
+// inGenericRegion reports whether pos is in one of regions.
+func inGenericRegion(regions []genericRegion, pos token.Pos) bool {
+	for _, r := range regions {
+		if r.pos <= pos && pos < r.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// genericRegions returns the generic code in the files of program: the declarations of generic functions and types,
+// and the instantiations of them by type arguments, e.g. f[int] or Box[string]{}.
+func genericRegions(program *loader.Program) []genericRegion {
+	regions := []genericRegion{}
+
+	// the positions of the names of the generic declarations
+	declared := map[token.Pos]bool{}
+	for _, pkg := range program.AllPackages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if isGenericFunc(decl) {
+						declared[decl.Name.Pos()] = true
+						regions = append(regions, genericRegion{decl.Pos(), decl.End()})
+					}
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						if spec, ok := spec.(*ast.TypeSpec); ok && isGenericTypeSpec(spec) {
+							declared[spec.Name.Pos()] = true
+							regions = append(regions, genericRegion{spec.Pos(), spec.End()})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, pkg := range program.AllPackages {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				x := instantiatedExpr(node)
+				if sel, ok := x.(*ast.SelectorExpr); ok {
+					x = sel.Sel
+				}
+				if ident, ok := x.(*ast.Ident); ok {
+					if obj := pkg.Uses[ident]; obj != nil && declared[obj.Pos()] {
+						regions = append(regions, genericRegion{node.Pos(), node.End()})
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	return regions
+}
@@ -0,0 +1,49 @@
+//go:build go1.18
+// +build go1.18
+
+package gen
+
+import (
+	"go/ast"
+)
+
+// isGenericFunc reports whether funcDecl has type parameters, or is a method of a generic type.
+func isGenericFunc(funcDecl *ast.FuncDecl) bool {
+	if funcDecl.Type.TypeParams != nil && funcDecl.Type.TypeParams.NumFields() > 0 {
+		return true
+	}
+
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return false
+	}
+
+	recv := funcDecl.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+
+	switch recv.(type) {
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return true
+	}
+
+	return false
+}
+
+// isGenericTypeSpec reports whether spec declares a generic type.
+func isGenericTypeSpec(spec *ast.TypeSpec) bool {
+	return spec.TypeParams != nil && spec.TypeParams.NumFields() > 0
+}
+
+// instantiatedExpr returns the expression indexed by node, which may be a generic function or type instantiated,
+// or nil if node is not an index expression.
+func instantiatedExpr(node ast.Node) ast.Expr {
+	switch node := node.(type) {
+	case *ast.IndexExpr:
+		return node.X
+	case *ast.IndexListExpr:
+		return node.X
+	}
+
+	return nil
+}
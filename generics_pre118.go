@@ -0,0 +1,31 @@
+//go:build !go1.18
+// +build !go1.18
+
+package gen
+
+import (
+	"fmt"
+
+	"go/ast"
+)
+
+// isGenericFunc reports whether funcDecl has type parameters, which the sources before Go 1.18 never have.
+func isGenericFunc(funcDecl *ast.FuncDecl) bool {
+	return false
+}
+
+// isGenericTypeSpec reports whether spec declares a generic type, which the sources before Go 1.18 never do.
+func isGenericTypeSpec(spec *ast.TypeSpec) bool {
+	return false
+}
+
+// instantiatedExpr returns the expression indexed by node, which is never instantiated before Go 1.18.
+func instantiatedExpr(node ast.Node) ast.Expr {
+	return nil
+}
+
+// FromGeneric rewrites the generic function at the line of the file into a type switch on its instantiations,
+// which requires Go 1.18 or later.
+func (g Gen) FromGeneric(filename string, line int) error {
+	return fmt.Errorf("generic functions require Go 1.18 or later")
+}
@@ -0,0 +1,260 @@
+//go:build go1.18
+// +build go1.18
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_Generics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/generics.go", "length", [][]types.Type{{types.NewSlice(types.Typ[types.Int])}})
+
+	var log bytes.Buffer
+	g := New()
+	g.CacheDir = dir
+	g.Logger = NewTextLogger(&log, false)
+	err = g.Loader.CreateFromFilenames("", "testdata/generics.go")
+	require.NoError(t, err)
+
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/generics.go"])
+	t.Log(out)
+
+	assert.Contains(t, out, "\tcase []int:\n\t\treturn len(v)\n")
+	assert.Equal(t, 1, bytes.Count([]byte(out), []byte("case []int:")), "generic functions not expanded")
+
+	t.Log(log.String())
+	assert.Contains(t, log.String(), "type switch in generic function First is not expanded")
+	assert.Contains(t, log.String(), "type switch in generic function Len is not expanded")
+
+	list, err := g.ListTypeSwitches()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+
+	assert.True(t, list[0].Expandable)
+	for _, info := range list[1:] {
+		assert.False(t, info.Expandable)
+		assert.False(t, info.TypeVariables)
+		assert.Equal(t, "in a generic function", info.Reason)
+	}
+}
+
+func TestInitProgram_Generics(t *testing.T) {
+	var log bytes.Buffer
+	g := New()
+	g.Logger = NewTextLogger(&log, false)
+	err := g.Loader.CreateFromFilenames("", "testdata/generics.go")
+	require.NoError(t, err)
+
+	err = g.initProgram(needSSA)
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+	assert.Empty(t, log.String())
+
+	// the type errors the type checker predating generics reports
+	at := func(pattern string) token.Pos {
+		src, err := ioutil.ReadFile("testdata/generics.go")
+		require.NoError(t, err)
+		offset := bytes.Index(src, []byte(pattern))
+		require.True(t, offset >= 0, pattern)
+		return g.tokenFile(file).Pos(offset)
+	}
+	typeError := func(pattern, msg string) error {
+		return types.Error{Fset: g.Loader.Fset, Pos: at(pattern), Msg: msg}
+	}
+
+	pkg.Errors = []error{
+		typeError("E\n\tswitch", "undeclared name: E"),
+		typeError("[]E }", "undeclared name: E"),
+		typeError("First[int]", "cannot index First"),
+		typeError("Box[int]{}", "Box is not a generic type"),
+		typeError("b.items", "invalid operation"),
+	}
+	pkg.TransitivelyErrorFree = false
+
+	err = g.checkGenericErrors(g.program)
+	require.NoError(t, err)
+	assert.Contains(t, log.String(), "package testdata is not analyzed: generic code does not type-check: undeclared name: E")
+
+	pkg.Errors = append(pkg.Errors, typeError("len(v)", "undeclared name: len"))
+	err = g.checkGenericErrors(g.program)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "undeclared name: len")
+	}
+
+	// the type switches of the package are left unexpanded, as their call sites are not analyzed
+	log.Reset()
+	edits, _, err := g.expandFileEdits(pkg, file, newFileImports(file, pkg.Pkg, &pkg.Info))
+	require.NoError(t, err)
+	assert.Empty(t, edits)
+	assert.Contains(t, log.String(), "type switch in package testdata is not expanded, as it or its imports have generic code")
+
+	_, err = g.callGraphNode(file.Decls[1].(*ast.FuncDecl))
+	assert.Error(t, err)
+}
+
+func TestToGeneric(t *testing.T) {
+	toGeneric := func(line int, wrapper bool) string {
+		out := new(bytes.Buffer)
+
+		g := New()
+		g.Features = Features{FeatureGenerics: true}
+		g.FileWriter = func(path string) io.WriteCloser {
+			if path == "testdata/togeneric.go" {
+				return nopCloser{out}
+			}
+
+			return nil
+		}
+		err := g.Loader.CreateFromFilenames("", "testdata/togeneric.go")
+		require.NoError(t, err)
+
+		err = g.ToGeneric("testdata/togeneric.go", line, wrapper)
+		require.NoError(t, err)
+
+		t.Log(out.String())
+		return out.String()
+	}
+
+	result := toGeneric(9, false)
+	assert.Contains(t, result, "// format formats a value with its unit.\nfunc format[T int | Celsius | float32 | float64](v T, prec int) string {\n\tswitch v := any(v).(type) {\n")
+	assert.Contains(t, result, "\tcase Celsius:\n\t\treturn fmt.Sprintf(\"%.*f°C\", prec, float64(v))\n")
+	assert.Contains(t, result, "\tdefault:\n\t\tpanic(\"unreachable\")\n")
+	assert.NotContains(t, result, "fmt.Stringer")
+
+	result = toGeneric(24, true)
+	assert.Contains(t, result, "// Deprecated: Use printAllGeneric instead.\nfunc printAll(x interface{}, names ...string) {\n")
+	assert.Contains(t, result, "\tcase []string:\n\t\tprintAllGeneric(x.([]string), names...)\n\t\treturn\n")
+	assert.Contains(t, result, "// printAllGeneric is printAll for the types of its cases, as a generic function.\nfunc printAllGeneric[T string | []string](x T, names ...string) {\n\tswitch any(x).(type) {\n")
+
+	g := New()
+	g.Features = Features{FeatureGenerics: true}
+	err := g.Loader.CreateFromFilenames("", "testdata/generics.go")
+	require.NoError(t, err)
+	err = g.ToGeneric("testdata/generics.go", 15, false)
+	assert.Error(t, err)
+
+	g = New()
+	err = g.Loader.CreateFromFilenames("", "testdata/togeneric.go")
+	require.NoError(t, err)
+	err = g.ToGeneric("testdata/togeneric.go", 9, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `enable it by the feature "generics"`)
+	}
+}
+
+func TestFromGeneric(t *testing.T) {
+	fromGeneric := func(line int) (string, error) {
+		out := new(bytes.Buffer)
+
+		g := New()
+		g.Features = Features{FeatureGenerics: true}
+		g.FileWriter = func(path string) io.WriteCloser {
+			if path == "testdata/fromgeneric.go" {
+				return nopCloser{out}
+			}
+
+			return nil
+		}
+		err := g.Loader.CreateFromFilenames("", "testdata/fromgeneric.go")
+		require.NoError(t, err)
+
+		err = g.FromGeneric("testdata/fromgeneric.go", line)
+		t.Log(out.String())
+		return out.String(), err
+	}
+
+	result, err := fromGeneric(14)
+	require.NoError(t, err)
+	assert.Contains(t, result, "// format formats a value with its unit.\nfunc format(v interface{}, prec int) string {\n\tswitch v := v.(type) {\n\tcase int:\n\t\tvar zero int\n")
+	assert.Contains(t, result, "\tcase Celsius:\n\t\tvar zero Celsius\n\t\tif v == zero {\n\t\t\treturn \"0\"\n\t\t}\n\t\treturn fmt.Sprintf(\"%.*v\", prec, v)\n\tcase float64:\n")
+	assert.Contains(t, result, "\tdefault:\n\t\tpanic(\"format: unexpected type\")\n")
+	assert.Contains(t, result, "fmt.Println(format(1, 0), format(Celsius(20), 1), format(3, 0))")
+	assert.Contains(t, result, "fmt.Println(format(float64(1.5), 2))")
+
+	// describe[Celsius] as a value would be of a different type
+	_, err = fromGeneric(22)
+	assert.Error(t, err)
+
+	_, err = fromGeneric(25)
+	assert.Error(t, err)
+
+	// label is instantiated with the type parameter of labelAll
+	_, err = fromGeneric(38)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "type argument of label is not resolved")
+	}
+}
+
+func TestTypeOfTypeExpr(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/fromgeneric.go")
+	require.NoError(t, err)
+	err = g.initProgram(needTypes)
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	tests := []struct {
+		expr     string
+		typ      string
+		basic    bool
+		resolved bool
+	}{
+		{"Celsius", "testdata.Celsius", false, true},
+		{"[]*Celsius", "[]*testdata.Celsius", false, true},
+		{"map[string]int", "map[string]int", false, true},
+		{"fmt.Stringer", "fmt.Stringer", true, true},
+		{"interface{ String() string }", "", true, false},
+		{"int | Celsius", "", false, false},
+		{"comparable", "", false, false},
+		{"fmt.pp", "", false, false},
+		{"Fahrenheit", "", false, false},
+	}
+
+	for _, test := range tests {
+		expr, err := parser.ParseExpr(test.expr)
+		require.NoError(t, err)
+
+		typ := typeOfTypeExpr(pkg, file, expr)
+		if test.resolved && assert.NotNil(t, typ, test.expr) {
+			assert.Equal(t, test.typ, typ.String(), test.expr)
+		}
+		if !test.resolved && test.expr != "comparable" {
+			assert.Nil(t, typ, test.expr)
+		}
+
+		assert.Equal(t, test.basic, isBasicInterface(pkg, file, expr), test.expr)
+	}
+
+	// the literals are of their default types when the type checker leaves them untyped
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	for lit, typ := range map[string]string{"1": "int", "1.5": "float64", "'a'": "rune", `"s"`: "string", "x": "<nil>"} {
+		expr, err := parser.ParseExpr(lit)
+		require.NoError(t, err)
+		assert.Equal(t, typ, fmt.Sprint(typeOfArgument(info, expr)), lit)
+	}
+}
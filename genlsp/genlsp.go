@@ -0,0 +1,299 @@
+// Package genlsp provides the rewritings of tsgen as the code actions of the Language Server Protocol,
+// "Expand type switch" and "Sort cases", for language servers to offer them on the type switches
+// in the ranges requested, with the edits to the documents computed from their unsaved contents.
+package genlsp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+const (
+	// KindExpand is the kind of the action expanding the type switches by Gen.Expand.
+	KindExpand CodeActionKind = "refactor.rewrite.expandTypeSwitch"
+
+	// KindSort is the kind of the action sorting the cases of the type switches by Gen.Sort.
+	KindSort CodeActionKind = "refactor.rewrite.sortCases"
+)
+
+// Provider computes the code actions for the Go documents open in an editor,
+// whose contents are given to Gen.Overlay so that the unsaved changes are rewritten.
+type Provider struct {
+	// newGen returns a Gen configured for the rewritings, e.g. with Main and Sorter.
+	newGen func() *gen.Gen
+
+	mu sync.Mutex
+
+	// documents are the contents of the open documents by their file names.
+	documents map[string][]byte
+}
+
+// NewProvider creates a Provider rewriting by the Gens newGen returns, one for each action computed.
+// If the Gen has no packages to load, the package in the directory of the document is created from its files,
+// or the package of its Main is imported if set.
+func NewProvider(newGen func() *gen.Gen) *Provider {
+	return &Provider{newGen: newGen, documents: map[string][]byte{}}
+}
+
+// DidOpen records the content of the document opened, for textDocument/didOpen.
+func (p *Provider) DidOpen(uri DocumentURI, text string) error {
+	return p.DidChange(uri, text)
+}
+
+// DidChange records the new content of the document, for textDocument/didChange with the full content.
+func (p *Provider) DidChange(uri DocumentURI, text string) error {
+	filename, err := uriFilename(uri)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.documents[filename] = []byte(text)
+	return nil
+}
+
+// DidClose forgets the content of the document closed, for textDocument/didClose.
+func (p *Provider) DidClose(uri DocumentURI) error {
+	filename, err := uriFilename(uri)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.documents, filename)
+	return nil
+}
+
+// CodeActions returns the actions for the type switches overlapping params.Range, for textDocument/codeAction:
+// one of KindExpand expanding them and one of KindSort sorting their cases, unless they change nothing
+// or are not of the kinds in params.Context.Only. Each has the edit replacing the text changed by the rewriting.
+// The actions computed are returned along with the error of the other, e.g. of an expansion failing to analyze the program.
+func (p *Provider) CodeActions(params CodeActionParams) ([]CodeAction, error) {
+	filename, err := uriFilename(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := p.content(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	region := gen.Region{
+		Filename: filename,
+		Start:    offsetOf(src, params.Range.Start),
+		End:      offsetOf(src, params.Range.End),
+	}
+	if !hasTypeSwitch(filename, src, region) {
+		return nil, nil
+	}
+
+	actions := []CodeAction{}
+	var firstErr error
+
+	for _, a := range []struct {
+		title   string
+		kind    CodeActionKind
+		rewrite func(gen.Gen) (map[string][]byte, error)
+	}{
+		{"Expand type switch", KindExpand, gen.Gen.ExpandBytes},
+		{"Sort cases", KindSort, gen.Gen.SortBytes},
+	} {
+		if !requested(params.Context.Only, a.kind) {
+			continue
+		}
+
+		newSrc, err := p.rewrite(filename, region, a.rewrite)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if newSrc == nil || string(newSrc) == string(src) {
+			continue
+		}
+
+		actions = append(actions, CodeAction{
+			Title: a.title,
+			Kind:  a.kind,
+			Edit: &WorkspaceEdit{
+				Changes: map[DocumentURI][]TextEdit{params.TextDocument.URI: {textEdit(src, newSrc)}},
+			},
+		})
+	}
+
+	return actions, firstErr
+}
+
+// rewrite returns the source of the file filename rewritten by rewrite in region, or nil if not written.
+func (p *Provider) rewrite(filename string, region gen.Region, rewrite func(gen.Gen) (map[string][]byte, error)) ([]byte, error) {
+	g := p.newGen()
+	g.Overlay = p.overlay()
+	g.Region = &region
+
+	if len(g.Loader.CreatePkgs) == 0 && len(g.Loader.ImportPkgs) == 0 {
+		if g.Main != "" {
+			g.Loader.Import(g.Main)
+		} else {
+			filenames, err := packageFiles(g.BuildContext(), filepath.Dir(filename))
+			if err != nil {
+				return nil, err
+			}
+
+			err = g.Loader.CreateFromFilenames("", filenames...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sources, err := rewrite(*g)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, src := range sources {
+		if abs, err := filepath.Abs(name); err == nil && abs == filename {
+			return src, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// content returns the content of the document of filename, or of the file if not open.
+func (p *Provider) content(filename string) ([]byte, error) {
+	p.mu.Lock()
+	src, ok := p.documents[filename]
+	p.mu.Unlock()
+
+	if ok {
+		return src, nil
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+// overlay returns a copy of the contents of the documents open.
+func (p *Provider) overlay() map[string][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	overlay := map[string][]byte{}
+	for name, src := range p.documents {
+		overlay[name] = src
+	}
+
+	return overlay
+}
+
+// requested reports whether the actions of kind are requested by only, which matches the kinds
+// equal to or under any of them, e.g. "refactor" matches "refactor.rewrite.sortCases".
+func requested(only []CodeActionKind, kind CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+
+	for _, o := range only {
+		if kind == o || strings.HasPrefix(string(kind), string(o)+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasTypeSwitch reports whether src of filename has a type switch overlapping region,
+// before loading the program to rewrite it.
+func hasTypeSwitch(filename string, src []byte, region gen.Region) bool {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sw, ok := node.(*ast.TypeSwitchStmt); ok {
+			start, end := fset.Position(sw.Pos()).Offset, fset.Position(sw.End()).Offset
+			found = found || (start <= region.End && region.Start <= end)
+		}
+		return !found
+	})
+
+	return found
+}
+
+// packageFiles returns the Go files in dir matched by ctxt.
+func packageFiles(ctxt *build.Context, dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := []string{}
+	for _, fi := range entries {
+		match, err := ctxt.MatchFile(dir, fi.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			filenames = append(filenames, filepath.Join(dir, fi.Name()))
+		}
+	}
+
+	return filenames, nil
+}
+
+// uriFilename returns the absolute file name of the file URI uri.
+func uriFilename(uri DocumentURI) (string, error) {
+	u, err := url.Parse(string(uri))
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URI: %s", uri)
+	}
+
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/path
+		path = strings.TrimPrefix(path, "/")
+	}
+
+	return filepath.Abs(filepath.FromSlash(path))
+}
+
+// FileURI returns the URI of the file filename.
+func FileURI(filename string) (DocumentURI, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	u := url.URL{Scheme: "file", Path: path}
+	return DocumentURI(u.String()), nil
+}
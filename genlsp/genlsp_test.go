@@ -0,0 +1,84 @@
+package genlsp
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/motemen/go-typeswitch-gen"
+)
+
+func TestPosition(t *testing.T) {
+	src := []byte("a := \"é𝄞\"\nb\n")
+
+	assert.Equal(t, 8, offsetOf(src, Position{Line: 0, Character: 7}))
+	assert.Equal(t, 12, offsetOf(src, Position{Line: 0, Character: 9}))
+	assert.Equal(t, 13, offsetOf(src, Position{Line: 0, Character: 100}))
+	assert.Equal(t, 14, offsetOf(src, Position{Line: 1, Character: 0}))
+	assert.Equal(t, 16, offsetOf(src, Position{Line: 5, Character: 0}))
+
+	assert.Equal(t, Position{Line: 0, Character: 9}, positionOf(src, 12))
+	assert.Equal(t, Position{Line: 1, Character: 1}, positionOf(src, 15))
+}
+
+func TestTextEdit(t *testing.T) {
+	edit := textEdit([]byte("x\n\"é\"\ny\n"), []byte("x\n\"è\"\ny\n"))
+	assert.Equal(t, Range{Start: Position{Line: 1, Character: 1}, End: Position{Line: 1, Character: 2}}, edit.Range)
+	assert.Equal(t, "è", edit.NewText)
+
+	edit = textEdit([]byte("a\nb\n"), []byte("a\nb\nc\n"))
+	assert.Equal(t, Range{Start: Position{Line: 2, Character: 0}, End: Position{Line: 2, Character: 0}}, edit.Range)
+	assert.Equal(t, "c\n", edit.NewText)
+}
+
+func TestProvider_CodeActions(t *testing.T) {
+	p := NewProvider(func() *gen.Gen {
+		g := gen.New()
+		g.Sorter = gen.ByTypeName
+		return g
+	})
+
+	uri, err := FileURI("../testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	src, err := ioutil.ReadFile("../testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	// unsaved changes are rewritten
+	err = p.DidOpen(uri, "// unsaved\n"+string(src))
+	require.NoError(t, err)
+
+	params := CodeActionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Range:        Range{Start: Position{Line: 25, Character: 2}, End: Position{Line: 25, Character: 2}},
+		Context:      CodeActionContext{Only: []CodeActionKind{KindSort}},
+	}
+
+	actions, err := p.CodeActions(params)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+
+	assert.Equal(t, "Sort cases", actions[0].Title)
+	edits := actions[0].Edit.Changes[uri]
+	require.Len(t, edits, 1)
+
+	t.Log(edits[0].NewText)
+
+	assert.True(t, edits[0].Range.Start.Line >= 25)
+	assert.True(t, strings.Index(edits[0].NewText, "case A:") < strings.Index(edits[0].NewText, "case B:"))
+
+	// out of the type switch
+	params.Range = Range{Start: Position{Line: 3, Character: 0}, End: Position{Line: 3, Character: 0}}
+	actions, err = p.CodeActions(params)
+	require.NoError(t, err)
+	assert.Len(t, actions, 0)
+
+	params.Range = Range{Start: Position{Line: 25, Character: 2}, End: Position{Line: 25, Character: 2}}
+	params.Context.Only = []CodeActionKind{"quickfix"}
+	actions, err = p.CodeActions(params)
+	require.NoError(t, err)
+	assert.Len(t, actions, 0)
+}
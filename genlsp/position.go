@@ -0,0 +1,85 @@
+package genlsp
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// offsetOf returns the byte offset in src of pos, clamped to the end of its line or of src.
+func offsetOf(src []byte, pos Position) int {
+	i := 0
+	for line := 0; line < pos.Line; line++ {
+		j := bytes.IndexByte(src[i:], '\n')
+		if j == -1 {
+			return len(src)
+		}
+		i += j + 1
+	}
+
+	for col := 0; col < pos.Character && i < len(src) && src[i] != '\n'; {
+		r, size := utf8.DecodeRune(src[i:])
+		col += utf16Len(r)
+		i += size
+	}
+
+	return i
+}
+
+// positionOf returns the position of the byte offset in src.
+func positionOf(src []byte, offset int) Position {
+	var pos Position
+
+	lineStart := 0
+	for {
+		j := bytes.IndexByte(src[lineStart:offset], '\n')
+		if j == -1 {
+			break
+		}
+		lineStart += j + 1
+		pos.Line++
+	}
+
+	for i := lineStart; i < offset; {
+		r, size := utf8.DecodeRune(src[i:])
+		pos.Character += utf16Len(r)
+		i += size
+	}
+
+	return pos
+}
+
+// utf16Len returns the number of UTF-16 code units encoding r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
+
+// textEdit returns the edit turning src into newSrc, which replaces the range from the first byte differing
+// to the last one, extended to the boundaries of characters.
+func textEdit(src, newSrc []byte) TextEdit {
+	start := 0
+	for start < len(src) && start < len(newSrc) && src[start] == newSrc[start] {
+		start++
+	}
+	for start > 0 && start < len(src) && !utf8.RuneStart(src[start]) {
+		start--
+	}
+
+	end, newEnd := len(src), len(newSrc)
+	for end > start && newEnd > start && src[end-1] == newSrc[newEnd-1] {
+		end--
+		newEnd--
+	}
+	for end < len(src) && !utf8.RuneStart(src[end]) {
+		end++
+		newEnd++
+	}
+
+	return TextEdit{
+		Range:   Range{Start: positionOf(src, start), End: positionOf(src, end)},
+		NewText: string(newSrc[start:newEnd]),
+	}
+}
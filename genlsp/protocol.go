@@ -0,0 +1,58 @@
+package genlsp
+
+// The types of the Language Server Protocol used by Provider, named and encoded as in the specification
+// (https://microsoft.github.io/language-server-protocol/specification), so that they can be
+// marshaled into the messages of a language server as they are.
+
+// DocumentURI is the URI of a document, e.g. file:///home/user/src/shape.go.
+type DocumentURI string
+
+// Position is a zero-based line and a character offset in it, counted in UTF-16 code units.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is the range between two positions, excluding End.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextEdit replaces the text in Range by NewText.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// WorkspaceEdit are the edits to the documents by their URIs.
+type WorkspaceEdit struct {
+	Changes map[DocumentURI][]TextEdit `json:"changes"`
+}
+
+// CodeActionKind is the kind of a code action, a hierarchical name like "refactor.rewrite".
+type CodeActionKind string
+
+// CodeAction is a change offered for a range of a document.
+type CodeAction struct {
+	Title string         `json:"title"`
+	Kind  CodeActionKind `json:"kind"`
+	Edit  *WorkspaceEdit `json:"edit,omitempty"`
+}
+
+// TextDocumentIdentifier identifies a document.
+type TextDocumentIdentifier struct {
+	URI DocumentURI `json:"uri"`
+}
+
+// CodeActionContext restricts the kinds of the code actions requested to Only, if not empty.
+type CodeActionContext struct {
+	Only []CodeActionKind `json:"only,omitempty"`
+}
+
+// CodeActionParams are the parameters of a textDocument/codeAction request.
+type CodeActionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Context      CodeActionContext      `json:"context"`
+}
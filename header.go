@@ -0,0 +1,40 @@
+package gen
+
+import (
+	"bytes"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// packageClauseOffset returns the offset of the package keyword in the source src of a file,
+// or -1 if it cannot be parsed.
+func packageClauseOffset(src []byte) int {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return -1
+	}
+
+	return fset.Position(file.Package).Offset
+}
+
+// preserveHeader returns the formatted source out of file with the header preceding the package clause,
+// e.g. build constraints and license comments, replaced with the one of the original source of file,
+// which the printer may reformat, so that the header is kept byte for byte.
+func (g Gen) preserveHeader(file *ast.File, out []byte) []byte {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return out
+	}
+
+	n, m := packageClauseOffset(src), packageClauseOffset(out)
+	if n == -1 || m == -1 || bytes.Equal(src[:n], out[:m]) {
+		return out
+	}
+
+	result := make([]byte, 0, n+len(out)-m)
+	result = append(result, src[:n]...)
+	return append(result, out[m:]...)
+}
@@ -0,0 +1,38 @@
+package gen
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreserveHeader(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	header := "// Copyright 2015 The Authors. \n//\n//\tLicensed under the MIT License.\n\n\n// +build !windows\n\n"
+
+	g := New()
+	g.Sorter = ByTypeName
+	g.Overlay = map[string][]byte{"testdata/sort/cases.go": append([]byte(header), src...)}
+
+	err = g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	sources, err := g.SortBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/sort/cases.go"])
+	t.Log(out)
+
+	assert.True(t, strings.HasPrefix(out, header+"package "), "header kept byte for byte")
+	assert.True(t, strings.Index(out, "case A:") < strings.Index(out, "case B:"))
+}
+
+func TestPackageClauseOffset(t *testing.T) {
+	assert.Equal(t, 12, packageClauseOffset([]byte("// comment\n\npackage main\n")))
+	assert.Equal(t, -1, packageClauseOffset([]byte("// comment\n")))
+}
@@ -0,0 +1,153 @@
+package gen
+
+import (
+	"regexp"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+)
+
+// hygiene renames the identifiers declared in the body of the template t which would collide
+// in clause, the one generated from t for the input type in with the bindings m:
+//
+//   - labels, which are scoped to the function and would be defined by every generated clause,
+//     are suffixed by the input type, e.g. loop to loop_int,
+//   - local declarations which shadow the names the bound types refer to, e.g. a variable io
+//     used with T bound to io.Reader, are suffixed by underscores, e.g. io to io_.
+//
+// The identifiers are located by their positions, which clause shares with the template.
+func (gen Gen) hygiene(stmt *TypeSwitchStmt, t *Template, clause *ast.CaseClause, m Bindings, in types.Type) {
+	qf := stmt.qualifier()
+
+	referenced := map[string]bool{}
+	for _, typ := range m {
+		typeNames(typ, qf, referenced)
+	}
+
+	// the objects declared in the template body to be renamed
+	renamed := map[types.Object]bool{}
+	for _, st := range t.Clause.Body {
+		ast.Inspect(st, func(node ast.Node) bool {
+			ident, ok := node.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			obj := stmt.info.Defs[ident]
+			if _, isLabel := obj.(*types.Label); isLabel || obj != nil && referenced[obj.Name()] {
+				renamed[obj] = true
+			}
+			return true
+		})
+	}
+
+	if len(renamed) == 0 {
+		return
+	}
+
+	positions := map[token.Pos]types.Object{}
+	for _, st := range t.Clause.Body {
+		ast.Inspect(st, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				if obj := stmt.info.ObjectOf(ident); renamed[obj] {
+					positions[ident.Pos()] = obj
+				}
+			}
+			return true
+		})
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(clause, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			used[ident.Name] = true
+		}
+		return true
+	})
+
+	// keyed by the suffixes too, as labels and other identifiers are in different namespaces
+	newNames := map[[2]string]string{}
+	newName := func(name, suffix string) string {
+		key := [2]string{name, suffix}
+		if n, ok := newNames[key]; ok {
+			return n
+		}
+
+		n := name + suffix
+		for used[n] || referenced[n] {
+			n = n + "_"
+		}
+		used[n] = true
+		newNames[key] = n
+		return n
+	}
+
+	ast.Inspect(clause, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		obj, ok := positions[ident.Pos()]
+		if !ok {
+			return true
+		}
+
+		if _, isLabel := obj.(*types.Label); isLabel {
+			ident.Name = newName(ident.Name, "_"+typeSuffix(typeString(in, qf)))
+		} else {
+			ident.Name = newName(ident.Name, "_")
+		}
+		return true
+	})
+}
+
+// typeNames adds the names which the source representation of t refers to, i.e. the qualifiers by qf
+// of the named types and the names of the predeclared types, to names.
+func typeNames(t types.Type, qf types.Qualifier, names map[string]bool) {
+	switch t := t.(type) {
+	case *types.Basic:
+		names[t.Name()] = true
+	case *types.Named:
+		if pkg := t.Obj().Pkg(); pkg != nil && qf(pkg) != "" {
+			names[qf(pkg)] = true
+		} else {
+			names[t.Obj().Name()] = true
+		}
+	case *types.Array:
+		typeNames(t.Elem(), qf, names)
+	case *types.Chan:
+		typeNames(t.Elem(), qf, names)
+	case *types.Map:
+		typeNames(t.Key(), qf, names)
+		typeNames(t.Elem(), qf, names)
+	case *types.Pointer:
+		typeNames(t.Elem(), qf, names)
+	case *types.Slice:
+		typeNames(t.Elem(), qf, names)
+	case *types.Signature:
+		typeNames(t.Params(), qf, names)
+		typeNames(t.Results(), qf, names)
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			typeNames(t.At(i).Type(), qf, names)
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			typeNames(t.Field(i).Type(), qf, names)
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			typeNames(t.Method(i).Type(), qf, names)
+		}
+	}
+}
+
+var nonIdentChars = regexp.MustCompile(`[^0-9A-Za-z]+`)
+
+// typeSuffix makes a type expression into a part of identifiers, e.g. map_string_int for map[string]int.
+func typeSuffix(expr string) string {
+	return strings.Trim(nonIdentChars.ReplaceAllString(expr, "_"), "_")
+}
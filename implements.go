@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// interfaceTemplates returns the templates of stmt whose patterns are interfaces with type variables
+// in their method sets, e.g. case interface{ Scan(T) error }:.
+func (g Gen) interfaceTemplates(stmt *TypeSwitchStmt) []Template {
+	templates := []Template{}
+	for _, t := range stmt.templates() {
+		if len(t.Clause.List) > 1 && !g.enabled(FeatureUnions) {
+			continue
+		}
+
+		if !isInterfacePattern(t.Pattern) || len(g.exprTypeVariables(stmt, t.Clause.List[t.index])) == 0 {
+			continue
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates
+}
+
+// isInterfacePattern reports whether p is an interface with methods, which matches the types by their method sets.
+func isInterfacePattern(p *TypePattern) bool {
+	iface, ok := p.Type.(*types.Interface)
+	return ok && iface.NumMethods() > 0
+}
+
+// implementingTypes returns the named types of the program, and the pointers to them, whose method sets
+// unify with the interface templates of stmt in pkg, for Gen.Implements. The types must be assignable to the subject
+// of stmt, and be named in pkg, i.e. declared in it at the package level or exported by another.
+// The interfaces are not taken, as their cases would catch the types of the other cases.
+func (g Gen) implementingTypes(pkg *loader.PackageInfo, stmt *TypeSwitchStmt) []types.Type {
+	if !g.Implements {
+		return nil
+	}
+
+	templates := g.interfaceTemplates(stmt)
+	if len(templates) == 0 {
+		return nil
+	}
+
+	x, _ := typeSwitchSubject(stmt.node)
+	subject := stmt.info.TypeOf(x)
+
+	found := []types.Type{}
+	for _, tn := range g.typeNames(&stmt.info) {
+		if tn.Pkg() == nil || tn.Parent() != tn.Pkg().Scope() {
+			continue
+		}
+		if tn.Pkg() != pkg.Pkg && !tn.Exported() {
+			continue
+		}
+
+		named, ok := tn.Type().(*types.Named)
+		if !ok || types.IsInterface(named) || g.isTypeVariable(named) {
+			continue
+		}
+
+		for _, t := range []types.Type{named, types.NewPointer(named)} {
+			if subject != nil && !types.AssignableTo(t, subject) {
+				continue
+			}
+
+			for _, tmpl := range templates {
+				tmpl.Pattern.isVar = g.isTypeVariable
+				tmpl.Pattern.matchLen = g.enabled(FeatureArrays)
+				tmpl.Pattern.matchMethods = true
+				tmpl.Pattern.mode = g.MatchMode
+				if m, _ := tmpl.Pattern.match(t); m != nil {
+					found = append(found, t)
+					break
+				}
+			}
+		}
+	}
+
+	return found
+}
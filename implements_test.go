@@ -0,0 +1,43 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_Implements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/implements.go", "decode", [][]types.Type{})
+
+	expand := func(implements bool) string {
+		g := New()
+		g.CacheDir = dir
+		g.Implements = implements
+		err := g.Loader.CreateFromFilenames("", "testdata/implements.go")
+		require.NoError(t, err)
+
+		sources, err := g.ExpandBytes()
+		require.NoError(t, err)
+
+		return string(sources["testdata/implements.go"])
+	}
+
+	assert.NotContains(t, expand(false), "case *Celsius:")
+
+	out := expand(true)
+	t.Log(out)
+
+	assert.Contains(t, out, "\tcase *Celsius:\n\t\tvar x string\n\t\treturn v.Scan(x)\n")
+	assert.Contains(t, out, "\tcase *Name:\n\t\tvar x []byte\n\t\treturn v.Scan(x)\n")
+	assert.NotContains(t, out, "case *Count:")
+	assert.NotContains(t, out, "case Celsius:")
+}
@@ -0,0 +1,245 @@
+package gen
+
+import (
+	"path"
+	"sort"
+	"strconv"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types"
+)
+
+// fileImports tracks the imports of a file for the types written in it by expansion.
+// Types of the packages not imported yet are qualified by new names, which are added to the file by fix.
+type fileImports struct {
+	// pkg is the package of the file.
+	pkg *types.Package
+
+	// names maps the paths of the packages imported by the file to the names the file refers them by.
+	names map[string]string
+
+	// taken is the set of the names of the file and package scope, not to be used for new imports.
+	taken map[string]bool
+
+	// added maps the paths of the packages to be imported to their names.
+	added map[string]string
+}
+
+// newFileImports returns the imports of file in the package pkg, type-checked into info.
+func newFileImports(file *ast.File, pkg *types.Package, info *types.Info) *fileImports {
+	fi := &fileImports{
+		pkg:   pkg,
+		names: map[string]string{},
+		taken: map[string]bool{},
+		added: map[string]string{},
+	}
+
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := importName(spec, info)
+		if name == "_" && fi.names[p] != "" {
+			// the package is also imported by a name
+			continue
+		}
+		fi.names[p] = name
+		fi.taken[name] = true
+	}
+
+	for name := range file.Scope.Objects {
+		fi.taken[name] = true
+	}
+	if pkg != nil {
+		for _, name := range pkg.Scope().Names() {
+			fi.taken[name] = true
+		}
+	}
+
+	return fi
+}
+
+// importName returns the name by which the file refers to the package imported by spec,
+// "." for dot imports and "_" for blank ones.
+func importName(spec *ast.ImportSpec, info *types.Info) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+
+	if pkgName, ok := info.Implicits[spec].(*types.PkgName); ok {
+		return pkgName.Imported().Name()
+	}
+
+	p, _ := strconv.Unquote(spec.Path.Value)
+	return path.Base(p)
+}
+
+// qualifier returns the qualifier of pkg in the file, which is empty for the package of the file
+// or dot-imported ones. Packages not imported by the file are recorded to be added,
+// named by their package names, suffixed by numbers if the names are taken.
+func (fi *fileImports) qualifier(pkg *types.Package) string {
+	if fi.pkg != nil && pkg.Path() == fi.pkg.Path() {
+		return ""
+	}
+
+	if name, ok := fi.names[pkg.Path()]; ok && name != "_" {
+		if name == "." {
+			return ""
+		}
+		return name
+	}
+
+	if name, ok := fi.added[pkg.Path()]; ok {
+		return name
+	}
+
+	name := pkg.Name()
+	for i := 2; fi.taken[name]; i++ {
+		name = pkg.Name() + strconv.Itoa(i)
+	}
+
+	fi.taken[name] = true
+	fi.added[pkg.Path()] = name
+
+	return name
+}
+
+// fix adds the imports recorded by qualifier to file, which is the rewritten one,
+// and removes the imports which are no longer used, e.g. the ones only the removed cases referred to.
+func (fi *fileImports) fix(fset *token.FileSet, file *ast.File) {
+	paths := []string{}
+	for p := range fi.added {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		name := fi.added[p]
+		if name == path.Base(p) {
+			name = ""
+		}
+		astutil.AddNamedImport(fset, file, name, p)
+	}
+
+	named := map[string]bool{}
+	for _, spec := range file.Imports {
+		if spec.Name == nil || spec.Name.Name != "_" {
+			named[spec.Path.Value] = true
+		}
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			// identifiers resolved by the parser are not of packages
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+
+	specs := make([]*ast.ImportSpec, len(file.Imports))
+	copy(specs, file.Imports)
+
+	for _, spec := range specs {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		if importNameOf(spec) == "_" && named[spec.Path.Value] {
+			// a blank import is redundant to the named one added
+			astutil.DeleteNamedImport(fset, file, "_", p)
+			continue
+		}
+
+		name, ok := fi.names[p]
+		if !ok {
+			name = fi.added[p]
+		}
+		if name == "" || name == "_" || name == "." || used[name] {
+			continue
+		}
+
+		astutil.DeleteNamedImport(fset, file, importNameOf(spec), p)
+	}
+}
+
+func importNameOf(spec *ast.ImportSpec) string {
+	if spec.Name == nil {
+		return ""
+	}
+	return spec.Name.Name
+}
+
+// unnameable returns the part of t which cannot be written in the file of stmt, i.e. an unexported named type,
+// struct field or interface method of another package, or nil if t can be written.
+func (stmt TypeSwitchStmt) unnameable(t types.Type) types.Object {
+	foreign := func(obj types.Object) bool {
+		if obj.Exported() || obj.Pkg() == nil {
+			return false
+		}
+		if stmt.imports != nil && stmt.imports.pkg != nil {
+			return obj.Pkg().Path() != stmt.imports.pkg.Path()
+		}
+		return obj.Pkg().Name() != stmt.file.Name.Name
+	}
+
+	switch t := t.(type) {
+	case *types.Named:
+		if foreign(t.Obj()) {
+			return t.Obj()
+		}
+	case *types.Array:
+		return stmt.unnameable(t.Elem())
+	case *types.Chan:
+		return stmt.unnameable(t.Elem())
+	case *types.Map:
+		if obj := stmt.unnameable(t.Key()); obj != nil {
+			return obj
+		}
+		return stmt.unnameable(t.Elem())
+	case *types.Pointer:
+		return stmt.unnameable(t.Elem())
+	case *types.Slice:
+		return stmt.unnameable(t.Elem())
+	case *types.Signature:
+		if obj := stmt.unnameable(t.Params()); obj != nil {
+			return obj
+		}
+		return stmt.unnameable(t.Results())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if obj := stmt.unnameable(t.At(i).Type()); obj != nil {
+				return obj
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			if foreign(f) {
+				return f
+			}
+			if obj := stmt.unnameable(f.Type()); obj != nil {
+				return obj
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			m := t.Method(i)
+			if foreign(m) {
+				return m
+			}
+			if obj := stmt.unnameable(m.Type()); obj != nil {
+				return obj
+			}
+		}
+	}
+
+	return nil
+}
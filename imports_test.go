@@ -0,0 +1,76 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+
+	"go/format"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileImports(t *testing.T) {
+	src := `package p
+
+import (
+	"fmt"
+	"io"
+)
+
+var bytes = 1
+
+var _ io.Reader
+var _ bytes2.Buffer
+var _ yaml.MapSlice
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	fi := newFileImports(file, types.NewPackage("example.com/p", "p"), &types.Info{})
+
+	assert.Equal(t, "", fi.qualifier(types.NewPackage("example.com/p", "p")))
+	assert.Equal(t, "io", fi.qualifier(types.NewPackage("io", "io")))
+	assert.Equal(t, "bytes2", fi.qualifier(types.NewPackage("bytes", "bytes")), "bytes is taken by the variable")
+	assert.Equal(t, "yaml", fi.qualifier(types.NewPackage("gopkg.in/yaml.v2", "yaml")))
+
+	fi.fix(fset, file)
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, file))
+
+	assert.Contains(t, buf.String(), `bytes2 "bytes"`)
+	assert.Contains(t, buf.String(), `yaml "gopkg.in/yaml.v2"`)
+	assert.Contains(t, buf.String(), `"io"`)
+	assert.NotContains(t, buf.String(), `"fmt"`, "unused imports are removed")
+}
+
+func TestTypeSwitchStmt_unnameable(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p", 0)
+	require.NoError(t, err)
+
+	p := types.NewPackage("example.com/p", "p")
+	q := types.NewPackage("example.com/q", "q")
+
+	stmt := TypeSwitchStmt{file: file, imports: newFileImports(file, p, &types.Info{})}
+
+	named := func(pkg *types.Package, name string) types.Type {
+		return types.NewNamed(types.NewTypeName(token.NoPos, pkg, name, nil), types.Typ[types.Int], nil)
+	}
+
+	assert.Nil(t, stmt.unnameable(named(q, "Thing")))
+	assert.Nil(t, stmt.unnameable(named(p, "thing")), "unexported types of the package itself can be written")
+
+	if obj := stmt.unnameable(types.NewSlice(types.NewPointer(named(q, "thing")))); assert.NotNil(t, obj) {
+		assert.Equal(t, "thing", obj.Name())
+	}
+
+	s := types.NewStruct([]*types.Var{types.NewField(token.NoPos, q, "n", types.Typ[types.Int], false)}, nil)
+	if obj := stmt.unnameable(s); assert.NotNil(t, obj) {
+		assert.Equal(t, "n", obj.Name())
+	}
+}
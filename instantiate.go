@@ -0,0 +1,368 @@
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// templateDirective marks the doc comment of a function as a template, which other packages instantiate.
+const templateDirective = "+tsgen template"
+
+// instantiateDirective prefixes the comments requesting instances of template functions, like
+//
+//	// +tsgen instantiate lib.Keys K=string V=int as stringKeys
+const instantiateDirective = "+tsgen instantiate"
+
+// instantiation is a request of an instance of a template function by a directive.
+type instantiation struct {
+	// pkgName is the name of the package of the template, empty for the package of the directive.
+	pkgName  string
+	funcName string
+
+	// bindings maps the type variables of the template to the type expressions substituted for them.
+	bindings map[string]string
+
+	// name is the name of the instance, empty for the default one.
+	name string
+}
+
+// parseInstantiateDirective parses the comment text as a directive of instantiateDirective,
+// returning nil if it is not one.
+func parseInstantiateDirective(text string) (*instantiation, error) {
+	text = strings.TrimSpace(text[2:])
+	if !strings.HasPrefix(text, instantiateDirective+" ") {
+		return nil, nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(text, instantiateDirective))
+	inst := &instantiation{bindings: map[string]string{}}
+
+	if i := strings.LastIndex(fields[0], "."); i != -1 {
+		inst.pkgName, inst.funcName = fields[0][:i], fields[0][i+1:]
+	} else {
+		inst.funcName = fields[0]
+	}
+
+	fields = fields[1:]
+	for len(fields) > 0 {
+		f := fields[0]
+		fields = fields[1:]
+
+		if f == "as" {
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("invalid directive: %s", text)
+			}
+			inst.name = fields[0]
+			break
+		}
+
+		i := strings.Index(f, "=")
+		if i <= 0 || i == len(f)-1 {
+			return nil, fmt.Errorf("invalid binding %q: must be <type variable>=<type>", f)
+		}
+		inst.bindings[f[:i]] = f[i+1:]
+	}
+
+	return inst, nil
+}
+
+// isTemplateDoc reports whether the doc comment cg has templateDirective.
+func isTemplateDoc(cg *ast.CommentGroup) bool {
+	if cg == nil {
+		return false
+	}
+
+	for _, c := range cg.List {
+		if strings.TrimSpace(c.Text[2:]) == templateDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Instantiate generates the instances of the template functions requested by the directives
+// in the files of the program, like:
+//
+//	// +tsgen instantiate lib.Keys K=string V=int
+//
+// A template is a function whose doc comment has "+tsgen template", in the package of the directive
+// or one imported by the file as lib, with type variables in its signature and body.
+// The instance is a copy of the template with the type variables replaced with the types bound,
+// which are written as the file refers to them, and the references to the package of the template qualified.
+// It is named by the template and the types bound (e.g. KeysStringInt) unless named with "as <name>"
+// at the end of the directive, and placed after the directive, which becomes its doc comment.
+// The instances generated by the previous runs are replaced.
+func (g Gen) Instantiate() error {
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return err
+	}
+
+	return g.doFiles(g.instantiateFile)
+}
+
+// instantiateFile generates the instances requested by the directives in file.
+func (g Gen) instantiateFile(pkg *loader.PackageInfo, file *ast.File) error {
+	tf := g.tokenFile(file)
+	imports := newFileImports(file, pkg.Pkg, &pkg.Info)
+	edits := []sourceEdit{}
+
+	for _, cg := range file.Comments {
+		var inst *instantiation
+		for _, c := range cg.List {
+			var err error
+			inst, err = parseInstantiateDirective(c.Text)
+			if err != nil {
+				return fmt.Errorf("%s: %s", g.Loader.Fset.Position(c.Pos()), err)
+			}
+			if inst != nil {
+				break
+			}
+		}
+		if inst == nil {
+			continue
+		}
+
+		text, err := g.instanceSource(pkg, file, imports, inst)
+		if err != nil {
+			return fmt.Errorf("%s: %s", g.Loader.Fset.Position(cg.Pos()), err)
+		}
+
+		var existing *ast.FuncDecl
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Doc == cg {
+				existing = funcDecl
+			}
+		}
+
+		if existing != nil {
+			edits = append(edits, sourceEdit{
+				start: tf.Offset(existing.Pos()),
+				end:   tf.Offset(existing.End()),
+				text:  []byte(text),
+			})
+		} else {
+			edits = append(edits, sourceEdit{
+				start: tf.Offset(cg.End()),
+				end:   tf.Offset(cg.End()),
+				text:  []byte("\n" + text),
+			})
+		}
+	}
+
+	if len(edits) == 0 {
+		return nil
+	}
+
+	err := g.editFileSource(file, edits)
+	if err != nil {
+		return err
+	}
+
+	imports.fix(g.Loader.Fset, file)
+
+	return nil
+}
+
+// templatePackage returns the package named name imported by file of pkg, or pkg itself if name is empty.
+// The package is found by the name file imports it as or its package name, so blank imports can be referred to.
+func (g Gen) templatePackage(pkg *loader.PackageInfo, file *ast.File, name string) (*loader.PackageInfo, error) {
+	if name == "" {
+		return pkg, nil
+	}
+
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		for tpkg, info := range g.program.AllPackages {
+			if tpkg.Path() == p && (importName(spec, &pkg.Info) == name || tpkg.Name() == name) {
+				return info, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("package not imported: %s", name)
+}
+
+// instanceSource returns the source of the instance of the template requested by inst in file of pkg,
+// recording the packages the instance refers to in imports.
+func (g Gen) instanceSource(pkg *loader.PackageInfo, file *ast.File, imports *fileImports, inst *instantiation) (string, error) {
+	tpkg, err := g.templatePackage(pkg, file, inst.pkgName)
+	if err != nil {
+		return "", err
+	}
+
+	fn, ok := tpkg.Pkg.Scope().Lookup(inst.funcName).(*types.Func)
+	if !ok {
+		return "", fmt.Errorf("function not found: %s.%s", tpkg.Pkg.Name(), inst.funcName)
+	}
+
+	var decl *ast.FuncDecl
+	var declFile *ast.File
+	for _, f := range tpkg.Files {
+		for _, d := range f.Decls {
+			if funcDecl, ok := d.(*ast.FuncDecl); ok && tpkg.Defs[funcDecl.Name] == fn {
+				decl, declFile = funcDecl, f
+			}
+		}
+	}
+	if decl == nil || decl.Body == nil {
+		return "", fmt.Errorf("source of %s not found", fn.FullName())
+	}
+	if !isTemplateDoc(decl.Doc) {
+		return "", fmt.Errorf("%s is not a template: its doc comment must have %q", fn.FullName(), "// "+templateDirective)
+	}
+
+	src, err := g.fileSource(declFile)
+	if err != nil {
+		return "", err
+	}
+
+	tf := g.tokenFile(declFile)
+	base := tf.Offset(decl.Pos())
+
+	name := inst.name
+	if name == "" {
+		vars := []string{}
+		for v := range inst.bindings {
+			vars = append(vars, v)
+		}
+		sort.Strings(vars)
+
+		name = inst.funcName
+		for _, v := range vars {
+			name += camelSuffix(inst.bindings[v])
+		}
+	}
+
+	// the type variables called as conversions, whose types are parenthesized
+	conversions := map[*ast.Ident]bool{}
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok {
+				conversions[ident] = true
+			}
+		}
+		return true
+	})
+
+	edits := []sourceEdit{}
+	replace := func(start, end token.Pos, text string) {
+		edits = append(edits, sourceEdit{start: tf.Offset(start) - base, end: tf.Offset(end) - base, text: []byte(text)})
+	}
+
+	used := map[string]bool{}
+	var failure error
+	ast.Inspect(decl, func(node ast.Node) bool {
+		if failure != nil {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			// a qualified identifier of another package, qualified as the file refers to the package
+			if x, ok := node.X.(*ast.Ident); ok {
+				if pkgName, ok := tpkg.Uses[x].(*types.PkgName); ok {
+					q := imports.qualifier(pkgName.Imported())
+					if q != "" {
+						q += "."
+					}
+					replace(node.Pos(), node.Sel.Pos(), q)
+					return false
+				}
+			}
+
+		case *ast.Ident:
+			if node == decl.Name {
+				replace(node.Pos(), node.End(), name)
+				return false
+			}
+
+			obj := tpkg.Uses[node]
+			if obj == nil || obj.Pkg() != tpkg.Pkg || obj.Parent() != tpkg.Pkg.Scope() {
+				return false
+			}
+
+			if tn, ok := obj.(*types.TypeName); ok {
+				if named, ok := tn.Type().(*types.Named); ok && g.isPackageTypeVariable(tpkg, named) {
+					t, ok := inst.bindings[tn.Name()]
+					if !ok {
+						failure = fmt.Errorf("type variable %s of %s not bound", tn.Name(), fn.FullName())
+						return false
+					}
+					if conversions[node] {
+						t = "(" + t + ")"
+					}
+
+					used[tn.Name()] = true
+					replace(node.Pos(), node.End(), t)
+					return false
+				}
+			}
+
+			if obj == fn {
+				// recursive calls call the instance
+				replace(node.Pos(), node.End(), name)
+				return false
+			}
+
+			if q := imports.qualifier(tpkg.Pkg); q != "" {
+				if !obj.Exported() {
+					failure = fmt.Errorf("%s refers to unexported %s", fn.FullName(), obj.Name())
+					return false
+				}
+				replace(node.Pos(), node.End(), q+"."+obj.Name())
+			}
+		}
+
+		return true
+	})
+	if failure != nil {
+		return "", failure
+	}
+
+	for v := range inst.bindings {
+		if !used[v] {
+			return "", fmt.Errorf("%s is not a type variable of %s", v, fn.FullName())
+		}
+	}
+
+	return string(applyEdits(src[base:tf.Offset(decl.End())], edits)), nil
+}
+
+// isPackageTypeVariable reports whether t is a type variable of the package pkg,
+// by its name or the "+tsgen typevar" comment of its declaration.
+func (g Gen) isPackageTypeVariable(pkg *loader.PackageInfo, t *types.Named) bool {
+	if g.isTypeVariable(t) {
+		return true
+	}
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if ok && pkg.Defs[typeSpec.Name] == t.Obj() {
+					return isTypeVariableComment(genDecl.Doc) || isTypeVariableComment(typeSpec.Comment)
+				}
+			}
+		}
+	}
+
+	return false
+}
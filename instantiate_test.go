@@ -0,0 +1,62 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstantiate(t *testing.T) {
+	instantiate := func(overlay map[string][]byte) string {
+		var out bytes.Buffer
+
+		g := New()
+		g.Overlay = overlay
+		g.FileWriter = func(path string) io.WriteCloser {
+			if path == "testdata/template/main.go" {
+				return nopCloser{&out}
+			}
+
+			return nil
+		}
+
+		err := g.Loader.CreateFromFilenames("", "testdata/template/main.go")
+		require.NoError(t, err)
+
+		err = g.applyOverlay()
+		require.NoError(t, err)
+
+		err = g.Instantiate()
+		require.NoError(t, err)
+
+		return out.String()
+	}
+
+	result := instantiate(nil)
+	t.Log(result)
+
+	assert.Contains(t, result, "// +tsgen instantiate lib.Keys K=string V=Score\nfunc KeysStringScore(m map[string]Score) []string {\n\tkeys := make([]string, 0, len(m))\n")
+	assert.Contains(t, result, "// +tsgen instantiate lib.Join K=string V=Score as joinScores\nfunc joinScores(m map[string]Score, format func(Score) string) string {\n")
+	assert.Contains(t, result, "parts = append(parts, format((Score)(v)))")
+	assert.Contains(t, result, "return strings.Join(parts, lib.Sep)")
+	assert.Contains(t, result, `"github.com/motemen/go-typeswitch-gen/testdata/template/lib"`)
+
+	again := instantiate(map[string][]byte{"testdata/template/main.go": []byte(result)})
+	assert.Equal(t, result, again)
+}
+
+func TestParseInstantiateDirective(t *testing.T) {
+	inst, err := parseInstantiateDirective("// +tsgen instantiate lib.Keys K=string V=map[string]int as keys")
+	require.NoError(t, err)
+	assert.Equal(t, &instantiation{pkgName: "lib", funcName: "Keys", bindings: map[string]string{"K": "string", "V": "map[string]int"}, name: "keys"}, inst)
+
+	inst, err = parseInstantiateDirective("// +tsgen typevar")
+	require.NoError(t, err)
+	assert.Nil(t, inst)
+
+	_, err = parseInstantiateDirective("// +tsgen instantiate Keys K")
+	assert.Error(t, err)
+}
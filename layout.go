@@ -0,0 +1,314 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+)
+
+// Markers of the region of generated case clauses in an expanded type switch statement.
+const (
+	generatedBeginMarker = "// tsgen: begin generated cases"
+	generatedEndMarker   = "// tsgen: end generated cases"
+)
+
+// TemplateMode controls what happens to the template clauses of expanded type switches.
+type TemplateMode int
+
+const (
+	// TemplateKeep keeps the template clauses, and the generated clauses in the generated region
+	// to be regenerated by later runs. This is the default.
+	TemplateKeep TemplateMode = iota
+
+	// TemplateComment turns the template clauses into comments for reference.
+	TemplateComment
+
+	// TemplateDelete deletes the template clauses.
+	TemplateDelete
+
+	// TemplateFallback converts the template clauses into the default clause, which runs their bodies
+	// for the types matching their patterns by reflection, so that the types not expanded still work at runtime.
+	TemplateFallback
+)
+
+var templateModeNames = []string{
+	TemplateKeep:     "keep",
+	TemplateComment:  "comment",
+	TemplateDelete:   "delete",
+	TemplateFallback: "fallback",
+}
+
+// ParseTemplateMode parses the name of a template mode, one of "keep", "comment", "delete" and "fallback".
+func ParseTemplateMode(s string) (TemplateMode, error) {
+	for mode, name := range templateModeNames {
+		if s == name {
+			return TemplateMode(mode), nil
+		}
+	}
+
+	return TemplateKeep, fmt.Errorf("unknown template mode: %q (known modes: keep, comment, delete, fallback)", s)
+}
+
+func (mode TemplateMode) String() string {
+	if mode < 0 || int(mode) >= len(templateModeNames) {
+		return fmt.Sprintf("TemplateMode(%d)", int(mode))
+	}
+
+	return templateModeNames[mode]
+}
+
+var markerPattern = regexp.MustCompile(`(?m)^[ \t]*(` + regexp.QuoteMeta(generatedBeginMarker) + `|` + regexp.QuoteMeta(generatedEndMarker) + `)[ \t]*\n?`)
+
+// stripMarkers removes the generated region markers from text and trims surrounding spaces.
+func stripMarkers(text string) string {
+	return strings.TrimSpace(markerPattern.ReplaceAllString(text, ""))
+}
+
+// generatedRange returns the positions of the markers of generated case clauses in stmt,
+// or token.NoPos if stmt has no generated region.
+func (gen Gen) generatedRange(stmt *TypeSwitchStmt) (begin, end token.Pos) {
+	for _, cg := range stmt.file.Comments {
+		if cg.Pos() < stmt.node.Body.Lbrace || cg.End() > stmt.node.Body.Rbrace {
+			continue
+		}
+
+		for _, c := range cg.List {
+			switch strings.TrimSpace(c.Text) {
+			case generatedBeginMarker:
+				if begin == token.NoPos {
+					begin = c.Pos()
+				}
+			case generatedEndMarker:
+				if begin != token.NoPos && end == token.NoPos {
+					end = c.Pos()
+				}
+			}
+		}
+	}
+
+	if begin == token.NoPos || end == token.NoPos {
+		return token.NoPos, token.NoPos
+	}
+
+	return
+}
+
+// isGeneratedClause reports whether the clause is in the generated region of stmt,
+// that is, generated by the previous runs.
+func (gen Gen) isGeneratedClause(stmt *TypeSwitchStmt, clause *ast.CaseClause) bool {
+	begin, end := gen.generatedRange(stmt)
+	return begin != token.NoPos && begin < clause.Pos() && clause.Pos() < end
+}
+
+// expandEdit returns an edit to the source which rewrites the body of stmt
+// with the case clauses expanded for ins. The clauses are laid out as:
+//
+//   - hand-written clauses in their original order,
+//   - generated clauses between the generatedBeginMarker and generatedEndMarker comments,
+//   - template clauses,
+//   - the default clause.
+//
+// The clauses generated by the previous runs are replaced with the new ones,
+// so that repeated runs and human edits outside the generated region compose.
+// Comments above the hand-written and template clauses are kept.
+//
+// Unless gen.TemplateMode is TemplateKeep, the template clauses are commented out, deleted or converted
+// into the default clause by fallbackClause, and the generated clauses are laid out without the markers,
+// as there will be no templates to regenerate them.
+// If gen.DefaultPanic is set and stmt has no default clause, one panicking with the unexpected type is added.
+// If gen.ErrorsAs is set and stmt switches on an error, the clauses are generated as errors.As checks by errorsAsEdit.
+// If gen.LineDirectives is set, the bodies of the generated clauses are attributed to their templates by //line directives.
+// If gen.Provenance is set, the generated clauses are preceded by comments noting their templates and call sites.
+// If gen.Annotation is set, its comments are put above the switch statement by withAnnotation.
+// It returns false if there is nothing to rewrite.
+func (gen Gen) expandEdit(stmt *TypeSwitchStmt, ins []types.Type) (sourceEdit, bool, error) {
+	clauses := gen.expandClauses(stmt, ins)
+	if gen.ErrorsAs && isErrorSwitch(stmt) {
+		return gen.errorsAsEdit(stmt, clauses)
+	}
+
+	generated := []string{}
+	for _, clause := range clauses {
+		text := gen.showClause(stmt, clause)
+		if gen.LineDirectives {
+			text = gen.withLineDirectives(clause, text)
+		}
+		text = gen.withProvenance(stmt, clause, text)
+		generated = append(generated, text)
+	}
+
+	return gen.layoutEdit(stmt, generated)
+}
+
+// layoutEdit returns an edit to the source which rewrites the body of stmt as expandEdit,
+// with the generated clauses given as their source texts.
+func (gen Gen) layoutEdit(stmt *TypeSwitchStmt, generated []string) (sourceEdit, bool, error) {
+	begin, _ := gen.generatedRange(stmt)
+	if len(generated) == 0 && begin == token.NoPos {
+		return sourceEdit{}, false, nil
+	}
+
+	src, err := gen.fileSource(stmt.file)
+	if err != nil {
+		return sourceEdit{}, false, err
+	}
+
+	tf := gen.tokenFile(stmt.file)
+	offset := func(pos token.Pos) int { return tf.Offset(pos) }
+
+	var handWritten, templates, defaults []string
+
+	// indents of the template clauses, to be stripped when commenting them out
+	var templateIndents []string
+
+	start := offset(stmt.node.Body.Lbrace) + 1
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		end := offset(gen.clauseEnd(stmt, clause))
+		text := stripLineDirectives(stripMarkers(string(src[start:end])))
+		start = end
+
+		switch {
+		case gen.isGeneratedClause(stmt, clause):
+			// to be replaced
+		case clause.List == nil:
+			defaults = append(defaults, text)
+		case gen.isTemplateClause(stmt, clause):
+			templates = append(templates, text)
+
+			lineStart := bytes.LastIndexByte(src[:offset(clause.Pos())], '\n') + 1
+			templateIndents = append(templateIndents, string(src[lineStart:offset(clause.Pos())]))
+		default:
+			handWritten = append(handWritten, text)
+		}
+	}
+	trailer := stripLineDirectives(stripMarkers(string(src[start:offset(stmt.node.Body.Rbrace)])))
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+
+	for _, text := range handWritten {
+		buf.WriteString(text + "\n")
+	}
+
+	keep := gen.TemplateMode == TemplateKeep
+
+	if len(generated) > 0 {
+		if keep {
+			buf.WriteString(generatedBeginMarker + "\n")
+		}
+		for _, text := range generated {
+			buf.WriteString(text + "\n")
+		}
+		if gen.LineDirectives {
+			// the printer misplaces a //line directive followed by a comment in the same group
+			buf.WriteString("\n")
+		}
+		if keep {
+			buf.WriteString(generatedEndMarker + "\n")
+		}
+	}
+
+	for i, text := range templates {
+		switch gen.TemplateMode {
+		case TemplateKeep:
+			buf.WriteString(text + "\n")
+		case TemplateComment:
+			buf.WriteString(commentOut(text, templateIndents[i]) + "\n")
+		}
+	}
+
+	if gen.TemplateMode == TemplateFallback && len(templates) > 0 {
+		fallback, err := gen.fallbackClause(stmt, src)
+		if err != nil {
+			return sourceEdit{}, false, err
+		}
+		buf.WriteString(fallback + "\n")
+	} else {
+		for _, text := range defaults {
+			buf.WriteString(text + "\n")
+		}
+
+		if len(defaults) == 0 && gen.DefaultPanic {
+			buf.WriteString(gen.defaultPanicClause(stmt, src) + "\n")
+		}
+	}
+
+	if trailer != "" {
+		buf.WriteString(trailer + "\n")
+	}
+	buf.WriteString("}")
+
+	edit, err := gen.withAnnotation(stmt, src, sourceEdit{
+		start: offset(stmt.node.Body.Lbrace),
+		end:   offset(stmt.node.Body.Rbrace) + 1,
+		text:  buf.Bytes(),
+	})
+	if err != nil {
+		return sourceEdit{}, false, err
+	}
+
+	return edit, true, nil
+}
+
+// defaultPanicClause returns a default clause for stmt which panics with the type of the subject,
+// e.g. default: panic(fmt.Sprintf("unexpected type %T", x)), importing fmt if necessary.
+// The subject is the variable bound by the switch, or the expression asserted if it has no side effects;
+// otherwise the clause panics without the type, as evaluating the expression again may differ.
+func (gen Gen) defaultPanicClause(stmt *TypeSwitchStmt, src []byte) string {
+	var subject string
+
+	switch a := stmt.node.Assign.(type) {
+	case *ast.AssignStmt:
+		subject = a.Lhs[0].(*ast.Ident).Name
+	case *ast.ExprStmt:
+		x := a.X.(*ast.TypeAssertExpr).X
+		if isPure(x) {
+			tf := gen.tokenFile(stmt.file)
+			subject = string(src[tf.Offset(x.Pos()):tf.Offset(x.End())])
+		}
+	}
+
+	if subject == "" {
+		return `default:
+panic("unexpected type")`
+	}
+
+	qf := stmt.qualifier()
+	return fmt.Sprintf(`default:
+panic(%s.Sprintf("unexpected type %%T", %s))`, qf(types.NewPackage("fmt", "fmt")), subject)
+}
+
+// isPure reports whether evaluating expr has no side effects, i.e. it is an identifier or a selector of one.
+func isPure(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isPure(e.X)
+	case *ast.ParenExpr:
+		return isPure(e.X)
+	}
+
+	return false
+}
+
+// commentOut turns the lines of text into line comments, stripping indent from them.
+func commentOut(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(strings.TrimPrefix(line, indent), " \t")
+		if line == "" {
+			lines[i] = "//"
+		} else {
+			lines[i] = "// " + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
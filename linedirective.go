@@ -0,0 +1,75 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go/ast"
+)
+
+// lineDirectivePrefix starts the //line directives, which must be at the beginning of lines.
+const lineDirectivePrefix = "//line "
+
+// restoreLinePlaceholder is the line of the //line directives restoring the positions after generated cases,
+// which is replaced with the actual line by fixLineDirectives once the file is formatted.
+// It must be a valid line number for the file to be parsed in between.
+const restoreLinePlaceholder = 999999999
+
+var placeholderDirective = regexp.MustCompile(`^` + lineDirectivePrefix + `(.+):` + strconv.Itoa(restoreLinePlaceholder) + `$`)
+
+// withLineDirectives returns text, the source of clause generated from a template clause,
+// with a //line directive attributing its body to the body of the template,
+// followed by one restoring the positions of the file, whose line is a placeholder.
+// It returns text as it is if the positions of the template are not known, e.g. for nested expansions.
+func (gen Gen) withLineDirectives(clause *ast.CaseClause, text string) string {
+	if len(clause.Body) == 0 || !clause.Body[0].Pos().IsValid() {
+		return text
+	}
+
+	i := strings.Index(text, "\n")
+	if i == -1 {
+		return text
+	}
+
+	// relative file names are resolved from the directory of the file, which has the template
+	pos := gen.Loader.Fset.PositionFor(clause.Body[0].Pos(), false)
+	filename := filepath.Base(pos.Filename)
+
+	return fmt.Sprintf("%s\n%s%s:%d\n%s\n%s%s:%d", text[:i], lineDirectivePrefix, filename, pos.Line,
+		strings.TrimLeft(text[i+1:], " \t"), lineDirectivePrefix, filename, restoreLinePlaceholder)
+}
+
+// fixLineDirectives replaces the placeholder lines of the //line directives in the formatted source src
+// with the lines following them, so that the positions after generated cases are restored.
+func fixLineDirectives(src []byte) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	for i, line := range lines {
+		m := placeholderDirective.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		// the next line is line i+2, as lines are numbered from 1
+		lines[i] = []byte(fmt.Sprintf("%s%s:%d", lineDirectivePrefix, m[1], i+2))
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// stripLineDirectives removes the //line directives at the beginning of text, a clause of a type switch,
+// which are the ones restoring the positions after the clauses generated by the previous runs.
+func stripLineDirectives(text string) string {
+	for strings.HasPrefix(text, lineDirectivePrefix) {
+		i := strings.Index(text, "\n")
+		if i == -1 {
+			return ""
+		}
+		text = strings.TrimSpace(text[i+1:])
+	}
+
+	return text
+}
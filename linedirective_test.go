@@ -0,0 +1,87 @@
+package gen
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go/ast"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEdit_LineDirectives(t *testing.T) {
+	// expand returns the source of testdata/layout.go, read from overlay if not nil, expanded with //line directives,
+	// and the line of the body of the template
+	expand := func(overlay []byte) (string, int) {
+		g := New()
+		g.LineDirectives = true
+		if overlay != nil {
+			g.Overlay = map[string][]byte{"testdata/layout.go": overlay}
+		}
+
+		err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+		require.NoError(t, err)
+
+		err = g.initProgram(needTypes)
+		require.NoError(t, err)
+
+		pkg := g.program.Created[0]
+		file := pkg.Files[0]
+
+		var templateLine int
+		var edits []sourceEdit
+		forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+			stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+			for _, st := range sw.Body.List {
+				if clause := st.(*ast.CaseClause); g.isTemplateClause(stmt, clause) {
+					templateLine = g.Loader.Fset.Position(clause.Body[0].Pos()).Line
+				}
+			}
+
+			edit, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")))
+			require.NoError(t, err)
+			require.True(t, ok)
+			edits = append(edits, edit)
+			return nil
+		})
+
+		err = g.editFileSource(file, edits)
+		require.NoError(t, err)
+
+		out, err := g.formatFile(file)
+		require.NoError(t, err)
+
+		return string(fixLineDirectives(out)), templateLine
+	}
+
+	directive := regexp.MustCompile(`^//line layout.go:(\d+)$`)
+
+	result, templateLine := expand(nil)
+	for i := 0; i < 2; i++ {
+		t.Log(result)
+
+		assert.Equal(t, 2, strings.Count(result, "\n//line layout.go:"+strconv.Itoa(templateLine)+"\n"), "a directive per generated case")
+
+		restores := 0
+		for j, line := range strings.Split(result, "\n") {
+			m := directive.FindStringSubmatch(line)
+			if m == nil || m[1] == strconv.Itoa(templateLine) {
+				continue
+			}
+			assert.Equal(t, strconv.Itoa(j+2), m[1], "restores the line of the file")
+			restores++
+		}
+		assert.Equal(t, 2, restores)
+
+		// the directives of the previous run are replaced
+		result, templateLine = expand([]byte(result))
+	}
+}
+
+func TestStripLineDirectives(t *testing.T) {
+	assert.Equal(t, "case int:", stripLineDirectives("//line a.go:10\n\ncase int:"))
+	assert.Equal(t, "case int:\n//line a.go:3", stripLineDirectives("case int:\n//line a.go:3"))
+}
@@ -0,0 +1,161 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+)
+
+// checkExhaustive returns a Diagnostic of RuleNonExhaustive describing the types of inTypes which no case
+// of stmt handles, with the call sites contributed them, for g.Lint. A type is handled by the hand-written
+// case of itself or of an interface it implements, or by a template matching it.
+// Type switches with default clauses are exhaustive.
+func (g Gen) checkExhaustive(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, inTypes []types.Type) error {
+	for _, st := range stmt.node.Body.List {
+		if st.(*ast.CaseClause).List == nil {
+			return nil
+		}
+	}
+
+	handWritten := g.handWrittenTypes(stmt)
+	unhandled := []types.Type{}
+	for _, t := range inTypes {
+		if shadowingType(handWritten, t) != nil {
+			continue
+		}
+		if tmpl, _, _ := g.findMatchingTemplate(stmt, t); tmpl == nil {
+			unhandled = append(unhandled, t)
+		}
+	}
+	if len(unhandled) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("type switch has no default clause and no case for %d argument types", len(unhandled))
+	msg = msg + g.typeSitesMessage(stmt, funcDecl, unhandled)
+
+	return Diagnostic{Pos: g.Loader.Fset.Position(stmt.node.Pos()), Msg: msg, Rule: RuleNonExhaustive}
+}
+
+// checkUnreachable returns the Diagnostics of RuleUnreachableCase of the cases of stmt which never match,
+// as a case before them matches all of their values, for g.Lint: the hand-written cases,
+// and the cases the templates would be expanded into for inTypes.
+// The clauses generated by the previous runs are not checked, as they are generated again.
+func (g Gen) checkUnreachable(stmt *TypeSwitchStmt, inTypes []types.Type) error {
+	var diags DiagnosticList
+
+	report := func(e ast.Expr, by types.Type, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		msg = msg + fmt.Sprintf(" is unreachable, as case %s before it matches all of its values", g.relativeTypeString(by, stmt.file))
+		diags = append(diags, Diagnostic{Pos: g.Loader.Fset.Position(e.Pos()), Msg: msg, Rule: RuleUnreachableCase})
+	}
+
+	handWritten := g.handWrittenTypes(stmt)
+
+	// the types of the hand-written cases before the clause
+	before := []types.Type{}
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		if g.isGeneratedClause(stmt, clause) {
+			continue
+		}
+
+		if g.isTemplateClause(stmt, clause) {
+			for _, t := range inTypes {
+				if containsIdentical(handWritten, t) {
+					continue
+				}
+				tmpl, _, _ := g.findMatchingTemplate(stmt, t)
+				if tmpl == nil || tmpl.Clause != clause {
+					continue
+				}
+				if by := shadowingType(before, t); by != nil {
+					pattern := tmpl.Clause.List[tmpl.index]
+					report(pattern, by, "case %s expanded from template %s", g.relativeTypeString(t, stmt.file), g.showNode(pattern))
+				}
+			}
+			continue
+		}
+
+		for _, e := range clause.List {
+			t := stmt.info.TypeOf(e)
+			if isUntypedNil(t) {
+				continue
+			}
+			if by := shadowingType(before, t); by != nil {
+				report(e, by, "case %s", g.showNode(e))
+			}
+		}
+		for _, e := range clause.List {
+			before = append(before, stmt.info.TypeOf(e))
+		}
+	}
+
+	if len(diags) == 0 {
+		return nil
+	}
+
+	return diags
+}
+
+// shadowingType returns the type of ts which matches all the values of the type t in a type switch,
+// t itself or an interface t implements, or nil if none.
+func shadowingType(ts []types.Type, t types.Type) types.Type {
+	for _, u := range ts {
+		if isUntypedNil(u) {
+			continue
+		}
+		if types.Identical(u, t) {
+			return u
+		}
+		if iface, ok := u.Underlying().(*types.Interface); ok && types.Implements(t, iface) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// isUntypedNil reports whether t is the type of nil, as of case nil:.
+func isUntypedNil(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.Kind() == types.UntypedNil
+}
+
+// typeSitesMessage returns the lines describing the types ts reaching stmt in funcDecl
+// with the call sites contributed them, appended to the messages of the diagnostics.
+func (g Gen) typeSitesMessage(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, ts []types.Type) string {
+	var buf bytes.Buffer
+
+	paramPos := subjectParamPos(&stmt.info, funcDecl, stmt)
+	for _, t := range ts {
+		sites := []string{}
+		if stmt.sites != nil && paramPos != -1 {
+			for _, p := range stmt.sites.having(paramPos, t).positions {
+				sites = append(sites, g.Loader.Fset.Position(p).String())
+			}
+		}
+		fmt.Fprintf(&buf, "\n\t%s (from %s)", t, strings.Join(sites, ", "))
+	}
+
+	return buf.String()
+}
+
+// staleDiagnostic returns a Diagnostic of RuleStaleCode of the file filename whose source src
+// is to be rewritten to out, at the first line which changes, for g.ReportStale.
+func staleDiagnostic(filename string, src, out []byte) Diagnostic {
+	n := 0
+	for n < len(src) && n < len(out) && src[n] == out[n] {
+		n++
+	}
+
+	return Diagnostic{
+		Pos:  token.Position{Filename: filename, Line: bytes.Count(src[:n], []byte("\n")) + 1, Column: 1},
+		Msg:  "generated code is out of date; run tsgen to regenerate it",
+		Rule: RuleStaleCode,
+	}
+}
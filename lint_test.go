@@ -0,0 +1,80 @@
+package gen
+
+import (
+	"go/ast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckExhaustive(t *testing.T) {
+	g := New()
+	g.Lint = true
+	err := g.Loader.CreateFromFilenames("", "testdata/lint.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		ins := canonicalTypes(callArgTypes(&pkg.Info, file, fd.Name.Name))
+
+		err := g.checkExhaustive(stmt, fd, ins)
+		switch fd.Name.Name {
+		case "describe":
+			if assert.Error(t, err) {
+				d, ok := err.(Diagnostic)
+				require.True(t, ok)
+				assert.Equal(t, RuleNonExhaustive, d.Rule)
+				assert.Equal(t, 22, d.Pos.Line)
+				assert.Contains(t, d.Msg, "type switch has no default clause and no case for 1 argument types")
+				assert.Contains(t, d.Msg, "\n\tint (from )")
+			}
+
+		case "show":
+			// has a default clause
+			assert.NoError(t, err)
+		}
+		return nil
+	})
+}
+
+func TestCheckUnreachable(t *testing.T) {
+	g := New()
+	g.Lint = true
+	err := g.Loader.CreateFromFilenames("", "testdata/lint.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	diags := DiagnosticList{}
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		ins := canonicalTypes(callArgTypes(&pkg.Info, file, fd.Name.Name))
+
+		err := g.checkUnreachable(stmt, ins)
+		if err != nil {
+			diags = append(diags, err.(DiagnosticList)...)
+		}
+		return nil
+	})
+
+	require.Len(t, diags, 2)
+
+	assert.Equal(t, RuleUnreachableCase, diags[0].Rule)
+	assert.Equal(t, 25, diags[0].Pos.Line)
+	assert.Equal(t, "case *bytes.Buffer is unreachable, as case io.Reader before it matches all of its values", diags[0].Msg)
+
+	assert.Equal(t, RuleUnreachableCase, diags[1].Rule)
+	assert.Equal(t, 40, diags[1].Pos.Line)
+	assert.Equal(t, "case *bytes.Buffer expanded from template *T is unreachable, as case fmt.Stringer before it matches all of its values", diags[1].Msg)
+}
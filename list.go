@@ -0,0 +1,214 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// TypeSwitchInfo describes a type switch statement found by ListTypeSwitches.
+type TypeSwitchInfo struct {
+	Pos token.Position
+
+	// Func is the name of the enclosing function declaration, e.g. Foo or (*T).Method,
+	// empty if the switch is outside of function declarations.
+	Func string
+
+	// Subject is the expression switched on, as written, and Type its static type.
+	Subject string
+	Type    types.Type
+
+	// Cases is the number of the case clauses, including the default one.
+	Cases int
+
+	// CaseTypes are the types of the cases, except for the templates and nil.
+	CaseTypes []types.Type
+
+	// TypeVariables reports whether any case type has type variables, that is, the switch has templates.
+	TypeVariables bool
+
+	// Expandable reports whether Expand expands the switch, otherwise Reason tells why not.
+	Expandable bool
+	Reason     string
+}
+
+// ListTypeSwitches returns all the type switches in the packages created or imported by g.Loader,
+// in the order of their positions, telling whether each of them is expanded by Expand.
+// A type switch is expandable if it has templates, is at the top level of the body of a function declaration
+// or in a template clause of an expandable one, binds a variable and switches on a parameter of the function,
+// and the function and its file are selected by g.FuncFilter, g.IncludePaths and the like.
+// Only the types are loaded, so whether any argument type is found at the call sites is not checked.
+func (g Gen) ListTypeSwitches() ([]TypeSwitchInfo, error) {
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.listTypeSwitches(g.isInitial), nil
+}
+
+// listTypeSwitches returns all the type switches in the packages of the program loaded for which include returns true,
+// in the order of their positions.
+func (g Gen) listTypeSwitches(include func(*loader.PackageInfo) bool) []TypeSwitchInfo {
+	list := []TypeSwitchInfo{}
+
+	for _, pkg := range g.program.AllPackages {
+		if !include(pkg) {
+			continue
+		}
+
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				funcDecl, _ := decl.(*ast.FuncDecl)
+
+				ast.Inspect(decl, func(node ast.Node) bool {
+					if sw, ok := node.(*ast.TypeSwitchStmt); ok {
+						list = append(list, g.typeSwitchInfo(pkg, file, funcDecl, sw))
+					}
+					return true
+				})
+			}
+		}
+	}
+
+	sort.Sort(byTypeSwitchInfoPos(list))
+
+	return list
+}
+
+// typeSwitchInfo returns the description of sw in funcDecl, which may be nil, of file of pkg.
+func (g Gen) typeSwitchInfo(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) TypeSwitchInfo {
+	stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+	x, name := typeSwitchSubject(sw)
+
+	info := TypeSwitchInfo{
+		Pos:       g.Loader.Fset.Position(sw.Pos()),
+		Subject:   g.showNode(x),
+		Type:      pkg.TypeOf(x),
+		Cases:     len(sw.Body.List),
+		CaseTypes: g.consistencyCaseTypes(stmt),
+	}
+
+	if funcDecl != nil {
+		info.Func = funcDeclName(pkg, funcDecl)
+	}
+
+	for _, clause := range sw.Body.List {
+		if g.isTemplateClause(stmt, clause.(*ast.CaseClause)) {
+			info.TypeVariables = true
+		}
+	}
+
+	filename := filepath.Clean(g.tokenFile(file).Name())
+
+	switch {
+	case funcDecl != nil && isGenericFunc(funcDecl):
+		// the type parameters are no type variables
+		info.TypeVariables = false
+		info.Reason = "in a generic function"
+	case !info.TypeVariables:
+		info.Reason = "no templates"
+	case funcDecl == nil:
+		info.Reason = "not in a function declaration"
+	case !containsStmt(funcDecl.Body.List, sw) && !g.expandsNested(pkg, file, funcDecl, sw):
+		info.Reason = "not at the top level of the function body"
+	case name == "":
+		info.Reason = "binds no variable"
+	case !isParam(&pkg.Info, funcDecl, subjectSource(&pkg.Info, funcDecl, stmt)) && !queriesSubject(&pkg.Info, funcDecl, sw):
+		info.Reason = fmt.Sprintf("%s is not a parameter of %s", info.Subject, funcDecl.Name.Name)
+	case !g.selectsFunc(pkg, funcDecl):
+		info.Reason = "function not selected"
+	case !g.isChanged(filename) || !g.includesFile(pkg, file, filename) || (g.Include != nil && !g.Include(filename)):
+		info.Reason = "file not included"
+	default:
+		info.Expandable = true
+	}
+
+	return info
+}
+
+// expandsNested reports whether sw is in the body of a template clause of an expandable type switch
+// at the top level of funcDecl, to be expanded along with it.
+func (g Gen) expandsNested(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) bool {
+	for _, st := range funcDecl.Body.List {
+		outer, ok := st.(*ast.TypeSwitchStmt)
+		if !ok {
+			continue
+		}
+
+		stmt := &TypeSwitchStmt{file: file, node: outer, info: pkg.Info}
+		for _, clause := range outer.Body.List {
+			clause := clause.(*ast.CaseClause)
+			if containsStmt(clause.Body, sw) && g.isTemplateClause(stmt, clause) {
+				return g.typeSwitchInfo(pkg, file, funcDecl, outer).Expandable
+			}
+		}
+	}
+
+	return false
+}
+
+// containsStmt reports whether list has stmt.
+func containsStmt(list []ast.Stmt, stmt ast.Stmt) bool {
+	for _, s := range list {
+		if s == stmt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isParam reports whether x is a named parameter of funcDecl.
+func isParam(info *types.Info, funcDecl *ast.FuncDecl, x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return false
+	}
+
+	obj := info.Uses[ident]
+	if obj == nil || obj.Parent() != info.Scopes[funcDecl.Type] {
+		return false
+	}
+
+	return namedParamPos(ident.Name, funcDecl.Type.Params) != -1
+}
+
+// String returns a one-line description of the type switch.
+func (info TypeSwitchInfo) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: switch on %s (%s)", info.Pos, info.Subject, info.Type)
+	if info.Func != "" {
+		fmt.Fprintf(&buf, " in %s", info.Func)
+	}
+
+	fmt.Fprintf(&buf, ": %d cases", info.Cases)
+	if info.TypeVariables {
+		buf.WriteString(", with type variables")
+	}
+
+	if info.Expandable {
+		buf.WriteString(", expandable")
+	} else {
+		fmt.Fprintf(&buf, ", not expandable: %s", info.Reason)
+	}
+
+	return buf.String()
+}
+
+type byTypeSwitchInfoPos []TypeSwitchInfo
+
+func (s byTypeSwitchInfoPos) Len() int      { return len(s) }
+func (s byTypeSwitchInfoPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byTypeSwitchInfoPos) Less(i, j int) bool {
+	if s[i].Pos.Filename != s[j].Pos.Filename {
+		return s[i].Pos.Filename < s[j].Pos.Filename
+	}
+	return s[i].Pos.Offset < s[j].Pos.Offset
+}
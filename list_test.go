@@ -0,0 +1,51 @@
+package gen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTypeSwitches(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/list.go")
+	require.NoError(t, err)
+
+	list, err := g.ListTypeSwitches()
+	require.NoError(t, err)
+
+	for _, info := range list {
+		t.Log(info)
+	}
+
+	require.Len(t, list, 6)
+
+	assert.Equal(t, 10, list[0].Pos.Line)
+	assert.Equal(t, "keys", list[0].Func)
+	assert.Equal(t, "m", list[0].Subject)
+	assert.Equal(t, "interface{}", list[0].Type.String())
+	assert.Equal(t, 1, list[0].Cases)
+	assert.True(t, list[0].TypeVariables)
+	assert.True(t, list[0].Expandable)
+
+	// nested in a template clause
+	assert.Equal(t, "f", list[2].Subject)
+	assert.True(t, list[2].Expandable)
+
+	assert.Equal(t, "(*S).describe", list[3].Func)
+	assert.Equal(t, 2, list[3].Cases)
+	assert.False(t, list[3].TypeVariables)
+	assert.False(t, list[3].Expandable)
+	assert.Equal(t, "no templates", list[3].Reason)
+
+	assert.Equal(t, "x is not a parameter of local", list[4].Reason)
+
+	assert.Equal(t, "fmt.Stringer", list[5].Type.String())
+	assert.Equal(t, "not at the top level of the function body", list[5].Reason)
+
+	g.FuncFilter = []string{"local"}
+	list, err = g.ListTypeSwitches()
+	require.NoError(t, err)
+	assert.Equal(t, "function not selected", list[0].Reason)
+}
@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"go/token"
+)
+
+// Logger is the interface to receive diagnostics from Gen.
+// pos is the position in the source which the message is about, which may be invalid.
+type Logger interface {
+	Debug(pos token.Position, msg string, fields ...Field)
+	Info(pos token.Position, msg string, fields ...Field)
+	Warn(pos token.Position, msg string, fields ...Field)
+}
+
+// Field is a key-value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F makes a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// NewTextLogger returns a Logger which writes messages as text lines to w.
+// Debug messages are written only if debug is true.
+func NewTextLogger(w io.Writer, debug bool) Logger {
+	return &textLogger{w: w, debug: debug}
+}
+
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	debug bool
+}
+
+func (l *textLogger) Debug(pos token.Position, msg string, fields ...Field) {
+	if l.debug {
+		l.write(pos, "", msg, fields)
+	}
+}
+
+func (l *textLogger) Info(pos token.Position, msg string, fields ...Field) {
+	l.write(pos, "", msg, fields)
+}
+
+func (l *textLogger) Warn(pos token.Position, msg string, fields ...Field) {
+	l.write(pos, "warning: ", msg, fields)
+}
+
+func (l *textLogger) write(pos token.Position, prefix, msg string, fields []Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if pos.IsValid() {
+		fmt.Fprintf(l.w, "%s: ", pos)
+	}
+
+	fmt.Fprint(l.w, prefix+msg)
+
+	for _, f := range fields {
+		fmt.Fprintf(l.w, " %s=%v", f.Key, f.Value)
+	}
+
+	fmt.Fprintln(l.w)
+}
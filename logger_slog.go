@@ -0,0 +1,45 @@
+//go:build go1.21
+// +build go1.21
+
+package gen
+
+import (
+	"context"
+	"log/slog"
+
+	"go/token"
+)
+
+// NewSlogLogger returns a Logger which sends messages to l.
+// The source position is attached as the "pos" attribute.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(pos token.Position, msg string, fields ...Field) {
+	s.log(slog.LevelDebug, pos, msg, fields)
+}
+
+func (s slogLogger) Info(pos token.Position, msg string, fields ...Field) {
+	s.log(slog.LevelInfo, pos, msg, fields)
+}
+
+func (s slogLogger) Warn(pos token.Position, msg string, fields ...Field) {
+	s.log(slog.LevelWarn, pos, msg, fields)
+}
+
+func (s slogLogger) log(level slog.Level, pos token.Position, msg string, fields []Field) {
+	attrs := make([]slog.Attr, 0, len(fields)+1)
+	if pos.IsValid() {
+		attrs = append(attrs, slog.String("pos", pos.String()))
+	}
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+
+	s.l.LogAttrs(context.Background(), level, msg, attrs...)
+}
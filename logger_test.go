@@ -0,0 +1,23 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+
+	"go/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	pos := token.Position{Filename: "a.go", Line: 1, Column: 2}
+
+	l := NewTextLogger(&buf, false)
+	l.Debug(pos, "debug")
+	l.Info(pos, "info", F("types", 3))
+	l.Warn(token.Position{}, "warn")
+
+	assert.Equal(t, "a.go:1:2: info types=3\nwarning: warn\n", buf.String())
+}
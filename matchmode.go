@@ -0,0 +1,49 @@
+package gen
+
+import (
+	"fmt"
+)
+
+// MatchMode controls how the named types in the input types, e.g. type Celsius float64,
+// are matched against patterns.
+// Aliases are resolved to the types they denote by the type checker, so they are matched as those types.
+type MatchMode int
+
+const (
+	// MatchNamed matches a named type only by the name, so that it matches the same named type
+	// or a type variable, but not its underlying type: float64 does not match Celsius. This is the default.
+	MatchNamed MatchMode = iota
+
+	// MatchUnderlying matches a named type only by its underlying type: float64 matches Celsius,
+	// while Celsius does not, and type variables are bound to the underlying types.
+	MatchUnderlying
+
+	// MatchEither matches a named type by the name first, then by its underlying type if not matched:
+	// both Celsius and float64 match Celsius, and type variables are bound to the named types.
+	MatchEither
+)
+
+var matchModeNames = []string{
+	MatchNamed:      "named",
+	MatchUnderlying: "underlying",
+	MatchEither:     "either",
+}
+
+// ParseMatchMode parses the name of a match mode, one of "named", "underlying" and "either".
+func ParseMatchMode(s string) (MatchMode, error) {
+	for mode, name := range matchModeNames {
+		if s == name {
+			return MatchMode(mode), nil
+		}
+	}
+
+	return MatchNamed, fmt.Errorf("unknown match mode: %q (known modes: named, underlying, either)", s)
+}
+
+func (mode MatchMode) String() string {
+	if mode < 0 || int(mode) >= len(matchModeNames) {
+		return fmt.Sprintf("MatchMode(%d)", int(mode))
+	}
+
+	return matchModeNames[mode]
+}
@@ -0,0 +1,118 @@
+package gen
+
+import (
+	"os"
+
+	"go/build"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// callPathPackages returns the import paths of the packages on the import paths from g.Main
+// to the initial packages, including both ends, whose functions may call the functions
+// whose type switches are expanded. It is computed from the imports of the packages
+// found by g.BuildContext() alone, before the program is loaded.
+// Without g.Main, only the created packages are, as the packages they import cannot call them.
+func (g *Gen) callPathPackages() (map[string]bool, error) {
+	paths := map[string]bool{}
+
+	if g.Main == "" {
+		for _, cp := range g.Loader.CreatePkgs {
+			if cp.Path != "" {
+				paths[cp.Path] = true
+			} else if len(cp.Files) > 0 {
+				paths[cp.Files[0].Name.Name] = true
+			}
+		}
+		return paths, nil
+	}
+
+	ctxt := g.BuildContext()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// reaches memoizes whether the package of each path reaches any of the initial packages
+	reaches := map[string]bool{}
+
+	var visit func(path, srcDir string) (bool, error)
+	visit = func(path, srcDir string) (bool, error) {
+		if path == "C" || path == "unsafe" {
+			return false, nil
+		}
+
+		// resolve the path, e.g. of a vendored package, without reading the files
+		bp, err := ctxt.Import(path, srcDir, build.FindOnly)
+		if err != nil {
+			return false, err
+		}
+
+		key := bp.ImportPath
+		if r, ok := reaches[key]; ok {
+			return r, nil
+		}
+		reaches[key] = false
+
+		bp, err = ctxt.ImportDir(bp.Dir, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return false, nil
+			}
+			return false, err
+		}
+
+		r := g.isInitialPackage(key)
+		for _, imp := range bp.Imports {
+			ok, err := visit(imp, bp.Dir)
+			if err != nil {
+				return false, err
+			}
+			r = r || ok
+		}
+
+		reaches[key] = r
+		return r, nil
+	}
+
+	_, err = visit(g.Main, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	for path, r := range reaches {
+		if r {
+			paths[path] = true
+		}
+	}
+
+	return paths, nil
+}
+
+// applyLowMemory makes g.Loader type-check the function bodies of the packages on the call paths
+// only, which are the ones SSA is built for, if g.LowMemory is set.
+func (g *Gen) applyLowMemory() error {
+	if !g.LowMemory {
+		return nil
+	}
+
+	paths, err := g.callPathPackages()
+	if err != nil {
+		return err
+	}
+
+	g.callPaths = paths
+	if g.Loader.TypeCheckFuncBodies == nil {
+		g.Loader.TypeCheckFuncBodies = func(path string) bool { return paths[path] }
+	}
+
+	return nil
+}
+
+// releasePackage drops the syntax trees and the type information of pkg, whose files are all rewritten,
+// so that they can be garbage collected while the other packages are rewritten.
+func (g Gen) releasePackage(pkg *loader.PackageInfo) {
+	pkg.Files = nil
+	pkg.Info = types.Info{}
+}
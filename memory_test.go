@@ -0,0 +1,60 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallPathPackages(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/e.go")
+	require.NoError(t, err)
+
+	paths, err := g.callPathPackages()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"testdata": true}, paths)
+
+	g = New()
+	g.Loader.ImportPkgs = map[string]bool{"github.com/motemen/go-typeswitch-gen": false}
+	g.Main = "github.com/motemen/go-typeswitch-gen/cmd/tsgen"
+
+	paths, err = g.callPathPackages()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"github.com/motemen/go-typeswitch-gen":           true,
+		"github.com/motemen/go-typeswitch-gen/cmd/tsgen": true,
+	}, paths)
+}
+
+func TestDoFiles_ReleaseRewritten(t *testing.T) {
+	var out bytes.Buffer
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		return nopCloser{&out}
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/e.go")
+	require.NoError(t, err)
+
+	err = g.initProgram(needTypes)
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	require.NotEmpty(t, pkg.Files)
+
+	g.releaseRewritten = true
+	err = g.doFiles(func(*loader.PackageInfo, *ast.File) error { return nil })
+	require.NoError(t, err)
+
+	assert.Contains(t, out.String(), "package ")
+	assert.Nil(t, pkg.Files)
+	assert.Nil(t, pkg.Types)
+}
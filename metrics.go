@@ -0,0 +1,291 @@
+package gen
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// Metrics are the measurements of the cost of expansion, recorded by Expand if Gen.Metrics is set,
+// e.g. to track it over time by WritePrometheus or Publish.
+// Expand resets them at its start. Loading and SSA building are timed in the other modes as well.
+type Metrics struct {
+	mu sync.Mutex
+
+	// LoadTime is the time spent loading and type-checking the program,
+	// SSATime building SSA and AnalysisTime running pointer analysis.
+	LoadTime     time.Duration
+	SSATime      time.Duration
+	AnalysisTime time.Duration
+
+	// TotalTime is the time of the whole run of Expand.
+	TotalTime time.Duration
+
+	// Switches are the measurements of the type switches expanded, in the order of their positions.
+	Switches []SwitchMetrics
+
+	// analysisStart and analysisEnd are when SSA building and pointer analysis for the switches started and ended,
+	// which are excluded from the times of the switches waiting for them.
+	analysisStart, analysisEnd time.Time
+}
+
+// SwitchMetrics are the measurements of a type switch expanded.
+type SwitchMetrics struct {
+	Pos token.Position
+
+	// Func is the name of the enclosing function, e.g. Foo or (*T).Method.
+	Func string
+
+	// Time is the time spent inferring the argument types and generating the cases of the switch,
+	// excluding SSA building and pointer analysis.
+	Time time.Duration
+
+	// Inferred is the number of the argument types inferred at the call sites,
+	// Matched the number of them matching a template, and Expanded the number of the cases generated,
+	// which excludes the types having hand-written cases or exceeding the limits of cases.
+	Inferred int
+	Matched  int
+	Expanded int
+}
+
+// reset clears the measurements for a new run.
+func (m *Metrics) reset() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LoadTime, m.SSATime, m.AnalysisTime, m.TotalTime = 0, 0, 0, 0
+	m.Switches = nil
+	m.analysisStart, m.analysisEnd = time.Time{}, time.Time{}
+}
+
+// phase is a phase of the run timed by Metrics.
+type phase int
+
+const (
+	phaseLoad phase = iota
+	phaseSSA
+	phaseAnalysis
+)
+
+// add adds the time since start to the time of the phase p.
+func (m *Metrics) add(p phase, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch p {
+	case phaseLoad:
+		m.LoadTime += time.Since(start)
+	case phaseSSA:
+		m.SSATime += time.Since(start)
+	case phaseAnalysis:
+		m.AnalysisTime += time.Since(start)
+	}
+}
+
+// analyzed records the interval of SSA building and pointer analysis for the switches.
+func (m *Metrics) analyzed(start, end time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.analysisStart, m.analysisEnd = start, end
+}
+
+// since returns the time since start, excluding the interval of SSA building and pointer analysis.
+func (m *Metrics) since(start time.Time) time.Duration {
+	end := time.Now()
+	d := end.Sub(start)
+	if m == nil {
+		return d
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.analysisEnd.IsZero() {
+		return d
+	}
+
+	from, to := m.analysisStart, m.analysisEnd
+	if start.After(from) {
+		from = start
+	}
+	if end.Before(to) {
+		to = end
+	}
+	if to.After(from) {
+		d -= to.Sub(from)
+	}
+
+	return d
+}
+
+// addSwitch records the measurements of a type switch.
+func (m *Metrics) addSwitch(s SwitchMetrics) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Switches = append(m.Switches, s)
+}
+
+// finish records the time of the run started at start, sorting the switches.
+func (m *Metrics) finish(start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.TotalTime = time.Since(start)
+	sort.Sort(bySwitchMetricsPos(m.Switches))
+}
+
+// snapshot returns a copy of the measurements, which can be read while they are recorded.
+func (m *Metrics) snapshot() *Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &Metrics{
+		LoadTime:     m.LoadTime,
+		SSATime:      m.SSATime,
+		AnalysisTime: m.AnalysisTime,
+		TotalTime:    m.TotalTime,
+		Switches:     append([]SwitchMetrics{}, m.Switches...),
+	}
+}
+
+// Publish exports the metrics as the expvar variable of name, served as JSON at /debug/vars
+// by the HTTP servers of the process. Like expvar.Publish, it panics if name is already used.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.snapshot()
+	}))
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text exposition format,
+// e.g. for the textfile collector of node_exporter. The times are in seconds,
+// and the measurements of the switches are labelled by their positions and functions.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.snapshot()
+
+	var buf bytes.Buffer
+	gauge := func(name, help string) {
+		fmt.Fprintf(&buf, "# HELP tsgen_%s %s\n# TYPE tsgen_%s gauge\n", name, help, name)
+	}
+
+	phases := []struct {
+		name, help string
+		d          time.Duration
+	}{
+		{"load_seconds", "Time spent loading and type-checking the program.", s.LoadTime},
+		{"ssa_seconds", "Time spent building SSA.", s.SSATime},
+		{"analysis_seconds", "Time spent in pointer analysis.", s.AnalysisTime},
+		{"total_seconds", "Time of the whole run of expansion.", s.TotalTime},
+	}
+	for _, p := range phases {
+		gauge(p.name, p.help)
+		fmt.Fprintf(&buf, "tsgen_%s %s\n", p.name, formatSeconds(p.d))
+	}
+
+	gauge("type_switches", "Number of the type switches expanded.")
+	fmt.Fprintf(&buf, "tsgen_type_switches %d\n", len(s.Switches))
+
+	perSwitch := []struct {
+		name, help string
+		value      func(SwitchMetrics) string
+	}{
+		{"switch_seconds", "Time spent on the type switch, excluding SSA building and pointer analysis.",
+			func(sw SwitchMetrics) string { return formatSeconds(sw.Time) }},
+		{"switch_inferred_types", "Number of the argument types of the type switch inferred at the call sites.",
+			func(sw SwitchMetrics) string { return strconv.Itoa(sw.Inferred) }},
+		{"switch_matched_types", "Number of the inferred types matching a template of the type switch.",
+			func(sw SwitchMetrics) string { return strconv.Itoa(sw.Matched) }},
+		{"switch_expanded_cases", "Number of the cases generated for the type switch.",
+			func(sw SwitchMetrics) string { return strconv.Itoa(sw.Expanded) }},
+	}
+	for _, p := range perSwitch {
+		gauge(p.name, p.help)
+		for _, sw := range s.Switches {
+			pos := fmt.Sprintf("%s:%d", relativePath(sw.Pos.Filename), sw.Pos.Line)
+			fmt.Fprintf(&buf, "tsgen_%s{pos=%s,func=%s} %s\n", p.name, strconv.Quote(pos), strconv.Quote(sw.Func), p.value(sw))
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatSeconds formats d in seconds.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// recordSwitches records the measurements of the expansions of pkg if g.Metrics is set.
+func (g Gen) recordSwitches(pkg *loader.PackageInfo, expansions []*expansion) {
+	if g.Metrics == nil {
+		return
+	}
+
+	for _, e := range expansions {
+		g.Metrics.addSwitch(g.switchMetrics(pkg, e))
+	}
+}
+
+// switchMetrics returns the measurements of the expansion e of pkg.
+func (g Gen) switchMetrics(pkg *loader.PackageInfo, e *expansion) SwitchMetrics {
+	s := SwitchMetrics{
+		Pos:      g.Loader.Fset.Position(e.stmt.node.Pos()),
+		Func:     funcDeclName(pkg, e.funcDecl),
+		Time:     e.elapsed,
+		Inferred: len(e.inferred),
+		Expanded: len(e.stmt.generated),
+	}
+
+	for _, t := range e.inferred {
+		if tmpl, _, _ := g.findMatchingTemplate(e.stmt, t); tmpl != nil {
+			s.Matched++
+		}
+	}
+
+	return s
+}
+
+// funcDeclName returns the name of funcDecl of pkg, e.g. Foo or (*T).Method.
+func funcDeclName(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl) string {
+	if fn, ok := pkg.Defs[funcDecl.Name].(*types.Func); ok {
+		return funcNames(fn)[0]
+	}
+
+	return funcDecl.Name.Name
+}
+
+type bySwitchMetricsPos []SwitchMetrics
+
+func (s bySwitchMetricsPos) Len() int      { return len(s) }
+func (s bySwitchMetricsPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySwitchMetricsPos) Less(i, j int) bool {
+	if s[i].Pos.Filename != s[j].Pos.Filename {
+		return s[i].Pos.Filename < s[j].Pos.Filename
+	}
+	return s[i].Pos.Offset < s[j].Pos.Offset
+}
@@ -0,0 +1,58 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go/token"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Since(t *testing.T) {
+	m := &Metrics{}
+
+	start := time.Now().Add(-3 * time.Second)
+	m.analyzed(start.Add(time.Second), start.Add(2*time.Second))
+
+	d := m.since(start)
+	assert.True(t, d >= 2*time.Second && d < 3*time.Second, "got %s", d)
+
+	var nilMetrics *Metrics
+	assert.True(t, nilMetrics.since(start) >= 3*time.Second)
+}
+
+func TestMetrics_WritePrometheus(t *testing.T) {
+	m := &Metrics{}
+	m.reset()
+
+	m.LoadTime = 1500 * time.Millisecond
+	m.addSwitch(SwitchMetrics{
+		Pos:      token.Position{Filename: "b.go", Offset: 10, Line: 3},
+		Func:     "(*T).Method",
+		Time:     250 * time.Millisecond,
+		Inferred: 4,
+		Matched:  3,
+		Expanded: 2,
+	})
+	m.addSwitch(SwitchMetrics{Pos: token.Position{Filename: "a.go", Offset: 20, Line: 5}, Func: "Foo", Inferred: 1})
+	m.finish(time.Now())
+
+	require.Len(t, m.Switches, 2)
+	assert.Equal(t, "a.go", m.Switches[0].Pos.Filename)
+
+	var buf bytes.Buffer
+	err := m.WritePrometheus(&buf)
+	require.NoError(t, err)
+
+	t.Log(buf.String())
+
+	assert.Contains(t, buf.String(), "# TYPE tsgen_load_seconds gauge\ntsgen_load_seconds 1.5\n")
+	assert.Contains(t, buf.String(), "tsgen_type_switches 2\n")
+	assert.Contains(t, buf.String(), "tsgen_switch_seconds{pos=\"b.go:3\",func=\"(*T).Method\"} 0.25\n")
+	assert.Contains(t, buf.String(), "tsgen_switch_inferred_types{pos=\"a.go:5\",func=\"Foo\"} 1\n")
+	assert.Contains(t, buf.String(), "tsgen_switch_matched_types{pos=\"b.go:3\",func=\"(*T).Method\"} 3\n")
+	assert.Contains(t, buf.String(), "tsgen_switch_expanded_cases{pos=\"b.go:3\",func=\"(*T).Method\"} 2\n")
+}
@@ -0,0 +1,237 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	texttemplate "text/template"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// MigrationIssue is a case clause of a type switch or a type assertion on an interface,
+// which fails to compile after the method set of the interface has changed.
+type MigrationIssue struct {
+	Pos token.Position
+
+	// Kind is either "case" or "assertion".
+	Kind string
+
+	// Type is the case type or the asserted type.
+	Type types.Type
+
+	// Errors are the type errors inside the case clause or the assertion.
+	Errors []types.Error
+
+	file    *ast.File
+	clause  *ast.CaseClause
+	varName string
+}
+
+// MigrationSnippet is the data given to the rewrite snippet of Migrate.
+type MigrationSnippet struct {
+	// Interface is the name of the interface.
+	Interface string
+
+	// Type is the case type as written in the file.
+	Type string
+
+	// Var is the name of the variable bound by the type switch, if any.
+	Var string
+}
+
+// Migrate locates the type switches and the type assertions on the interface named iface
+// (e.g. "io.Reader" or "Node"), and reports the case clauses and the assertions which fail to compile,
+// typically after the method set of the interface has changed.
+// The program is loaded allowing type errors.
+//
+// If snippet is not empty, the bodies of the failing case clauses are replaced with it,
+// a text/template of Go statements executed with MigrationSnippet, and the files are written by g.FileWriter.
+func (g Gen) Migrate(iface string, snippet string) ([]MigrationIssue, error) {
+	typeErrors := []types.Error{}
+	g.Loader.AllowErrors = true
+	g.Loader.TypeChecker.Error = func(err error) {
+		if terr, ok := err.(types.Error); ok {
+			typeErrors = append(typeErrors, terr)
+		}
+	}
+
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaceType types.Type
+	for _, tn := range g.typeNames(nil) {
+		if _, ok := tn.Type().Underlying().(*types.Interface); ok && (tn.Name() == iface || interfaceNameMatches(tn.Type(), iface)) {
+			ifaceType = tn.Type()
+			break
+		}
+	}
+	if ifaceType == nil {
+		return nil, fmt.Errorf("interface not found: %s", iface)
+	}
+
+	errorsIn := func(node ast.Node) []types.Error {
+		errs := []types.Error{}
+		for _, terr := range typeErrors {
+			if node.Pos() <= terr.Pos && terr.Pos < node.End() {
+				errs = append(errs, terr)
+			}
+		}
+		return errs
+	}
+
+	issues := []MigrationIssue{}
+
+	pkgs := append([]*loader.PackageInfo{}, g.program.Created...)
+	for _, pkg := range g.program.Imported {
+		pkgs = append(pkgs, pkg)
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.TypeSwitchStmt:
+					x, varName := typeSwitchSubject(n)
+					if x == nil || !types.Identical(pkg.TypeOf(x), ifaceType) {
+						return true
+					}
+
+					for _, st := range n.Body.List {
+						clause := st.(*ast.CaseClause)
+						if clause.List == nil {
+							continue
+						}
+
+						errs := errorsIn(clause)
+						if len(errs) == 0 {
+							continue
+						}
+
+						issues = append(issues, MigrationIssue{
+							Pos:     g.Loader.Fset.Position(clause.Pos()),
+							Kind:    "case",
+							Type:    pkg.TypeOf(clause.List[0]),
+							Errors:  errs,
+							file:    file,
+							clause:  clause,
+							varName: varName,
+						})
+					}
+
+				case *ast.TypeAssertExpr:
+					if n.Type == nil || !types.Identical(pkg.TypeOf(n.X), ifaceType) {
+						return true
+					}
+
+					errs := errorsIn(n)
+					if len(errs) == 0 {
+						return true
+					}
+
+					issues = append(issues, MigrationIssue{
+						Pos:    g.Loader.Fset.Position(n.Pos()),
+						Kind:   "assertion",
+						Type:   pkg.TypeOf(n.Type),
+						Errors: errs,
+						file:   file,
+					})
+				}
+
+				return true
+			})
+		}
+	}
+
+	if snippet == "" {
+		return issues, nil
+	}
+
+	tmpl, err := texttemplate.New("snippet").Parse(snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, g.doFiles(func(pkg *loader.PackageInfo, file *ast.File) error {
+		edits := []sourceEdit{}
+		tf := g.tokenFile(file)
+
+		for _, issue := range issues {
+			if issue.file != file || issue.clause == nil {
+				continue
+			}
+
+			var buf bytes.Buffer
+			err := tmpl.Execute(&buf, MigrationSnippet{
+				Interface: iface,
+				Type:      g.showNode(issue.clause.List[0]),
+				Var:       issue.varName,
+			})
+			if err != nil {
+				return err
+			}
+
+			edits = append(edits, sourceEdit{
+				start: tf.Offset(issue.clause.Colon) + 1,
+				end:   tf.Offset(issue.clause.End()),
+				text:  append([]byte("\n"), buf.Bytes()...),
+			})
+		}
+
+		if len(edits) == 0 {
+			return nil
+		}
+
+		return g.editFileSource(file, edits)
+	})
+}
+
+// typeSwitchSubject returns the expression x of a type switch on x.(type)
+// and the name of the variable bound by the switch if any.
+func typeSwitchSubject(sw *ast.TypeSwitchStmt) (ast.Expr, string) {
+	switch a := sw.Assign.(type) {
+	case *ast.AssignStmt:
+		if ta, ok := a.Rhs[0].(*ast.TypeAssertExpr); ok {
+			return ta.X, a.Lhs[0].(*ast.Ident).Name
+		}
+	case *ast.ExprStmt:
+		if ta, ok := a.X.(*ast.TypeAssertExpr); ok {
+			return ta.X, ""
+		}
+	}
+
+	return nil, ""
+}
+
+// String returns a human-readable report of the issue.
+func (issue MigrationIssue) String() string {
+	return fmt.Sprintf("%s: %s", issue.Pos, issue.message())
+}
+
+// message returns the report of the issue without its position.
+func (issue MigrationIssue) message() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s fails to compile:", issue.Kind, issue.Type)
+
+	errs := make([]string, len(issue.Errors))
+	for i, terr := range issue.Errors {
+		errs[i] = terr.Error()
+	}
+	sort.Strings(errs)
+
+	for _, e := range errs {
+		fmt.Fprintf(&buf, "\n\t%s", e)
+	}
+
+	return buf.String()
+}
+
+// Diagnostic returns the issue as a Diagnostic of RuleMigration, e.g. for SARIF reports.
+func (issue MigrationIssue) Diagnostic() Diagnostic {
+	return Diagnostic{Pos: issue.Pos, Msg: issue.message(), Rule: RuleMigration}
+}
@@ -0,0 +1,40 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	var out bytes.Buffer
+
+	g := New()
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/migrate/node.go" {
+			return nopCloser{&out}
+		}
+
+		return nil
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/migrate/node.go")
+	require.NoError(t, err)
+
+	issues, err := g.Migrate("I", `panic("TODO: migrate {{.Var}} of {{.Type}} to {{.Interface}}")`)
+	require.NoError(t, err)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, "case", issues[0].Kind)
+	assert.Equal(t, "E.T2", issues[0].Type.String())
+	assert.Equal(t, "assertion", issues[1].Kind)
+
+	result := out.String()
+	t.Log(result)
+
+	assert.Contains(t, result, "\tcase T2:\n\t\tpanic(\"TODO: migrate i of T2 to I\")\n")
+	assert.Contains(t, result, "\tcase T1:\n\t\t_ = i\n")
+}
@@ -0,0 +1,506 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go/build"
+)
+
+// Modules resolves the import paths of the packages of a Go module, or of the modules of a go.work workspace,
+// to their directories: the modules of the workspace themselves, the targets of their replace directives,
+// and the versions they require in the module cache. See LoadModules.
+type Modules struct {
+	// Main are the modules of the workspace, or the module alone.
+	Main []Module
+
+	// replaces are the replace directives of the workspace and of its modules, the former taking precedence.
+	replaces []replace
+
+	// requires are the versions of the modules required, the highest one of each.
+	requires map[string]string
+
+	// modCache is the module cache, $GOMODCACHE or $GOPATH/pkg/mod.
+	modCache string
+}
+
+// Module is a Go module in a directory.
+type Module struct {
+	Path string
+	Dir  string
+}
+
+// replace is a replace directive, old[@oldVersion] => new[@newVersion], whose new is a directory if newVersion is empty.
+type replace struct {
+	old, oldVersion string
+	new, newVersion string
+}
+
+// modulesRoot is the GOPATH entry the packages of modules are imported from, which is mapped to their directories.
+var modulesRoot = filepath.Join(string(filepath.Separator), "$tsgen-modules")
+
+// LoadModules loads the workspace dir belongs to: the go.work file in dir or its ancestors, or the one
+// $GOWORK names, or the go.mod file in dir or its ancestors without one. It returns nil without either,
+// or if $GO111MODULE is off, as the program is loaded from GOPATH then. $GOWORK=off ignores go.work files.
+func LoadModules(dir string) (*Modules, error) {
+	if os.Getenv("GO111MODULE") == "off" {
+		return nil, nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Modules{requires: map[string]string{}, modCache: moduleCacheDir()}
+
+	work := os.Getenv("GOWORK")
+	if work == "" {
+		work = findUp(dir, "go.work")
+	} else if work == "off" {
+		work = ""
+	}
+
+	if work != "" {
+		return m, m.loadWork(work)
+	}
+
+	if mod := findUp(dir, "go.mod"); mod != "" {
+		return m, m.loadMod(mod)
+	}
+
+	return nil, nil
+}
+
+// moduleCacheDir returns the directory of the module cache.
+func moduleCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// findUp returns the path of the file name in dir or its nearest ancestor having it, or "" if none.
+func findUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadWork loads the modules used by the go.work file work and its replace directives.
+func (m *Modules) loadWork(work string) error {
+	stmts, err := parseModFile(work)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(work)
+
+	for _, st := range stmts {
+		switch st.verb {
+		case "use":
+			if len(st.args) != 1 {
+				return fmt.Errorf("%s:%d: usage: use <dir>", work, st.line)
+			}
+
+			err := m.loadMod(filepath.Join(resolveDir(dir, st.args[0]), "go.mod"))
+			if err != nil {
+				return err
+			}
+
+		case "replace":
+			r, err := parseReplace(dir, st.args)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", work, st.line, err)
+			}
+
+			// the replacements of the workspace precede the ones of the modules
+			m.replaces = append([]replace{r}, m.replaces...)
+		}
+	}
+
+	if len(m.Main) == 0 {
+		return fmt.Errorf("%s: no modules used", work)
+	}
+
+	return nil
+}
+
+// loadMod loads the go.mod file mod as a main module, with its requirements and replace directives.
+func (m *Modules) loadMod(mod string) error {
+	stmts, err := parseModFile(mod)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(mod)
+
+	module := Module{Dir: dir}
+	for _, st := range stmts {
+		switch st.verb {
+		case "module":
+			if len(st.args) != 1 {
+				return fmt.Errorf("%s:%d: usage: module <path>", mod, st.line)
+			}
+			module.Path = st.args[0]
+
+		case "require":
+			if len(st.args) != 2 {
+				return fmt.Errorf("%s:%d: usage: require <path> <version>", mod, st.line)
+			}
+
+			path, version := st.args[0], st.args[1]
+			if v, ok := m.requires[path]; !ok || compareVersions(v, version) < 0 {
+				m.requires[path] = version
+			}
+
+		case "replace":
+			r, err := parseReplace(dir, st.args)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", mod, st.line, err)
+			}
+			m.replaces = append(m.replaces, r)
+		}
+	}
+
+	if module.Path == "" {
+		return fmt.Errorf("%s: no module directive", mod)
+	}
+
+	m.Main = append(m.Main, module)
+
+	return nil
+}
+
+// parseReplace parses the arguments of a replace directive in a file of dir.
+func parseReplace(dir string, args []string) (replace, error) {
+	var r replace
+
+	var old, new []string
+	for i, a := range args {
+		if a == "=>" {
+			old, new = args[:i], args[i+1:]
+		}
+	}
+
+	if len(old) < 1 || len(old) > 2 || len(new) < 1 || len(new) > 2 {
+		return r, fmt.Errorf("usage: replace <path> [<version>] => <path> [<version>]")
+	}
+
+	r.old = old[0]
+	if len(old) == 2 {
+		r.oldVersion = old[1]
+	}
+
+	r.new = new[0]
+	if len(new) == 2 {
+		r.newVersion = new[1]
+	} else if !isLocalPath(r.new) {
+		return r, fmt.Errorf("replacement module %s without version", r.new)
+	} else {
+		r.new = resolveDir(dir, r.new)
+	}
+
+	return r, nil
+}
+
+// isLocalPath reports whether path in a replace directive is a directory, not a module path.
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") ||
+		strings.HasPrefix(path, `.\`) || strings.HasPrefix(path, `..\`)
+}
+
+// resolveDir returns the directory path in a file of dir.
+func resolveDir(dir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(dir, path)
+}
+
+// Resolve returns the directory of the package of importPath, in the module whose path is
+// the longest prefix of it: a main module, a replacement or the version required in the module cache.
+// It returns false if no module provides the package, e.g. of the standard library.
+func (m *Modules) Resolve(importPath string) (string, bool) {
+	dir, rest, ok := m.resolveModule(importPath)
+	if !ok {
+		return "", false
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(rest)), true
+}
+
+// resolveModule returns the directory of the module providing the package of importPath,
+// with the rest of importPath after the module path.
+func (m *Modules) resolveModule(importPath string) (string, string, bool) {
+	for prefix := importPath; prefix != "." && prefix != "/" && prefix != ""; prefix = pathDir(prefix) {
+		rest := strings.TrimPrefix(strings.TrimPrefix(importPath, prefix), "/")
+
+		for _, mod := range m.Main {
+			if mod.Path == prefix {
+				return mod.Dir, rest, true
+			}
+		}
+
+		version, required := m.requires[prefix]
+
+		for _, r := range m.replaces {
+			if r.old != prefix || (r.oldVersion != "" && r.oldVersion != version) {
+				continue
+			}
+
+			if r.newVersion == "" {
+				return r.new, rest, true
+			}
+			return m.cachedModuleDir(r.new, r.newVersion), rest, true
+		}
+
+		if required && m.modCache != "" {
+			return m.cachedModuleDir(prefix, version), rest, true
+		}
+	}
+
+	return "", "", false
+}
+
+func pathDir(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i == -1 {
+		return ""
+	}
+	return path[:i]
+}
+
+// cachedModuleDir returns the directory of the version of the module path in the module cache,
+// whose upper-case letters are escaped as "!" followed by the lower-case ones.
+func (m *Modules) cachedModuleDir(path, version string) string {
+	escape := func(s string) string {
+		var buf bytes.Buffer
+		for _, r := range s {
+			if unicode.IsUpper(r) {
+				buf.WriteByte('!')
+				r = unicode.ToLower(r)
+			}
+			buf.WriteRune(r)
+		}
+		return buf.String()
+	}
+
+	return filepath.Join(m.modCache, filepath.FromSlash(escape(path)+"@"+escape(version)))
+}
+
+// compareVersions compares the semantic versions a and b, e.g. v1.2.3 and v1.10.0-pre,
+// returning a negative number, zero or a positive one as a is lower, equal or higher.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]string, string) {
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.IndexByte(v, '+'); i != -1 {
+			v = v[:i]
+		}
+
+		pre := ""
+		if i := strings.IndexByte(v, '-'); i != -1 {
+			v, pre = v[:i], v[i+1:]
+		}
+
+		return strings.Split(v, "."), pre
+	}
+
+	as, apre := split(a)
+	bs, bpre := split(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+
+		if an != bn {
+			return an - bn
+		}
+	}
+
+	// a pre-release precedes the release
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	default:
+		return strings.Compare(apre, bpre)
+	}
+}
+
+// modStmt is a directive of a go.mod or go.work file, with the ones in blocks like require ( ... ) flattened.
+type modStmt struct {
+	verb string
+	args []string
+	line int
+}
+
+// parseModFile parses the directives of the go.mod or go.work file filename.
+func parseModFile(filename string) ([]modStmt, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := []modStmt{}
+	block := ""
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.Index(text, "//"); i != -1 {
+			text = text[:i]
+		}
+
+		fields, err := modFields(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, line, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+
+		case block != "":
+			stmts = append(stmts, modStmt{verb: block, args: fields, line: line})
+
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+
+		default:
+			stmts = append(stmts, modStmt{verb: fields[0], args: fields[1:], line: line})
+		}
+	}
+
+	if err := s.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return stmts, nil
+}
+
+// modFields splits a line of a go.mod file into its fields, unquoting the quoted ones.
+func modFields(line string) ([]string, error) {
+	fields := []string{}
+
+	for {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return fields, nil
+		}
+
+		if line[0] != '"' && line[0] != '`' {
+			i := strings.IndexFunc(line, unicode.IsSpace)
+			if i == -1 {
+				i = len(line)
+			}
+			fields = append(fields, line[:i])
+			line = line[i:]
+			continue
+		}
+
+		// the end of the quoted string, skipping the escaped quotes
+		end := -1
+		for i := 1; i < len(line); i++ {
+			if line[0] == '"' && line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == line[0] {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated string %s", line)
+		}
+
+		s, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, s)
+		line = line[end+1:]
+	}
+}
+
+// buildContext returns ctxt made to import the packages of the modules, from modulesRoot added to its GOPATH,
+// whose paths are mapped to the directories of the modules by JoinPath. Modules in GOPATH mode of go/build.
+func (m *Modules) buildContext(ctxt build.Context) *build.Context {
+	ctxt.GOPATH = modulesRoot + string(filepath.ListSeparator) + ctxt.GOPATH
+
+	joinPath := ctxt.JoinPath
+	ctxt.JoinPath = func(elem ...string) string {
+		var path string
+		if joinPath != nil {
+			path = joinPath(elem...)
+		} else {
+			path = filepath.Join(elem...)
+		}
+
+		src := filepath.Join(modulesRoot, "src") + string(filepath.Separator)
+		if !strings.HasPrefix(path, src) {
+			return path
+		}
+
+		if dir, ok := m.Resolve(filepath.ToSlash(strings.TrimPrefix(path, src))); ok {
+			return dir
+		}
+
+		// not provided by the modules; not found in the root
+		return path
+	}
+
+	return &ctxt
+}
+
+// applyModules makes g.Loader import the packages of g.Modules, if set.
+func (g *Gen) applyModules() {
+	if g.Modules == nil {
+		return
+	}
+
+	ctxt := build.Default
+	if g.Loader.Build != nil {
+		ctxt = *g.Loader.Build
+	}
+
+	g.Loader.Build = g.Modules.buildContext(ctxt)
+}
@@ -0,0 +1,103 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go/build"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-modules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"go.work": "go 1.21\n\nuse (\n\t./app\n\t./lib // templates\n)\n\nreplace example.com/fork v1.0.0 => ./fork\n",
+		"app/go.mod": `module example.com/app
+
+require (
+	example.com/lib v0.0.0
+	example.com/Dep v1.2.0
+	example.com/fork v1.0.0
+)
+
+replace example.com/other => example.com/other2 v0.3.0
+replace example.com/fork => ../unused
+`,
+		"app/main.go":    "package main\n",
+		"lib/go.mod":     "module example.com/lib\n\nrequire example.com/Dep v1.10.0-rc.1\n",
+		"lib/sub/sub.go": "package sub\n",
+		"fork/go.mod":    "module example.com/fork\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	for _, env := range []string{"GOWORK", "GO111MODULE", "GOMODCACHE"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("GOWORK", "")
+	os.Setenv("GO111MODULE", "")
+	os.Setenv("GOMODCACHE", filepath.Join(dir, "cache"))
+
+	m, err := LoadModules(filepath.Join(dir, "app"))
+	require.NoError(t, err)
+	require.NotNil(t, m)
+
+	assert.Equal(t, []Module{
+		{Path: "example.com/app", Dir: filepath.Join(dir, "app")},
+		{Path: "example.com/lib", Dir: filepath.Join(dir, "lib")},
+	}, m.Main)
+
+	for importPath, expected := range map[string]string{
+		"example.com/lib/sub":   filepath.Join(dir, "lib", "sub"),
+		"example.com/app":       filepath.Join(dir, "app"),
+		"example.com/fork/x":    filepath.Join(dir, "fork", "x"),
+		"example.com/Dep/a":     filepath.Join(dir, "cache", "example.com", "!dep@v1.10.0-rc.1", "a"),
+		"example.com/other/pkg": filepath.Join(dir, "cache", "example.com", "other2@v0.3.0", "pkg"),
+	} {
+		resolved, ok := m.Resolve(importPath)
+		if assert.True(t, ok, importPath) {
+			assert.Equal(t, expected, resolved, importPath)
+		}
+	}
+
+	_, ok := m.Resolve("fmt")
+	assert.False(t, ok)
+
+	// imported from the sibling module by go/build
+	ctxt := m.buildContext(build.Default)
+	p, err := ctxt.Import("example.com/lib/sub", filepath.Join(dir, "app"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "lib", "sub"), p.Dir)
+	assert.Equal(t, []string{"sub.go"}, p.GoFiles)
+
+	// the module alone
+	os.Setenv("GOWORK", "off")
+	m, err = LoadModules(filepath.Join(dir, "lib", "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, []Module{{Path: "example.com/lib", Dir: filepath.Join(dir, "lib")}}, m.Main)
+
+	os.Setenv("GO111MODULE", "off")
+	m, err = LoadModules(filepath.Join(dir, "lib"))
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.True(t, compareVersions("v1.2.3", "v1.10.0") < 0)
+	assert.True(t, compareVersions("v1.10.0-rc.1", "v1.10.0") < 0)
+	assert.True(t, compareVersions("v2.0.0+incompatible", "v1.9.9") > 0)
+	assert.Equal(t, 0, compareVersions("v1.0.0", "v1.0.0"))
+}
@@ -0,0 +1,92 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputRoot returns the directory whose layout is mirrored under g.OutputDir for filename:
+// the common ancestor of the directories of g.Modules.Main, the src directory of the GOPATH entry
+// holding filename, or else the working directory.
+func (g Gen) outputRoot(filename string) (string, error) {
+	if g.Modules != nil && len(g.Modules.Main) > 0 {
+		root := g.Modules.Main[0].Dir
+		for _, m := range g.Modules.Main[1:] {
+			for !isUnder(m.Dir, root) {
+				root = filepath.Dir(root)
+			}
+		}
+		return root, nil
+	}
+
+	for _, gopath := range filepath.SplitList(g.BuildContext().GOPATH) {
+		src := filepath.Join(gopath, "src")
+		if isUnder(filename, src) {
+			return src, nil
+		}
+	}
+
+	return os.Getwd()
+}
+
+// isUnder reports whether path is dir or in the tree under it.
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// outputPath returns the path under g.OutputDir the file filename is written to,
+// at its relativeOutputPath, e.g. <OutputDir>/lib/foo.go for <module>/lib/foo.go.
+func (g Gen) outputPath(filename string) (string, error) {
+	rel, err := g.relativeOutputPath(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(g.OutputDir, rel), nil
+}
+
+// relativeOutputPath returns the path of the file filename relative to its outputRoot.
+func (g Gen) relativeOutputPath(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := g.outputRoot(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if !isUnder(abs, root) {
+		return "", fmt.Errorf("cannot write %s out of its tree: not in %s", filename, root)
+	}
+
+	return filepath.Rel(root, abs)
+}
+
+// outputWriter writes the file filename to its outputPath on Close, creating the directories as needed.
+type outputWriter struct {
+	bytes.Buffer
+	g        Gen
+	filename string
+}
+
+func (w *outputWriter) Close() error {
+	path, err := w.g.outputPath(w.filename)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+
+	r := &fileReplacer{filename: path}
+	r.Write(w.Bytes())
+	return r.Close()
+}
@@ -0,0 +1,101 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"golang.org/x/tools/go/loader"
+)
+
+// overlayContent returns the content of the file in g.Overlay, if any.
+func (g Gen) overlayContent(filename string) ([]byte, bool) {
+	if len(g.Overlay) == 0 {
+		return nil, false
+	}
+
+	if src, ok := g.Overlay[filename]; ok {
+		return src, true
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, false
+	}
+
+	for name, src := range g.Overlay {
+		if nameAbs, err := filepath.Abs(name); err == nil && nameAbs == abs {
+			return src, true
+		}
+	}
+
+	return nil, false
+}
+
+// readSource reads the source file, preferring the content in g.Overlay.
+func (g Gen) readSource(filename string) ([]byte, error) {
+	if src, ok := g.overlayContent(filename); ok {
+		return src, nil
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+// applyOverlay makes g.Loader read the files in g.Overlay instead of the ones on disk.
+// The files of the created packages, which are parsed already, are parsed again from the overlay,
+// and the files of imported packages are opened through the build context.
+func (g *Gen) applyOverlay() error {
+	if len(g.Overlay) == 0 {
+		return nil
+	}
+
+	ctxt := build.Default
+	if g.Loader.Build != nil {
+		ctxt = *g.Loader.Build
+	}
+
+	openFile := ctxt.OpenFile
+	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		if src, ok := g.overlayContent(path); ok {
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		}
+
+		if openFile != nil {
+			return openFile(path)
+		}
+
+		return os.Open(path)
+	}
+	g.Loader.Build = &ctxt
+
+	// Copy not to modify the packages of the caller's Gen
+	createPkgs := make([]loader.CreatePkg, len(g.Loader.CreatePkgs))
+	for i, cp := range g.Loader.CreatePkgs {
+		createPkgs[i] = loader.CreatePkg{Path: cp.Path, Files: make([]*ast.File, len(cp.Files))}
+
+		for j, file := range cp.Files {
+			createPkgs[i].Files[j] = file
+
+			name := g.tokenFile(file).Name()
+			src, ok := g.overlayContent(name)
+			if !ok {
+				continue
+			}
+
+			newFile, err := parser.ParseFile(g.Loader.Fset, name, src, g.Loader.ParserMode)
+			if err != nil {
+				return err
+			}
+
+			createPkgs[i].Files[j] = newFile
+		}
+	}
+	g.Loader.CreatePkgs = createPkgs
+
+	return nil
+}
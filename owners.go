@@ -0,0 +1,132 @@
+package gen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+)
+
+// Owners is a set of CODEOWNERS-style rules, which map file paths to their owners.
+type Owners struct {
+	// Root is the directory the patterns are relative to.
+	Root string
+
+	rules []ownerRule
+}
+
+type ownerRule struct {
+	pattern string
+	owners  []string
+}
+
+// ReadOwners reads a CODEOWNERS file. Each line is a path pattern followed by owners,
+// and the last matching line takes precedence. Patterns are relative to the directory
+// of the file, or its parent if the file is in a ".github" or "docs" directory.
+func ReadOwners(filename string) (*Owners, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	if base := filepath.Base(root); base == ".github" || base == "docs" {
+		root = filepath.Dir(root)
+	}
+
+	return ParseOwners(f, root)
+}
+
+// ParseOwners parses CODEOWNERS-style rules from r, whose patterns are relative to root.
+func ParseOwners(r io.Reader, root string) (*Owners, error) {
+	o := &Owners{Root: root}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		o.rules = append(o.rules, ownerRule{pattern: fields[0], owners: fields[1:]})
+	}
+
+	return o, s.Err()
+}
+
+// Lookup returns the owners of the file at path, or nil if no rules match.
+func (o *Owners) Lookup(path string) []string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+
+	rel, err := filepath.Rel(o.Root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	for i := len(o.rules) - 1; i >= 0; i-- {
+		if matchPath(o.rules[i].pattern, rel) {
+			return o.rules[i].owners
+		}
+	}
+
+	return nil
+}
+
+// reportOwners writes to g.OwnersReport the owners of the call sites which contributed
+// each of inTypes expanded in stmt, so that the reviews of the generated cases can be routed to them.
+func (g Gen) reportOwners(stmt *TypeSwitchStmt, funcDecl *ast.FuncDecl, inTypes []types.Type) {
+	if g.Owners == nil || g.OwnersReport == nil || stmt.sites == nil {
+		return
+	}
+
+	paramPos := subjectParamPos(&stmt.info, funcDecl, stmt)
+	if paramPos == -1 {
+		return
+	}
+
+	pos := g.Loader.Fset.Position(stmt.node.Pos())
+
+	for _, t := range inTypes {
+		ownerSites := map[string][]string{}
+		for _, p := range stmt.sites.having(paramPos, t).positions {
+			site := g.Loader.Fset.Position(p)
+
+			owners := g.Owners.Lookup(site.Filename)
+			if len(owners) == 0 {
+				owners = []string{"(no owners)"}
+			}
+
+			for _, owner := range owners {
+				ownerSites[owner] = append(ownerSites[owner], site.String())
+			}
+		}
+
+		names := []string{}
+		for owner := range ownerSites {
+			names = append(names, owner)
+		}
+		sort.Strings(names)
+
+		entries := make([]string, len(names))
+		for i, owner := range names {
+			entries[i] = fmt.Sprintf("%s (%s)", owner, strings.Join(ownerSites[owner], ", "))
+		}
+
+		fmt.Fprintf(g.OwnersReport, "%s: case %s: %s\n", pos, g.relativeTypeString(t, stmt.file), strings.Join(entries, ", "))
+	}
+}
@@ -0,0 +1,36 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwners(t *testing.T) {
+	o, err := ParseOwners(strings.NewReader(`
+# default
+*           @everyone
+/cmd/       @cli-team
+*.adoc      @docs
+testdata/** @test-team
+`), "/repo")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"@everyone"}, o.Lookup("/repo/api.go"))
+	assert.Equal(t, []string{"@cli-team"}, o.Lookup("/repo/cmd/tsgen/main.go"))
+	assert.Equal(t, []string{"@docs"}, o.Lookup("/repo/docs/matching.adoc"))
+	assert.Equal(t, []string{"@test-team"}, o.Lookup("/repo/testdata/spec/match.spec"))
+	assert.Nil(t, o.Lookup("/elsewhere/a.go"))
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("*.go", "a/b/c.go"))
+	assert.True(t, matchPath("/a/", "a/b/c.go"))
+	assert.False(t, matchPath("/a/", "a"))
+	assert.True(t, matchPath("a/**/c.go", "a/c.go"))
+	assert.True(t, matchPath("a/**/c.go", "a/b/b/c.go"))
+	assert.False(t, matchPath("/b", "a/b/c.go"))
+	assert.True(t, matchPath("b", "a/b/c.go"))
+}
@@ -0,0 +1,177 @@
+package gen
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/loader"
+)
+
+// regexpPrefix prefixes the patterns of Gen.IncludePaths and Gen.ExcludePaths which are regular expressions.
+const regexpPrefix = "re:"
+
+// defaultExcludePaths are the patterns of the files excluded unless matched by Gen.IncludePaths.
+var defaultExcludePaths = []string{"vendor/", "testdata/"}
+
+// generatedComment matches the comment marking generated files, as in https://golang.org/s/generatedcode.
+var generatedComment = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// includesFile reports whether file of pkg, named filename, is to be rewritten according to
+// g.IncludePaths, g.ExcludePaths and the default exclusions.
+func (g Gen) includesFile(pkg *loader.PackageInfo, file *ast.File, filename string) bool {
+	p := relativePath(filename)
+
+	if matchPaths(g.ExcludePaths, p) {
+		return false
+	}
+
+	if g.IncludePaths != nil {
+		return matchPaths(g.IncludePaths, p)
+	}
+
+	for _, created := range g.program.Created {
+		if created == pkg {
+			// given by name
+			return true
+		}
+	}
+
+	return !matchPaths(defaultExcludePaths, p) && !isGeneratedFile(file)
+}
+
+// relativePath returns the slash-separated path of filename relative to the current directory,
+// or the absolute one if it is out of the directory.
+func relativePath(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.ToSlash(filename)
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+
+	return filepath.ToSlash(abs)
+}
+
+// matchPaths reports whether the slash-separated path p matches any of patterns,
+// each a glob for matchPath or a regular expression prefixed with regexpPrefix.
+func matchPaths(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, regexpPrefix) {
+			if ok, err := regexp.MatchString(strings.TrimPrefix(pattern, regexpPrefix), p); err == nil && ok {
+				return true
+			}
+		} else if matchPath(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPathPatterns reports the invalid patterns in patterns.
+func checkPathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, regexpPrefix) {
+			if _, err := regexp.Compile(strings.TrimPrefix(pattern, regexpPrefix)); err != nil {
+				return fmt.Errorf("invalid path pattern %q: %s", pattern, err)
+			}
+			continue
+		}
+
+		for _, seg := range strings.Split(pattern, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("invalid path pattern %q: %s", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isGeneratedFile reports whether file has the comment marking generated files before its package clause.
+func isGeneratedFile(file *ast.File) bool {
+	for _, cg := range file.Comments {
+		if cg.Pos() > file.Package {
+			break
+		}
+
+		for _, c := range cg.List {
+			if generatedComment.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchPath reports whether the slash-separated path matches the glob pattern,
+// which may contain "**" matching zero or more path segments as well as
+// the wildcards of path.Match in each segment.
+// As in .gitignore, a pattern without a slash (other than a trailing one) matches at any directory level,
+// a pattern matching a directory matches the files beneath it, and
+// a pattern with a trailing slash matches only directories.
+func matchPath(pattern, p string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	patSegs := strings.Split(pattern, "/")
+	pathSegs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+
+	starts := 1
+	if !anchored {
+		starts = len(pathSegs)
+	}
+
+	for i := 0; i < starts; i++ {
+		for j := i + 1; j <= len(pathSegs); j++ {
+			if dirOnly && j == len(pathSegs) {
+				continue
+			}
+			if matchSegments(patSegs, pathSegs[i:j]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches any number of segments.
+func matchSegments(pat, segs []string) bool {
+	if len(pat) == 0 {
+		return len(segs) == 0
+	}
+
+	if pat[0] == "**" {
+		for k := 0; k <= len(segs); k++ {
+			if matchSegments(pat[1:], segs[k:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segs) == 0 {
+		return false
+	}
+
+	ok, err := path.Match(pat[0], segs[0])
+	if err != nil || !ok {
+		return false
+	}
+
+	return matchSegments(pat[1:], segs[1:])
+}
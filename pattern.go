@@ -0,0 +1,631 @@
+package gen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// Bindings maps the names of type variables to the concrete types bound to them.
+// Length variables of array patterns, e.g. N of [N]T, are bound to ArrayLen values.
+type Bindings map[string]types.Type
+
+// ArrayLen is the length of an array type bound to a length variable, e.g. N of [N]T.
+// It is not a Go type, but implements types.Type to be held in Bindings.
+type ArrayLen int64
+
+// Underlying returns n itself.
+func (n ArrayLen) Underlying() types.Type { return n }
+
+// String returns the length as a decimal literal.
+func (n ArrayLen) String() string { return strconv.FormatInt(int64(n), 10) }
+
+// String returns the bindings like "K=string, V=int" sorted by the type variable names.
+func (m Bindings) String() string {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bindings := make([]string, len(names))
+	for i, name := range names {
+		bindings[i] = name + "=" + m[name].String()
+	}
+
+	return strings.Join(bindings, ", ")
+}
+
+// TypePattern is a type which may contain type variables, e.g. map[string]T,
+// which matches concrete types by binding them to the type variables.
+type TypePattern struct {
+	// Type is the pattern type.
+	Type types.Type
+
+	// isVar reports whether a named type is a type variable.
+	// If nil, the empty interfaces with all-uppercase names are.
+	isVar func(*types.Named) bool
+
+	// matchLen tells whether array patterns match only the arrays of the same lengths.
+	matchLen bool
+
+	// lenVars maps the array types in the pattern whose lengths are length variables to their names.
+	lenVars map[*types.Array]string
+
+	// matchMethods tells whether interface patterns match the types which have the methods of them.
+	matchMethods bool
+
+	// mode controls how the named types in the input types are matched.
+	mode MatchMode
+}
+
+// ParseTypePattern parses src as a type expression into a TypePattern, like ParsePattern,
+// but the identifiers with all-uppercase names which are not predeclared, e.g. T or K, are the type variables.
+func ParseTypePattern(src string) (*TypePattern, error) {
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type pattern %q: %s", src, err)
+	}
+
+	vars := []string{}
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Ident:
+			if node.Name == strings.ToUpper(node.Name) && types.Universe.Lookup(node.Name) == nil {
+				vars = append(vars, node.Name)
+			}
+		}
+		return true
+	})
+
+	return ParsePattern(src, vars...)
+}
+
+// ParsePattern parses src as a type expression into a TypePattern whose type variables are vars,
+// e.g. ParsePattern("map[K]V", "K", "V").
+// Variables used as array lengths are length variables, e.g. N of ParsePattern("[N]T", "N", "T"),
+// which are bound to the lengths of the arrays. Other array patterns match only the arrays of the same lengths.
+// Interface patterns, e.g. interface{ Get() T }, match the types which have the methods of them.
+// Qualified identifiers refer to the packages imported by their names, e.g. io.Reader,
+// which must be importable by the path same as the name.
+func ParsePattern(src string, vars ...string) (*TypePattern, error) {
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type pattern %q: %s", src, err)
+	}
+
+	isDeclared := map[string]bool{}
+	for _, name := range vars {
+		isDeclared[name] = true
+	}
+
+	imports := map[string]bool{}
+	isLen := map[string]bool{}
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := node.X.(*ast.Ident); ok {
+				imports[x.Name] = true
+			}
+		case *ast.ArrayType:
+			if n, ok := node.Len.(*ast.Ident); ok && isDeclared[n.Name] {
+				isLen[n.Name] = true
+			}
+		}
+		return true
+	})
+
+	file := &ast.File{Name: ast.NewIdent("pattern")}
+
+	paths := []string{}
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file.Decls = append(file.Decls, &ast.GenDecl{
+			Tok: token.IMPORT,
+			Specs: []ast.Spec{
+				&ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", path)}},
+			},
+		})
+	}
+
+	for name := range isDeclared {
+		if isLen[name] {
+			file.Decls = append(file.Decls, &ast.GenDecl{
+				Tok: token.CONST,
+				Specs: []ast.Spec{
+					&ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent(name)}, Values: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}}},
+				},
+			})
+			continue
+		}
+
+		file.Decls = append(file.Decls, &ast.GenDecl{
+			Tok: token.TYPE,
+			Specs: []ast.Spec{
+				&ast.TypeSpec{Name: ast.NewIdent(name), Type: &ast.InterfaceType{Methods: &ast.FieldList{}}},
+			},
+		})
+	}
+
+	file.Decls = append(file.Decls, &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{
+			&ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent("_")}, Type: expr},
+		},
+	})
+
+	conf := loader.Config{Fset: token.NewFileSet(), SourceImports: true}
+	conf.CreateFromFiles("pattern", file)
+
+	prog, err := conf.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid type pattern %q: %s", src, err)
+	}
+
+	pkg := prog.Created[0]
+	isVar := func(t *types.Named) bool {
+		return t.Obj().Pkg() == pkg.Pkg && isDeclared[t.Obj().Name()]
+	}
+
+	return &TypePattern{
+		Type:         pkg.TypeOf(expr),
+		isVar:        isVar,
+		matchLen:     true,
+		lenVars:      lengthVariables(expr, &pkg.Info),
+		matchMethods: true,
+	}, nil
+}
+
+// lengthVariables returns the array types in the type expression expr whose lengths are length variables,
+// constants with names of an uppercase letter followed by digits like N or N1, mapped to their names.
+func lengthVariables(expr ast.Expr, info *types.Info) map[*types.Array]string {
+	lenVars := map[*types.Array]string{}
+	ast.Inspect(expr, func(node ast.Node) bool {
+		at, ok := node.(*ast.ArrayType)
+		if !ok {
+			return true
+		}
+
+		if n, ok := at.Len.(*ast.Ident); ok {
+			if c, ok := info.Uses[n].(*types.Const); ok && lengthVariableName.MatchString(c.Name()) {
+				if array, ok := info.TypeOf(at).(*types.Array); ok {
+					lenVars[array] = c.Name()
+				}
+			}
+		}
+
+		return true
+	})
+
+	return lenVars
+}
+
+var lengthVariableName = regexp.MustCompile(`^[A-Z][0-9]*$`)
+
+// Match matches the type in against the pattern and returns the types bound to the type variables.
+// A type variable declared as a non-empty interface with a comment of "// +tsgen typevar",
+// e.g. type T interface{ io.Reader }, is bounded and matches only the types implementing it.
+func (p *TypePattern) Match(in types.Type) (Bindings, bool) {
+	m, _ := p.match(in)
+	return m, m != nil
+}
+
+// match is like Match, but returns nil bindings if not matched,
+// along with the reasons why the type variables could not be bound if any.
+func (p *TypePattern) match(in types.Type) (Bindings, []matchFailure) {
+	mt := &typeMatcher{isVar: p.isVar, matchLen: p.matchLen, lenVars: p.lenVars, matchMethods: p.matchMethods, mode: p.mode}
+	if mt.isVar == nil {
+		mt.isVar = isTypeVariableName
+	}
+
+	m := Bindings{}
+	if !mt.match(p.Type, in, m) {
+		return nil, mt.violations
+	}
+
+	return m, nil
+}
+
+// String returns the pattern type as a string.
+func (p *TypePattern) String() string {
+	return p.Type.String()
+}
+
+// isTypeVariableName reports whether t is an empty interface with an all-uppercase name.
+// Bounded type variables, non-empty interfaces, are not recognized by their names
+// but must be declared with a comment of "// +tsgen typevar", as ordinary interfaces may be named like I or R.
+func isTypeVariableName(t *types.Named) bool {
+	it, ok := t.Underlying().(*types.Interface)
+	if !ok || !it.Empty() {
+		return false
+	}
+
+	name := t.Obj().Name()
+	return name == strings.ToUpper(name)
+}
+
+// typeMatcher matches types against patterns, where named types for which isVar returns true are type variables.
+type typeMatcher struct {
+	isVar func(*types.Named) bool
+
+	// matchLen, lenVars, matchMethods and mode are those of TypePattern.
+	matchLen     bool
+	lenVars      map[*types.Array]string
+	matchMethods bool
+	mode         MatchMode
+
+	// violations are the reasons why types which matched type variables could not be bound to them,
+	// e.g. not satisfying their bounds.
+	violations []matchFailure
+}
+
+// matchFailure explains why a type did not match a pattern where it might be unexpected,
+// a boundViolation, a bindingConflict, an occursViolation or a directionMismatch.
+type matchFailure interface {
+	String() string
+}
+
+// boundViolation is a type which matched a bounded type variable but does not implement the bound.
+type boundViolation struct {
+	typeVar *types.Named
+	typ     types.Type
+}
+
+func (v boundViolation) String() string {
+	return fmt.Sprintf("%s does not satisfy the bound %s of type variable %s", v.typ, v.typeVar.Underlying(), v.typeVar.Obj().Name())
+}
+
+// bindingConflict is a type which matched a type variable, or a length of arrays which matched a length variable,
+// already bound to another one in the same pattern, e.g. string for T of map[T]T against map[int]string.
+type bindingConflict struct {
+	name       string
+	bound, typ types.Type
+}
+
+func (c bindingConflict) String() string {
+	return fmt.Sprintf("%s is bound to both %s and %s", c.name, c.bound, c.typ)
+}
+
+// typeVariableBound returns the bound of the type variable t, which is the interface it is declared as
+// if it has any methods, or nil if t is unbounded.
+func typeVariableBound(t *types.Named) *types.Interface {
+	if iface, ok := t.Underlying().(*types.Interface); ok && !iface.Empty() {
+		return iface
+	}
+
+	return nil
+}
+
+// match matches in against the pattern type pat, recording the types bound to the type variables in m.
+// Named types in in are matched according to mt.mode.
+func (mt *typeMatcher) match(pat, in types.Type, m Bindings) bool {
+	named, ok := in.(*types.Named)
+	if !ok {
+		return mt.matchType(pat, in, m)
+	}
+
+	switch mt.mode {
+	case MatchUnderlying:
+		return mt.matchType(pat, named.Underlying(), m)
+
+	case MatchEither:
+		saved := Bindings{}
+		for name, t := range m {
+			saved[name] = t
+		}
+
+		if mt.matchType(pat, named, m) {
+			return true
+		}
+
+		// Restore the bindings possibly made by the failed match
+		for name := range m {
+			delete(m, name)
+		}
+		for name, t := range saved {
+			m[name] = t
+		}
+
+		return mt.matchType(pat, named.Underlying(), m)
+
+	default:
+		return mt.matchType(pat, named, m)
+	}
+}
+
+// matchType is the body of match, which matches in as is.
+func (mt *typeMatcher) matchType(pat, in types.Type, m Bindings) bool {
+	switch pat := pat.(type) {
+	case *types.Array:
+		in, ok := in.(*types.Array)
+		if !ok {
+			return false
+		}
+
+		if mt.matchLen {
+			if name, ok := mt.lenVars[pat]; ok {
+				if bound, ok := m[name]; ok && bound != ArrayLen(in.Len()) {
+					mt.violations = append(mt.violations, bindingConflict{name: name, bound: bound, typ: ArrayLen(in.Len())})
+					return false
+				}
+				m[name] = ArrayLen(in.Len())
+			} else if pat.Len() != in.Len() {
+				return false
+			}
+		}
+
+		return mt.match(pat.Elem(), in.Elem(), m)
+
+	case *types.Basic:
+		return types.Identical(pat, in)
+
+	case *types.Chan:
+		in, ok := in.(*types.Chan)
+		if !ok {
+			return false
+		}
+
+		// The direction is a part of the type, so chan int does not match <-chan T, nor vice versa
+		if pat.Dir() != in.Dir() {
+			mt.violations = append(mt.violations, directionMismatch{pat: pat, typ: in})
+			return false
+		}
+
+		return mt.match(pat.Elem(), in.Elem(), m)
+
+	case *types.Interface:
+		if mt.matchMethods && pat.NumMethods() > 0 {
+			return mt.matchMethodSet(pat, in, m)
+		}
+
+		in, ok := in.(*types.Interface)
+		if !ok {
+			return false
+		}
+
+		// XXX is it OK?
+		return types.Identical(pat, in)
+
+	case *types.Map:
+		in, ok := in.(*types.Map)
+		if !ok {
+			return false
+		}
+
+		if !mt.match(pat.Key(), in.Key(), m) {
+			return false
+		}
+		if !mt.match(pat.Elem(), in.Elem(), m) {
+			return false
+		}
+
+		return true
+
+	case *types.Named:
+		if mt.isVar(pat) {
+			// A type variable appearing more than once must be bound to the identical types
+			name := pat.Obj().Name()
+			if bound, ok := m[name]; ok {
+				if !types.Identical(bound, in) {
+					mt.violations = append(mt.violations, bindingConflict{name: name, bound: bound, typ: in})
+					return false
+				}
+				return true
+			}
+
+			// in may be of the template itself, e.g. []T passed by a recursive call from a template clause
+			if occurs(pat, in) {
+				mt.violations = append(mt.violations, occursViolation{typeVar: pat, typ: in})
+				return false
+			}
+
+			if bound := typeVariableBound(pat); bound != nil && !types.Implements(in, bound) {
+				mt.violations = append(mt.violations, boundViolation{typeVar: pat, typ: in})
+				return false
+			}
+
+			m[name] = in
+			return true
+		}
+
+		return pat.String() == in.String()
+
+	case *types.Pointer:
+		in, ok := in.(*types.Pointer)
+		if !ok {
+			return false
+		}
+
+		return mt.match(pat.Elem(), in.Elem(), m)
+
+	case *types.Signature:
+		in, ok := in.(*types.Signature)
+		if !ok {
+			return false
+		}
+
+		// func(...T) matches only variadic functions, not func([]T)
+		if pat.Variadic() != in.Variadic() {
+			return false
+		}
+
+		if !mt.match(pat.Params(), in.Params(), m) {
+			return false
+		}
+
+		if !mt.match(pat.Results(), in.Results(), m) {
+			return false
+		}
+
+		return true
+
+	case *types.Slice:
+		in, ok := in.(*types.Slice)
+		if !ok {
+			return false
+		}
+
+		return mt.match(pat.Elem(), in.Elem(), m)
+
+	case *types.Struct:
+		in, ok := in.(*types.Struct)
+		if !ok {
+			return false
+		}
+
+		if pat.NumFields() != in.NumFields() {
+			return false
+		}
+
+		// The fields must agree in their names, embeddedness and tags, and their types are matched independently
+		for i := 0; i < pat.NumFields(); i++ {
+			pf, f := pat.Field(i), in.Field(i)
+			if pf.Anonymous() != f.Anonymous() || pat.Tag(i) != in.Tag(i) {
+				return false
+			}
+
+			// The name of an embedded type variable, e.g. T of struct{ T }, is of the type bound to it
+			if !(pf.Anonymous() && mt.isEmbeddedVar(pf.Type())) && pf.Id() != f.Id() {
+				return false
+			}
+
+			if !mt.match(pf.Type(), f.Type(), m) {
+				return false
+			}
+		}
+
+		return true
+
+	case *types.Tuple:
+		in, ok := in.(*types.Tuple)
+		if !ok {
+			return false
+		}
+
+		if pat.Len() != in.Len() {
+			return false
+		}
+
+		for i := 0; i < pat.Len(); i++ {
+			if !mt.match(pat.At(i).Type(), in.At(i).Type(), m) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		fmt.Printf("TODO: %#v\n", pat)
+		return false
+	}
+}
+
+// occursViolation is a type which matched a type variable but contains the type variable itself.
+type occursViolation struct {
+	typeVar *types.Named
+	typ     types.Type
+}
+
+func (v occursViolation) String() string {
+	return fmt.Sprintf("type variable %s cannot be bound to %s which contains itself", v.typeVar.Obj().Name(), v.typ)
+}
+
+// occurs reports whether the type variable v occurs in t.
+func occurs(v *types.Named, t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Named:
+		return t == v
+	case *types.Array:
+		return occurs(v, t.Elem())
+	case *types.Chan:
+		return occurs(v, t.Elem())
+	case *types.Map:
+		return occurs(v, t.Key()) || occurs(v, t.Elem())
+	case *types.Pointer:
+		return occurs(v, t.Elem())
+	case *types.Slice:
+		return occurs(v, t.Elem())
+	case *types.Signature:
+		return occurs(v, t.Params()) || occurs(v, t.Results())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if occurs(v, t.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if occurs(v, t.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			if occurs(v, t.Method(i).Type()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// directionMismatch is a channel type which did not match a channel pattern for their directions.
+type directionMismatch struct {
+	pat, typ *types.Chan
+}
+
+func (d directionMismatch) String() string {
+	return fmt.Sprintf("%s is %s, but the pattern %s is %s", d.typ, chanDirName(d.typ.Dir()), d.pat, chanDirName(d.pat.Dir()))
+}
+
+func chanDirName(dir types.ChanDir) string {
+	switch dir {
+	case types.SendOnly:
+		return "send-only"
+	case types.RecvOnly:
+		return "receive-only"
+	default:
+		return "bidirectional"
+	}
+}
+
+// isEmbeddedVar reports whether the embedded field type t is a type variable.
+func (mt *typeMatcher) isEmbeddedVar(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && mt.isVar(named)
+}
+
+// matchMethodSet matches in against the interface pattern pat structurally,
+// that is, the method set of in must have all the methods of pat with signatures matching theirs.
+func (mt *typeMatcher) matchMethodSet(pat *types.Interface, in types.Type, m Bindings) bool {
+	for i := 0; i < pat.NumMethods(); i++ {
+		fn := pat.Method(i)
+
+		obj, _, _ := types.LookupFieldOrMethod(in, false, fn.Pkg(), fn.Name())
+		method, ok := obj.(*types.Func)
+		if !ok {
+			return false
+		}
+
+		if !mt.match(fn.Type(), method.Type(), m) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,569 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTypePattern(t *testing.T) {
+	pat, err := ParseTypePattern("map[K]V")
+	require.NoError(t, err)
+
+	in, err := ParseTypePattern("map[string][]int")
+	require.NoError(t, err)
+
+	m, ok := pat.Match(in.Type)
+	require.True(t, ok)
+	assert.Equal(t, "K=string, V=[]int", m.String())
+
+	pat, err = ParseTypePattern("[]T")
+	require.NoError(t, err)
+
+	_, ok = pat.Match(in.Type)
+	assert.False(t, ok)
+
+	pat, err = ParseTypePattern("func(io.Reader) T")
+	require.NoError(t, err)
+
+	in, err = ParseTypePattern("func(io.Reader) error")
+	require.NoError(t, err)
+
+	m, ok = pat.Match(in.Type)
+	require.True(t, ok)
+	assert.Equal(t, "T=error", m.String())
+
+	_, err = ParseTypePattern("map[K]")
+	assert.Error(t, err)
+}
+
+func TestParsePattern(t *testing.T) {
+	pat, err := ParsePattern("map[Key]Value", "Key", "Value")
+	require.NoError(t, err)
+
+	in, err := ParsePattern("map[string]bool")
+	require.NoError(t, err)
+
+	m, ok := pat.Match(in.Type)
+	require.True(t, ok)
+	assert.Equal(t, "Key=string, Value=bool", m.String())
+
+	// T is not declared as a type variable
+	_, err = ParsePattern("[]T", "U")
+	assert.Error(t, err)
+}
+
+func TestParsePattern_Array(t *testing.T) {
+	pat, err := ParsePattern("[N]T", "N", "T")
+	require.NoError(t, err)
+
+	in, err := ParsePattern("[4]string")
+	require.NoError(t, err)
+
+	m, ok := pat.Match(in.Type)
+	require.True(t, ok)
+	assert.Equal(t, "N=4, T=string", m.String())
+	assert.Equal(t, ArrayLen(4), m["N"])
+
+	pat, err = ParsePattern("[3]T", "T")
+	require.NoError(t, err)
+
+	_, ok = pat.Match(in.Type)
+	assert.False(t, ok)
+}
+
+func TestTypePattern_match_Conflict(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		vars     []string
+		input    string
+		conflict string
+	}{
+		{"func(T) T", []string{"T"}, "func(int) string", "T is bound to both int and string"},
+		{"map[K]K", []string{"K"}, "map[string]bool", "K is bound to both string and bool"},
+		{"struct{ a, b T }", []string{"T"}, "struct{ a int; b string }", "T is bound to both int and string"},
+		{"[N][N]T", []string{"N", "T"}, "[2][3]int", "N is bound to both 2 and 3"},
+	}
+
+	for _, test := range tests {
+		pat, err := ParsePattern(test.pattern, test.vars...)
+		require.NoError(t, err)
+
+		in, err := ParsePattern(test.input)
+		require.NoError(t, err)
+
+		m, failures := pat.match(in.Type)
+		assert.Nil(t, m, test.pattern)
+		if assert.Len(t, failures, 1, test.pattern) {
+			assert.Equal(t, test.conflict, failures[0].String())
+		}
+	}
+}
+
+func TestTypePattern_match_Occurs(t *testing.T) {
+	pat, err := ParsePattern("[]T", "T")
+	require.NoError(t, err)
+
+	// [][]T, as passed by a recursive call from the template itself
+	m, failures := pat.match(types.NewSlice(pat.Type))
+	assert.Nil(t, m)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "type variable T cannot be bound to []pattern.T which contains itself", failures[0].String())
+}
+
+func TestTypePattern_match_ChanDir(t *testing.T) {
+	pat, err := ParsePattern("<-chan T", "T")
+	require.NoError(t, err)
+
+	in, err := ParsePattern("chan int")
+	require.NoError(t, err)
+
+	m, failures := pat.match(in.Type)
+	assert.Nil(t, m)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "chan int is bidirectional, but the pattern <-chan pattern.T is receive-only", failures[0].String())
+}
+
+func TestTypeSwitchStmt_Inflate(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/layout.go", nil, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("testdata", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	var sw *ast.TypeSwitchStmt
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node, ok := node.(*ast.TypeSwitchStmt); ok && sw == nil {
+			sw = node
+		}
+		return true
+	})
+	require.NotNil(t, sw)
+
+	in := types.NewMap(types.Typ[types.String], types.Typ[types.Bool])
+
+	g := New()
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	tmpl, m := g.FindMatchingTemplate(stmt, in)
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "T=bool", m.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, tmpl.Apply(m).List[0]))
+	assert.Equal(t, "map[string]bool", buf.String())
+
+	node := g.Inflate(stmt, []types.Type{in})
+	buf.Reset()
+	require.NoError(t, format.Node(&buf, fset, node.Body.List[0].(*ast.CaseClause).List[0]))
+	assert.Equal(t, "map[string]bool", buf.String())
+}
+
+func TestTemplate_Apply_KeyValue(t *testing.T) {
+	src := `package p
+
+type K interface{}
+type V interface{}
+
+type pair struct{ K int }
+
+func invert(m interface{}) interface{} {
+	switch m := m.(type) {
+	case map[K]V:
+		inverted := make(map[V]K, len(m))
+		for k, v := range m {
+			inverted[v] = k
+		}
+		_ = pair{}.K
+		return inverted
+	}
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[3].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	g := New()
+	tmpl, m := g.FindMatchingTemplate(stmt, types.NewMap(types.Typ[types.String], types.Typ[types.Int]))
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "K=string, V=int", m.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, tmpl.Apply(m)))
+	assert.Contains(t, buf.String(), "case map[string]int:")
+	assert.Contains(t, buf.String(), "make(map[int]string, len(m))")
+	assert.Contains(t, buf.String(), "pair{}.K")
+
+	_, m = g.FindMatchingTemplate(stmt, types.NewMap(types.Typ[types.String], types.Typ[types.String]))
+	assert.Equal(t, "K=string, V=string", m.String())
+}
+
+func TestTemplate_Apply_ArrayLen(t *testing.T) {
+	src := `package p
+
+const N = 0
+
+type T interface{}
+
+func sum(a interface{}) int {
+	switch a := a.(type) {
+	case [N]T:
+		n := 0
+		for i := 0; i < N; i++ {
+			_ = a[i]
+			n++
+		}
+		return n
+	}
+	return 0
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[2].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	g := New()
+	in := types.NewArray(types.Typ[types.Int], 3)
+
+	// without the feature, the length is not bound
+	tmpl, m := g.FindMatchingTemplate(stmt, in)
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "T=int", m.String())
+
+	g.Features = Features{FeatureArrays: true}
+	tmpl, m = g.FindMatchingTemplate(stmt, in)
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "N=3, T=int", m.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, tmpl.Apply(m)))
+	assert.Contains(t, buf.String(), "case [3]int:")
+	assert.Contains(t, buf.String(), "i < 3;")
+}
+
+func TestTemplate_Apply_Variadic(t *testing.T) {
+	src := `package p
+
+type T interface{}
+
+func call(f interface{}, args []interface{}) error {
+	switch f := f.(type) {
+	case func(...T) error:
+		xs := make([]T, len(args))
+		for i, arg := range args {
+			xs[i] = arg.(T)
+		}
+		return f(xs...)
+	}
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[1].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	variadic, err := ParsePattern("func(...string) error")
+	require.NoError(t, err)
+
+	nonVariadic, err := ParsePattern("func([]string) error")
+	require.NoError(t, err)
+
+	g := New()
+	tmpl, m := g.FindMatchingTemplate(stmt, variadic.Type)
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "T=string", m.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, tmpl.Apply(m)))
+	assert.Contains(t, buf.String(), "case func(...string) error:")
+	assert.Contains(t, buf.String(), "return f(xs...)")
+
+	tmpl, _ = g.FindMatchingTemplate(stmt, nonVariadic.Type)
+	assert.Nil(t, tmpl)
+}
+
+func TestFindMatchingTemplate_Interface(t *testing.T) {
+	src := `package p
+
+type T interface{}
+
+type box struct{ v int }
+
+func (b box) Get() int { return b.v }
+
+func unbox(x interface{}) interface{} {
+	switch x := x.(type) {
+	case interface{ Get() T }:
+		var v T = x.Get()
+		return v
+	}
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	pkg, err := conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[3].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	box := pkg.Scope().Lookup("box").Type()
+
+	g := New()
+	tmpl, _ := g.FindMatchingTemplate(stmt, box)
+	assert.Nil(t, tmpl, "interface patterns match only identical interfaces without the feature")
+
+	g.Features = Features{FeatureInterfaces: true}
+	tmpl, m := g.FindMatchingTemplate(stmt, box)
+	require.NotNil(t, tmpl)
+	assert.Equal(t, "T=int", m.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, tmpl.Apply(m)))
+	assert.Contains(t, buf.String(), "case interface{ Get() int }:")
+	assert.Contains(t, buf.String(), "var v int = x.Get()")
+
+	tmpl, _ = g.FindMatchingTemplate(stmt, types.NewPointer(box))
+	assert.NotNil(t, tmpl, "the method set of *box includes Get")
+
+	tmpl, _ = g.FindMatchingTemplate(stmt, types.Typ[types.Int])
+	assert.Nil(t, tmpl)
+}
+
+func TestTypeSwitchStmt_Inflate_MatchMode(t *testing.T) {
+	src := `package p
+
+type T interface{}
+
+type Temps []float64
+
+func first(x interface{}) interface{} {
+	switch x := x.(type) {
+	case []T:
+		var v T = x[0]
+		return v
+	}
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	pkg, err := conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[2].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	temps := pkg.Scope().Lookup("Temps").Type()
+
+	g := New()
+	g.Loader.Fset = fset
+	assert.Len(t, g.Inflate(stmt, []types.Type{temps}).Body.List, 1, "Temps does not match []T by name")
+
+	g.MatchMode = MatchEither
+	node := g.Inflate(stmt, []types.Type{temps})
+	require.Len(t, node.Body.List, 2)
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Node(&buf, fset, node.Body.List[0]))
+	assert.Contains(t, buf.String(), "case Temps:")
+	assert.Contains(t, buf.String(), "var v float64 = x[0]")
+}
+
+func TestTypeSwitchStmt_Inflate_Unions(t *testing.T) {
+	src := `package p
+
+type T interface{}
+
+func size(x interface{}) int {
+	switch x.(type) {
+	case []T, map[string]T:
+		var zero T
+		_ = zero
+		return 1
+	}
+	return 0
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[1].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	ins := []types.Type{
+		types.NewSlice(types.Typ[types.Int]),
+		types.NewMap(types.Typ[types.String], types.Typ[types.Int]),
+		types.NewMap(types.Typ[types.String], types.Typ[types.Bool]),
+	}
+
+	show := func(nodes []ast.Stmt) []string {
+		ss := []string{}
+		for _, node := range nodes {
+			exprs := []string{}
+			for _, e := range node.(*ast.CaseClause).List {
+				exprs = append(exprs, types.ExprString(e))
+			}
+			ss = append(ss, strings.Join(exprs, ", "))
+		}
+		return ss
+	}
+
+	g := New()
+	g.Loader.Fset = fset
+	assert.Len(t, g.Inflate(stmt, ins).Body.List, 1, "multi-type clauses are not templates without the feature")
+
+	g.Features = Features{FeatureUnions: true}
+	assert.Equal(t, []string{"[]int", "map[string]int", "map[string]bool", "[]T, map[string]T"}, show(g.Inflate(stmt, ins).Body.List))
+
+	g.MergeCases = true
+	assert.Equal(t, []string{"[]int, map[string]int", "map[string]bool", "[]T, map[string]T"}, show(g.Inflate(stmt, ins).Body.List))
+}
+
+func TestTypeSwitchStmt_Inflate_Hygiene(t *testing.T) {
+	src := `package p
+
+type T interface{}
+
+func count(x interface{}) int {
+	switch x := x.(type) {
+	case []T:
+		io := len(x)
+		var first T
+	loop:
+		for i := range x {
+			if i >= io {
+				break loop
+			}
+			first = x[i]
+		}
+		_ = first
+		return io
+	}
+	return 0
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	var conf types.Config
+	_, err = conf.Check("p", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	sw := file.Decls[1].(*ast.FuncDecl).Body.List[0].(*ast.TypeSwitchStmt)
+	stmt := NewTypeSwitchStmt(file, sw, info)
+
+	readers, err := ParsePattern("[]io.Reader")
+	require.NoError(t, err)
+
+	g := New()
+	g.Loader.Fset = fset
+	node := g.Inflate(stmt, []types.Type{types.NewSlice(types.Typ[types.Int]), readers.Type})
+	require.Len(t, node.Body.List, 3)
+
+	show := func(node ast.Node) string {
+		var buf bytes.Buffer
+		require.NoError(t, format.Node(&buf, fset, node))
+		return buf.String()
+	}
+
+	ints := show(node.Body.List[0])
+	assert.Contains(t, ints, "io := len(x)")
+	assert.Contains(t, ints, "loop_int:")
+	assert.Contains(t, ints, "break loop_int")
+
+	rs := show(node.Body.List[1])
+	assert.Contains(t, rs, "io_ := len(x)")
+	assert.Contains(t, rs, "var first io.Reader")
+	assert.Contains(t, rs, "if i >= io_ {")
+	assert.Contains(t, rs, "return io_")
+	assert.Contains(t, rs, "loop_io_Reader:")
+
+	assert.Contains(t, show(node.Body.List[2]), "loop:")
+}
@@ -0,0 +1,87 @@
+package gen
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+)
+
+// Version is the version of tsgen noted in the provenance comments, which can be set by the linker,
+// e.g. -ldflags "-X github.com/motemen/go-typeswitch-gen.Version=v1.2.3".
+// If empty, the version of the module in the build information is used.
+var Version = ""
+
+// modulePath is the path of the module of the package, to find its version in the build information.
+const modulePath = "github.com/motemen/go-typeswitch-gen"
+
+// maxProvenanceSites is the number of the call sites listed in a provenance comment.
+const maxProvenanceSites = 3
+
+// toolVersion returns Version, or the version of the module in the build information,
+// with its checksum if the module is a dependency. It returns "devel" if unknown.
+func toolVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+
+		for _, dep := range info.Deps {
+			if dep.Path != modulePath {
+				continue
+			}
+
+			if dep.Sum != "" {
+				return dep.Version + " " + dep.Sum
+			}
+			return dep.Version
+		}
+	}
+
+	return "devel"
+}
+
+// provenanceComment returns the comment noting where the clause generated from the template t
+// with the bindings m for the type in came from: the pattern and the bindings,
+// the call sites which passed in, and the version of tsgen.
+func (gen Gen) provenanceComment(stmt *TypeSwitchStmt, t *Template, m Bindings, in types.Type) string {
+	text := "// tsgen: from " + gen.showNode(t.Clause.List[t.index])
+	if len(m) > 0 {
+		text += " with " + m.String()
+	}
+
+	if stmt.sites != nil {
+		if pos := subjectParamPos(&stmt.info, stmt.sites.funcDecl, stmt); pos != -1 {
+			sites := []string{}
+			for _, p := range stmt.sites.having(pos, in).positions {
+				position := gen.Loader.Fset.PositionFor(p, false)
+				sites = append(sites, fmt.Sprintf("%s:%d", relativePath(position.Filename), position.Line))
+			}
+
+			if len(sites) > maxProvenanceSites {
+				sites = append(sites[:maxProvenanceSites], fmt.Sprintf("%d more", len(sites)-maxProvenanceSites))
+			}
+			if len(sites) > 0 {
+				text += ", called at " + strings.Join(sites, ", ")
+			}
+		}
+	}
+
+	return text + " (tsgen " + toolVersion() + ")"
+}
+
+// withProvenance returns text, the source of clause, preceded by its provenance comments recorded in stmt.
+func (gen Gen) withProvenance(stmt *TypeSwitchStmt, clause *ast.CaseClause, text string) string {
+	comments := stmt.provenance[clause]
+	if len(comments) == 0 {
+		return text
+	}
+
+	return strings.Join(comments, "\n") + "\n" + text
+}
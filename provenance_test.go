@@ -0,0 +1,58 @@
+package gen
+
+import (
+	"testing"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEdit_Provenance(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v0.0.0-test"
+
+	g := New()
+	g.Provenance = true
+	err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	var edits []sourceEdit
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		// the call sites of keys in main
+		sites := &callSites{funcDecl: fd}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == fd.Name.Name {
+					sites.args = append(sites.args, []types.Type{pkg.TypeOf(call.Args[0])})
+					sites.positions = append(sites.positions, call.Lparen)
+				}
+			}
+			return true
+		})
+
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info, sites: sites}
+		edit, ok, err := g.expandEdit(stmt, canonicalTypes(sites.typesAt(0)))
+		require.NoError(t, err)
+		require.True(t, ok)
+		edits = append(edits, edit)
+		return nil
+	})
+
+	err = g.editFileSource(file, edits)
+	require.NoError(t, err)
+
+	result := g.showNode(file)
+	t.Log(result)
+
+	assert.Contains(t, result, "// tsgen: from map[string]T with T=bool, called at testdata/layout.go:7 (tsgen v0.0.0-test)\n\tcase map[string]bool:")
+	assert.Contains(t, result, "// tsgen: from map[string]T with T=int, called at testdata/layout.go:6 (tsgen v0.0.0-test)\n\tcase map[string]int:")
+}
@@ -0,0 +1,139 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"go/ast"
+	"go/format"
+)
+
+// Region is a range of byte offsets in a file, e.g. the selection or the cursor of an editor.
+type Region struct {
+	Filename   string
+	Start, End int
+}
+
+// inRegion reports whether node of file overlaps g.Region, which is true for any node if g.Region is not set.
+// A node touching the region, e.g. a cursor at its end, overlaps it.
+func (g Gen) inRegion(file *ast.File, node ast.Node) bool {
+	if g.Region == nil {
+		return true
+	}
+
+	tf := g.tokenFile(file)
+	if !sameFile(tf.Name(), g.Region.Filename) {
+		return false
+	}
+
+	return tf.Offset(node.Pos()) <= g.Region.End && g.Region.Start <= tf.Offset(node.End())
+}
+
+// sameFile reports whether the names a and b refer to the same file.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// ExpandAt expands only the type switch enclosing the byte offset of the file filename,
+// directly inside a function declaration, as Expand does, and returns its new text without rewriting any file.
+// The text replaces the statement in the source, and with g.ErrorsAs, the errors.As checks preceding it as well,
+// formatted with the lines after the first indented as in the source. The imports the expanded cases need are not added.
+func (g Gen) ExpandAt(filename string, offset int) ([]byte, error) {
+	err := g.initProgram(needFuncBodies)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.CacheDir != "" {
+		g.cache, err = g.openAnalysisCache()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g.initRun()
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtOffset(filename, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	info := g.typeSwitchInfo(pkg, file, funcDecl, sw)
+	if !info.Expandable {
+		return nil, fmt.Errorf("%s: type switch is not expandable: %s", info.Pos, info.Reason)
+	}
+
+	tf := g.tokenFile(file)
+	g.Region = &Region{Filename: tf.Name(), Start: offset, End: offset}
+
+	edits, _, err := g.expandFileEdits(pkg, file, newFileImports(file, pkg.Pkg, &pkg.Info))
+	if err != nil {
+		return nil, err
+	}
+
+	if g.cache != nil {
+		err = g.cache.save()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(edits) == 0 {
+		src, err := g.fileSource(file)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte{}, src[tf.Offset(sw.Pos()):tf.Offset(sw.End())]...), nil
+	}
+
+	_, _, text, err := g.statementEdit(file, sw, edits[0])
+	return text, err
+}
+
+// statementEdit returns the range of the source of file replaced by edit of the type switch sw,
+// from the beginning of the edit or sw to the end of sw, and its new text formatted as a statement,
+// with the lines after the first indented as the line of sw.
+func (g Gen) statementEdit(file *ast.File, sw *ast.TypeSwitchStmt, edit sourceEdit) (int, int, []byte, error) {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	tf := g.tokenFile(file)
+	start, end := tf.Offset(sw.Pos()), tf.Offset(sw.End())
+
+	// the edit may begin before the switch with g.ErrorsAs
+	if edit.start < start {
+		start = edit.start
+	}
+
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	indent := src[lineStart:start]
+	for i, c := range indent {
+		if c != ' ' && c != '\t' {
+			indent = indent[:i]
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(indent)
+	buf.Write(src[start:edit.start])
+	buf.Write(edit.text)
+	buf.Write(src[edit.end:end])
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return start, end, bytes.TrimSpace(out), nil
+}
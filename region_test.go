@@ -0,0 +1,87 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src, err := ioutil.ReadFile("testdata/nested.go")
+	require.NoError(t, err)
+
+	cacheCallSites(t, dir, "testdata/nested.go", "add", [][]types.Type{
+		{types.Typ[types.Int], types.Typ[types.Int]},
+		{types.Typ[types.String], types.Typ[types.String]},
+	})
+
+	g := New()
+	g.CacheDir = dir
+	err = g.Loader.CreateFromFilenames("", "testdata/nested.go")
+	require.NoError(t, err)
+
+	text, err := g.ExpandAt("testdata/nested.go", bytes.Index(src, []byte("case B:")))
+	require.NoError(t, err)
+
+	t.Log(string(text))
+
+	assert.True(t, bytes.HasPrefix(text, []byte("switch a := a.(type) {")))
+	assert.True(t, bytes.HasSuffix(text, []byte("}")))
+	assert.Contains(t, string(text), "case int:\n\t\tswitch b := b.(type) {")
+	assert.Contains(t, string(text), "case string:")
+
+	_, err = g.ExpandAt("testdata/nested.go", bytes.Index(src, []byte("add(1, 2)")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no type switch found at offset")
+}
+
+// cacheCallSites stores in the analysis cache in dir the call sites of the function of name in filename
+// with the argument types args, so that the tests expand it without analyzing the program.
+func cacheCallSites(t *testing.T, dir, filename, name string, args [][]types.Type) {
+	cacheCallSitesOf(t, dir, []string{filename}, map[string][][]types.Type{name: args})
+}
+
+// cacheCallSitesOf is like cacheCallSites, but for the functions of the names of args
+// in the package of filenames.
+func cacheCallSitesOf(t *testing.T, dir string, filenames []string, args map[string][][]types.Type) {
+	g := New()
+	g.CacheDir = dir
+	err := g.Loader.CreateFromFilenames("", filenames...)
+	require.NoError(t, err)
+	require.NoError(t, g.load())
+
+	c, err := g.openAnalysisCache()
+	require.NoError(t, err)
+
+	for _, file := range g.program.Created[0].Files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			sites, ok := args[funcDecl.Name.Name]
+			if !ok {
+				continue
+			}
+
+			positions := []token.Pos{}
+			for range sites {
+				positions = append(positions, funcDecl.Pos())
+			}
+			c.put(g.Loader.Fset, funcDecl, &callSites{funcDecl: funcDecl, args: sites, positions: positions})
+		}
+	}
+	require.NoError(t, c.save())
+}
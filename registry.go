@@ -0,0 +1,238 @@
+package gen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// Registry designates the type switches expanded by the types registered by the calls of a registration function,
+// e.g. gob.Register(T{}) or RegisterHandler(new(T)). Plugin-style programs register their types so and use them
+// through reflection or the like, which the call graph by pointer analysis does not pass to the type switches.
+type Registry struct {
+	// Func is the registration function, named as the entries of Gen.FuncFilter are, e.g. encoding/gob.Register.
+	Func string
+
+	// Arg is the index of the argument of the calls of Func whose static type is registered.
+	Arg int
+
+	// Switches are the functions whose type switches are expanded by the types registered, named as
+	// the entries of Gen.FuncFilter are. The types are taken as passed to every parameter of an interface type
+	// of the functions, at the positions of the registration calls. If empty, all the functions are designated.
+	Switches []string
+}
+
+// ParseRegistry parses a registry specified as func[:arg][=switch], e.g. "encoding/gob.Register=lib.Decode",
+// designating the type switches of the function switch, or all the functions if omitted,
+// for the types passed as the argument of index arg, or 0 if omitted, of the calls of func.
+func ParseRegistry(s string) (Registry, error) {
+	r := Registry{Func: s}
+
+	if i := strings.Index(s, "="); i != -1 {
+		r.Func = s[:i]
+		r.Switches = []string{s[i+1:]}
+	}
+
+	if i := strings.LastIndex(r.Func, ":"); i != -1 {
+		n, err := strconv.Atoi(r.Func[i+1:])
+		if err != nil {
+			return Registry{}, fmt.Errorf("invalid argument index of registry %q: %s", s, err)
+		}
+		r.Func, r.Arg = r.Func[:i], n
+	}
+
+	return r, r.check()
+}
+
+// check reports the errors in the configuration of r.
+func (r Registry) check() error {
+	if r.Func == "" {
+		return fmt.Errorf("registry without a registration function")
+	}
+
+	if r.Arg < 0 {
+		return fmt.Errorf("negative argument index of registry %s: %d", r.Func, r.Arg)
+	}
+
+	if err := checkFuncFilterEntry(r.Func); err != nil {
+		return err
+	}
+
+	for _, sw := range r.Switches {
+		if err := checkFuncFilterEntry(sw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// designates reports whether r designates the type switches of fn.
+func (r Registry) designates(fn *types.Func) bool {
+	if len(r.Switches) == 0 {
+		return true
+	}
+
+	for _, sw := range r.Switches {
+		if matchesFunc(sw, fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registration is a type registered by a call of the function of a registry.
+type registration struct {
+	typ types.Type
+
+	// pos is the position of the left parenthesis of the call.
+	pos token.Pos
+}
+
+// registeredTypes holds the types registered by the calls of the functions of Gen.Registries,
+// found once in a run on the first use.
+type registeredTypes struct {
+	once sync.Once
+
+	// byRegistry[i] are the types registered with g.Registries[i].
+	byRegistry [][]registration
+}
+
+// registrations returns the types registered by the calls in the program, by the indices of g.Registries.
+func (g Gen) registrations() [][]registration {
+	if g.registered == nil {
+		return g.findRegistrations()
+	}
+
+	g.registered.once.Do(func() {
+		g.registered.byRegistry = g.findRegistrations()
+	})
+
+	return g.registered.byRegistry
+}
+
+// findRegistrations finds the calls of the functions of g.Registries in the program.
+func (g Gen) findRegistrations() [][]registration {
+	byRegistry := make([][]registration, len(g.Registries))
+
+	for _, pkg := range g.program.AllPackages {
+		info := &pkg.Info
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				call, ok := node.(*ast.CallExpr)
+				if !ok || call.Ellipsis != token.NoPos {
+					return true
+				}
+
+				fn := calledFunc(info, call)
+				if fn == nil {
+					return true
+				}
+
+				for i, r := range g.Registries {
+					if r.Arg >= len(call.Args) || !matchesFunc(r.Func, fn) {
+						continue
+					}
+
+					t := info.TypeOf(call.Args[r.Arg])
+					if t == nil || types.IsInterface(t) {
+						g.log(file, call, "type registered by %s is not static", g.showNode(call.Args[r.Arg]))
+						continue
+					}
+
+					byRegistry[i] = append(byRegistry[i], registration{typ: t, pos: call.Lparen})
+				}
+
+				return true
+			})
+		}
+	}
+
+	return byRegistry
+}
+
+// calledFunc returns the function or method called by call statically, or nil if not.
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := call.Fun
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		fn, _ := info.Uses[fun].(*types.Func)
+		return fn
+
+	case *ast.SelectorExpr:
+		fn, _ := info.Uses[fun.Sel].(*types.Func)
+		return fn
+	}
+
+	return nil
+}
+
+// registeredSite is a registration of a type as if passed to the parameters of a function at a call site.
+type registeredSite struct {
+	// args[i] is the type registered if the i-th parameter is of an interface it implements, or nil.
+	args []types.Type
+
+	pos token.Pos
+
+	// registry is the registration function.
+	registry string
+}
+
+// registeredSites returns the types registered with the registries designating funcDecl of pkg,
+// as if passed to every parameter of an interface type of it at the registration calls.
+func (g Gen) registeredSites(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl) []registeredSite {
+	if len(g.Registries) == 0 {
+		return nil
+	}
+
+	fn, ok := pkg.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return nil
+	}
+
+	params := fn.Type().(*types.Signature).Params()
+
+	sites := []registeredSite{}
+	for i, regs := range g.registrations() {
+		if !g.Registries[i].designates(fn) {
+			continue
+		}
+
+		for _, reg := range regs {
+			args := make([]types.Type, params.Len())
+			for j := range args {
+				iface, ok := params.At(j).Type().Underlying().(*types.Interface)
+				if ok && types.Implements(reg.typ, iface) {
+					args[j] = reg.typ
+				}
+			}
+
+			sites = append(sites, registeredSite{args: args, pos: reg.pos, registry: g.Registries[i].Func})
+		}
+	}
+
+	return sites
+}
+
+// addRegisteredTypes adds to cs the types registered for funcDecl of pkg, as if passed by other call sites at the registration calls.
+func (g Gen) addRegisteredTypes(pkg *loader.PackageInfo, funcDecl *ast.FuncDecl, cs *callSites) {
+	for _, site := range g.registeredSites(pkg, funcDecl) {
+		cs.args = append(cs.args, site.args)
+		cs.positions = append(cs.positions, site.pos)
+	}
+}
@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRegistry(t *testing.T) {
+	r, err := ParseRegistry("encoding/gob.Register")
+	require.NoError(t, err)
+	assert.Equal(t, Registry{Func: "encoding/gob.Register"}, r)
+
+	r, err = ParseRegistry("(*Mux).Handle:1=lib.(*Mux).ServeHTTP")
+	require.NoError(t, err)
+	assert.Equal(t, Registry{Func: "(*Mux).Handle", Arg: 1, Switches: []string{"lib.(*Mux).ServeHTTP"}}, r)
+
+	_, err = ParseRegistry("Register:x")
+	assert.Error(t, err)
+
+	_, err = ParseRegistry("=handle")
+	assert.Error(t, err)
+
+	_, err = ParseRegistry("re:(")
+	assert.Error(t, err)
+}
+
+func TestExpand_Registries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// no call sites
+	cacheCallSites(t, dir, "testdata/registry.go", "handle", [][]types.Type{})
+
+	g := New()
+	g.CacheDir = dir
+	g.Registries = []Registry{
+		{Func: "Register"},
+		{Func: "RegisterHandler", Arg: 1, Switches: []string{"handle"}},
+		{Func: "RegisterHandler", Arg: 1, Switches: []string{"other"}},
+	}
+	err = g.Loader.CreateFromFilenames("", "testdata/registry.go")
+	require.NoError(t, err)
+
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/registry.go"])
+	t.Log(out)
+
+	assert.Contains(t, out, "case *Point:")
+	assert.Contains(t, out, "case *Line:")
+	assert.Contains(t, out, "case Circle:")
+	assert.NotContains(t, out, "case Point:")
+
+	g = New()
+	g.Registries = []Registry{{Func: "Register", Switches: []string{"re:("}}}
+	err = g.Loader.CreateFromFilenames("", "testdata/registry.go")
+	require.NoError(t, err)
+	_, err = g.ExpandBytes()
+	assert.Error(t, err)
+}
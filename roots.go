@@ -0,0 +1,272 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/parser"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/types"
+)
+
+// rootsPkgPath and rootsFilename are the path and the file name of the synthetic main package
+// calling the functions of Gen.Roots. The file is added to the file set of the program, but not on disk.
+const (
+	rootsPkgPath  = "tsgen/roots"
+	rootsFilename = "tsgen_roots.go"
+)
+
+// rootFuncs returns the functions of the program named by g.Roots, in the order of their positions.
+// Each root must name at least one exported function, or an exported method of an exported type,
+// whose parameters are of the types which can be named out of its package. The functions of the patterns
+// like lib.* which cannot be called so are skipped.
+func (g Gen) rootFuncs() ([]*types.Func, error) {
+	funcs := []*types.Func{}
+	for _, root := range g.Roots {
+		pattern := strings.HasPrefix(root, regexpPrefix) || strings.HasSuffix(root, ".*")
+
+		found := false
+		for _, pkg := range g.program.AllPackages {
+			for _, obj := range pkg.Defs {
+				fn, ok := obj.(*types.Func)
+				if !ok || !matchesRoot(root, fn) || containsFunc(funcs, fn) {
+					continue
+				}
+
+				if err := checkRoot(fn); err != nil {
+					if pattern {
+						continue
+					}
+					return nil, fmt.Errorf("cannot use %s as a root: %s", root, err)
+				}
+
+				funcs = append(funcs, fn)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("root %s does not name any function of the program to be called", root)
+		}
+	}
+
+	sort.Sort(byFuncPos(funcs))
+
+	return funcs, nil
+}
+
+// matchesRoot reports whether root, an entry of Gen.Roots, matches the function fn as FuncFilter does.
+// The methods of pointer receivers are matched by T.Method too, e.g. lib.Worker.Run for (*Worker).Run.
+func matchesRoot(root string, fn *types.Func) bool {
+	if matchesFunc(root, fn) {
+		return true
+	}
+
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil || fn.Pkg() == nil {
+		return false
+	}
+
+	p, ok := recv.Type().(*types.Pointer)
+	if !ok {
+		return false
+	}
+
+	name := types.TypeString(p.Elem(), func(*types.Package) string { return "" }) + "." + fn.Name()
+	return root == name || root == fn.Pkg().Name()+"."+name || root == fn.Pkg().Path()+"."+name
+}
+
+// checkRoot reports why fn cannot be called from the synthetic main package, if it cannot.
+func checkRoot(fn *types.Func) error {
+	if !fn.Exported() {
+		return fmt.Errorf("%s is unexported", fn.Name())
+	}
+
+	sig := fn.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		t := recv.Type()
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+
+		named, ok := t.(*types.Named)
+		if !ok || !named.Obj().Exported() {
+			return fmt.Errorf("the receiver of %s is not of an exported type", fn.Name())
+		}
+		if types.IsInterface(named) {
+			return fmt.Errorf("%s is a method of interface %s", fn.Name(), named.Obj().Name())
+		}
+	}
+
+	for i := 0; i < sig.Params().Len(); i++ {
+		if name := unexportedName(sig.Params().At(i).Type()); name != "" {
+			return fmt.Errorf("parameter %d of %s refers to unexported %s", i, fn.Name(), name)
+		}
+	}
+
+	return nil
+}
+
+// unexportedName returns the name of an unexported type or struct field in t, which cannot be named
+// out of its package, or "" if none.
+func unexportedName(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && !obj.Exported() {
+			return obj.Name()
+		}
+	case *types.Pointer:
+		return unexportedName(t.Elem())
+	case *types.Slice:
+		return unexportedName(t.Elem())
+	case *types.Array:
+		return unexportedName(t.Elem())
+	case *types.Chan:
+		return unexportedName(t.Elem())
+	case *types.Map:
+		if name := unexportedName(t.Key()); name != "" {
+			return name
+		}
+		return unexportedName(t.Elem())
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				if name := unexportedName(tuple.At(i).Type()); name != "" {
+					return name
+				}
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if !t.Field(i).Exported() {
+				return t.Field(i).Name()
+			}
+			if name := unexportedName(t.Field(i).Type()); name != "" {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// rootsSource returns the source of the synthetic main package, whose main function calls each of funcs
+// with the zero values of its parameters, e.g. r0.HandleRequest(*new(r0.Request)), and the methods on new values
+// of their receiver types, e.g. new(r0.Worker).Run().
+func rootsSource(funcs []*types.Func) []byte {
+	names := map[*types.Package]string{}
+	paths := []string{}
+	qualifier := func(pkg *types.Package) string {
+		if _, ok := names[pkg]; !ok {
+			names[pkg] = "r" + strconv.Itoa(len(names))
+			paths = append(paths, pkg.Path())
+		}
+		return names[pkg]
+	}
+
+	var body bytes.Buffer
+	for _, fn := range funcs {
+		sig := fn.Type().(*types.Signature)
+
+		callee := qualifier(fn.Pkg()) + "." + fn.Name()
+		if recv := sig.Recv(); recv != nil {
+			if p, ok := recv.Type().(*types.Pointer); ok {
+				callee = fmt.Sprintf("new(%s).%s", types.TypeString(p.Elem(), qualifier), fn.Name())
+			} else {
+				callee = fmt.Sprintf("(*new(%s)).%s", types.TypeString(recv.Type(), qualifier), fn.Name())
+			}
+		}
+
+		args := []string{}
+		for i := 0; i < sig.Params().Len(); i++ {
+			args = append(args, fmt.Sprintf("*new(%s)", types.TypeString(sig.Params().At(i).Type(), qualifier)))
+		}
+		if sig.Variadic() {
+			args[len(args)-1] += "..."
+		}
+
+		fmt.Fprintf(&body, "\t%s(%s)\n", callee, strings.Join(args, ", "))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("package main\n\nimport (\n")
+	for i, path := range paths {
+		fmt.Fprintf(&buf, "\tr%d %q\n", i, path)
+	}
+	fmt.Fprintf(&buf, ")\n\nfunc main() {\n%s}\n", body.String())
+
+	return buf.Bytes()
+}
+
+// rootsPackage creates the SSA package of the synthetic main package calling the functions of g.Roots,
+// type-checked against the packages of the program, to be the main package of pointer analysis.
+func (g Gen) rootsPackage() (*ssa.Package, error) {
+	funcs, err := g.rootFuncs()
+	if err != nil {
+		return nil, err
+	}
+
+	src := rootsSource(funcs)
+	g.log(nil, nil, "synthetic main package of the roots:\n%s", src)
+
+	file, err := parser.ParseFile(g.Loader.Fset, rootsFilename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Implicits:  map[ast.Node]types.Object{},
+		Scopes:     map[ast.Node]*types.Scope{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+
+	conf := types.Config{Importer: programImporter{g}}
+	pkg, err := conf.Check(rootsPkgPath, g.Loader.Fset, []*ast.File{file}, info)
+	if err != nil {
+		return nil, fmt.Errorf("cannot call the roots: %s", err)
+	}
+
+	ssaPkg := g.ssaProgram.CreatePackage(pkg, []*ast.File{file}, info, false)
+	ssaPkg.Build()
+
+	return ssaPkg, nil
+}
+
+// programImporter imports the packages of the program loaded by g, so that the objects are shared with it.
+type programImporter struct {
+	g Gen
+}
+
+func (imp programImporter) Import(path string) (*types.Package, error) {
+	for pkg := range imp.g.program.AllPackages {
+		if pkg.Path() == path {
+			return pkg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("package %s is not in the program", path)
+}
+
+// containsFunc reports whether funcs has fn.
+func containsFunc(funcs []*types.Func, fn *types.Func) bool {
+	for _, f := range funcs {
+		if f == fn {
+			return true
+		}
+	}
+
+	return false
+}
+
+type byFuncPos []*types.Func
+
+func (s byFuncPos) Len() int           { return len(s) }
+func (s byFuncPos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFuncPos) Less(i, j int) bool { return s[i].Pos() < s[j].Pos() }
@@ -0,0 +1,76 @@
+package gen
+
+import (
+	"testing"
+
+	"go/ast"
+	"go/parser"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootFuncs(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/roots.go")
+	require.NoError(t, err)
+	require.NoError(t, g.load())
+
+	roots := func(names ...string) ([]string, error) {
+		g.Roots = names
+		funcs, err := g.rootFuncs()
+		if err != nil {
+			return nil, err
+		}
+
+		s := []string{}
+		for _, fn := range funcs {
+			s = append(s, funcNames(fn)[0])
+		}
+		return s, nil
+	}
+
+	names, err := roots("server.HandleRequest", "server.Worker.Run")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HandleRequest", "(*Worker).Run"}, names)
+
+	// the unexported ones are skipped by the patterns
+	names, err = roots("server.*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HandleRequest", "(*Worker).Run", "Worker.String"}, names)
+
+	_, err = roots("handle")
+	require.Error(t, err)
+	assert.Equal(t, "cannot use handle as a root: handle is unexported", err.Error())
+
+	_, err = roots("Serve")
+	require.Error(t, err)
+	assert.Equal(t, "root Serve does not name any function of the program to be called", err.Error())
+
+	g.Roots = []string{"server.HandleRequest", "(*Worker).Run", "Worker.String"}
+	funcs, err := g.rootFuncs()
+	require.NoError(t, err)
+
+	src := rootsSource(funcs)
+	assert.Equal(t, `package main
+
+import (
+	r0 "server"
+)
+
+func main() {
+	r0.HandleRequest(*new(*r0.Request), *new([]string)...)
+	new(r0.Worker).Run()
+	(*new(r0.Worker)).String()
+}
+`, string(src))
+
+	// the synthetic main package is type-checked against the packages of the program
+	file, err := parser.ParseFile(g.Loader.Fset, rootsFilename, src, 0)
+	require.NoError(t, err)
+
+	conf := types.Config{Importer: programImporter{*g}}
+	_, err = conf.Check(rootsPkgPath, g.Loader.Fset, []*ast.File{file}, nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,170 @@
+package gen
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sarifSchema is the JSON schema of the SARIF logs WriteSARIF writes.
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// ruleDescriptions describe the rules of diagnostics in SARIF logs.
+var ruleDescriptions = map[string]string{
+	RuleFailure:         "Type switch could not be rewritten",
+	RuleTooManyCases:    "Type switch would have more expanded cases than allowed",
+	RuleUnmatchedType:   "Argument type matches no template of the type switch",
+	RuleInvalidCase:     "Generated case does not compile",
+	RuleMissingCases:    "Type switch misses cases the other switches on the interface have",
+	RuleInvalidTemplate: "Template case does not compile for synthetic types",
+	RuleMigration:       "Case or assertion fails to compile after the interface changed",
+	RuleStaleCode:       "Generated code is out of date",
+	RuleNonExhaustive:   "Type switch has no case for an argument type and no default clause",
+	RuleUnreachableCase: "Case never matches as a case before it matches all of its values",
+}
+
+// ruleLevels are the levels of the rules in SARIF logs other than "error".
+var ruleLevels = map[string]string{
+	RuleMissingCases:    "warning",
+	RuleUnreachableCase: "warning",
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes diags to w as a SARIF 2.1.0 log, for GitHub code scanning and other tools
+// to show them inline on the source. The files are referred to by their paths relative to
+// the current directory, which should be the root of the repository.
+// The diagnostics of RuleMissingCases and RuleUnreachableCase are warnings, and the others errors.
+func WriteSARIF(w io.Writer, diags DiagnosticList) error {
+	results := []sarifResult{}
+	used := map[string]bool{}
+
+	for _, d := range diags {
+		rule := d.Rule
+		if rule == "" {
+			rule = RuleFailure
+		}
+		used[rule] = true
+
+		level := ruleLevels[rule]
+		if level == "" {
+			level = "error"
+		}
+
+		result := sarifResult{RuleID: rule, Level: level, Message: sarifMessage{Text: d.Msg}}
+		if d.Pos.IsValid() {
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(d.Pos.Filename)},
+					Region:           sarifRegion{StartLine: d.Pos.Line, StartColumn: d.Pos.Column},
+				},
+			}}
+		}
+
+		results = append(results, result)
+	}
+
+	ids := []string{}
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rules := []sarifRule{}
+	for _, id := range ids {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: ruleDescriptions[id]}})
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "tsgen",
+				Version:        toolVersion(),
+				InformationURI: "https://" + modulePath,
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+
+	enc, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(enc, '\n'))
+	return err
+}
+
+// sarifURI returns the URI of the file filename, relative to the current directory if it is in it.
+func sarifURI(filename string) string {
+	p := relativePath(filename)
+	if !filepath.IsAbs(filepath.FromSlash(p)) {
+		return p
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		// a volume name
+		p = "/" + p
+	}
+
+	return "file://" + p
+}
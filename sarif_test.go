@@ -0,0 +1,88 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	diags := DiagnosticList{
+		{
+			Pos:  token.Position{Filename: "testdata/consistency/shape.go", Line: 31, Column: 2},
+			Msg:  "type switch on shape.Shape\n\tmissing: shape.Triangle",
+			Rule: RuleMissingCases,
+		},
+		{
+			Pos: token.Position{Filename: "/tmp/x.go", Line: 3, Column: 1},
+			Msg: "something failed",
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteSARIF(&buf, diags)
+	require.NoError(t, err)
+
+	t.Log(buf.String())
+
+	var log sarifLog
+	err = json.Unmarshal(buf.Bytes(), &log)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+
+	run := log.Runs[0]
+	assert.Equal(t, "tsgen", run.Tool.Driver.Name)
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	assert.Equal(t, RuleFailure, run.Tool.Driver.Rules[0].ID)
+	assert.Equal(t, RuleMissingCases, run.Tool.Driver.Rules[1].ID)
+
+	require.Len(t, run.Results, 2)
+	assert.Equal(t, RuleMissingCases, run.Results[0].RuleID)
+	assert.Equal(t, "warning", run.Results[0].Level)
+	assert.Equal(t, "testdata/consistency/shape.go", run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 31, run.Results[0].Locations[0].PhysicalLocation.Region.StartLine)
+
+	assert.Equal(t, RuleFailure, run.Results[1].RuleID)
+	assert.Equal(t, "error", run.Results[1].Level)
+	assert.Equal(t, "file:///tmp/x.go", run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+}
+
+func TestWriteSARIF_Rules(t *testing.T) {
+	tests := []struct {
+		rule  string
+		level string
+	}{
+		{RuleStaleCode, "error"},
+		{RuleNonExhaustive, "error"},
+		{RuleUnreachableCase, "warning"},
+	}
+
+	for _, test := range tests {
+		diags := DiagnosticList{
+			{Pos: token.Position{Filename: "testdata/lint.go", Line: 25, Column: 7}, Msg: "message", Rule: test.rule},
+		}
+
+		var buf bytes.Buffer
+		err := WriteSARIF(&buf, diags)
+		require.NoError(t, err)
+
+		var log sarifLog
+		err = json.Unmarshal(buf.Bytes(), &log)
+		require.NoError(t, err)
+
+		run := log.Runs[0]
+		require.Len(t, run.Tool.Driver.Rules, 1, test.rule)
+		assert.Equal(t, test.rule, run.Tool.Driver.Rules[0].ID)
+		assert.NotEmpty(t, run.Tool.Driver.Rules[0].ShortDescription.Text, test.rule)
+
+		require.Len(t, run.Results, 1, test.rule)
+		assert.Equal(t, test.rule, run.Results[0].RuleID)
+		assert.Equal(t, test.level, run.Results[0].Level, test.rule)
+	}
+}
@@ -18,13 +18,14 @@ import (
 // TODO: support interface{} type, analyzing call graphs
 func (g Gen) scaffoldFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) error {
 	return forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
-		typeSwitch := &typeSwitchStmt{
+		typeSwitch := &TypeSwitchStmt{
 			file: file,
 			node: sw,
 			info: pkg.Info,
 		}
 
-		subjType := pkg.Info.TypeOf(typeSwitch.subject())
+		x, _ := typeSwitchSubject(typeSwitch.node)
+		subjType := pkg.Info.TypeOf(x)
 		subjIf, ok := subjType.Underlying().(*types.Interface)
 		if !ok {
 			return fmt.Errorf("not an interface type: %v", subjType)
@@ -36,7 +37,7 @@ func (g Gen) scaffoldFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) e
 
 		// List possible type cases
 		candTypes := []types.Type{}
-		for _, t := range g.allNamedTypes() {
+		for _, t := range g.allNamedTypes(&pkg.Info) {
 			if _, isIf := t.Underlying().(*types.Interface); isIf {
 				continue
 			}
@@ -98,6 +99,11 @@ func forTypeSwitchStmt(file *ast.File, proc func(*ast.FuncDecl, *ast.TypeSwitchS
 			continue
 		}
 
+		if isGenericFunc(funcDecl) {
+			// The type switches on type parameters are no templates
+			continue
+		}
+
 		// For each type switch statements...
 		for _, stmt := range funcDecl.Body.List {
 			sw, ok := stmt.(*ast.TypeSwitchStmt)
@@ -159,18 +165,14 @@ func addImport(file *ast.File, path string) {
 // allNamedTypes returns all named types declared or loaded inside
 // the program, plus built-in error type.
 // (as oracle tool does)
-func (g Gen) allNamedTypes() []types.Type {
+func (g Gen) allNamedTypes(info *types.Info) []types.Type {
 	all := []types.Type{}
 
-	for _, info := range g.program.AllPackages {
-		for _, obj := range info.Defs {
-			if obj != nil && !obj.Exported() {
-				continue
-			}
-			if tn, ok := obj.(*types.TypeName); ok {
-				all = append(all, tn.Type())
-			}
+	for _, tn := range g.typeNames(info) {
+		if !tn.Exported() {
+			continue
 		}
+		all = append(all, tn.Type())
 	}
 
 	all = append(all, types.Universe.Lookup("error").Type())
@@ -0,0 +1,273 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// Server keeps a program loaded and analyzed in memory, answering the requests of editors
+// by JSON-RPC 1.0 as the service "Tsgen", with the methods Expand and List.
+// The program is reloaded by the next request after any of its files is modified,
+// and SSA and pointer analysis are rebuilt by the next expansion.
+type Server struct {
+	// newGen returns a Gen configured to load the program, which is not loaded yet.
+	newGen func() (*Gen, error)
+
+	// mu serializes the requests, which rewrite the files of g temporarily.
+	mu sync.Mutex
+
+	// g is the Gen of the program loaded, and modTimes the modification times of its files.
+	g        *Gen
+	modTimes map[string]time.Time
+}
+
+// NewServer creates a Server serving the program loaded by the Gen newGen returns,
+// which is called again to reload the program after its files are modified.
+func NewServer(newGen func() (*Gen, error)) *Server {
+	return &Server{newGen: newGen}
+}
+
+// ExpandArgs are the arguments of Server.Expand.
+type ExpandArgs struct {
+	// File and Line are the position of the type switch to expand, at any line of it.
+	File string
+	Line int
+}
+
+// ExpandReply is the reply of Server.Expand.
+type ExpandReply struct {
+	// Source is the source of the file with the type switch expanded.
+	Source string
+
+	// Changed reports whether Source differs from the file.
+	Changed bool
+}
+
+// ListArgs are the arguments of Server.List.
+type ListArgs struct {
+	// Package is the import path or the directory of the package to list the type switches of.
+	// If empty, the ones of the packages created or imported are listed.
+	Package string
+}
+
+// ListReply is the reply of Server.List.
+type ListReply struct {
+	Switches []TypeSwitchSummary
+}
+
+// TypeSwitchSummary is a TypeSwitchInfo as sent by Server.List, with the position and the type as strings.
+type TypeSwitchSummary struct {
+	Pos        string
+	Func       string
+	Subject    string
+	Type       string
+	Cases      int
+	Expandable bool
+	Reason     string
+}
+
+// Warm loads the program and runs pointer analysis ahead of the requests,
+// so that the first expansion answers as fast as the later ones.
+func (s *Server) Warm() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.program()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.pointerAnalysis()
+	return err
+}
+
+// Expand expands the type switch at args.File and args.Line as Gen.Expand does,
+// replying the rewritten source of the file without writing it.
+func (s *Server) Expand(args *ExpandArgs, reply *ExpandReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := s.program()
+	if err != nil {
+		return err
+	}
+
+	g := *loaded
+	g.GenerateTests = false
+	g.totalCases = &caseCount{}
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtLine(args.File, args.Line)
+	if err != nil {
+		return err
+	}
+
+	info := g.typeSwitchInfo(pkg, file, funcDecl, sw)
+	if !info.Expandable {
+		return fmt.Errorf("%s: type switch is not expandable: %s", info.Pos, info.Reason)
+	}
+
+	offset := g.tokenFile(file).Offset(sw.Pos())
+	g.Region = &Region{Filename: g.tokenFile(file).Name(), Start: offset, End: offset}
+
+	src, err := g.fileSource(file)
+	if err != nil {
+		return err
+	}
+
+	// the file is rewritten by reparsing its source, restored for the later requests
+	orig := *file
+	defer func() { *file = orig }()
+
+	err = g.expandFileTypeSwitches(pkg, file)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	err = g.writeNode(&bytesWriter{close: func(b []byte) { out = b }}, file)
+	if err != nil {
+		return err
+	}
+
+	reply.Source = string(out)
+	reply.Changed = !bytes.Equal(out, src)
+	return nil
+}
+
+// List replies the type switches of the package args.Package as ListTypeSwitches does.
+func (s *Server) List(args *ListArgs, reply *ListReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.program()
+	if err != nil {
+		return err
+	}
+
+	include := g.isInitial
+	if args.Package != "" {
+		dir, err := filepath.Abs(args.Package)
+		if err != nil {
+			return err
+		}
+
+		include = func(pkg *loader.PackageInfo) bool {
+			if pkg.Pkg.Path() == args.Package {
+				return true
+			}
+			if len(pkg.Files) == 0 {
+				return false
+			}
+			d, err := filepath.Abs(filepath.Dir(g.tokenFile(pkg.Files[0]).Name()))
+			return err == nil && d == dir
+		}
+	}
+
+	reply.Switches = []TypeSwitchSummary{}
+	for _, info := range g.listTypeSwitches(include) {
+		reply.Switches = append(reply.Switches, TypeSwitchSummary{
+			Pos:        info.Pos.String(),
+			Func:       info.Func,
+			Subject:    info.Subject,
+			Type:       fmt.Sprint(info.Type),
+			Cases:      info.Cases,
+			Expandable: info.Expandable,
+			Reason:     info.Reason,
+		})
+	}
+
+	return nil
+}
+
+// Serve accepts connections on l, serving the requests of each by ServeConn, until l fails.
+func (s *Server) Serve(l net.Listener) error {
+	srv, err := s.rpcServer()
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// ServeConn serves the JSON-RPC requests on conn until the client hangs up.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) error {
+	srv, err := s.rpcServer()
+	if err != nil {
+		return err
+	}
+
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+func (s *Server) rpcServer() (*rpc.Server, error) {
+	srv := rpc.NewServer()
+	err := srv.RegisterName("Tsgen", s)
+	if err != nil {
+		return nil, err
+	}
+
+	return srv, nil
+}
+
+// program returns the Gen of the program loaded, loading it if not yet or any of its files is modified.
+// Must be called with s.mu held.
+func (s *Server) program() (*Gen, error) {
+	if s.g != nil && !s.modified() {
+		return s.g, nil
+	}
+
+	g, err := s.newGen()
+	if err != nil {
+		return nil, err
+	}
+
+	// SSA is built lazily by the first expansion, as in ExpandContext
+	err = g.initProgram(needFuncBodies)
+	if err != nil {
+		return nil, err
+	}
+	g.initRun()
+
+	modTimes := map[string]time.Time{}
+	for _, pkg := range g.program.AllPackages {
+		for _, file := range pkg.Files {
+			name := g.tokenFile(file).Name()
+			if fi, err := os.Stat(name); err == nil {
+				modTimes[name] = fi.ModTime()
+			}
+		}
+	}
+
+	s.g, s.modTimes = g, modTimes
+	return g, nil
+}
+
+// modified reports whether any of the files of the program loaded is modified or removed since loaded.
+func (s *Server) modified() bool {
+	for name, modTime := range s.modTimes {
+		fi, err := os.Stat(name)
+		if err != nil || !fi.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+package gen
+
+import (
+	"net"
+	"net/rpc/jsonrpc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	loads := 0
+	s := NewServer(func() (*Gen, error) {
+		loads++
+		g := New()
+		err := g.Loader.CreateFromFilenames("", "testdata/list.go")
+		return g, err
+	})
+
+	serverConn, clientConn := net.Pipe()
+	go s.ServeConn(serverConn)
+
+	client := jsonrpc.NewClient(clientConn)
+	defer client.Close()
+
+	var list ListReply
+	err := client.Call("Tsgen.List", &ListArgs{Package: "testdata"}, &list)
+	require.NoError(t, err)
+
+	require.Len(t, list.Switches, 6)
+	assert.Equal(t, "testdata/list.go:10:2", list.Switches[0].Pos)
+	assert.Equal(t, "keys", list.Switches[0].Func)
+	assert.Equal(t, "interface{}", list.Switches[0].Type)
+	assert.True(t, list.Switches[0].Expandable)
+	assert.Equal(t, "no templates", list.Switches[3].Reason)
+
+	err = client.Call("Tsgen.List", &ListArgs{Package: "example.com/other"}, &list)
+	require.NoError(t, err)
+	assert.Len(t, list.Switches, 0)
+
+	var expanded ExpandReply
+	err = client.Call("Tsgen.Expand", &ExpandArgs{File: "testdata/list.go", Line: 33}, &expanded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "type switch is not expandable: no templates")
+
+	err = client.Call("Tsgen.Expand", &ExpandArgs{File: "testdata/list.go", Line: 1}, &expanded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no type switch found at testdata/list.go:1")
+
+	// the program is kept loaded while the files are unchanged
+	assert.Equal(t, 1, loads)
+}
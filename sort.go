@@ -1,7 +1,11 @@
 package gen
 
 import (
+	"bytes"
+	"fmt"
+	"regexp"
 	"sort"
+	"strings"
 
 	"go/ast"
 	"go/token"
@@ -18,11 +22,54 @@ import (
 //   case C: // implements I1, I2
 //   case D: // implements I2
 // Will be sorted as C, B, D, A, as I2 is more popular than I1.
-func (g Gen) sortFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) error {
+// The strategy can be changed by g.Sorter. g.InterfacePriority overrides the computed popularity.
+// If g.SortBanners is set, sorted cases are grouped under comment banners instead.
+// If g.ValueSorter is set, the value switches in file are sorted too by sortValueSwitch.
+func (g Gen) sortFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) (err error) {
+	sorter := g.Sorter
+	if sorter == nil {
+		sorter = ByInterfacePopularity
+	}
+
+	edits := []sourceEdit{}
+
 	ast.Inspect(file, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+
+		if stmt, ok := n.(*ast.SwitchStmt); ok && g.ValueSorter != nil {
+			if !g.inRegion(file, stmt) || !isSortableValueSwitch(stmt, &pkg.Info) {
+				return true
+			}
+
+			edit, e := g.sortedClausesEdit(file, stmt.Body, g.ValueSorter, &pkg.Info, false)
+			if e != nil {
+				err = e
+				return false
+			}
+			edits = append(edits, edit)
+			return false
+		}
+
 		if stmt, ok := n.(*ast.TypeSwitchStmt); ok {
-			sort.Sort(g.byInterface(stmt.Body.List, &pkg.Info))
-			// sort.Sort(byName{stmt.Body.List, g})
+			if !g.inRegion(file, stmt) {
+				return false
+			}
+
+			// The edits to the source discard the changes to the AST,
+			// so type switches are sorted by edits too if any.
+			if g.SortBanners || g.ValueSorter != nil {
+				edit, e := g.sortedClausesEdit(file, stmt.Body, sorter, &pkg.Info, g.SortBanners)
+				if e != nil {
+					err = e
+					return false
+				}
+				edits = append(edits, edit)
+				return false
+			}
+
+			sort.Sort(sorter.Sorter(&g, stmt.Body.List, &pkg.Info))
 
 			// Remove empty lines between cases
 			// as sorting cases will break the spacing.
@@ -38,10 +85,274 @@ func (g Gen) sortFileTypeSwitches(pkg *loader.PackageInfo, file *ast.File) error
 
 		return true
 	})
+	if err != nil {
+		return
+	}
+
+	if len(edits) > 0 {
+		err = g.editFileSource(file, edits)
+	}
+
+	return
+}
+
+// sortedClausesEdit sorts the case clauses in body, the body of a switch statement, and returns an edit to the source
+// which rewrites body into sorted clauses. If banners is set, the clauses are grouped by the interfaces
+// they implement. Groups are separated by blank lines and labelled with
+// comment banners like "// --- implements io.Reader ---" when sorted by interface popularity.
+// Comments above case clauses, and the ones following them on their last lines, move along with them.
+func (g Gen) sortedClausesEdit(file *ast.File, body *ast.BlockStmt, sorter CaseSorter, info *types.Info, banners bool) (sourceEdit, error) {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return sourceEdit{}, err
+	}
+
+	tf := g.tokenFile(file)
+	offset := func(pos token.Pos) int { return tf.Offset(pos) }
+
+	// The text of a clause spans from its Pos to its End and the comment following it on the line,
+	// including the comments above it, after the ones following the previous clause.
+	clauseText := map[ast.Stmt]string{}
+	start := g.lineCommentEnd(file, body.Lbrace+1)
+	head := strings.TrimSpace(string(src[offset(body.Lbrace)+1 : start]))
+	for _, st := range body.List {
+		end := g.lineCommentEnd(file, st.End())
+		clauseText[st] = lineIndent(src, offset(st.Pos())) + stripBanners(string(src[start:end]))
+		start = end
+	}
+	trailer := stripBanners(string(src[start:offset(body.Rbrace)]))
+
+	s := sorter.Sorter(&g, body.List, info)
+	sort.Sort(s)
+
+	var interfaces []types.Type
+	if bip, ok := s.(byInterfacePopularity); ok && banners {
+		interfaces = bip.interfaces
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	if head != "" {
+		buf.WriteString(" " + head)
+	}
+	buf.WriteString("\n")
+
+	var prevGroup types.Type
+	for i, st := range body.List {
+		group := clauseGroup(st.(*ast.CaseClause), interfaces, info)
+		if i == 0 || group != prevGroup {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			if group != nil {
+				fmt.Fprintf(&buf, "%s// --- implements %s ---\n", lineIndent(src, offset(st.Pos())), g.relativeTypeString(group, file))
+			}
+		}
+		prevGroup = group
+
+		buf.WriteString(clauseText[st])
+		buf.WriteString("\n")
+	}
+
+	if trailer != "" {
+		buf.WriteString(trailer)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}")
+
+	return sourceEdit{
+		start: offset(body.Lbrace),
+		end:   offset(body.Rbrace) + 1,
+		text:  buf.Bytes(),
+	}, nil
+}
+
+// lineCommentEnd returns the offset of the end of the comments following pos on its line in file,
+// e.g. of a line comment after the last statement of a case clause, or the offset of pos if none.
+func (g Gen) lineCommentEnd(file *ast.File, pos token.Pos) int {
+	tf := g.tokenFile(file)
+	end := tf.Offset(pos)
+	line := tf.Line(pos)
+
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if c.Pos() >= pos && tf.Line(c.Pos()) == line {
+				end = tf.Offset(c.End())
+			}
+		}
+	}
+
+	return end
+}
+
+// lineIndent returns the spaces and tabs at the head of the line in src at offset,
+// so that the comments above clauses keep their columns, which gofmt aligns them by.
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < offset && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+
+	return string(src[start:end])
+}
+
+var bannerPattern = regexp.MustCompile(`(?m)^[ \t]*// --- implements .* ---[ \t]*\n`)
+
+// stripBanners removes the comment banners generated by the previous run from text
+// and trims surrounding spaces.
+func stripBanners(text string) string {
+	return strings.TrimSpace(bannerPattern.ReplaceAllString(text, ""))
+}
+
+// clauseGroup returns the first interface in interfaces which the type of cc implements,
+// or nil if there are none or cc is the default clause.
+func clauseGroup(cc *ast.CaseClause, interfaces []types.Type, info *types.Info) types.Type {
+	if cc.List == nil {
+		return nil
+	}
+
+	t := info.TypeOf(cc.List[0])
+	for _, in := range interfaces {
+		if types.Implements(t, in.Underlying().(*types.Interface)) {
+			return in
+		}
+	}
 
 	return nil
 }
 
+// CaseSorter is a strategy to sort case clauses in type switch statements.
+// Sorter returns a sort.Interface which sorts list, the body of a type switch statement,
+// using info to obtain the types of case clauses.
+type CaseSorter interface {
+	Sorter(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface
+}
+
+// CaseSorterFunc is an adapter to use an ordinary function as a CaseSorter.
+type CaseSorterFunc func(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface
+
+// Sorter calls f(g, list, info).
+func (f CaseSorterFunc) Sorter(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface {
+	return f(g, list, info)
+}
+
+// CaseLess is a comparator of case clauses which reports whether a should be sorted before b.
+// It implements CaseSorter. Default clauses are always sorted last,
+// so a and b given to the function are never "default" clauses.
+type CaseLess func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool
+
+// Sorter returns a sort.Interface using less as its comparator.
+func (less CaseLess) Sorter(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface {
+	return byCaseLess{list: list, less: less, gen: g, info: info}
+}
+
+// Built-in sort strategies.
+var (
+	// ByInterfacePopularity sorts case clauses by the popularity of
+	// interfaces implemented by their types. This is the default.
+	ByInterfacePopularity CaseSorter = CaseSorterFunc(func(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface {
+		return g.byInterface(list, info)
+	})
+
+	// ByTypeName sorts case clauses alphabetically by their type expressions.
+	ByTypeName CaseSorter = CaseSorterFunc(func(g *Gen, list []ast.Stmt, info *types.Info) sort.Interface {
+		return byTypeName{list: list, gen: g}
+	})
+
+	// ByBodyLength sorts case clauses by the number of statements in their bodies,
+	// shorter first.
+	ByBodyLength CaseSorter = CaseLess(func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool {
+		if len(a.Body) != len(b.Body) {
+			return len(a.Body) < len(b.Body)
+		}
+
+		return g.showNode(a.List[0]) < g.showNode(b.List[0])
+	})
+
+	// ByDeclarationOrder sorts case clauses by the source positions of
+	// where their types are declared. Unnamed types are sorted last by name.
+	ByDeclarationOrder CaseSorter = CaseLess(func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool {
+		pa, pb := declPos(info.TypeOf(a.List[0])), declPos(info.TypeOf(b.List[0]))
+		if pa != pb {
+			if pa == token.NoPos {
+				return false
+			}
+			if pb == token.NoPos {
+				return true
+			}
+			return pa < pb
+		}
+
+		return g.showNode(a.List[0]) < g.showNode(b.List[0])
+	})
+)
+
+// caseSorters holds the named sort strategies, which can be looked up by LookupCaseSorter.
+var caseSorters = map[string]CaseSorter{
+	"popularity":  ByInterfacePopularity,
+	"name":        ByTypeName,
+	"body-length": ByBodyLength,
+	"declaration": ByDeclarationOrder,
+}
+
+// RegisterCaseSorter registers a sort strategy by name.
+// It overrides the existing strategy of the same name if any.
+func RegisterCaseSorter(name string, s CaseSorter) {
+	caseSorters[name] = s
+}
+
+// LookupCaseSorter returns the sort strategy registered by name, or nil if not found.
+func LookupCaseSorter(name string) CaseSorter {
+	return caseSorters[name]
+}
+
+// CaseSorterNames returns the names of registered sort strategies in alphabetical order.
+func CaseSorterNames() []string {
+	names := make([]string, 0, len(caseSorters))
+	for name := range caseSorters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// declPos returns the position where the type t (or its element type if t is a pointer) is declared.
+func declPos(t types.Type) token.Pos {
+	if pt, ok := t.(*types.Pointer); ok {
+		t = pt.Elem()
+	}
+
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Pos()
+	}
+
+	return token.NoPos
+}
+
+type byCaseLess struct {
+	list []ast.Stmt
+	less CaseLess
+	gen  *Gen
+	info *types.Info
+}
+
+func (s byCaseLess) Len() int      { return len(s.list) }
+func (s byCaseLess) Swap(i, j int) { s.list[i], s.list[j] = s.list[j], s.list[i] }
+func (s byCaseLess) Less(i, j int) bool {
+	cc1 := s.list[i].(*ast.CaseClause)
+	cc2 := s.list[j].(*ast.CaseClause)
+
+	if cc1.List == nil {
+		return false
+	}
+	if cc2.List == nil {
+		return true
+	}
+
+	return s.less(s.gen, s.info, cc1, cc2)
+}
+
 type byTypeName struct {
 	list []ast.Stmt
 	gen  *Gen
@@ -84,14 +395,10 @@ func (g Gen) byInterface(list []ast.Stmt, info *types.Info) byInterfacePopularit
 
 	// Count all interfaces' implementation counts
 	implCounts := map[types.Type]int{}
-	for _, info := range g.program.AllPackages {
-		for _, obj := range info.Defs {
-			if tn, ok := obj.(*types.TypeName); ok {
-				t := tn.Type()
-				if _, ok := t.Underlying().(*types.Interface); ok {
-					implCounts[t] = 0
-				}
-			}
+	for _, tn := range g.typeNames(info) {
+		t := tn.Type()
+		if _, ok := t.Underlying().(*types.Interface); ok {
+			implCounts[t] = 0
 		}
 	}
 
@@ -110,6 +417,10 @@ func (g Gen) byInterface(list []ast.Stmt, info *types.Info) byInterfacePopularit
 
 	sort.Sort(byImplCount{interfaceOrder, implCounts})
 
+	if len(g.InterfacePriority) > 0 {
+		interfaceOrder = prioritizeInterfaces(interfaceOrder, g.InterfacePriority)
+	}
+
 	g.log(nil, nil, "%v", interfaceOrder)
 
 	return byInterfacePopularity{
@@ -120,6 +431,57 @@ func (g Gen) byInterface(list []ast.Stmt, info *types.Info) byInterfacePopularit
 	}
 }
 
+// ParseInterfacePriority parses an interface priority list like "io.Reader > fmt.Stringer"
+// into a list of interface names, which can be used as Gen.InterfacePriority.
+func ParseInterfacePriority(s string) []string {
+	names := []string{}
+	for _, name := range strings.Split(s, ">") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// prioritizeInterfaces moves interfaces whose names are listed in priority
+// to the head of interfaces in the order of priority. Other interfaces remain in
+// their order after them.
+func prioritizeInterfaces(interfaces []types.Type, priority []string) []types.Type {
+	ordered := make([]types.Type, 0, len(interfaces))
+	used := map[types.Type]bool{}
+
+	for _, name := range priority {
+		for _, in := range interfaces {
+			if !used[in] && interfaceNameMatches(in, name) {
+				ordered = append(ordered, in)
+				used[in] = true
+			}
+		}
+	}
+
+	for _, in := range interfaces {
+		if !used[in] {
+			ordered = append(ordered, in)
+		}
+	}
+
+	return ordered
+}
+
+// interfaceNameMatches reports whether the named type t is referred by name,
+// which is either its full form (e.g. "github.com/motemen/gen.I")
+// or its short form qualified by the package name (e.g. "gen.I").
+func interfaceNameMatches(t types.Type, name string) bool {
+	if t.String() == name {
+		return true
+	}
+
+	short, _ := splitType(t)
+	return short == name
+}
+
 type byImplCount struct {
 	interfaces []types.Type
 	count      map[types.Type]int
@@ -0,0 +1,249 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sortFile sorts the cases in the file filename with g, returning the result.
+func sortFile(t *testing.T, g *Gen, filename string) string {
+	var out bytes.Buffer
+
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == filename {
+			return nopCloser{&out}
+		}
+
+		return nil
+	}
+
+	err := g.Loader.CreateFromFilenames("", filename)
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+
+	return out.String()
+}
+
+func sortCases(t *testing.T, sorter CaseSorter) []string {
+	g := New()
+	g.Sorter = sorter
+
+	cases := []string{}
+	for _, line := range strings.Split(sortFile(t, g, "testdata/sort/cases.go"), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "case ") || line == "default:" {
+			cases = append(cases, line)
+		}
+	}
+
+	return cases
+}
+
+func TestSort_Sorters(t *testing.T) {
+	assert.Equal(t, []string{"case A:", "case B:", "case C:", "default:"}, sortCases(t, ByTypeName))
+	assert.Equal(t, []string{"case C:", "case A:", "case B:", "default:"}, sortCases(t, ByBodyLength))
+	assert.Equal(t, []string{"case C:", "case A:", "case B:", "default:"}, sortCases(t, ByDeclarationOrder))
+}
+
+func TestLookupCaseSorter(t *testing.T) {
+	assert.Equal(t, []string{"body-length", "declaration", "name", "popularity"}, CaseSorterNames())
+	assert.Nil(t, LookupCaseSorter("no-such-sorter"))
+}
+
+func TestSortTypeSwitches(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "testdata/sort/cases.go", nil, parser.ParseComments)
+	require.NoError(t, err)
+
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	conf := types.Config{}
+	_, err = conf.Check("E", fset, []*ast.File{file}, info)
+	require.NoError(t, err)
+
+	g := New()
+	g.Sorter = ByTypeName
+	err = g.SortTypeSwitches(fset, file, info)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = format.Node(&out, fset, file)
+	require.NoError(t, err)
+
+	result := out.String()
+	assert.True(t, strings.Index(result, "case A:") < strings.Index(result, "case B:"))
+	assert.True(t, strings.Index(result, "case B:") < strings.Index(result, "case C:"))
+}
+
+func TestParseInterfacePriority(t *testing.T) {
+	assert.Equal(t, []string{"io.Reader", "fmt.Stringer"}, ParseInterfacePriority("io.Reader > fmt.Stringer"))
+	assert.Equal(t, []string{"E.J"}, ParseInterfacePriority(" E.J >"))
+}
+
+func TestSort_InterfacePriority(t *testing.T) {
+	g := New()
+	g.InterfacePriority = []string{"E.J"}
+
+	result := sortFile(t, g, "testdata/sort/cases.go")
+	// B implements J only, A implements I only
+	assert.True(t, strings.Index(result, "case B:") < strings.Index(result, "case A:"))
+}
+
+func TestSort_Banners(t *testing.T) {
+	g := New()
+	g.SortBanners = true
+
+	result := sortFile(t, g, "testdata/sort/cases.go")
+	t.Log(result)
+
+	assert.Contains(t, result, "\t// --- implements I ---\n\tcase C:")
+	assert.Contains(t, result, "\n\n\t// --- implements J ---\n\tcase B:")
+	assert.True(t, strings.Index(result, "case A:") < strings.Index(result, "// --- implements J ---"))
+}
+
+func TestSort_BannersComments(t *testing.T) {
+	g := New()
+	g.SortBanners = true
+
+	result := sortFile(t, g, "testdata/sort/comments/cases.go")
+	t.Log(result)
+
+	// the comments following the last statements stay on their lines, and the ones above clauses move along
+	assert.Contains(t, result, "switch i := i.(type) { // sorted\n\t// --- implements I ---\n\tcase C: // C is empty\n\t// A is last\n\tcase A:\n\t\t_ = i\n")
+	assert.Contains(t, result, "\tcase B:\n\t\t_ = i\n\t\t_ = i // B\n")
+	assert.Contains(t, result, "\tdefault:\n\t\t_ = i // default\n\t}")
+}
+
+func TestSort_Concurrency(t *testing.T) {
+	sortWith := func(concurrency int) string {
+		g := New()
+		g.Sorter = ByTypeName
+		g.Concurrency = concurrency
+
+		return sortFile(t, g, "testdata/sort/cases.go")
+	}
+
+	assert.Equal(t, sortWith(1), sortWith(4))
+}
+
+func TestSort_ChangedFiles(t *testing.T) {
+	written := []string{}
+
+	g := New()
+	g.ChangedFiles = []string{"testdata/sort/other.go"}
+	g.FileWriter = func(path string) io.WriteCloser {
+		written = append(written, path)
+		return nopCloser{&bytes.Buffer{}}
+	}
+
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+	assert.Empty(t, written)
+
+	g.ChangedFiles = []string{"testdata/sort/cases.go"}
+	err = g.Sort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"testdata/sort/cases.go"}, written)
+}
+
+func TestSort_Overlay(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+
+	g := New()
+	g.Sorter = ByTypeName
+	g.Overlay = map[string][]byte{
+		"testdata/sort/cases.go": append([]byte("// unsaved\n"), src...),
+	}
+	g.FileWriter = func(path string) io.WriteCloser {
+		if path == "testdata/sort/cases.go" {
+			return nopCloser{&out}
+		}
+
+		return nil
+	}
+
+	err = g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	err = g.Sort()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(out.String(), "// unsaved\n"))
+	assert.True(t, strings.Index(out.String(), "case A:") < strings.Index(out.String(), "case B:"))
+}
+
+func TestSortBytes(t *testing.T) {
+	g := New()
+	g.Sorter = ByTypeName
+
+	err := g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	sources, err := g.SortBytes()
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+
+	src := string(sources["testdata/sort/cases.go"])
+	assert.True(t, strings.Index(src, "case A:") < strings.Index(src, "case B:"))
+}
+
+func sortValueCases(t *testing.T, sorter CaseSorter) string {
+	g := New()
+	g.ValueSorter = sorter
+
+	return sortFile(t, g, "testdata/sort/values.go")
+}
+
+func TestSort_ValueSwitches(t *testing.T) {
+	cases := func(result string, from, to string) []string {
+		result = result[strings.Index(result, from):strings.Index(result, to)]
+
+		cases := []string{}
+		for _, line := range strings.Split(result, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "case ") || line == "default:" || strings.HasPrefix(line, "//") {
+				cases = append(cases, line)
+			}
+		}
+		return cases
+	}
+
+	result := sortValueCases(t, ByConstantValue)
+	t.Log(result)
+	assert.Equal(t, []string{"case Black:", "case Red:", "case Green, 10:", "// Blue is the sky", "case Blue:", "default:"}, cases(result, "func name", "func weight"))
+	assert.Equal(t, []string{"case \"l\":", "case \"m\":", "case \"s\":", "case s == \"xs\":", "case s == \"xl\":"}, cases(result, "func weight", "func next"))
+	assert.Equal(t, []string{"case Green:", "case Red:"}, cases(result, "func next", "return Red"))
+	assert.Contains(t, result, "\t\treturn \"green\"\n\t// Blue is the sky\n\tcase Blue:")
+
+	result = sortValueCases(t, ByCaseExpression)
+	assert.Equal(t, []string{"case Black:", "// Blue is the sky", "case Blue:", "case Green, 10:", "case Red:", "default:"}, cases(result, "func name", "func weight"))
+
+	result = sortValueCases(t, ByConstantDeclaration)
+	assert.Equal(t, []string{"case Red:", "case Green, 10:", "// Blue is the sky", "case Blue:", "case Black:", "default:"}, cases(result, "func name", "func weight"))
+
+	assert.Equal(t, []string{"declaration", "name", "value"}, ValueSorterNames())
+	assert.Nil(t, LookupValueSorter("popularity"))
+}
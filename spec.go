@@ -0,0 +1,311 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// MatchSpec is a table-driven specification of the pattern matching semantics,
+// which tells which patterns match which types and what bindings result.
+//
+// A spec is written in a line-oriented text format:
+//
+//	# a comment
+//	typevars T S
+//	typevar R io.Reader
+//	lenvars N
+//	features arrays,interfaces
+//	import io
+//
+//	## Section title
+//	map[string]T | map[string][]io.Reader | T=[]io.Reader
+//	map[T]bool   | map[int]string         | no match
+//	mode either
+//	int64        | time.Duration          |
+//
+// "typevars" declares type variables, "typevar" declares a type variable bounded by an interface,
+// "lenvars" declares length variables of array patterns, "features" enables experimental features
+// and "import" imports packages
+// which patterns and inputs can refer to. "mode" sets the MatchMode of the following cases. Each case is a line of a pattern,
+// an input type and the expected bindings (as "T=int, S=string", or "no match"),
+// separated by "|".
+type MatchSpec struct {
+	Imports  []string
+	TypeVars []string
+	// Bounds maps the bounded type variables in TypeVars to their bounds.
+	Bounds   map[string]string
+	LenVars  []string
+	Features Features
+	Cases    []MatchSpecCase
+}
+
+// MatchSpecCase is a case of a MatchSpec.
+type MatchSpecCase struct {
+	Section  string
+	Mode     MatchMode
+	Pattern  string
+	Input    string
+	Expected string
+	Line     int
+}
+
+// MatchSpecResult is the result of running a MatchSpecCase.
+type MatchSpecResult struct {
+	Case   MatchSpecCase
+	Actual string
+}
+
+// OK reports whether the case resulted as expected.
+func (r MatchSpecResult) OK() bool {
+	return r.Actual == r.Case.Expected
+}
+
+const noMatch = "no match"
+
+// ParseMatchSpec parses a MatchSpec from r.
+func ParseMatchSpec(r io.Reader) (*MatchSpec, error) {
+	spec := &MatchSpec{}
+
+	var (
+		section string
+		mode    MatchMode
+	)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case line == "":
+			continue
+
+		case strings.HasPrefix(line, "## "):
+			section = strings.TrimSpace(line[3:])
+
+		case strings.HasPrefix(line, "#"):
+			continue
+
+		case strings.HasPrefix(line, "typevars "):
+			spec.TypeVars = append(spec.TypeVars, strings.Fields(line)[1:]...)
+
+		case strings.HasPrefix(line, "typevar "):
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: expected typevar <name> <bound>: %q", n, line)
+			}
+
+			if spec.Bounds == nil {
+				spec.Bounds = map[string]string{}
+			}
+			spec.TypeVars = append(spec.TypeVars, fields[1])
+			spec.Bounds[fields[1]] = strings.Join(fields[2:], " ")
+
+		case strings.HasPrefix(line, "lenvars "):
+			spec.LenVars = append(spec.LenVars, strings.Fields(line)[1:]...)
+
+		case strings.HasPrefix(line, "features "):
+			features, err := ParseFeatures(strings.TrimSpace(line[len("features "):]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+
+			if spec.Features == nil {
+				spec.Features = Features{}
+			}
+			for f := range features {
+				spec.Features[f] = true
+			}
+
+		case strings.HasPrefix(line, "mode "):
+			var err error
+			mode, err = ParseMatchMode(strings.TrimSpace(line[len("mode "):]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+
+		case strings.HasPrefix(line, "import "):
+			spec.Imports = append(spec.Imports, strings.Fields(line)[1:]...)
+
+		default:
+			fields := strings.Split(line, "|")
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected <pattern> | <input> | <expected>: %q", n, line)
+			}
+
+			spec.Cases = append(spec.Cases, MatchSpecCase{
+				Section:  section,
+				Mode:     mode,
+				Pattern:  strings.TrimSpace(fields[0]),
+				Input:    strings.TrimSpace(fields[1]),
+				Expected: strings.TrimSpace(fields[2]),
+				Line:     n,
+			})
+		}
+	}
+
+	return spec, s.Err()
+}
+
+// RunMatchSpec runs the cases of spec against the pattern matcher of g and returns their results.
+// The cases are type-checked in an ad-hoc package named "spec".
+// The features of spec are enabled in addition to the ones of g.
+func (g Gen) RunMatchSpec(spec *MatchSpec) ([]MatchSpecResult, error) {
+	features := Features{}
+	for f := range g.Features {
+		features[f] = true
+	}
+	for f := range spec.Features {
+		features[f] = true
+	}
+	g.Features = features
+
+	var src bytes.Buffer
+
+	fmt.Fprintln(&src, "package spec")
+	for _, path := range spec.Imports {
+		fmt.Fprintf(&src, "import %q\n", path)
+	}
+	for _, name := range spec.TypeVars {
+		if _, ok := spec.Bounds[name]; ok {
+			fmt.Fprintln(&src, "// +tsgen typevar")
+		}
+		fmt.Fprintf(&src, "type %s interface{ %s }\n", name, spec.Bounds[name])
+	}
+	for _, name := range spec.LenVars {
+		fmt.Fprintf(&src, "const %s = 0\n", name)
+	}
+	for i, c := range spec.Cases {
+		fmt.Fprintf(&src, "var pattern%d %s\n", i, c.Pattern)
+		fmt.Fprintf(&src, "var input%d %s\n", i, c.Input)
+	}
+
+	g.Loader = loader.Config{ParserMode: parser.ParseComments}
+
+	file, err := g.Loader.ParseFile("spec.go", src.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	g.Loader.CreateFromFiles("spec", file)
+
+	err = g.initProgram(needTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	info := g.program.Created[0]
+
+	patternExprs := map[string]ast.Expr{}
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.VAR {
+			spec := decl.Specs[0].(*ast.ValueSpec)
+			patternExprs[spec.Names[0].Name] = spec.Type
+		}
+	}
+
+	typeOf := func(name string) types.Type {
+		for ident, obj := range info.Defs {
+			if ident.Name == name && obj != nil {
+				return obj.Type()
+			}
+		}
+		return nil
+	}
+
+	results := make([]MatchSpecResult, len(spec.Cases))
+	for i, c := range spec.Cases {
+		patName := fmt.Sprintf("pattern%d", i)
+		pat, in := typeOf(patName), typeOf(fmt.Sprintf("input%d", i))
+		if pat == nil || in == nil {
+			return nil, fmt.Errorf("line %d: could not type-check %q or %q", c.Line, c.Pattern, c.Input)
+		}
+
+		actual := noMatch
+		p := &TypePattern{
+			Type:         pat,
+			isVar:        g.isTypeVariable,
+			matchLen:     g.enabled(FeatureArrays),
+			lenVars:      lengthVariables(patternExprs[patName], &info.Info),
+			matchMethods: g.enabled(FeatureInterfaces),
+			mode:         c.Mode,
+		}
+		if m, ok := p.Match(in); ok {
+			actual = m.String()
+		}
+
+		results[i] = MatchSpecResult{Case: c, Actual: actual}
+	}
+
+	return results, nil
+}
+
+// WriteDoc writes the cases of spec as AsciiDoc tables, one for each section.
+func (spec *MatchSpec) WriteDoc(w io.Writer) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("= Pattern matching specification\n\n")
+	typeVars := make([]string, len(spec.TypeVars))
+	for i, name := range spec.TypeVars {
+		typeVars[i] = name
+		if bound, ok := spec.Bounds[name]; ok {
+			typeVars[i] = name + " " + bound
+		}
+	}
+	printf("Type variables: `%s`\n", strings.Join(typeVars, "`, `"))
+	if len(spec.LenVars) > 0 {
+		printf("\nLength variables: `%s`\n", strings.Join(spec.LenVars, "`, `"))
+	}
+	if len(spec.Features) > 0 {
+		features := []string{}
+		for f := range spec.Features {
+			features = append(features, string(f))
+		}
+		sort.Strings(features)
+		printf("\nExperimental features: `%s`\n", strings.Join(features, "`, `"))
+	}
+
+	section, mode := "", MatchNamed
+	for i, c := range spec.Cases {
+		if i == 0 || c.Section != section || c.Mode != mode {
+			if i > 0 {
+				printf("|===\n")
+			}
+			if i == 0 || c.Section != section {
+				section = c.Section
+				if section != "" {
+					printf("\n== %s\n", section)
+				}
+			}
+			mode = c.Mode
+			if mode != MatchNamed {
+				printf("\nMatch mode: `%s`\n", mode)
+			}
+			printf("\n|===\n|Pattern |Input |Result\n\n")
+		}
+
+		result := c.Expected
+		if result == "" {
+			result = "match (no bindings)"
+		}
+		printf("|`%s` |`%s` |%s\n", c.Pattern, c.Input, result)
+	}
+	if len(spec.Cases) > 0 {
+		printf("|===\n")
+	}
+
+	return err
+}
@@ -0,0 +1,26 @@
+package gen
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchSpec(t *testing.T) {
+	f, err := os.Open("testdata/spec/match.spec")
+	require.NoError(t, err)
+	defer f.Close()
+
+	spec, err := ParseMatchSpec(f)
+	require.NoError(t, err)
+
+	results, err := New().RunMatchSpec(spec)
+	require.NoError(t, err)
+
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("testdata/spec/match.spec:%d: %s against %s: expected %q but got %q", r.Case.Line, r.Case.Pattern, r.Case.Input, r.Case.Expected, r.Actual)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// specializationMarker prefixes the doc comment line of the functions generated by Specialize,
+// followed by the name of the function specialized.
+const specializationMarker = "// tsgen: specialization of "
+
+// Specialize generates a specialized copy of the functions with template type switches on their parameters
+// for each of the argument types, e.g. keysMapStringInt and keysMapStringBool of keys,
+// in which the type switch is replaced with the template clause matched.
+// The type switch of the original function becomes a dispatcher which calls the specializations.
+// With DispatchTableMin, the functions with as many specializations dispatch by a table of them
+// keyed by reflect.Type instead of the type switch.
+// If RewriteCallSites is set, the calls whose arguments are statically of the specialized types
+// are rewritten to call the specializations directly, avoiding boxing them into interfaces.
+//
+// The specializations generated by the previous runs are regenerated with the same names,
+// so that the call sites rewritten keep compiling.
+func (g Gen) Specialize() error {
+	return g.SpecializeContext(context.Background())
+}
+
+// SpecializeContext is like Specialize but can be cancelled by ctx.
+func (g Gen) SpecializeContext(ctx context.Context) error {
+	g.ctx = ctx
+
+	err := g.initProgram(needFuncBodies)
+	if err != nil {
+		return err
+	}
+
+	if g.CacheDir != "" {
+		g.cache, err = g.openAnalysisCache()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.totalCases = &caseCount{}
+	g.pta = &analysisResult{}
+
+	funcs := []*specializedFunc{}
+	for _, pkg := range g.program.AllPackages {
+		if !g.isInitial(pkg) {
+			continue
+		}
+
+		existing := existingSpecializations(pkg)
+		tables := existingDispatchTables(pkg)
+		imports := map[*ast.File]*fileImports{}
+
+		for _, file := range pkg.Files {
+			if !g.isChanged(g.tokenFile(file).Name()) {
+				continue
+			}
+
+			for _, decl := range file.Decls {
+				if err := g.context().Err(); err != nil {
+					return err
+				}
+
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+
+				f := g.specializable(pkg, file, funcDecl)
+				if f == nil {
+					continue
+				}
+
+				if imports[file] == nil {
+					imports[file] = newFileImports(file, pkg.Pkg, &pkg.Info)
+				}
+				f.stmt.imports = imports[file]
+
+				ins, err := g.possibleSubjectTypes(pkg, funcDecl, f.stmt)
+				if err != nil {
+					return err
+				}
+
+				ins, err = g.limitCases(f.stmt, funcDecl, canonicalTypes(ins))
+				if err != nil {
+					return err
+				}
+
+				g.planSpecializations(f, ins, existing[funcDecl.Name.Name], funcs)
+				g.planDispatchTable(f, tables[funcDecl.Name.Name])
+				funcs = append(funcs, f)
+			}
+		}
+	}
+
+	return g.doFiles(func(pkg *loader.PackageInfo, file *ast.File) error {
+		edits, err := g.specializeEdits(pkg, file, funcs)
+		if err != nil || len(edits) == 0 {
+			return err
+		}
+
+		err = g.editFileSource(file, edits)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range funcs {
+			if f.file == file {
+				f.stmt.imports.fix(g.Loader.Fset, file)
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// specializedFunc is a function whose type switch on a parameter is specialized.
+type specializedFunc struct {
+	pkg  *loader.PackageInfo
+	file *ast.File
+	decl *ast.FuncDecl
+	obj  types.Object
+	stmt *TypeSwitchStmt
+
+	// paramPos is the position of the parameter which is the subject of stmt.
+	paramPos int
+
+	// specs are the specializations, in the order of the input types.
+	specs []*specialization
+
+	// stale are the specializations generated by the previous runs, replaced by specs.
+	stale []*ast.FuncDecl
+
+	// table is the name of the dispatch table of the specializations, if generated instead of the cases.
+	table string
+
+	// staleTable are the declarations of the dispatch table generated by the previous runs,
+	// and staleLookup is the statement looking it up, which are replaced.
+	staleTable  []ast.Decl
+	staleLookup ast.Stmt
+}
+
+// specialization is a copy of a function specialized for the type in of the subject of its type switch.
+type specialization struct {
+	name     string
+	in       types.Type
+	template *Template
+	bindings Bindings
+
+	// existing reports whether the specialization was generated by the previous runs,
+	// so that the call sites in other files can call it.
+	existing bool
+
+	// kept reports whether the specialization is in another file than the function,
+	// which is left as it is instead of being regenerated.
+	kept bool
+}
+
+// specializable returns the function funcDecl to be specialized if it is a function, not a method,
+// whose first top-level statement of type switch is on a parameter, like switch m := m.(type),
+// and has templates. It returns nil otherwise.
+func (g Gen) specializable(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl) *specializedFunc {
+	if funcDecl.Recv != nil || funcDecl.Body == nil || isGenericFunc(funcDecl) || specializationOf(funcDecl) != "" {
+		return nil
+	}
+
+	if !g.selectsFunc(pkg, funcDecl) {
+		return nil
+	}
+
+	for _, st := range funcDecl.Body.List {
+		sw, ok := st.(*ast.TypeSwitchStmt)
+		if !ok {
+			continue
+		}
+
+		if _, ok := sw.Assign.(*ast.AssignStmt); !ok || sw.Init != nil {
+			return nil
+		}
+
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+
+		if !g.hasTemplates(stmt) {
+			return nil
+		}
+
+		// the specializations are dispatched by the parameter itself, not by the variables defined from it
+		x, _ := typeSwitchSubject(sw)
+		paramPos := subjectParamPos(&pkg.Info, funcDecl, stmt)
+		if paramPos == -1 || !isParam(&pkg.Info, funcDecl, x) {
+			return nil
+		}
+
+		// all the parameters are passed to the specializations by their names
+		for _, field := range funcDecl.Type.Params.List {
+			for _, name := range field.Names {
+				if name.Name == "_" {
+					g.warn(file, funcDecl, "%s is not specialized: it has a parameter named _", funcDecl.Name)
+					return nil
+				}
+			}
+			if len(field.Names) == 0 {
+				g.warn(file, funcDecl, "%s is not specialized: it has unnamed parameters", funcDecl.Name)
+				return nil
+			}
+		}
+
+		return &specializedFunc{
+			pkg:      pkg,
+			file:     file,
+			decl:     funcDecl,
+			obj:      pkg.Info.Defs[funcDecl.Name],
+			stmt:     stmt,
+			paramPos: paramPos,
+		}
+	}
+
+	return nil
+}
+
+// planSpecializations determines the specializations of f for the input types ins and the types of
+// the specializations generated by the previous runs, existing, which are kept by the same names.
+// The names of the others are the name of f followed by the types bound to the type variables,
+// e.g. keysStringInt for map[K]V, or by the input type if it is taken, e.g. keysMapStringInt,
+// avoiding the names in the package scope and the ones of the specializations of planned.
+func (g Gen) planSpecializations(f *specializedFunc, ins []types.Type, existing []*ast.FuncDecl, planned []*specializedFunc) {
+	existingNames := map[string]types.Type{}
+	for _, decl := range existing {
+		if t := specializedType(f.pkg, decl, f.paramPos); t != nil {
+			existingNames[decl.Name.Name] = t
+			ins = append(ins, t)
+		}
+
+		// the ones moved to other files are left as they are
+		if g.tokenFile(decl) == g.tokenFile(f.file) {
+			f.stale = append(f.stale, decl)
+		}
+	}
+	ins = canonicalTypes(ins)
+
+	taken := map[string]bool{}
+	if f.pkg.Pkg != nil {
+		for _, name := range f.pkg.Pkg.Scope().Names() {
+			taken[name] = true
+		}
+	}
+	for _, p := range planned {
+		for _, spec := range p.specs {
+			taken[spec.name] = true
+		}
+	}
+
+	// names readable without the file imports, which qualifier would add to
+	qf := func(pkg *types.Package) string {
+		if f.pkg.Pkg != nil && pkg.Path() == f.pkg.Pkg.Path() {
+			return ""
+		}
+		return pkg.Name()
+	}
+
+	handWritten := g.handWrittenTypes(f.stmt)
+
+	for _, in := range ins {
+		if containsIdentical(handWritten, in) {
+			g.log(f.file, f.stmt.node, "%s already has a case clause", in)
+			continue
+		}
+
+		if obj := f.stmt.unnameable(in); obj != nil {
+			g.warn(f.file, f.stmt.node, "%s is skipped: %s is unexported in package %s", in, obj.Name(), obj.Pkg().Path())
+			continue
+		}
+
+		t, m, violations := g.findMatchingTemplate(f.stmt, in)
+		if t == nil {
+			for _, v := range violations {
+				g.warn(f.file, f.stmt.node, "%s is skipped: %s", in, v)
+			}
+			continue
+		}
+
+		if breaksSwitch(t.Clause.Body) {
+			g.warn(f.file, t.Clause, "%s is not specialized: the template clause breaks out of the type switch", in)
+			continue
+		}
+
+		spec := &specialization{in: in, template: t, bindings: m}
+
+		for _, decl := range existing {
+			if typ, ok := existingNames[decl.Name.Name]; ok && types.Identical(typ, in) {
+				spec.name = decl.Name.Name
+				spec.existing = true
+				spec.kept = g.tokenFile(decl) != g.tokenFile(f.file)
+			}
+		}
+
+		if spec.name == "" {
+			vars := []string{}
+			for v := range m {
+				vars = append(vars, v)
+			}
+			sort.Strings(vars)
+
+			bound := []string{}
+			for _, v := range vars {
+				bound = append(bound, typeString(m[v], qf))
+			}
+
+			candidates := []string{
+				f.decl.Name.Name + camelSuffix(strings.Join(bound, "_")),
+				f.decl.Name.Name + camelSuffix(typeString(in, qf)),
+			}
+			for _, name := range candidates {
+				if !taken[name] {
+					spec.name = name
+					break
+				}
+			}
+			for i := 2; spec.name == ""; i++ {
+				if name := candidates[1] + strconv.Itoa(i); !taken[name] {
+					spec.name = name
+				}
+			}
+		}
+
+		taken[spec.name] = true
+		f.specs = append(f.specs, spec)
+	}
+}
+
+// camelSuffix makes a type expression into a suffix of identifiers, e.g. MapStringInt for map[string]int.
+func camelSuffix(expr string) string {
+	parts := strings.Split(typeSuffix(expr), "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// breaksSwitch reports whether any of stmts has an unlabeled break statement which breaks out of
+// the enclosing switch, which cannot be moved out of it.
+func breaksSwitch(stmts []ast.Stmt) bool {
+	found := false
+	for _, st := range stmts {
+		ast.Inspect(st, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+				return false
+			case *ast.BranchStmt:
+				if node.Tok == token.BREAK && node.Label == nil {
+					found = true
+				}
+			}
+			return !found
+		})
+	}
+
+	return found
+}
+
+// specializationOf returns the name of the function which funcDecl is a specialization of,
+// or an empty string if it is not generated by Specialize.
+func specializationOf(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Doc == nil {
+		return ""
+	}
+
+	for _, c := range funcDecl.Doc.List {
+		if strings.HasPrefix(c.Text, specializationMarker) {
+			return strings.TrimSpace(strings.TrimPrefix(c.Text, specializationMarker))
+		}
+	}
+
+	return ""
+}
+
+// existingSpecializations returns the specializations in pkg generated by the previous runs,
+// keyed by the names of the functions specialized.
+func existingSpecializations(pkg *loader.PackageInfo) map[string][]*ast.FuncDecl {
+	existing := map[string][]*ast.FuncDecl{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+				if name := specializationOf(funcDecl); name != "" {
+					existing[name] = append(existing[name], funcDecl)
+				}
+			}
+		}
+	}
+
+	return existing
+}
+
+// declStart returns the start of decl including its doc comment.
+func declStart(decl ast.Decl) token.Pos {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			return decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			return decl.Doc.Pos()
+		}
+	}
+
+	return decl.Pos()
+}
+
+// specializedType returns the type of the paramPos-th parameter of the specialization decl.
+func specializedType(pkg *loader.PackageInfo, decl *ast.FuncDecl, paramPos int) types.Type {
+	var pos int
+	for _, field := range decl.Type.Params.List {
+		for _, name := range field.Names {
+			if pos == paramPos {
+				if obj := pkg.Info.Defs[name]; obj != nil {
+					return obj.Type()
+				}
+				return nil
+			}
+			pos++
+		}
+	}
+
+	return nil
+}
+
+// specializeEdits returns the edits to file of pkg which specialize funcs: the type switches of the functions
+// in file dispatch to the specializations, which are inserted after the functions replacing the stale ones,
+// and if g.RewriteCallSites is set, the calls in file are rewritten to call the specializations.
+func (g Gen) specializeEdits(pkg *loader.PackageInfo, file *ast.File, funcs []*specializedFunc) ([]sourceEdit, error) {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := g.tokenFile(file)
+	offset := func(pos token.Pos) int { return tf.Offset(pos) }
+
+	edits := []sourceEdit{}
+
+	// ranges of the source replaced, where the calls are not rewritten
+	replaced := [][2]token.Pos{}
+
+	for _, f := range funcs {
+		if f.file != file {
+			continue
+		}
+
+		stale := []ast.Decl{}
+		for _, decl := range f.stale {
+			stale = append(stale, decl)
+		}
+		for _, decl := range append(stale, f.staleTable...) {
+			start := declStart(decl)
+			edits = append(edits, sourceEdit{start: offset(start), end: offset(decl.End())})
+			replaced = append(replaced, [2]token.Pos{start, decl.End()})
+		}
+
+		dispatch := []string{}
+		if f.table == "" {
+			for _, spec := range f.specs {
+				dispatch = append(dispatch, g.dispatchClause(f, spec))
+			}
+		}
+
+		if l := f.staleLookup; l != nil {
+			var lookup string
+			if f.table != "" {
+				lookup = g.dispatchLookup(f)
+			}
+			edits = append(edits, sourceEdit{start: offset(l.Pos()), end: offset(l.End()), text: []byte(lookup)})
+			replaced = append(replaced, [2]token.Pos{l.Pos(), l.End()})
+		} else if f.table != "" {
+			pos := offset(f.stmt.node.Pos())
+			edits = append(edits, sourceEdit{start: pos, end: pos, text: []byte(g.dispatchLookup(f) + "\n\n")})
+		}
+
+		edit, ok, err := g.layoutEdit(f.stmt, dispatch)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			edits = append(edits, edit)
+			replaced = append(replaced, [2]token.Pos{f.stmt.node.Pos(), f.stmt.node.End()})
+		}
+
+		var buf bytes.Buffer
+		for _, spec := range f.specs {
+			if !spec.kept {
+				buf.WriteString("\n\n" + g.specializationSource(f, spec, src))
+			}
+		}
+		if f.table != "" {
+			buf.WriteString("\n\n" + g.dispatchTableSource(f, src))
+		}
+		edits = append(edits, sourceEdit{start: offset(f.decl.End()), end: offset(f.decl.End()), text: []byte(buf.String())})
+	}
+
+	if !g.RewriteCallSites {
+		return edits, nil
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+
+		for _, r := range replaced {
+			if r[0] <= node.Pos() && node.End() <= r[1] {
+				return false
+			}
+		}
+
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var fun *ast.Ident
+		switch e := call.Fun.(type) {
+		case *ast.Ident:
+			fun = e
+		case *ast.SelectorExpr:
+			fun = e.Sel
+		default:
+			return true
+		}
+
+		for _, f := range funcs {
+			if f.obj == nil || pkg.Info.Uses[fun] != f.obj || f.paramPos >= len(call.Args) {
+				continue
+			}
+
+			t := pkg.Info.TypeOf(call.Args[f.paramPos])
+			if t == nil || types.IsInterface(t) {
+				continue
+			}
+
+			for _, spec := range f.specs {
+				if types.Identical(t, spec.in) && (f.file == file || spec.existing) {
+					edits = append(edits, sourceEdit{start: offset(fun.Pos()), end: offset(fun.End()), text: []byte(spec.name)})
+					g.log(file, call, "call rewritten to %s", spec.name)
+				}
+			}
+		}
+
+		return true
+	})
+
+	return edits, nil
+}
+
+// dispatchClause returns the source of the case clause of the type switch of f which calls spec.
+func (g Gen) dispatchClause(f *specializedFunc, spec *specialization) string {
+	bound := f.stmt.node.Assign.(*ast.AssignStmt).Lhs[0].(*ast.Ident).Name
+	call := fmt.Sprintf("%s(%s)", spec.name, strings.Join(dispatchArgs(f, bound), ", "))
+
+	return fmt.Sprintf("case %s:\n%s", typeString(spec.in, f.stmt.qualifier()), dispatchReturn(f, call))
+}
+
+// specializationSource returns the source of the specialization spec of f, whose source file is src:
+// a copy of f with the subject parameter of the type of spec.in, and the type switch replaced with
+// the body of the template clause applied. The statements following the type switch are dropped
+// if the body ends with a return statement or a panic.
+func (g Gen) specializationSource(f *specializedFunc, spec *specialization, src []byte) string {
+	tf := g.tokenFile(f.file)
+	text := func(from, to token.Pos) string {
+		return string(src[tf.Offset(from):tf.Offset(to)])
+	}
+
+	qf := f.stmt.qualifier()
+
+	clause := g.applyNested(f.stmt, spec.template, spec.bindings, spec.in)
+	g.hygiene(f.stmt, spec.template, clause, spec.bindings, spec.in)
+
+	params := []string{}
+	var pos int
+	for _, field := range f.decl.Type.Params.List {
+		for _, name := range field.Names {
+			typ := text(field.Type.Pos(), field.Type.End())
+			if pos == f.paramPos {
+				typ = typeString(spec.in, qf)
+			}
+			params = append(params, name.Name+" "+typ)
+			pos++
+		}
+	}
+
+	var results string
+	if f.decl.Type.Results != nil {
+		results = text(f.decl.Type.Results.Pos(), f.decl.Type.Results.End())
+	}
+
+	sw := f.stmt.node
+	before := text(f.decl.Body.Lbrace+1, sw.Pos())
+	if l := f.staleLookup; l != nil {
+		before = text(f.decl.Body.Lbrace+1, l.Pos()) + text(l.End(), sw.Pos())
+	}
+	before = strings.TrimSpace(before)
+	after := strings.TrimSpace(text(sw.End(), f.decl.Body.Rbrace))
+
+	body := []string{}
+	param := f.stmt.subject().Name
+	if bound := sw.Assign.(*ast.AssignStmt).Lhs[0].(*ast.Ident).Name; bound != param && refersTo(clause.Body, bound) {
+		body = append(body, fmt.Sprintf("%s := %s", bound, param))
+	}
+	for _, st := range clause.Body {
+		body = append(body, g.showNode(st))
+	}
+
+	if terminates(clause.Body) {
+		after = ""
+	}
+
+	block := strings.Join(body, "\n")
+	if before != "" || after != "" {
+		block = "{\n" + block + "\n}"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s is %s specialized for %s.\n", spec.name, f.decl.Name.Name, typeString(spec.in, qf))
+	buf.WriteString(specializationMarker + f.decl.Name.Name + "\n")
+	fmt.Fprintf(&buf, "func %s(%s) %s {\n", spec.name, strings.Join(params, ", "), results)
+	for _, s := range []string{before, block, after} {
+		if s != "" {
+			buf.WriteString(s + "\n")
+		}
+	}
+	buf.WriteString("}")
+
+	return buf.String()
+}
+
+// terminates reports whether stmts end with a return statement or a call to panic.
+func terminates(stmts []ast.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+
+	switch st := stmts[len(stmts)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		if call, ok := st.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
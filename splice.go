@@ -0,0 +1,141 @@
+package gen
+
+import (
+	"bytes"
+
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+)
+
+// declRange is the range of the source of a top-level declaration with its doc comment.
+type declRange struct {
+	start, end int
+}
+
+// declRanges parses src and returns the ranges of its top-level declarations.
+func declRanges(src []byte) ([]declRange, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := fset.File(file.Pos())
+	ranges := make([]declRange, len(file.Decls))
+	for i, decl := range file.Decls {
+		start := decl.Pos()
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		}
+		ranges[i] = declRange{start: tf.Offset(start), end: tf.Offset(decl.End())}
+	}
+
+	return ranges, nil
+}
+
+// spliceUnchanged returns out, the formatted source of file rewritten, with the top-level declarations
+// which are not changed by the rewrite replaced with their original source text, so that the code untouched
+// by tsgen is kept byte for byte instead of being reformatted, along with the spaces and comments between them.
+// A declaration is unchanged if it is formatted the same as the original one.
+func (g Gen) spliceUnchanged(file *ast.File, out []byte) []byte {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return out
+	}
+
+	formatted, err := format.Source(src)
+	if err == nil {
+		formatted, err = g.Format.reprint(formatted)
+	}
+	if err != nil {
+		return out
+	}
+
+	orig, err := declRanges(src)
+	if err != nil {
+		return out
+	}
+	before, err := declRanges(formatted)
+	if err != nil || len(before) != len(orig) {
+		return out
+	}
+	after, err := declRanges(out)
+	if err != nil || len(after) == 0 {
+		return out
+	}
+
+	text := func(b []byte, r declRange) []byte { return b[r.start:r.end] }
+
+	// match[j] is the index of the original declaration the j-th one of out is unchanged from, or -1,
+	// by the longest common subsequence of the declarations
+	n, m := len(before), len(after)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if bytes.Equal(text(formatted, before[i]), text(out, after[j])) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	match := make([]int, m)
+	for i, j := 0, 0; j < m; {
+		switch {
+		case i < n && bytes.Equal(text(formatted, before[i]), text(out, after[j])) && lcs[i][j] == lcs[i+1][j+1]+1:
+			match[j] = i
+			i, j = i+1, j+1
+		case i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			match[j] = -1
+			j++
+		}
+	}
+
+	var buf bytes.Buffer
+
+	// the spaces and comments before the first declaration, after the last one and between the declarations
+	// are the original ones if the declarations around them are unchanged and adjacent
+	if match[0] == 0 {
+		buf.Write(src[:orig[0].start])
+	} else {
+		buf.Write(out[:after[0].start])
+	}
+
+	for j := range after {
+		if i := match[j]; i != -1 {
+			buf.Write(text(src, orig[i]))
+		} else {
+			buf.Write(text(out, after[j]))
+		}
+
+		switch {
+		case j == m-1 && match[j] == n-1:
+			buf.Write(src[orig[n-1].end:])
+		case j == m-1:
+			buf.Write(out[after[j].end:])
+		case match[j] != -1 && match[j+1] == match[j]+1:
+			buf.Write(src[orig[match[j]].end:orig[match[j+1]].start])
+		default:
+			buf.Write(out[after[j].end:after[j+1].start])
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,47 @@
+package gen
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpliceUnchanged(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	untouched := "\n\n\n// untouched keeps its formatting\nfunc untouched( ) int { return 1+2 }\n"
+	source := strings.Replace(string(src), "type A struct{}", "type A struct{  }", 1) + untouched
+
+	g := New()
+	g.Sorter = ByTypeName
+	g.Overlay = map[string][]byte{"testdata/sort/cases.go": []byte(source)}
+
+	err = g.Loader.CreateFromFilenames("", "testdata/sort/cases.go")
+	require.NoError(t, err)
+
+	sources, err := g.SortBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/sort/cases.go"])
+	t.Log(out)
+
+	assert.True(t, strings.HasSuffix(out, "\n}\n\n"+strings.TrimLeft(untouched, "\n")), "untouched declarations are kept")
+	assert.Contains(t, out, "type A struct{  }")
+	assert.True(t, strings.Index(out, "case A:") < strings.Index(out, "case B:"))
+}
+
+func TestSpliceUnchanged_AddedDecls(t *testing.T) {
+	src := []byte("package a\n\nfunc f()  {}\n\nfunc g() {}\n")
+
+	g := New()
+	g.Overlay = map[string][]byte{"a.go": src}
+	file, err := g.Loader.ParseFile("a.go", src)
+	require.NoError(t, err)
+
+	out := g.spliceUnchanged(file, []byte("package a\n\nfunc f() {}\n\nfunc h() {}\n\nfunc g() { println() }\n"))
+	assert.Equal(t, "package a\n\nfunc f()  {}\n\nfunc h() {}\n\nfunc g() { println() }\n", string(out))
+}
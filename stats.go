@@ -0,0 +1,152 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/types"
+)
+
+// statsBarWidth is the width of the longest bar of the histograms of Stats.WriteReport.
+const statsBarWidth = 40
+
+// Stats are the statistics of type switches, collected by Add from the results of ListTypeSwitches,
+// possibly of several runs for the packages of a module.
+type Stats struct {
+	// Switches is the number of the type switches.
+	Switches int
+
+	// Packages maps the directories of the packages to the numbers of their type switches.
+	Packages map[string]int
+
+	// CaseCounts maps the numbers of cases to the numbers of the type switches with them.
+	CaseCounts map[int]int
+
+	// Interfaces maps the interfaces switched on to the numbers of the type switches on them.
+	Interfaces map[string]int
+
+	// CaseTypes maps the case types to the numbers of the type switches having them.
+	CaseTypes map[string]int
+}
+
+// NewStats creates an empty Stats.
+func NewStats() *Stats {
+	return &Stats{
+		Packages:   map[string]int{},
+		CaseCounts: map[int]int{},
+		Interfaces: map[string]int{},
+		CaseTypes:  map[string]int{},
+	}
+}
+
+// Add counts the type switches in list.
+func (s *Stats) Add(list []TypeSwitchInfo) {
+	for _, info := range list {
+		s.Switches++
+		s.Packages[filepath.Dir(info.Pos.Filename)]++
+		s.CaseCounts[info.Cases]++
+
+		if info.Type != nil {
+			if _, ok := info.Type.Underlying().(*types.Interface); ok {
+				s.Interfaces[info.Type.String()]++
+			}
+		}
+
+		for _, t := range info.CaseTypes {
+			s.CaseTypes[t.String()]++
+		}
+	}
+}
+
+// WriteReport writes the statistics to w: the numbers of type switches per package,
+// the histogram of the numbers of cases, and the top interfaces switched on and case types,
+// at most top of each or all of them if top is 0.
+func (s *Stats) WriteReport(w io.Writer, top int) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d type switches in %d packages\n", s.Switches, len(s.Packages))
+
+	buf.WriteString("\ntype switches per package:\n")
+	writeHistogram(&buf, sortedCounts(s.Packages, 0))
+
+	cases := []int{}
+	for n := range s.CaseCounts {
+		cases = append(cases, n)
+	}
+	sort.Ints(cases)
+
+	caseCounts := []labelCount{}
+	for _, n := range cases {
+		caseCounts = append(caseCounts, labelCount{label: fmt.Sprint(n), count: s.CaseCounts[n]})
+	}
+
+	buf.WriteString("\ncases per type switch:\n")
+	writeHistogram(&buf, caseCounts)
+
+	buf.WriteString("\ninterfaces switched on:\n")
+	writeHistogram(&buf, sortedCounts(s.Interfaces, top))
+
+	buf.WriteString("\ncase types:\n")
+	writeHistogram(&buf, sortedCounts(s.CaseTypes, top))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type labelCount struct {
+	label string
+	count int
+}
+
+// sortedCounts returns the counts in descending order, and then in the order of the labels,
+// at most top of them unless top is 0.
+func sortedCounts(counts map[string]int, top int) []labelCount {
+	list := []labelCount{}
+	for label, count := range counts {
+		list = append(list, labelCount{label: label, count: count})
+	}
+	sort.Sort(byCount(list))
+
+	if top > 0 && len(list) > top {
+		list = list[:top]
+	}
+
+	return list
+}
+
+// writeHistogram writes the counts with bars scaled to statsBarWidth.
+func writeHistogram(buf *bytes.Buffer, counts []labelCount) {
+	if len(counts) == 0 {
+		buf.WriteString("  (none)\n")
+		return
+	}
+
+	width, max := 0, 0
+	for _, c := range counts {
+		if len(c.label) > width {
+			width = len(c.label)
+		}
+		if c.count > max {
+			max = c.count
+		}
+	}
+
+	for _, c := range counts {
+		bar := (c.count*statsBarWidth + max - 1) / max
+		fmt.Fprintf(buf, "  %-*s %s %d\n", width, c.label, strings.Repeat("#", bar), c.count)
+	}
+}
+
+type byCount []labelCount
+
+func (s byCount) Len() int      { return len(s) }
+func (s byCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool {
+	if s[i].count != s[j].count {
+		return s[i].count > s[j].count
+	}
+	return s[i].label < s[j].label
+}
@@ -0,0 +1,42 @@
+package gen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+
+	for _, filename := range []string{"testdata/list.go", "testdata/consistency/shape.go"} {
+		g := New()
+		err := g.Loader.CreateFromFilenames("", filename)
+		require.NoError(t, err)
+
+		list, err := g.ListTypeSwitches()
+		require.NoError(t, err)
+
+		stats.Add(list)
+	}
+
+	assert.Equal(t, 9, stats.Switches)
+	assert.Equal(t, map[string]int{"testdata": 6, "testdata/consistency": 3}, stats.Packages)
+	assert.Equal(t, map[int]int{1: 5, 2: 2, 3: 2}, stats.CaseCounts)
+	assert.Equal(t, 3, stats.Interfaces["shape.Shape"])
+	assert.Equal(t, 5, stats.Interfaces["interface{}"])
+	assert.Equal(t, 3, stats.CaseTypes["shape.Circle"])
+	assert.Equal(t, 1, stats.CaseTypes["int"])
+
+	var buf bytes.Buffer
+	err := stats.WriteReport(&buf, 2)
+	require.NoError(t, err)
+
+	t.Log(buf.String())
+
+	assert.Contains(t, buf.String(), "9 type switches in 2 packages\n")
+	assert.Contains(t, buf.String(), "\ncases per type switch:\n  1 ######################################## 5\n  2 ################ 2\n")
+	assert.Contains(t, buf.String(), "\ninterfaces switched on:\n  interface{} ######################################## 5\n  shape.Shape ######################## 3\n\n")
+}
@@ -0,0 +1,27 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+func keys(x interface{}) []string {
+	m := x.(map[string]T)
+	ks := []string{}
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks // sorted later
+}
+
+func describe(x interface{}) {
+	if _, ok := x.(fmt.Stringer); ok {
+		return
+	}
+	fmt.Println(x)
+}
+
+func main() {
+	keys(map[string]int{})
+	keys(map[string]bool{})
+	describe(1)
+}
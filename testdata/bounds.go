@@ -0,0 +1,34 @@
+package testdata
+
+import (
+	"fmt"
+	"time"
+)
+
+// I is an ordinary interface, not a type variable, though named like one.
+type I interface {
+	String() string
+}
+
+// S is a type variable bounded by fmt.Stringer.
+// +tsgen typevar
+type S interface {
+	fmt.Stringer
+}
+
+func main() {
+	describe(time.Second)
+	describe([]time.Duration{})
+	describe([]int{})
+}
+
+func describe(x interface{}) string {
+	switch x := x.(type) {
+	case I:
+		return x.String()
+	case []S:
+		return x[0].String()
+	}
+
+	return ""
+}
@@ -0,0 +1,6 @@
+//go:build extra
+// +build extra
+
+package main
+
+func extra() {}
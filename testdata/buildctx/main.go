@@ -0,0 +1,8 @@
+package main
+
+func main() {
+	describe(platform())
+}
+
+func describe(x interface{}) {
+}
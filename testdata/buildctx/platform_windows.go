@@ -0,0 +1,3 @@
+package main
+
+func platform() int { return 0 }
@@ -0,0 +1,43 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+// S is bounded by fmt.Stringer.
+// +tsgen typevar
+type S interface {
+	String() string
+}
+
+type Shape interface {
+	Area() float64
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case []S:
+		return v[0].String()
+	case map[string]S:
+		// S has no Len method
+		return fmt.Sprint(v[""].Len())
+	case []T:
+		// compiles only if T is an interface
+		_, ok := v[0].(fmt.Stringer)
+		return fmt.Sprint(ok)
+	default:
+		return ""
+	}
+}
+
+func area(s Shape) float64 {
+	switch s := s.(type) {
+	case T:
+		// s has the methods of Shape when generated
+		return s.Area()
+	case []T:
+		return float64(len(s))
+	}
+
+	return 0
+}
@@ -0,0 +1,22 @@
+package testdata
+
+type T interface{}
+
+func main() {
+	first(map[string]int{})
+	first(map[string]bool{})
+}
+
+func first(m interface{}) interface{} {
+	switch m := m.(type) {
+	case map[string]T:
+		// the first value found
+		var r T // <-- T here
+		for _, v := range m {
+			r = v /* found */
+			break
+		}
+		return r // zero if empty
+	}
+	return nil
+}
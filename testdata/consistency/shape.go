@@ -0,0 +1,50 @@
+package shape
+
+import "fmt"
+
+type Shape interface {
+	isShape()
+}
+
+type Circle struct{ R float64 }
+type Square struct{ Side float64 }
+type Triangle struct{ Base, Height float64 }
+
+func (Circle) isShape()   {}
+func (Square) isShape()   {}
+func (Triangle) isShape() {}
+
+func Area(s Shape) float64 {
+	switch s := s.(type) {
+	case Circle:
+		return 3.14 * s.R * s.R
+	case Square:
+		return s.Side * s.Side
+	case Triangle:
+		return s.Base * s.Height / 2
+	}
+
+	return 0
+}
+
+func Name(s Shape) string {
+	switch s.(type) {
+	case Circle:
+		return "circle"
+	case Square:
+		return "square"
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+func Corners(s Shape) int {
+	switch s.(type) {
+	case Circle, nil:
+		return 0
+	case Triangle:
+		return 3
+	}
+
+	return -1
+}
@@ -0,0 +1,23 @@
+package testdata
+
+type T interface{}
+
+func main() {
+	describe(map[string]int{})
+	describe(map[string]bool{})
+	describe("s")
+	describe(1)
+}
+
+func describe(x interface{}) string {
+	switch x := x.(type) {
+	case map[string]T:
+		return "map"
+	case []T:
+		return "slice"
+	case string:
+		return x
+	}
+
+	return ""
+}
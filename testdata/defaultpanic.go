@@ -0,0 +1,25 @@
+package testdata
+
+type T interface{}
+
+func main() {
+	length([]int{})
+	length([]string{})
+	count([]int{})
+}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		return len(v)
+	}
+	return 0
+}
+
+func count(v interface{}) int {
+	switch v.(type) {
+	case []T:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,34 @@
+package testdata
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type T interface{}
+
+func describe(v interface{}) string {
+	//tsgen:expand types=int,*bytes.Buffer,map[string]int default=panic
+	switch v := v.(type) {
+	case T:
+		return fmt.Sprint(v)
+	}
+
+	return ""
+}
+
+func length(v interface{}) int {
+	//tsgen:expand types=[]int,[]string dedupe=true templates=delete
+	switch v.(type) {
+	case []T:
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	describe(1)
+	length([]int{})
+	fmt.Print(&bytes.Buffer{})
+}
@@ -0,0 +1,33 @@
+package testdata
+
+type T interface{}
+
+type Describer interface {
+	Describe(v interface{}) string
+}
+
+type describer struct{}
+
+func (describer) Describe(v interface{}) string {
+	return describe(v)
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case []T:
+		if len(v) == 0 {
+			return "empty"
+		}
+		return "slice"
+	}
+
+	return "other"
+}
+
+func main() {
+	f := describe
+	f([]int{1})
+
+	var d Describer = describer{}
+	d.Describe([]string{"a"})
+}
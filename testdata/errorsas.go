@@ -0,0 +1,34 @@
+package testdata
+
+import (
+	"fmt"
+	"os"
+)
+
+// +tsgen typevar
+type T interface {
+	error
+}
+
+type NotFound struct {
+	Name string
+}
+
+func (e *NotFound) Error() string {
+	return e.Name + " not found"
+}
+
+func main() {
+	describe(&NotFound{"x"})
+	describe(&os.PathError{})
+	describe(fmt.Errorf("describe %s: %w", "y", &NotFound{"y"}))
+}
+
+func describe(err error) string {
+	switch err := err.(type) {
+	case T:
+		return "error: " + err.Error()
+	}
+
+	return ""
+}
@@ -0,0 +1,30 @@
+package testdata
+
+type T interface{}
+
+func main() {
+	describe(1)
+	describe("s")
+	describe([]int{})
+	describe([]int{})
+
+	local()
+}
+
+func describe(x interface{}) string {
+	switch x := x.(type) {
+	case []T:
+		return "slice"
+	case string:
+		return x
+	}
+
+	return ""
+}
+
+func local() {
+	var x interface{} = 1
+	switch x.(type) {
+	case []T:
+	}
+}
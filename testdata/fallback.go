@@ -0,0 +1,70 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+// +tsgen typevar
+type S interface {
+	String() string
+}
+
+func main() {
+	keys(map[string]int{})
+	length([]int{})
+	describe([]fmt.Stringer{})
+	show(1)
+	total(new(int))
+}
+
+func keys(m interface{}) []string {
+	switch m := m.(type) {
+	case map[string]T:
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		return keys
+	default:
+		return nil
+	}
+}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		// the elements as T
+		var elems []T
+		elems = append(elems, v...)
+		return len(elems)
+	}
+	return -1
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case []S:
+		s := ""
+		for _, e := range v {
+			s += e.String()
+		}
+		return s
+	}
+	return ""
+}
+
+func show(v interface{}) string {
+	switch v.(type) {
+	case T:
+		return "any"
+	}
+	return "nil"
+}
+
+func total(v interface{}) int {
+	switch v := v.(type) {
+	case *T:
+		return len(fmt.Sprint(*v))
+	}
+	return 0
+}
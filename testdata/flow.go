@@ -0,0 +1,55 @@
+package testdata
+
+type T interface{}
+
+type holder struct {
+	v interface{}
+}
+
+func get() interface{} {
+	return []string{}
+}
+
+func initStmt(p interface{}) int {
+	switch v := p; x := v.(type) {
+	case []T:
+		return len(x)
+	}
+	return 0
+}
+
+func defined(p interface{}) int {
+	v := p
+	w := (v)
+	switch x := w.(type) {
+	case []T:
+		return len(x)
+	}
+	return 0
+}
+
+func field(h holder) int {
+	switch x := h.v.(type) {
+	case []T:
+		return len(x)
+	}
+	return 0
+}
+
+func call() int {
+	switch v := get(); x := v.(type) {
+	case []T:
+		return len(x)
+	}
+	return 0
+}
+
+func reassigned(p interface{}) int {
+	v := p
+	v = []int{}
+	switch x := v.(type) {
+	case []T:
+		return len(x)
+	}
+	return 0
+}
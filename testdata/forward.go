@@ -0,0 +1,28 @@
+package main
+
+type T interface{}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		return len(v)
+	}
+	return 0
+}
+
+// lengthWrap forwards its parameter to length
+func lengthWrap(v interface{}) int {
+	return length(v)
+}
+
+// lengthLogged forwards through another wrapper, passing a value of its own too
+func lengthLogged(v interface{}) int {
+	lengthWrap([]byte("called"))
+	return lengthWrap(v)
+}
+
+func main() {
+	lengthWrap([]string{})
+	lengthLogged([]bool{})
+	length([]int{})
+}
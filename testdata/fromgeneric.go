@@ -0,0 +1,47 @@
+package testdata
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Celsius float64
+
+func (c Celsius) String() string { return strconv.FormatFloat(float64(c), 'f', 1, 64) + "°C" }
+
+// format formats a value with its unit.
+func format[T int | Celsius | float64](v T, prec int) string {
+	var zero T
+	if v == zero {
+		return "0"
+	}
+	return fmt.Sprintf("%.*v", prec, v)
+}
+
+func describe[S fmt.Stringer](s S) string {
+	return "<" + s.String() + ">"
+}
+
+func pair[K comparable, V any](k K, v V) {}
+
+func use() {
+	fmt.Println(format(1, 0), format[Celsius](20, 1), format(3, 0))
+	fmt.Println(describe(Celsius(1)))
+	fmt.Println(format[float64](1.5, 2))
+}
+
+func useValue() {
+	f := describe[Celsius]
+	fmt.Println(f(2))
+}
+
+func label[L any](l L) string {
+	return fmt.Sprint(l)
+}
+
+func labelAll[U any](us []U) {
+	for _, u := range us {
+		label(u)
+	}
+	label("x")
+}
@@ -0,0 +1,29 @@
+package main
+
+type T interface{}
+
+type shape struct{}
+
+func main() {
+	describe(1)
+	shape{}.area(1)
+	(&shape{}).name(1)
+}
+
+func describe(x interface{}) {
+	switch x.(type) {
+	case T:
+	}
+}
+
+func (s shape) area(x interface{}) {
+	switch x.(type) {
+	case T:
+	}
+}
+
+func (s *shape) name(x interface{}) {
+	switch x.(type) {
+	case T:
+	}
+}
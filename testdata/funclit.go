@@ -0,0 +1,32 @@
+package testdata
+
+type T interface{}
+
+func each(list []interface{}, f func(interface{}) int) {
+	for _, v := range list {
+		f(v)
+	}
+}
+
+func main() {
+	size := func(v interface{}) int {
+		switch v := v.(type) {
+		case []T:
+			return len(v)
+		}
+
+		return 0
+	}
+
+	size([]int{1, 2})
+	size([]string{"a"})
+
+	each([]interface{}{map[string]bool{}}, func(v interface{}) int {
+		switch v := v.(type) {
+		case map[string]T:
+			return len(v)
+		}
+
+		return 0
+	})
+}
@@ -0,0 +1,38 @@
+package testdata
+
+type T interface{}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		return len(v)
+	}
+	return 0
+}
+
+func First[E any](v interface{}) E {
+	var zero E
+	switch v := v.(type) {
+	case []T:
+		_ = v
+	}
+	return zero
+}
+
+type Box[E any] struct{ items []E }
+
+func (b *Box[E]) Len(v interface{}) int {
+	switch v := v.(type) {
+	case E:
+		return 1
+	case []T:
+		return len(v)
+	}
+	return len(b.items)
+}
+
+func main() {
+	length([]int{})
+	First[int]([]string{})
+	(&Box[int]{}).Len([]bool{})
+}
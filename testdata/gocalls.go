@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+type T interface{}
+
+type S struct{}
+
+func (s *S) show(v interface{}) string {
+	switch v := v.(type) {
+	case []T:
+		return fmt.Sprint(len(v))
+	}
+	return ""
+}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		return len(v)
+	}
+	return 0
+}
+
+func main() {
+	go length([]string{})
+	defer length([]bool{})
+
+	s := &S{}
+	s.show([]byte{})
+	go s.show([]uint{})
+
+	// method value and method expression
+	f := s.show
+	f([]float64{})
+	g := (*S).show
+	g(s, []rune{})
+}
@@ -0,0 +1,37 @@
+package testdata
+
+type T interface{}
+
+type Celsius float64
+
+func (c *Celsius) Scan(s string) error {
+	return nil
+}
+
+type Name string
+
+func (n *Name) Scan(b []byte) error {
+	return nil
+}
+
+// Count has a Scan method of another signature.
+type Count int
+
+func (n *Count) Scan(s string) (int, error) {
+	return 0, nil
+}
+
+func decode(v interface{}) error {
+	switch v := v.(type) {
+	case interface{ Scan(T) error }:
+		var x T
+		return v.Scan(x)
+	}
+
+	return nil
+}
+
+func main() {
+	var c Celsius
+	decode(&c)
+}
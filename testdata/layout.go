@@ -0,0 +1,33 @@
+package testdata
+
+type T interface{}
+
+func main() {
+	keys(map[string]int{})
+	keys(map[string]bool{})
+	keys(map[string]string{})
+}
+
+func keys(m interface{}) []string {
+	switch m := m.(type) {
+	default:
+		panic("unexpected")
+	// tsgen: begin generated cases
+	case map[string]float64:
+		return nil
+	case map[string]int:
+		return nil
+	// tsgen: end generated cases
+
+	case map[string]T:
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		return keys
+
+	// hand-written
+	case map[string]string:
+		return []string{"a"}
+	}
+}
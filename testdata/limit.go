@@ -0,0 +1,23 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+func main() {
+	describe("s")
+	describe([]int{})
+	describe([]bool{})
+	describe(1)
+}
+
+func describe(x interface{}) string {
+	switch x := x.(type) {
+	case string:
+		return x
+	case []T:
+		return fmt.Sprint(len(x))
+	}
+
+	return ""
+}
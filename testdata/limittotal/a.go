@@ -0,0 +1,30 @@
+package limittotal
+
+type T interface{}
+
+func main() {
+	fits([]string{})
+	unmatched([]int{})
+	unmatched(1)
+	later([]int{})
+	later([]bool{})
+}
+
+func fits(x interface{}) int {
+	switch x := x.(type) {
+	case []T:
+		return len(x)
+	}
+
+	return 0
+}
+
+// int matches no template
+func unmatched(x interface{}) int {
+	switch x := x.(type) {
+	case []T:
+		return len(x)
+	}
+
+	return 0
+}
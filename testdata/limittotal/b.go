@@ -0,0 +1,10 @@
+package limittotal
+
+func later(x interface{}) int {
+	switch x := x.(type) {
+	case []T:
+		return len(x)
+	}
+
+	return 0
+}
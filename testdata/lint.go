@@ -0,0 +1,45 @@
+package testdata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type T interface{}
+
+func main() {
+	describe(1)
+	describe(&bytes.Buffer{})
+	describe([]int{})
+	describe("s")
+
+	show(&bytes.Buffer{})
+	show(new(int))
+}
+
+func describe(x interface{}) string {
+	switch x := x.(type) {
+	case io.Reader:
+		return "reader"
+	case *bytes.Buffer:
+		return x.String()
+	case []T:
+		return fmt.Sprint(len(x))
+	case string:
+		return x
+	}
+
+	return ""
+}
+
+func show(x interface{}) {
+	switch x := x.(type) {
+	case fmt.Stringer:
+		fmt.Println(x.String())
+	case *T:
+		fmt.Println(*x)
+	default:
+		fmt.Println(x)
+	}
+}
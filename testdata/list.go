@@ -0,0 +1,56 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+type S struct{}
+
+func keys(m interface{}) []string {
+	switch m := m.(type) {
+	case map[string]T:
+		ks := []string{}
+		for k := range m {
+			ks = append(ks, k)
+		}
+		return ks
+	}
+	return nil
+}
+
+func apply(v interface{}, f interface{}) {
+	switch v := v.(type) {
+	case T:
+		switch f := f.(type) {
+		case func(T):
+			f(v)
+		}
+	}
+}
+
+func (s *S) describe(v interface{}) string {
+	switch v.(type) {
+	case int, string:
+		return "basic"
+	default:
+		return "other"
+	}
+}
+
+func local() {
+	var x interface{} = []int{}
+	switch x := x.(type) {
+	case []T:
+		fmt.Println(len(x))
+	}
+
+	f := func(v fmt.Stringer) {
+		if v != nil {
+			switch v := v.(type) {
+			case T:
+				fmt.Println(v)
+			}
+		}
+	}
+	f(nil)
+}
@@ -0,0 +1,26 @@
+package E
+
+type I interface {
+	meth()
+	added()
+}
+
+type T1 struct{}
+
+func (t T1) meth()  {}
+func (t T1) added() {}
+
+type T2 struct{}
+
+func (t T2) meth() {}
+
+func f(i I) {
+	switch i := i.(type) {
+	case T1:
+		_ = i
+	case T2:
+		i.meth()
+	}
+
+	_ = i.(T2)
+}
@@ -0,0 +1,24 @@
+package testdata
+
+type A interface{}
+type B interface{}
+
+func main() {
+	add(1, 2)
+	add(1.5, 2)
+	add("a", "b")
+}
+
+func add(a, b interface{}) []interface{} {
+	switch a := a.(type) {
+	case A:
+		switch b := b.(type) {
+		case B:
+			var x A = a
+			var y B = b
+			return []interface{}{x, y}
+		}
+	}
+
+	return nil
+}
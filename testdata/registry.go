@@ -0,0 +1,31 @@
+package testdata
+
+type T interface{}
+
+type Point struct{ X, Y int }
+
+type Circle struct{ R float64 }
+
+type Line struct{}
+
+func Register(v interface{}) {}
+
+func RegisterHandler(name string, h interface{}) {}
+
+func handle(v interface{}) string {
+	switch v := v.(type) {
+	case *T:
+		_ = v
+		return "pointer"
+	case T:
+		_ = v
+		return "value"
+	}
+	return ""
+}
+
+func init() {
+	Register(Circle{})
+	RegisterHandler("point", new(Point))
+	RegisterHandler("line", &Line{})
+}
@@ -0,0 +1,35 @@
+package server
+
+type T interface{}
+
+type Request struct {
+	Body interface{}
+}
+
+func HandleRequest(req *Request, opts ...string) {
+	describe(req.Body)
+	describe(len(opts))
+}
+
+type Worker struct{}
+
+func (w *Worker) Run() {
+	describe("job")
+}
+
+func (w Worker) String() string {
+	return "worker"
+}
+
+func handle(req request) {}
+
+type request struct{}
+
+func describe(v interface{}) string {
+	switch v.(type) {
+	case []T:
+		return "slice"
+	}
+
+	return "other"
+}
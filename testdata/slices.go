@@ -0,0 +1,32 @@
+package main
+
+type T interface{}
+
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case []T:
+		return len(v)
+	}
+	return 0
+}
+
+// Process passes each of items to length
+func Process(items ...interface{}) int {
+	n := 0
+	for _, it := range items {
+		n += length(it)
+	}
+	return n
+}
+
+func main() {
+	list := []interface{}{[]int{}, []string{}}
+	for _, it := range list {
+		length(it)
+	}
+
+	Process([]bool{}, []byte{})
+
+	items := []interface{}{[]float64{}}
+	Process(items...)
+}
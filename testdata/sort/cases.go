@@ -0,0 +1,35 @@
+package E
+
+type I interface {
+	meth()
+}
+
+type J interface {
+	other()
+}
+
+type C struct{}
+
+func (c C) meth()  {}
+func (c C) other() {}
+
+type A struct{}
+
+func (a A) meth() {}
+
+type B struct{}
+
+func (b B) other() {}
+
+func f(i interface{}) {
+	switch i := i.(type) {
+	default:
+		_ = i
+	case B:
+		_ = i
+		_ = i
+	case C:
+	case A:
+		_ = i
+	}
+}
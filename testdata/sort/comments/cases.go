@@ -0,0 +1,36 @@
+package E
+
+type I interface {
+	meth()
+}
+
+type J interface {
+	other()
+}
+
+type C struct{}
+
+func (c C) meth()  {}
+func (c C) other() {}
+
+type A struct{}
+
+func (a A) meth() {}
+
+type B struct{}
+
+func (b B) other() {}
+
+func f(i interface{}) {
+	switch i := i.(type) { // sorted
+	default:
+		_ = i // default
+	case B:
+		_ = i
+		_ = i // B
+	case C: // C is empty
+	// A is last
+	case A:
+		_ = i
+	}
+}
@@ -0,0 +1,57 @@
+package E
+
+type Color int
+
+const (
+	Red Color = iota + 2
+	Green
+	Blue
+	Black = 0
+)
+
+func name(c Color) string {
+	switch c {
+	// Blue is the sky
+	case Blue:
+		return "blue"
+	case Black:
+		return "black"
+	case Green, 10:
+		return "green"
+	default:
+		return ""
+	case Red:
+		return "red"
+	}
+}
+
+func weight(s string) int {
+	switch s {
+	case "m":
+		return 2
+	case "l":
+		return 3
+	case "s":
+		return 1
+	}
+
+	switch {
+	case s == "xs":
+		return 0
+	case s == "xl":
+		return 4
+	}
+
+	return -1
+}
+
+func next(c Color) Color {
+	switch c {
+	case Green:
+		fallthrough
+	case Red:
+		return Blue
+	}
+
+	return Red
+}
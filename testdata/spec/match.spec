@@ -0,0 +1,112 @@
+# The specification of the pattern matching semantics of template case clauses.
+# Each line is: <pattern> | <input type> | <expected bindings or "no match">
+typevars T S
+typevar R fmt.Stringer
+lenvars N
+features arrays,interfaces
+import io
+import fmt
+import time
+
+## Type variables
+T | int | T=int
+T | []io.Reader | T=[]io.Reader
+*T | *int | T=int
+*T | int | no match
+
+## Bounded type variables
+R | time.Duration | R=time.Duration
+[]R | []time.Duration | R=time.Duration
+[]R | []int | no match
+
+## Basic and named types
+int | int | 
+int | string | no match
+io.Reader | io.Reader | 
+io.Reader | io.Writer | no match
+int64 | time.Duration | no match
+time.Duration | int64 | no match
+
+## Slices and arrays
+[]T | []int | T=int
+[]T | map[int]int | no match
+[]chan<- T | []chan<- bool | T=bool
+[3]T | [3]int | T=int
+[3]T | [4]int | no match
+[3]T | []int | no match
+[N]T | [4]int | N=4, T=int
+[N][N]T | [2][2]byte | N=2, T=byte
+[N][N]T | [2][3]byte | no match
+
+## Maps
+map[string]T | map[string][]io.Reader | T=[]io.Reader
+map[T]bool | map[int]bool | T=int
+map[T]bool | map[int]string | no match
+map[T]S | map[int]string | S=string, T=int
+map[T]S | map[string][]io.Reader | S=[]io.Reader, T=string
+map[T]T | map[int]int | T=int
+map[T]T | map[int]string | no match
+
+## Channels
+chan T | chan int | T=int
+chan<- T | chan<- int | T=int
+chan<- T | chan int | no match
+<-chan T | chan<- int | no match
+<-chan T | <-chan int | T=int
+<-chan T | chan int | no match
+chan T | <-chan int | no match
+chan T | chan<- int | no match
+chan (<-chan T) | chan (<-chan int) | T=int
+chan (<-chan T) | chan chan int | no match
+
+## Functions
+func(T) | func(int) | T=int
+func(T) (S, error) | func(bool) (io.Reader, error) | S=io.Reader, T=bool
+func(T) | func(int, int) | no match
+func(T) T | func(int) int | T=int
+func(T) T | func(int) string | no match
+func(T) error | func(int) | no match
+func(...T) error | func(...int) error | T=int
+func(...T) error | func([]int) error | no match
+func([]T) error | func(...int) error | no match
+func(string, ...T) | func(string, ...io.Reader) | T=io.Reader
+T | func(...int) | T=func(...int)
+
+## Structs
+struct{ foo T } | struct{ foo []byte } | T=[]byte
+struct{ foo T } | struct{ foo, bar int } | no match
+struct{ foo T } | struct{ bar int } | no match
+struct{ foo T; bar S } | struct{ foo int; bar string } | S=string, T=int
+struct{ foo, bar T } | struct{ foo, bar int } | T=int
+struct{ foo, bar T } | struct{ foo int; bar string } | no match
+struct{ foo T "tag" } | struct{ foo int "tag" } | T=int
+struct{ foo T "tag" } | struct{ foo int } | no match
+struct{ io.Reader; n T } | struct{ io.Reader; n int } | T=int
+struct{ io.Reader; n T } | struct{ r io.Reader; n int } | no match
+struct{ T } | struct{ io.Reader } | T=io.Reader
+struct{ T } | struct{ r io.Reader } | no match
+
+## Interfaces
+interface{} | interface{} | 
+interface{} | interface{ Read() } | no match
+interface{ String() T } | time.Duration | T=string
+interface{ String() T } | int | no match
+interface{ String() T } | fmt.Stringer | T=string
+interface{ Read(T) (S, error) } | io.ReadCloser | S=int, T=[]byte
+interface{ Read(T) (T, error) } | io.Reader | no match
+
+## Named types
+# Named types match by their names by default (mode named);
+# with mode underlying they match by their underlying types, and with mode either by both.
+mode underlying
+int64 | time.Duration | 
+[]int64 | []time.Duration | 
+T | time.Duration | T=int64
+time.Duration | time.Duration | no match
+mode either
+int64 | time.Duration | 
+T | time.Duration | T=time.Duration
+[]T | []time.Duration | T=time.Duration
+time.Duration | time.Duration | 
+time.Duration | int64 | no match
+map[T]T | map[time.Duration]int64 | no match
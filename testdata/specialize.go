@@ -0,0 +1,27 @@
+package testdata
+
+import "fmt"
+
+type K interface{}
+type V interface{}
+
+func main() {
+	keys(map[string]int{})
+	keys(map[string]bool{})
+
+	var m interface{} = map[string]int{}
+	keys(m)
+}
+
+func keys(m interface{}) []string {
+	switch m := m.(type) {
+	case map[K]V:
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		return keys
+	}
+
+	return nil
+}
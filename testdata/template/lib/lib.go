@@ -0,0 +1,36 @@
+package lib
+
+import "strings"
+
+type K interface{}
+type V interface{}
+
+// Sep separates the pairs joined by Join.
+const Sep = ", "
+
+// Keys returns the keys of m.
+// +tsgen template
+func Keys(m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Join formats the values of m as strings joined by Sep.
+// +tsgen template
+func Join(m map[K]V, format func(V) string) string {
+	parts := []string{}
+	for _, v := range m {
+		parts = append(parts, format(V(v)))
+	}
+
+	return strings.Join(parts, Sep)
+}
+
+// Lookup is not a template.
+func Lookup(m map[K]V, k K) V {
+	return m[k]
+}
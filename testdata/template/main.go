@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	_ "github.com/motemen/go-typeswitch-gen/testdata/template/lib"
+)
+
+type Score int
+
+// +tsgen instantiate lib.Keys K=string V=Score
+func KeysStringScore(m map[string]Score) []string {
+	return nil
+}
+
+// +tsgen instantiate lib.Join K=string V=Score as joinScores
+
+func main() {
+	scores := map[string]Score{"a": 1, "b": 2}
+	fmt.Println(strings.Join(KeysStringScore(scores), ","))
+}
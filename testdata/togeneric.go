@@ -0,0 +1,30 @@
+package testdata
+
+import "fmt"
+
+type Celsius float64
+
+// format formats a value with its unit.
+func format(v interface{}, prec int) string {
+	switch v := v.(type) {
+	case int:
+		return fmt.Sprintf("%d", v)
+	case Celsius:
+		return fmt.Sprintf("%.*f°C", prec, float64(v))
+	case float32, float64:
+		return fmt.Sprintf("%.*v", prec, v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return "?"
+	}
+}
+
+func printAll(x interface{}, names ...string) {
+	switch x.(type) {
+	case string:
+		fmt.Println(names)
+	case []string:
+		fmt.Println(x)
+	}
+}
@@ -0,0 +1,30 @@
+package testdata
+
+type T interface{}
+type K interface{}
+
+func main() {
+	kind([]int{1})
+	keys([]int{1})
+}
+
+func kind(v interface{}) string {
+	switch v.(type) {
+	case []T:
+		return "slice"
+	case map[K]T:
+		return "map"
+	}
+
+	return ""
+}
+
+func keys(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []T:
+		var k K
+		return []interface{}{k, v}
+	}
+
+	return nil
+}
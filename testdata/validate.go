@@ -0,0 +1,21 @@
+package testdata
+
+import "fmt"
+
+type T interface{}
+
+func main() {
+	first([]fmt.Stringer{})
+	first([]int{})
+}
+
+func first(s interface{}) fmt.Stringer {
+	switch s := s.(type) {
+	case []T:
+		// compiles only if T is an interface
+		x, _ := s[0].(fmt.Stringer)
+		return x
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package testdata
+
+type Node interface {
+	Pos() int
+}
+
+type Binary struct {
+	Op          string
+	Left, Right Node
+}
+
+func (*Binary) Pos() int { return 0 }
+
+type Literal int
+
+func (Literal) Pos() int { return 0 }
+
+type Ident string
+
+func (Ident) Pos() int { return 0 }
+
+func eval(n Node, env map[string]int) int {
+	switch n := n.(type) {
+	case *Binary:
+		if n.Op == "+" {
+			return eval(n.Left, env) + eval(n.Right, env)
+		}
+		return eval(n.Left, env) * eval(n.Right, env)
+	case Literal:
+		return int(n)
+	case Ident:
+		return env[string(n)]
+	}
+
+	panic("unknown node")
+}
@@ -0,0 +1,212 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go/ast"
+	"go/format"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// generatedTests holds the test files generated in a run with g.GenerateTests,
+// which are written after the files rewritten.
+type generatedTests struct {
+	sync.Mutex
+
+	// files maps the names of the test files to their sources.
+	files map[string][]byte
+}
+
+// TestFileName returns the name of the test file generated for the file filename with Gen.GenerateTests,
+// e.g. keys_tsgen_test.go for keys.go.
+func TestFileName(filename string) string {
+	return strings.TrimSuffix(filename, ".go") + "_tsgen_test.go"
+}
+
+// caseTest is a test of a generated case, which calls fn with a zero value of typ as the parameter
+// of index param, switched on by the expanded type switch.
+type caseTest struct {
+	fn    *types.Func
+	param int
+	typ   types.Type
+}
+
+// addCaseTests generates the test file of file, which is rewritten by expansions,
+// with a test for each of the generated cases.
+func (g Gen) addCaseTests(pkg *loader.PackageInfo, file *ast.File, expansions []*expansion) error {
+	tests := []caseTest{}
+
+	for _, e := range expansions {
+		if !e.edited {
+			continue
+		}
+
+		fn, ok := pkg.Defs[e.funcDecl.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+
+		x := subjectSource(&pkg.Info, e.funcDecl, e.stmt)
+		ident, ok := x.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		sig := fn.Type().(*types.Signature)
+		param := -1
+		for i := 0; i < sig.Params().Len(); i++ {
+			if sig.Params().At(i) == pkg.Uses[ident] {
+				param = i
+			}
+		}
+		if param == -1 || (sig.Variadic() && param == sig.Params().Len()-1) {
+			g.log(file, e.stmt.node, "no tests generated: not a type switch on a parameter")
+			continue
+		}
+
+		for _, t := range e.stmt.generated {
+			tests = append(tests, caseTest{fn: fn, param: param, typ: t})
+		}
+	}
+
+	if len(tests) == 0 {
+		return nil
+	}
+
+	src, err := caseTestsSource(pkg.Pkg, tests)
+	if err != nil {
+		return err
+	}
+
+	src, err = g.Format.groupImports(src)
+	if err == nil {
+		src, err = g.Format.reprint(src)
+	}
+	if err != nil {
+		return err
+	}
+
+	g.tests.Lock()
+	defer g.tests.Unlock()
+
+	g.tests.files[TestFileName(g.tokenFile(file).Name())] = src
+
+	return nil
+}
+
+// caseTestsSource returns the source of the test file of the package pkg with tests.
+func caseTestsSource(pkg *types.Package, tests []caseTest) ([]byte, error) {
+	file := &ast.File{Name: ast.NewIdent(pkg.Name()), Scope: ast.NewScope(nil)}
+	imports := newFileImports(file, pkg, &types.Info{})
+	testingPkg := imports.qualifier(types.NewPackage("testing", "testing"))
+
+	var body bytes.Buffer
+	names := map[string]bool{}
+	for _, test := range tests {
+		sig := test.fn.Type().(*types.Signature)
+
+		name := "Test"
+		if recv := sig.Recv(); recv != nil {
+			name += camelSuffix(typeString(recv.Type(), imports.qualifier)) + "_"
+		}
+		name += strings.ToUpper(test.fn.Name()[:1]) + test.fn.Name()[1:] + "_" + camelSuffix(typeString(test.typ, imports.qualifier))
+
+		unique := name
+		for i := 2; names[unique]; i++ {
+			unique = name + strconv.Itoa(i)
+		}
+		names[unique] = true
+
+		fmt.Fprintf(&body, "\nfunc %s(t *%s.T) {\n", unique, testingPkg)
+
+		args := []string{}
+		for i := 0; i < sig.Params().Len(); i++ {
+			if sig.Variadic() && i == sig.Params().Len()-1 {
+				break
+			}
+
+			v := sig.Params().At(i)
+			argName := v.Name()
+			if argName == "" || argName == "_" || argName == "t" {
+				argName = "arg" + strconv.Itoa(i)
+			}
+
+			t := v.Type()
+			if i == test.param {
+				t = test.typ
+			}
+
+			fmt.Fprintf(&body, "var %s %s\n", argName, typeString(t, imports.qualifier))
+			args = append(args, argName)
+		}
+
+		call := test.fn.Name()
+		if recv := sig.Recv(); recv != nil {
+			t := recv.Type()
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			fmt.Fprintf(&body, "var recv %s\n", typeString(t, imports.qualifier))
+			call = "recv." + call
+		}
+
+		fmt.Fprintf(&body, "%s(%s)\n}\n", call, strings.Join(args, ", "))
+	}
+
+	paths := []string{}
+	for p := range imports.added {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by tsgen; DO NOT EDIT.\n")
+	buf.WriteString("// Each test calls a function with a zero value of a type expanded in its type switch.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\nimport (\n", pkg.Name())
+	for _, p := range paths {
+		name := imports.added[p]
+		if name == path.Base(p) {
+			name = ""
+		}
+		fmt.Fprintf(&buf, "%s %q\n", name, p)
+	}
+	buf.WriteString(")\n")
+	buf.Write(body.Bytes())
+
+	return format.Source(buf.Bytes())
+}
+
+// writeTests writes the test files generated in the run by g.FileWriter.
+func (g Gen) writeTests() error {
+	names := []string{}
+	for name := range g.tests.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		w := g.fileWriter(name)
+		if w == nil {
+			continue
+		}
+
+		_, err := w.Write(g.tests.files[name])
+		if err != nil {
+			return err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package gen
+
+import (
+	"testing"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaseTestsSource(t *testing.T) {
+	g := New()
+	err := g.Loader.CreateFromFilenames("", "testdata/layout.go")
+	require.NoError(t, err)
+
+	err = g.load()
+	require.NoError(t, err)
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+
+	tests := []caseTest{}
+	forTypeSwitchStmt(file, func(fd *ast.FuncDecl, sw *ast.TypeSwitchStmt) error {
+		stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+		_, ok, err := g.expandEdit(stmt, canonicalTypes(callArgTypes(&pkg.Info, file, "keys")))
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		for _, typ := range stmt.generated {
+			tests = append(tests, caseTest{fn: pkg.Defs[fd.Name].(*types.Func), param: 0, typ: typ})
+		}
+		return nil
+	})
+
+	// map[string]string has a hand-written case
+	require.Len(t, tests, 2)
+
+	src, err := caseTestsSource(pkg.Pkg, tests)
+	require.NoError(t, err)
+
+	result := string(src)
+	t.Log(result)
+
+	assert.Contains(t, result, "// Code generated by tsgen; DO NOT EDIT.")
+	assert.Contains(t, result, "import (\n\t\"testing\"\n)")
+	assert.Contains(t, result, "func TestKeys_MapStringBool(t *testing.T) {\n\tvar m map[string]bool\n\tkeys(m)\n}\n")
+	assert.Contains(t, result, "func TestKeys_MapStringInt(t *testing.T) {")
+
+	assert.Equal(t, "testdata/layout_tsgen_test.go", TestFileName("testdata/layout.go"))
+}
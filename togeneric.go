@@ -0,0 +1,304 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// ToGeneric rewrites the function of the type switch at the line of the file into a generic function (Go 1.18 or later)
+// whose type parameter is constrained by the union of the case types, e.g. func f[T int | string](v T),
+// in place of the parameter switched on. The type switch in it is on any(v), keeping the case clauses of the types,
+// so that each body has v of its type as before.
+//
+// If wrapper is set, the generic function is added as <name>Generic, and the original is kept as a deprecated wrapper
+// whose case clauses of the types call it, so that the callers passing other types keep working.
+// It requires FeatureGenerics.
+func (g Gen) ToGeneric(filename string, line int, wrapper bool) error {
+	err := g.requireFeature(FeatureGenerics, "to-generic")
+	if err != nil {
+		return err
+	}
+
+	err = g.initProgram(needTypes)
+	if err != nil {
+		return err
+	}
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtLine(filename, line)
+	if err != nil {
+		return err
+	}
+
+	src, err := g.fileSource(file)
+	if err != nil {
+		return err
+	}
+
+	gf, err := g.newGenericFunc(pkg, file, funcDecl, sw, wrapper)
+	if err != nil {
+		return err
+	}
+
+	edits := gf.edits(g, src)
+
+	return g.doFiles(func(_ *loader.PackageInfo, f *ast.File) error {
+		if f != file {
+			return nil
+		}
+
+		return g.editFileSource(file, edits)
+	})
+}
+
+// genericFunc is a function whose type switch is to be rewritten into a generic function.
+type genericFunc struct {
+	pkg      *loader.PackageInfo
+	file     *ast.File
+	funcDecl *ast.FuncDecl
+	sw       *ast.TypeSwitchStmt
+
+	// subject is the parameter switched on, and bound is the variable the type switch binds, or "" if none.
+	subject *ast.Ident
+	bound   string
+
+	// union are the case types constraining the type parameter, in the order of the clauses.
+	union []ast.Expr
+
+	// kept are the case clauses kept in the generic function, whose case types are all in union.
+	kept map[*ast.CaseClause]bool
+
+	// name is the name of the generic function, and typeParam is the name of its type parameter.
+	name      string
+	typeParam string
+
+	wrapper bool
+}
+
+// newGenericFunc checks that the function funcDecl of the type switch sw can be rewritten into a generic function,
+// and names it and its type parameter.
+func (g Gen) newGenericFunc(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt, wrapper bool) (*genericFunc, error) {
+	fail := func(format string, args ...interface{}) (*genericFunc, error) {
+		return nil, fmt.Errorf("%s: cannot generate generic function: %s", g.Loader.Fset.Position(sw.Pos()), fmt.Sprintf(format, args...))
+	}
+
+	if funcDecl.Recv != nil {
+		return fail("%s is a method, which cannot have type parameters", funcDecl.Name.Name)
+	}
+	if isGenericFunc(funcDecl) {
+		return fail("%s is generic already", funcDecl.Name.Name)
+	}
+	if !containsStmt(funcDecl.Body.List, sw) {
+		return fail("the type switch is not at the top level of %s", funcDecl.Name.Name)
+	}
+
+	x, bound := typeSwitchSubject(sw)
+	subject, ok := x.(*ast.Ident)
+	if !ok || !isParam(&pkg.Info, funcDecl, subject) {
+		return fail("the subject %s is not a parameter of %s", g.showNode(x), funcDecl.Name.Name)
+	}
+
+	for _, field := range funcDecl.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok && len(field.Names) > 0 && field.Names[0].Name == subject.Name {
+			return fail("the subject %s is variadic", subject.Name)
+		}
+		for _, name := range field.Names {
+			if wrapper && name.Name == "_" {
+				return fail("the parameters must be named to be passed from the wrapper")
+			}
+		}
+	}
+
+	gf := &genericFunc{
+		pkg:      pkg,
+		file:     file,
+		funcDecl: funcDecl,
+		sw:       sw,
+		subject:  subject,
+		bound:    bound,
+		kept:     map[*ast.CaseClause]bool{},
+		wrapper:  wrapper,
+	}
+
+	stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+	for _, st := range sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if g.isTemplateClause(stmt, clause) {
+			return fail("the type switch has templates; expand it first")
+		}
+
+		inUnion := len(clause.List) > 0
+		for _, e := range clause.List {
+			t := pkg.TypeOf(e)
+			if t == nil || types.IsInterface(t) {
+				// nil, and the interfaces, which a union cannot have
+				inUnion = false
+			}
+		}
+		if !inUnion {
+			continue
+		}
+
+		gf.kept[clause] = true
+		gf.union = append(gf.union, clause.List...)
+	}
+
+	if len(gf.union) == 0 {
+		return fail("the type switch has no case clauses of concrete types")
+	}
+
+	// the names used in the function, to be avoided by the type parameter
+	used := map[string]bool{}
+	ast.Inspect(funcDecl, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			used[ident.Name] = true
+		}
+		return true
+	})
+	gf.typeParam = "T"
+	for i := 2; used[gf.typeParam] || pkg.Pkg.Scope().Lookup(gf.typeParam) != nil; i++ {
+		gf.typeParam = "T" + strconv.Itoa(i)
+	}
+
+	gf.name = funcDecl.Name.Name
+	if wrapper {
+		gf.name = funcDecl.Name.Name + "Generic"
+		if pkg.Pkg.Scope().Lookup(gf.name) != nil {
+			return fail("%s is already declared", gf.name)
+		}
+	}
+
+	return gf, nil
+}
+
+// edits returns the edits to the file, whose source is src, which replace the function with the generic function,
+// or add it after the function rewritten into the wrapper.
+func (gf *genericFunc) edits(g Gen, src []byte) []sourceEdit {
+	tf := g.tokenFile(gf.file)
+	text := func(from, to token.Pos) string {
+		return string(src[tf.Offset(from):tf.Offset(to)])
+	}
+
+	var union []string
+	for _, e := range gf.union {
+		union = append(union, text(e.Pos(), e.End()))
+	}
+
+	// the parameters, one by one, with the type of the subject replaced by the type parameter
+	params := []string{}
+	args := []string{}
+	for _, field := range gf.funcDecl.Type.Params.List {
+		typ := text(field.Type.Pos(), field.Type.End())
+		if len(field.Names) == 0 {
+			params = append(params, typ)
+			continue
+		}
+
+		for _, name := range field.Names {
+			if name.Name == gf.subject.Name {
+				params = append(params, name.Name+" "+gf.typeParam)
+			} else {
+				params = append(params, name.Name+" "+typ)
+			}
+
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				args = append(args, name.Name+"...")
+			} else {
+				args = append(args, name.Name)
+			}
+		}
+	}
+
+	var results string
+	if gf.funcDecl.Type.Results != nil {
+		results = " " + text(gf.funcDecl.Type.Results.Pos(), gf.funcDecl.Type.Results.End())
+	}
+
+	// the body, switching on any(v) by the clauses kept
+	body := gf.funcDecl.Body
+	bodyEdits := []sourceEdit{}
+	offset := func(pos token.Pos) int { return tf.Offset(pos) - tf.Offset(body.Pos()) }
+
+	// the default clause is unreachable, but kept panicking if the function would end without returning
+	last := body.List[len(body.List)-1] == gf.sw && gf.funcDecl.Type.Results != nil
+
+	x, _ := typeSwitchSubject(gf.sw)
+	bodyEdits = append(bodyEdits, sourceEdit{start: offset(x.Pos()), end: offset(x.End()), text: []byte("any(" + gf.subject.Name + ")")})
+	prevEnd := gf.sw.Body.Lbrace + 1
+	for _, st := range gf.sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		start := prevEnd
+		prevEnd = clause.End()
+		if gf.kept[clause] {
+			continue
+		}
+
+		if clause.List == nil && last {
+			bodyEdits = append(bodyEdits, sourceEdit{start: offset(clause.Colon + 1), end: offset(clause.End()), text: []byte("\npanic(\"unreachable\")")})
+		} else {
+			// removed with the line break before it
+			bodyEdits = append(bodyEdits, sourceEdit{start: offset(start), end: offset(clause.End())})
+		}
+	}
+	newBody := applyEdits([]byte(text(body.Pos(), body.End())), bodyEdits)
+
+	var buf bytes.Buffer
+	if gf.wrapper {
+		fmt.Fprintf(&buf, "\n\n// %s is %s for the types of its cases, as a generic function.\n", gf.name, gf.funcDecl.Name.Name)
+	}
+	fmt.Fprintf(&buf, "func %s[%s %s](%s)%s %s", gf.name, gf.typeParam, strings.Join(union, " | "), strings.Join(params, ", "), results, newBody)
+
+	if !gf.wrapper {
+		return []sourceEdit{{start: tf.Offset(gf.funcDecl.Pos()), end: tf.Offset(gf.funcDecl.End()), text: buf.Bytes()}}
+	}
+
+	// the wrapper, whose clauses kept call the generic function
+	end := tf.Offset(gf.funcDecl.End())
+	edits := []sourceEdit{{start: end, end: end, text: buf.Bytes()}}
+
+	// appended to the doc comment, if any
+	deprecated := fmt.Sprintf("// Deprecated: Use %s instead.\n", gf.name)
+	if gf.funcDecl.Doc != nil {
+		deprecated = "//\n" + deprecated
+	}
+	edits = append(edits, sourceEdit{start: tf.Offset(gf.funcDecl.Pos()), end: tf.Offset(gf.funcDecl.Pos()), text: []byte(deprecated)})
+
+	for _, st := range gf.sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if !gf.kept[clause] || len(clause.List) != 1 {
+			// the variable of a clause of multiple types is of the interface
+			continue
+		}
+
+		// the subject passed is the variable of the case type, or asserted to it if the switch binds none
+		value := gf.bound
+		if value == "" {
+			value = gf.subject.Name + ".(" + text(clause.List[0].Pos(), clause.List[0].End()) + ")"
+		}
+
+		clauseArgs := make([]string, len(args))
+		for i, a := range args {
+			if a == gf.subject.Name {
+				a = value
+			}
+			clauseArgs[i] = a
+		}
+
+		clauseCall := gf.name + "(" + strings.Join(clauseArgs, ", ") + ")"
+		if results != "" {
+			clauseCall = "return " + clauseCall
+		} else {
+			clauseCall = clauseCall + "\nreturn"
+		}
+
+		edits = append(edits, sourceEdit{start: tf.Offset(clause.Colon + 1), end: tf.Offset(clause.End()), text: []byte("\n" + clauseCall)})
+	}
+
+	return edits
+}
@@ -0,0 +1,129 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+)
+
+// checkTypeVariables checks the uses of the type variables in the template clauses of stmt.
+// A body referring to a type variable which the pattern of its clause does not bind fails,
+// as the generated clauses would still refer to the type variable. A type variable of a pattern
+// used neither in the body nor through the variable bound by the switch is warned of,
+// as the clauses generated for the types would be all alike.
+func (g Gen) checkTypeVariables(stmt *TypeSwitchStmt) error {
+	for _, st := range stmt.node.Body.List {
+		clause := st.(*ast.CaseClause)
+		if !g.isTemplateClause(stmt, clause) {
+			continue
+		}
+
+		used := g.bodyTypeVariables(stmt, clause)
+
+		// the type variables bound by the patterns of nested type switches, expanded with them
+		nested := []string{}
+		for _, s := range clause.Body {
+			ast.Inspect(s, func(node ast.Node) bool {
+				if sw, ok := node.(*ast.TypeSwitchStmt); ok {
+					for _, st := range sw.Body.List {
+						for _, e := range st.(*ast.CaseClause).List {
+							nested = append(nested, g.exprTypeVariables(stmt, e)...)
+						}
+					}
+				}
+				return true
+			})
+		}
+
+		for _, e := range clause.List {
+			vars := g.exprTypeVariables(stmt, e)
+			if len(vars) == 0 {
+				continue
+			}
+
+			for _, name := range used {
+				if !containsString(vars, name) && !containsString(nested, name) {
+					return Diagnostic{
+						Pos: g.Loader.Fset.Position(clause.Pos()),
+						Msg: fmt.Sprintf("template case %s refers to type variable %s, which its pattern does not bind", types.ExprString(e), name),
+					}
+				}
+			}
+
+			if g.usesBoundVariable(stmt, clause) {
+				continue
+			}
+
+			unused := []string{}
+			for _, name := range vars {
+				if !containsString(used, name) && !containsString(unused, name) {
+					unused = append(unused, name)
+				}
+			}
+			if len(unused) > 0 {
+				g.warn(stmt.file, clause, "type variable %s of template case %s is not used in its body, so the generated cases are all alike", strings.Join(unused, ", "), types.ExprString(e))
+			}
+		}
+	}
+
+	return nil
+}
+
+// bodyTypeVariables returns the names of the type variables the body of clause of stmt refers to.
+func (g Gen) bodyTypeVariables(stmt *TypeSwitchStmt, clause *ast.CaseClause) []string {
+	names := []string{}
+	for _, s := range clause.Body {
+		ast.Inspect(s, func(node ast.Node) bool {
+			ident, ok := node.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			tn, ok := stmt.info.Uses[ident].(*types.TypeName)
+			if !ok {
+				return true
+			}
+
+			if named, ok := tn.Type().(*types.Named); ok && g.isTypeVariable(named) && !containsString(names, ident.Name) {
+				names = append(names, ident.Name)
+			}
+
+			return true
+		})
+	}
+
+	return names
+}
+
+// usesBoundVariable reports whether the body of clause of stmt refers to the variable bound by the switch.
+func (g Gen) usesBoundVariable(stmt *TypeSwitchStmt, clause *ast.CaseClause) bool {
+	obj := stmt.info.Implicits[clause]
+	if obj == nil {
+		return false
+	}
+
+	found := false
+	for _, s := range clause.Body {
+		ast.Inspect(s, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok && stmt.info.Uses[ident] == obj {
+				found = true
+			}
+			return !found
+		})
+	}
+
+	return found
+}
+
+// containsString reports whether list has s.
+func containsString(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go/token"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand_TypeVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheCallSites(t, dir, "testdata/typevars.go", "kind", [][]types.Type{{types.NewSlice(types.Typ[types.Int])}})
+
+	var log bytes.Buffer
+	g := New()
+	g.CacheDir = dir
+	g.Logger = NewTextLogger(&log, false)
+	err = g.Loader.CreateFromFilenames("", "testdata/typevars.go")
+	require.NoError(t, err)
+
+	_, err = g.ExpandBytes()
+	require.Error(t, err)
+	t.Log(err)
+
+	diags, ok := err.(DiagnosticList)
+	require.True(t, ok)
+	require.Len(t, diags, 1)
+	assert.Equal(t, 24, diags[0].Pos.Line)
+	assert.Equal(t, "template case []T refers to type variable K, which its pattern does not bind", diags[0].Msg)
+
+	t.Log(log.String())
+	assert.Contains(t, log.String(), "type variable T of template case []T is not used in its body, so the generated cases are all alike")
+	assert.Contains(t, log.String(), "type variable K, T of template case map[K]T is not used in its body")
+}
+
+func TestExpand_BoundedTypeVariables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsgen-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	duration := types.NewNamed(types.NewTypeName(token.NoPos, types.NewPackage("time", "time"), "Duration", nil), types.Typ[types.Int64], nil)
+	cacheCallSites(t, dir, "testdata/bounds.go", "describe", [][]types.Type{
+		{duration},
+		{types.NewSlice(duration)},
+		{types.NewSlice(types.Typ[types.Int])},
+	})
+
+	var log bytes.Buffer
+	g := New()
+	g.CacheDir = dir
+	g.Logger = NewTextLogger(&log, false)
+	err = g.Loader.CreateFromFilenames("", "testdata/bounds.go")
+	require.NoError(t, err)
+
+	sources, err := g.ExpandBytes()
+	require.NoError(t, err)
+
+	out := string(sources["testdata/bounds.go"])
+	t.Log(out)
+
+	// I is not marked as a type variable, so case I: is hand-written
+	assert.Contains(t, out, "\tcase I:\n\t\treturn x.String()\n")
+	assert.NotContains(t, out, "case time.Duration:")
+
+	assert.Contains(t, out, "case []time.Duration:")
+	assert.NotContains(t, out, "case []int:")
+
+	t.Log(log.String())
+	assert.Contains(t, log.String(), "[]int is skipped: int does not satisfy the bound")
+}
@@ -0,0 +1,177 @@
+package gen
+
+import (
+	"fmt"
+
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// invalidCase is a generated case clause which does not compile.
+type invalidCase struct {
+	expansion *expansion
+	typ       types.Type
+	err       types.Error
+}
+
+// invalidCases type-checks the package pkg with edits applied to file,
+// and returns the generated case clauses of expansions in which type errors are found.
+// The errors outside the generated clauses are ignored.
+func (g Gen) invalidCases(pkg *loader.PackageInfo, file *ast.File, edits []sourceEdit, expansions []*expansion) ([]invalidCase, error) {
+	src, err := g.fileSource(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// the imports for the generated cases are added on writing
+	var fix func(*token.FileSet, *ast.File)
+	if imports := expansions[0].stmt.imports; imports != nil {
+		fix = imports.fix
+	}
+
+	newFile, info, typeErrors, err := g.typeCheckSource(pkg, file, applyEdits(src, edits), fix)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := g.fileNames[file]
+
+	invalid := []invalidCase{}
+	found := map[*expansion]map[types.Type]bool{}
+
+	for _, terr := range typeErrors {
+		if terr.Fset.Position(terr.Pos).Filename != filename {
+			continue
+		}
+
+		for _, e := range expansions {
+			if !e.edited {
+				continue
+			}
+
+			funcDecl := newFile.Decls[e.declIndex].(*ast.FuncDecl)
+			body := funcDecl.Body
+			if e.lit != 0 {
+				body = funcLits(funcDecl)[e.lit-1].Body
+			}
+			sw := body.List[e.stmtIndex].(*ast.TypeSwitchStmt)
+			stmt := &TypeSwitchStmt{file: newFile, node: sw, info: info}
+
+			for _, st := range sw.Body.List {
+				clause := st.(*ast.CaseClause)
+				if len(clause.List) == 0 || terr.Pos < clause.Pos() || clause.End() <= terr.Pos || !g.isGeneratedClause(stmt, clause) {
+					continue
+				}
+
+				// A merged clause (see Gen.MergeCases) is invalid for all of its types
+				for _, expr := range clause.List {
+					t := g.expandedType(e, file, info.TypeOf(expr), types.ExprString(expr))
+					if t == nil || found[e][t] {
+						continue
+					}
+
+					if found[e] == nil {
+						found[e] = map[types.Type]bool{}
+					}
+					found[e][t] = true
+
+					invalid = append(invalid, invalidCase{expansion: e, typ: t, err: terr})
+				}
+			}
+		}
+	}
+
+	if len(invalid) == 0 && len(typeErrors) > 0 {
+		g.log(file, file, "type errors outside generated cases: %v", typeErrors[0])
+	}
+
+	return invalid, nil
+}
+
+// typeCheckSource type-checks the package pkg with the source of file replaced by src, which is fixed by fix if not nil
+// after parsed, and returns the file parsed from src, the type information of the package and the type errors in it.
+func (g Gen) typeCheckSource(pkg *loader.PackageInfo, file *ast.File, src []byte, fix func(*token.FileSet, *ast.File)) (*ast.File, types.Info, []types.Error, error) {
+	conf := loader.Config{
+		Fset:          token.NewFileSet(),
+		ParserMode:    parser.ParseComments,
+		SourceImports: g.Loader.SourceImports,
+		Build:         g.Loader.Build,
+		AllowErrors:   true,
+	}
+
+	path := pkg.Pkg.Path()
+	conf.TypeCheckFuncBodies = func(p string) bool { return p == path }
+
+	typeErrors := []types.Error{}
+	conf.TypeChecker.Error = func(err error) {
+		if terr, ok := err.(types.Error); ok {
+			typeErrors = append(typeErrors, terr)
+		}
+	}
+
+	var newFile *ast.File
+	files := []*ast.File{}
+	for _, f := range pkg.Files {
+		fsrc := src
+		if f != file {
+			var err error
+			fsrc, err = g.readSource(g.fileNames[f])
+			if err != nil {
+				return nil, types.Info{}, nil, err
+			}
+		}
+
+		parsed, err := conf.ParseFile(g.fileNames[f], fsrc)
+		if err != nil {
+			return nil, types.Info{}, nil, err
+		}
+		if f == file {
+			if fix != nil {
+				fix(conf.Fset, parsed)
+			}
+			newFile = parsed
+		}
+
+		files = append(files, parsed)
+	}
+
+	conf.CreateFromFiles(path, files...)
+
+	prog, err := conf.Load()
+	if err != nil {
+		return nil, types.Info{}, nil, err
+	}
+
+	return newFile, prog.Created[0].Info, typeErrors, nil
+}
+
+// expandedType returns the type in e.inTypes for which a case clause of the type t, written as expr, is generated.
+// t is of the program type-checked for validation, so it is compared by its string representation.
+func (g Gen) expandedType(e *expansion, file *ast.File, t types.Type, expr string) types.Type {
+	for _, in := range e.inTypes {
+		if t != nil && types.TypeString(t, nil) == types.TypeString(in, nil) {
+			return in
+		}
+		if g.relativeTypeString(in, file) == expr {
+			return in
+		}
+	}
+
+	return nil
+}
+
+func (g Gen) invalidCasesError(invalid []invalidCase) error {
+	diags := make(DiagnosticList, len(invalid))
+	for i, c := range invalid {
+		diags[i] = Diagnostic{
+			Pos:  g.Loader.Fset.Position(c.expansion.stmt.node.Pos()),
+			Msg:  fmt.Sprintf("generated case %s does not compile: %s", c.typ, c.err),
+			Rule: RuleInvalidCase,
+		}
+	}
+
+	return diags
+}
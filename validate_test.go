@@ -0,0 +1,58 @@
+package gen
+
+import (
+	"testing"
+
+	"go/ast"
+	"golang.org/x/tools/go/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidCases(t *testing.T) {
+	g := New()
+	g.Validate = true
+	err := g.Loader.CreateFromFilenames("", "testdata/validate.go")
+	require.NoError(t, err)
+
+	require.NoError(t, g.load())
+
+	pkg := g.program.Created[0]
+	file := pkg.Files[0]
+	g.fileNames = map[*ast.File]string{file: "testdata/validate.go"}
+
+	var stringer types.Type
+	for ident, obj := range pkg.Uses {
+		if ident.Name == "Stringer" {
+			stringer = obj.Type()
+		}
+	}
+	require.NotNil(t, stringer)
+
+	var e *expansion
+	for i, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "first" {
+			e = &expansion{
+				stmt:      &TypeSwitchStmt{file: file, node: funcDecl.Body.List[0].(*ast.TypeSwitchStmt), info: pkg.Info},
+				funcDecl:  funcDecl,
+				inTypes:   []types.Type{types.NewSlice(stringer), types.NewSlice(types.Typ[types.Int])},
+				declIndex: i,
+			}
+		}
+	}
+	require.NotNil(t, e)
+
+	edit, ok, err := g.expandEdit(e.stmt, e.inTypes)
+	require.NoError(t, err)
+	require.True(t, ok)
+	e.edited = true
+
+	invalid, err := g.invalidCases(pkg, file, []sourceEdit{edit}, []*expansion{e})
+	require.NoError(t, err)
+	require.Len(t, invalid, 1)
+	assert.Equal(t, "[]int", invalid[0].typ.String())
+
+	e.remove(invalid[0].typ)
+	assert.Len(t, e.inTypes, 1)
+}
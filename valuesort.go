@@ -0,0 +1,153 @@
+package gen
+
+import (
+	"sort"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/exact"
+	"golang.org/x/tools/go/types"
+)
+
+// isSortableValueSwitch reports whether the case clauses of the value switch stmt can be reordered
+// without changing its behavior: it must have a tag, every case expression must be a constant,
+// which cannot be duplicated nor have side effects, and no clause may fall through.
+func isSortableValueSwitch(stmt *ast.SwitchStmt, info *types.Info) bool {
+	if stmt.Tag == nil || len(stmt.Body.List) < 2 {
+		return false
+	}
+
+	for _, st := range stmt.Body.List {
+		cc, ok := st.(*ast.CaseClause)
+		if !ok {
+			return false
+		}
+
+		for _, e := range cc.List {
+			if info.Types[e].Value == nil {
+				return false
+			}
+		}
+
+		if n := len(cc.Body); n > 0 {
+			if br, ok := cc.Body[n-1].(*ast.BranchStmt); ok && br.Tok == token.FALLTHROUGH {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Built-in sort strategies of value switches, for Gen.ValueSorter.
+// Each sorts case clauses by their first expressions, and the ties by the text of them.
+var (
+	// ByConstantValue sorts case clauses by the values of their constants, e.g. numerically for numbers,
+	// lexically for strings and false before true. The values of different kinds are sorted by their kinds.
+	ByConstantValue CaseSorter = CaseLess(func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool {
+		va, vb := info.Types[a.List[0]].Value, info.Types[b.List[0]].Value
+		if va != nil && vb != nil {
+			if ka, kb := constantKind(va), constantKind(vb); ka != kb {
+				return ka < kb
+			}
+			if !exact.Compare(va, token.EQL, vb) {
+				switch va.Kind() {
+				case exact.Bool:
+					return !exact.BoolVal(va)
+				case exact.Int, exact.Float, exact.String:
+					return exact.Compare(va, token.LSS, vb)
+				}
+			}
+		}
+
+		return g.showNode(a.List[0]) < g.showNode(b.List[0])
+	})
+
+	// ByCaseExpression sorts case clauses alphabetically by their expressions as written.
+	ByCaseExpression CaseSorter = CaseLess(func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool {
+		return g.showNode(a.List[0]) < g.showNode(b.List[0])
+	})
+
+	// ByConstantDeclaration sorts case clauses by the source positions where their constants are declared,
+	// e.g. in the order of an enumeration by iota. Literals are sorted last by their text.
+	ByConstantDeclaration CaseSorter = CaseLess(func(g *Gen, info *types.Info, a, b *ast.CaseClause) bool {
+		pa, pb := constantDeclPos(a.List[0], info), constantDeclPos(b.List[0], info)
+		if pa != pb {
+			if pa == token.NoPos {
+				return false
+			}
+			if pb == token.NoPos {
+				return true
+			}
+			return pa < pb
+		}
+
+		return g.showNode(a.List[0]) < g.showNode(b.List[0])
+	})
+)
+
+// constantKind returns the kind of v for sorting, where integers and floats are the same kind
+// so that they are compared by their values.
+func constantKind(v exact.Value) exact.Kind {
+	if v.Kind() == exact.Int {
+		return exact.Float
+	}
+
+	return v.Kind()
+}
+
+// constantDeclPos returns the position where the constant referred by e, e.g. Red or color.Red, is declared,
+// or token.NoPos if e is not a named constant.
+func constantDeclPos(e ast.Expr, info *types.Info) token.Pos {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = p.X
+	}
+
+	var ident *ast.Ident
+	switch e := e.(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return token.NoPos
+	}
+
+	if c, ok := info.Uses[ident].(*types.Const); ok {
+		return c.Pos()
+	}
+
+	return token.NoPos
+}
+
+// valueSorters holds the named sort strategies of value switches, which can be looked up by LookupValueSorter.
+var valueSorters = map[string]CaseSorter{
+	"value":       ByConstantValue,
+	"name":        ByCaseExpression,
+	"declaration": ByConstantDeclaration,
+}
+
+// RegisterValueSorter registers a sort strategy of value switches by name.
+// It overrides the existing strategy of the same name if any.
+func RegisterValueSorter(name string, s CaseSorter) {
+	valueSorters[name] = s
+}
+
+// LookupValueSorter returns the sort strategy of value switches registered by name, or nil if not found.
+func LookupValueSorter(name string) CaseSorter {
+	return valueSorters[name]
+}
+
+// ValueSorterNames returns the names of registered sort strategies of value switches in alphabetical order.
+func ValueSorterNames() []string {
+	names := make([]string, 0, len(valueSorters))
+	for name := range valueSorters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,418 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types"
+)
+
+// GenerateVisitor rewrites the type switch at the line of the file, which must be on a parameter of
+// a named interface type, e.g. Node, into the visitor pattern:
+//
+//   - NodeVisitor, an interface with a method for each case clause, e.g. VisitBinary(n *Binary),
+//     and VisitDefault for the default clause and the statements following the switch, if any,
+//   - AcceptNode, a function calling the method of a NodeVisitor for the dynamic type of a Node,
+//   - a struct type implementing NodeVisitor by the bodies of the case clauses, named after the enclosing function,
+//     e.g. evalVisitor, holding the other parameters of the function,
+//
+// and the enclosing function calls AcceptNode with it. The function must consist of the type switch
+// optionally followed by statements, and the switch must have no templates. The file is written by g.FileWriter.
+func (g Gen) GenerateVisitor(filename string, line int) error {
+	err := g.initProgram(needTypes)
+	if err != nil {
+		return err
+	}
+
+	pkg, file, funcDecl, sw, err := g.typeSwitchAtLine(filename, line)
+	if err != nil {
+		return err
+	}
+
+	src, err := g.fileSource(file)
+	if err != nil {
+		return err
+	}
+
+	v, err := g.newVisitor(pkg, file, funcDecl, sw)
+	if err != nil {
+		return err
+	}
+
+	edits := v.edits(g, src)
+
+	return g.doFiles(func(_ *loader.PackageInfo, f *ast.File) error {
+		if f != file {
+			return nil
+		}
+
+		return g.editFileSource(file, edits)
+	})
+}
+
+// visitor is a type switch to be rewritten into the visitor pattern.
+type visitor struct {
+	pkg      *loader.PackageInfo
+	file     *ast.File
+	funcDecl *ast.FuncDecl
+	sw       *ast.TypeSwitchStmt
+
+	// subject is the parameter switched on, and bound is the name of the variable of the case types,
+	// which is the name of the parameter if the switch binds none.
+	subject *ast.Ident
+	bound   string
+
+	// iface is the name of the interface type of subject.
+	iface string
+
+	// names of the generated declarations
+	visitorName, acceptName, implName string
+
+	// methods are the names of the visitor methods for the case clauses,
+	// and defaultMethod is the one for the default clause and the statements following the switch.
+	methods       map[*ast.CaseClause]string
+	defaultMethod string
+}
+
+// newVisitor checks that the type switch sw in funcDecl can be rewritten into the visitor pattern,
+// and names the declarations to be generated.
+func (g Gen) newVisitor(pkg *loader.PackageInfo, file *ast.File, funcDecl *ast.FuncDecl, sw *ast.TypeSwitchStmt) (*visitor, error) {
+	fail := func(format string, args ...interface{}) (*visitor, error) {
+		return nil, fmt.Errorf("%s: cannot generate visitor: %s", g.Loader.Fset.Position(sw.Pos()), fmt.Sprintf(format, args...))
+	}
+
+	if funcDecl.Body.List[0] != ast.Stmt(sw) {
+		return fail("the type switch must be the first statement of %s", funcDecl.Name.Name)
+	}
+	if sw.Init != nil {
+		return fail("the type switch has an init statement")
+	}
+
+	x, bound := typeSwitchSubject(sw)
+	subject, ok := x.(*ast.Ident)
+	if !ok {
+		return fail("the subject is not a parameter")
+	}
+	obj := pkg.Info.Uses[subject]
+	if obj == nil || obj.Parent() != pkg.Info.Scopes[funcDecl.Type] || namedParamPos(subject.Name, funcDecl.Type.Params) == -1 {
+		return fail("the subject %s is not a parameter of %s", subject.Name, funcDecl.Name.Name)
+	}
+
+	named, ok := obj.Type().(*types.Named)
+	if !ok || !types.IsInterface(named) {
+		return fail("the subject %s is not of a named interface type", subject.Name)
+	}
+
+	if bound == "" {
+		bound = subject.Name
+	}
+
+	v := &visitor{
+		pkg:      pkg,
+		file:     file,
+		funcDecl: funcDecl,
+		sw:       sw,
+		subject:  subject,
+		bound:    bound,
+		iface:    named.Obj().Name(),
+		methods:  map[*ast.CaseClause]string{},
+	}
+
+	stmt := &TypeSwitchStmt{file: file, node: sw, info: pkg.Info}
+	taken := map[string]bool{}
+	for _, st := range sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if g.isTemplateClause(stmt, clause) {
+			return fail("the type switch has templates; expand it first")
+		}
+		if breaksSwitch(clause.Body) {
+			return fail("a case clause breaks out of the type switch")
+		}
+
+		if clause.List == nil {
+			continue
+		}
+
+		names := []string{}
+		for _, e := range clause.List {
+			if ident, ok := e.(*ast.Ident); ok && ident.Name == "nil" {
+				names = append(names, "Nil")
+			} else {
+				names = append(names, camelSuffix(types.ExprString(e)))
+			}
+		}
+
+		name := "Visit" + strings.Join(names, "Or")
+		for i := 2; taken[name]; i++ {
+			name = "Visit" + strings.Join(names, "Or") + strconv.Itoa(i)
+		}
+		taken[name] = true
+		v.methods[clause] = name
+	}
+
+	if v.tail() != nil || v.defaultClause() != nil {
+		v.defaultMethod = "VisitDefault"
+		for i := 2; taken[v.defaultMethod]; i++ {
+			v.defaultMethod = "VisitDefault" + strconv.Itoa(i)
+		}
+	}
+
+	exported := func(name string) string {
+		if ast.IsExported(v.iface) {
+			return name
+		}
+		return strings.ToLower(name[:1]) + name[1:]
+	}
+
+	v.visitorName = v.iface + "Visitor"
+	v.acceptName = exported("Accept" + strings.ToUpper(v.iface[:1]) + v.iface[1:])
+	v.implName = funcDecl.Name.Name + "Visitor"
+	if funcDecl.Recv != nil {
+		v.implName = funcDecl.Name.Name + "MethodVisitor"
+	}
+
+	for _, name := range []string{v.visitorName, v.acceptName, v.implName} {
+		if pkg.Pkg != nil && pkg.Pkg.Scope().Lookup(name) != nil {
+			return fail("%s is already declared", name)
+		}
+	}
+
+	return v, nil
+}
+
+// tail returns the statements following the type switch.
+func (v *visitor) tail() []ast.Stmt {
+	if len(v.funcDecl.Body.List) == 1 {
+		return nil
+	}
+
+	return v.funcDecl.Body.List[1:]
+}
+
+// defaultClause returns the default clause of the type switch, or nil if none.
+func (v *visitor) defaultClause() *ast.CaseClause {
+	for _, st := range v.sw.Body.List {
+		if clause := st.(*ast.CaseClause); clause.List == nil {
+			return clause
+		}
+	}
+
+	return nil
+}
+
+// fields returns the receiver and the parameters of the function other than the subject,
+// which are held by the visitor implementation.
+func (v *visitor) fields() []*ast.Ident {
+	names := []*ast.Ident{}
+
+	lists := []*ast.FieldList{v.funcDecl.Type.Params}
+	if v.funcDecl.Recv != nil {
+		lists = []*ast.FieldList{v.funcDecl.Recv, v.funcDecl.Type.Params}
+	}
+
+	for _, list := range lists {
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				if name.Name != "_" && name.Name != v.subject.Name {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// edits returns the edits to the file, whose source is src, which rewrite the function into a call of
+// the accept function and add the generated declarations after it.
+func (v *visitor) edits(g Gen, src []byte) []sourceEdit {
+	tf := g.tokenFile(v.file)
+	text := func(from, to token.Pos) string {
+		return string(src[tf.Offset(from):tf.Offset(to)])
+	}
+
+	fieldType := map[*ast.Ident]string{}
+	for _, list := range []*ast.FieldList{v.funcDecl.Recv, v.funcDecl.Type.Params} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				fieldType[name] = text(field.Type.Pos(), field.Type.End())
+			}
+		}
+	}
+	var ifaceType string
+	for _, field := range v.funcDecl.Type.Params.List {
+		for _, name := range field.Names {
+			if name.Name == v.subject.Name {
+				ifaceType = fieldType[name]
+			}
+		}
+	}
+
+	var results string
+	if v.funcDecl.Type.Results != nil {
+		results = text(v.funcDecl.Type.Results.Pos(), v.funcDecl.Type.Results.End())
+	}
+	returns := results != ""
+
+	call := func(format string, args ...interface{}) string {
+		if returns {
+			return "return " + fmt.Sprintf(format, args...)
+		}
+		return fmt.Sprintf(format, args...)
+	}
+
+	// the names used in the function, to be avoided by the receivers of the methods
+	used := map[string]bool{}
+	ast.Inspect(v.funcDecl, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			used[ident.Name] = true
+		}
+		return true
+	})
+	recv := "vis"
+	for used[recv] {
+		recv = recv + "_"
+	}
+	visitorArg := "v"
+	for visitorArg == v.bound {
+		visitorArg = visitorArg + "_"
+	}
+
+	var tail string
+	if stmts := v.tail(); stmts != nil {
+		tail = strings.TrimSpace(text(v.sw.End(), v.funcDecl.Body.Rbrace))
+	}
+
+	// body returns the body of a method with the statements stmts, whose source is body,
+	// followed by the statements following the switch unless it terminates.
+	body := func(stmts []ast.Stmt, body string) string {
+		lines := []string{}
+		for _, name := range v.fields() {
+			obj := v.pkg.Info.Defs[name]
+			if refersToObject(v.pkg, stmts, obj) || !terminates(stmts) && refersToObject(v.pkg, v.tail(), obj) {
+				lines = append(lines, fmt.Sprintf("%s := %s.%s", name.Name, recv, name.Name))
+			}
+		}
+
+		subject := v.pkg.Info.Uses[v.subject]
+		if v.bound != v.subject.Name && (refersToObject(v.pkg, stmts, subject) || !terminates(stmts) && refersToObject(v.pkg, v.tail(), subject)) {
+			lines = append(lines, fmt.Sprintf("var %s %s = %s", v.subject.Name, ifaceType, v.bound))
+		}
+
+		if s := strings.TrimSpace(body); s != "" {
+			lines = append(lines, s)
+		}
+		if tail != "" && !terminates(stmts) {
+			lines = append(lines, tail)
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	var buf bytes.Buffer
+
+	// the visitor interface
+	fmt.Fprintf(&buf, "\n\n// %s has a method for each of the types of %s handled by %s.\n", v.visitorName, v.iface, v.funcDecl.Name.Name)
+	fmt.Fprintf(&buf, "type %s interface {\n", v.visitorName)
+	for _, st := range v.sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if name, ok := v.methods[clause]; ok {
+			fmt.Fprintf(&buf, "%s(%s %s) %s\n", name, v.bound, v.caseType(clause, ifaceType), results)
+		}
+	}
+	if v.defaultMethod != "" {
+		fmt.Fprintf(&buf, "%s(%s %s) %s\n", v.defaultMethod, v.bound, ifaceType, results)
+	}
+	buf.WriteString("}\n\n")
+
+	// the accept function
+	fmt.Fprintf(&buf, "// %s calls the method of %s for the dynamic type of %s.\n", v.acceptName, visitorArg, v.bound)
+	fmt.Fprintf(&buf, "func %s(%s %s, %s %s) %s {\n", v.acceptName, v.bound, ifaceType, visitorArg, v.visitorName, results)
+	fmt.Fprintf(&buf, "switch %s := %s.(type) {\n", v.bound, v.bound)
+	for _, st := range v.sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if name, ok := v.methods[clause]; ok {
+			fmt.Fprintf(&buf, "case %s:\n%s\n", v.caseList(clause, text), call("%s.%s(%s)", visitorArg, name, v.bound))
+		}
+	}
+	if v.defaultMethod != "" {
+		fmt.Fprintf(&buf, "default:\n%s\n", call("%s.%s(%s)", visitorArg, v.defaultMethod, v.bound))
+	}
+	buf.WriteString("}\n}\n\n")
+
+	// the visitor implementation
+	fmt.Fprintf(&buf, "// %s is the %s with the case clauses of the type switch of %s.\n", v.implName, v.visitorName, v.funcDecl.Name.Name)
+	fmt.Fprintf(&buf, "type %s struct {\n", v.implName)
+	for _, name := range v.fields() {
+		fmt.Fprintf(&buf, "%s %s\n", name.Name, fieldType[name])
+	}
+	buf.WriteString("}\n")
+
+	for _, st := range v.sw.Body.List {
+		clause := st.(*ast.CaseClause)
+		if name, ok := v.methods[clause]; ok {
+			fmt.Fprintf(&buf, "\nfunc (%s %s) %s(%s %s) %s {\n%s\n}\n", recv, v.implName, name, v.bound, v.caseType(clause, ifaceType), results, body(clause.Body, text(clause.Colon+1, clause.End())))
+		}
+	}
+	if v.defaultMethod != "" {
+		var stmts []ast.Stmt
+		var src string
+		if clause := v.defaultClause(); clause != nil {
+			stmts, src = clause.Body, text(clause.Colon+1, clause.End())
+		}
+		fmt.Fprintf(&buf, "\nfunc (%s %s) %s(%s %s) %s {\n%s\n}\n", recv, v.implName, v.defaultMethod, v.bound, ifaceType, results, body(stmts, src))
+	}
+
+	// the function rewritten to accept the visitor
+	fields := []string{}
+	for _, name := range v.fields() {
+		fields = append(fields, fmt.Sprintf("%s: %s", name.Name, name.Name))
+	}
+	newBody := fmt.Sprintf("{\n%s\n}", call("%s(%s, %s{%s})", v.acceptName, v.subject.Name, v.implName, strings.Join(fields, ", ")))
+
+	end := tf.Offset(v.funcDecl.End())
+	return []sourceEdit{
+		{start: tf.Offset(v.funcDecl.Body.Lbrace), end: end, text: []byte(newBody)},
+		{start: end, end: end, text: bytes.TrimRight(buf.Bytes(), "\n")},
+	}
+}
+
+// caseType returns the type of the variable bound in clause: the case type if it is the only one,
+// or the interface type ifaceType otherwise.
+func (v *visitor) caseType(clause *ast.CaseClause, ifaceType string) string {
+	if len(clause.List) == 1 {
+		if ident, ok := clause.List[0].(*ast.Ident); !ok || ident.Name != "nil" {
+			return types.ExprString(clause.List[0])
+		}
+	}
+
+	return ifaceType
+}
+
+// caseList returns the source of the case types of clause.
+func (v *visitor) caseList(clause *ast.CaseClause, text func(from, to token.Pos) string) string {
+	return text(clause.List[0].Pos(), clause.List[len(clause.List)-1].End())
+}
+
+// refersToObject reports whether any of stmts refers to obj.
+func refersToObject(pkg *loader.PackageInfo, stmts []ast.Stmt, obj types.Object) bool {
+	found := false
+	for _, st := range stmts {
+		ast.Inspect(st, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok && pkg.Info.Uses[ident] == obj {
+				found = true
+			}
+			return !found
+		})
+	}
+
+	return found
+}